@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/state"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type applyFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Spec
+	File   string
+	DryRun bool
+
+	// Errors
+	ContinueOnError bool
+
+	// Confirmation
+	AutoApprove bool
+	Yes         bool
+
+	// Safety
+	Force bool
+
+	// Output
+	Output string
+}
+
+// applyResult is the machine readable outcome printed by apply when using
+// --output json. Applied is only set once the plan has been applied.
+type applyResult struct {
+	Plan     state.Plan          `json:"plan"`
+	Applied  *state.Plan         `json:"applied,omitempty"`
+	Tokens   map[string][]string `json:"tokens,omitempty"`
+	Failures []applyFailure      `json:"failures,omitempty"`
+}
+
+// applyFailure is a cluster failing to be reconciled as printed by apply when
+// using --output json.
+type applyFailure struct {
+	ClusterID string `json:"cluster_id"`
+	Error     string `json:"error"`
+}
+
+var (
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Reconcile Vault PKI backends with a declarative spec file.",
+		Long: `Reconcile Vault PKI backends with a declarative spec file. Missing mounts,
+root CAs, roles and policies are created. Roles and policies not matching the
+spec are updated. Tokens are only generated for newly set up clusters. Resources
+are never deleted. The planned changes are shown and must be confirmed before
+they are applied, unless --auto-approve is given. The spec is written in HCL,
+JSON or YAML, in case the file ends in .yaml or .yml, e.g.
+
+    cluster "foo" {
+      common_name = "foo.example.com"
+
+      role {
+        allowed_domains = ["foo.example.com"]
+      }
+
+      tokens {
+        num = 1
+      }
+    }`,
+		RunE: applyRun,
+	}
+
+	newApplyFlags = &applyFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(applyCmd)
+	configValidators["apply"] = func() []error { return applyValidate(newApplyFlags) }
+
+	newApplyFlags.Vault.register(applyCmd.Flags())
+
+	applyCmd.Flags().StringVarP(&newApplyFlags.File, "file", "f", "", "Spec file describing the desired state of the clusters.")
+	applyCmd.Flags().BoolVar(&newApplyFlags.DryRun, "dry-run", false, "Only show the changes without applying them. (Default false)")
+	applyCmd.Flags().BoolVar(&newApplyFlags.ContinueOnError, "continue-on-error", false, "Continue with the remaining clusters in case a cluster fails to be reconciled. Failures are summarized at the end. (Default false)")
+
+	applyCmd.Flags().BoolVar(&newApplyFlags.AutoApprove, "auto-approve", false, "Apply the planned changes without asking for confirmation. (Default false)")
+	applyCmd.Flags().BoolVar(&newApplyFlags.Yes, "yes", false, "Proceed despite warnings about contradicting domain options of the spec using --auto-approve. (Default false)")
+
+	applyCmd.Flags().BoolVar(&newApplyFlags.Force, "force", false, "Change Vault even in case a maintenance operation, e.g. a rekey or a seal migration, is in progress. (Default false)")
+
+	applyCmd.Flags().StringVar(&newApplyFlags.Output, "output", "text", "Output format of the plan and its outcome. One of text or json.")
+}
+
+func applyValidate(newApplyFlags *applyFlags) []error {
+	var errs []error
+
+	errs = append(errs, newApplyFlags.Vault.validate()...)
+	if newApplyFlags.File == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--file must not be empty"))
+	}
+	if err := validateOutput(newApplyFlags.Output); err != nil {
+		errs = append(errs, err)
+	} else if newApplyFlags.Output == "json" && !newApplyFlags.DryRun && !newApplyFlags.AutoApprove {
+		errs = append(errs, maskAnyf(invalidConfigError, "--output json requires --auto-approve or --dry-run, since the plan cannot be confirmed interactively"))
+	}
+
+	return errs
+}
+
+// applyConfirmed returns whether apply proceeds despite warnings. Using
+// --dry-run, warnings are only printed, so the plan is shown regardless.
+func applyConfirmed(newApplyFlags *applyFlags) bool {
+	return newApplyFlags.Yes || newApplyFlags.DryRun || !newApplyFlags.AutoApprove
+}
+
+func applyRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(applyValidate(newApplyFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	spec, err := state.ParseFile(newApplyFlags.File)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newApplyFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to reconcile PKI backend specific resources.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newApplyFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a token generator to reconcile token specific resources.
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = tracer
+		tokenConfig.VaultClient = newVaultClient
+		tokenConfig.SharedMount = newApplyFlags.Vault.sharedMount()
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a state service to reconcile Vault with the spec.
+	var stateService state.Service
+	{
+		stateConfig := state.DefaultServiceConfig()
+		stateConfig.PKIService = pkiService
+		stateConfig.TokenService = tokenService
+		stateConfig.SharedMount = newApplyFlags.Vault.sharedMount()
+		stateService, err = state.NewService(stateConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	plan, err := stateService.Plan(spec)
+	if err != nil {
+		return maskAny(err)
+	}
+	// Warnings are confirmed along with the plan when asking for confirmation.
+	// Applying unattended, they must be confirmed using --yes.
+	err = confirmWarnings(plan.Warnings, applyConfirmed(newApplyFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if plan.Actions == nil {
+		plan.Actions = []state.Action{}
+	}
+	jsonOutput := newApplyFlags.Output == "json"
+
+	if jsonOutput && (len(plan.Actions) == 0 || newApplyFlags.DryRun) {
+		err = printJSON(applyResult{Plan: plan})
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+	if len(plan.Actions) == 0 {
+		fmt.Printf("Vault matches the spec. No changes necessary.\n")
+		return nil
+	}
+
+	if !jsonOutput {
+		fmt.Printf("The following changes would be applied:\n")
+		fmt.Printf("\n")
+		printPlan(plan)
+		fmt.Printf("%s\n", formatPlanSummary(plan))
+		fmt.Printf("\n")
+	}
+	if newApplyFlags.DryRun {
+		return nil
+	}
+	err = verifyNoMaintenance(newVaultClient, newApplyFlags.Force)
+	if err != nil {
+		return maskAny(err)
+	}
+	if !newApplyFlags.AutoApprove {
+		err = confirmApply()
+		if err != nil {
+			return maskAny(err)
+		}
+		fmt.Printf("\n")
+	}
+
+	applyConfig := state.ApplyConfig{
+		Spec:            spec,
+		Plan:            plan,
+		ContinueOnError: newApplyFlags.ContinueOnError,
+	}
+	result, err := stateService.Apply(applyConfig)
+	if err != nil {
+		printAppliedTokens(spec, result)
+		return maskAny(err)
+	}
+
+	if jsonOutput {
+		out := applyResult{
+			Plan:    plan,
+			Applied: &result.Plan,
+			Tokens:  result.Tokens,
+		}
+		if out.Applied.Actions == nil {
+			out.Applied.Actions = []state.Action{}
+		}
+		for _, f := range result.Failures {
+			out.Failures = append(out.Failures, applyFailure{ClusterID: f.ClusterID, Error: f.Err.Error()})
+		}
+		err = printJSON(out)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	if !jsonOutput && len(result.Plan.Actions) > 0 {
+		fmt.Printf("The following changes have been applied:\n")
+		fmt.Printf("\n")
+		printPlan(result.Plan)
+	}
+
+	for _, c := range spec.Clusters {
+		tokens, ok := result.Tokens[c.ID]
+		if !ok || jsonOutput {
+			continue
+		}
+		fmt.Printf("The following tokens have been generated for cluster '%s':\n", c.ID)
+		fmt.Printf("\n")
+		for _, t := range tokens {
+			fmt.Printf("    %s\n", t)
+		}
+		fmt.Printf("\n")
+	}
+
+	if len(result.Failures) > 0 {
+		clusters := map[string]bool{}
+		for _, a := range plan.Actions {
+			clusters[a.ClusterID] = true
+		}
+		if !jsonOutput {
+			fmt.Printf("The following clusters failed to be reconciled and may be applied partially:\n")
+			fmt.Printf("\n")
+			for _, f := range result.Failures {
+				fmt.Printf("    %s: %s\n", f.ClusterID, f.Err.Error())
+			}
+			fmt.Printf("\n")
+		}
+		return maskAnyf(batchFailedError, "%d of %d clusters failed", len(result.Failures), len(clusters))
+	}
+
+	return nil
+}
+
+// printAppliedTokens prints the tokens generated by a failed apply to stderr,
+// since they are valid in Vault but not written anywhere.
+func printAppliedTokens(spec state.Spec, result state.Result) {
+	for _, c := range spec.Clusters {
+		tokens, ok := result.Tokens[c.ID]
+		if !ok {
+			continue
+		}
+		printWarning("%d token(s) were generated for cluster '%s' before the failure and are not written anywhere:", len(tokens), c.ID)
+		for _, t := range tokens {
+			fmt.Fprintf(os.Stderr, "    %s\n", t)
+		}
+	}
+}
+
+// printPlan prints the actions of the given plan grouped by cluster.
+func printPlan(plan state.Plan) {
+	var clusterID string
+	for _, a := range plan.Actions {
+		if a.ClusterID != clusterID {
+			if clusterID != "" {
+				fmt.Printf("\n")
+			}
+			clusterID = a.ClusterID
+			fmt.Printf("Cluster '%s':\n", clusterID)
+		}
+
+		symbol := "+"
+		if a.Type == state.ActionUpdate {
+			symbol = "~"
+		}
+		fmt.Printf("    %s %-7s %s\n", symbol, a.Resource, a.Path)
+		for _, c := range a.Changes {
+			fmt.Printf("          %s: '%s' -> '%s'\n", c.Field, c.Before, c.After)
+		}
+	}
+	fmt.Printf("\n")
+}
+
+// formatPlanSummary counts the actions of the given plan by their type.
+func formatPlanSummary(plan state.Plan) string {
+	var create, update int
+	for _, a := range plan.Actions {
+		if a.Type == state.ActionUpdate {
+			update++
+		} else {
+			create++
+		}
+	}
+
+	return fmt.Sprintf("Plan: %d to create, %d to update.", create, update)
+}
+
+// confirmApply asks for confirmation on stdin before a plan is applied. Only
+// the answer yes confirms it, so e.g. an empty stdin in CI cancels applying.
+func confirmApply() error {
+	fmt.Printf("Apply these changes? Only 'yes' is accepted: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return maskAny(err)
+	}
+	if strings.TrimSpace(answer) != "yes" {
+		if err == io.EOF {
+			fmt.Printf("\n")
+		}
+		return maskAnyf(applyCancelledError, "no changes applied, use --auto-approve to apply without confirmation")
+	}
+
+	return nil
+}
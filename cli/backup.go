@@ -0,0 +1,362 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type backupFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Archive
+	Out     string
+	KeyFile string
+}
+
+// backupManifest describes the content of a backup archive. It is the first
+// file of the archive.
+type backupManifest struct {
+	ClusterID          string   `json:"cluster_id"`
+	CreatedAt          string   `json:"created_at"`
+	CertctlVersion     string   `json:"certctl_version,omitempty"`
+	IncludesPrivateKey bool     `json:"includes_private_key"`
+	Files              []string `json:"files"`
+}
+
+// backupMount is the mount configuration of the PKI backend as written to a
+// backup archive.
+type backupMount struct {
+	Path            string `json:"path"`
+	Type            string `json:"type"`
+	Description     string `json:"description"`
+	DefaultLeaseTTL string `json:"default_lease_ttl"`
+	MaxLeaseTTL     string `json:"max_lease_ttl"`
+}
+
+// backupFile is a single file of a backup archive.
+type backupFile struct {
+	Name string
+	Data []byte
+}
+
+var (
+	backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the PKI configuration and CA chain of a cluster to an archive.",
+		Long: `Back up the PKI configuration and CA chain of a cluster to a gzipped tar
+archive, e.g. for disaster recovery documentation. The archive holds the root
+CA, the CA chain, the configuration of all PKI roles, the PKI issue policy, the
+mount tuning and the URL config of the PKI backend, next to a manifest.
+
+Vault never exposes the private key of a CA, so the archive holds no key
+material certificates can be issued with. The private key exported when the
+root CA was generated can be added using --include-exported-key. It is
+checked to belong to the root CA.
+
+The archive is written atomically, i.e. it either holds a complete backup or
+is not written at all. Unlike export, the backup is a snapshot meant to be
+read by humans, not a spec apply can reconcile Vault with.`,
+		RunE: backupRun,
+	}
+
+	newBackupFlags = &backupFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(backupCmd)
+	configValidators["backup"] = func() []error { return backupValidate(newBackupFlags) }
+
+	newBackupFlags.Vault.register(backupCmd.Flags())
+
+	backupCmd.Flags().StringVar(&newBackupFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend being backed up.")
+
+	backupCmd.Flags().StringVar(&newBackupFlags.Out, "out", "", "File path the gzipped tar archive is written to, e.g. cluster.tar.gz.")
+	backupCmd.Flags().StringVar(&newBackupFlags.KeyFile, "include-exported-key", "", "File path of the PEM encoded private key exported when the root CA was generated. It is added to the archive, which then allows issuing certificates. Must belong to the root CA.")
+}
+
+func backupValidate(newBackupFlags *backupFlags) []error {
+	var errs []error
+
+	errs = append(errs, newBackupFlags.Vault.validate()...)
+	if newBackupFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newBackupFlags.Out == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--out must not be empty"))
+	}
+	if newBackupFlags.KeyFile != "" {
+		if _, err := os.Stat(newBackupFlags.KeyFile); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--include-exported-key %s", err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func backupRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(backupValidate(newBackupFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newBackupFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to read the PKI backend specific resources.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newBackupFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a token generator to read the policy of the cluster.
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = tracer
+		tokenConfig.VaultClient = newVaultClient
+		tokenConfig.SharedMount = newBackupFlags.Vault.sharedMount()
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	files, err := backupFiles(newBackupFlags, pkiService, tokenService)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	manifest := backupManifest{
+		ClusterID:          newBackupFlags.ClusterID,
+		CreatedAt:          time.Now().UTC().Format(time.RFC3339),
+		CertctlVersion:     version,
+		IncludesPrivateKey: newBackupFlags.KeyFile != "",
+	}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.Name)
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return maskAny(err)
+	}
+	files = append([]backupFile{{Name: "manifest.json", Data: append(b, '\n')}}, files...)
+
+	dir := backupDir(newBackupFlags, pkiService)
+	archive, err := backupArchive(dir, files)
+	if err != nil {
+		return maskAny(err)
+	}
+	// The archive may hold a private key, so it is never readable by others.
+	err = writeOutputFile(newBackupFlags.Out, archive, os.FileMode(0600))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Backed up cluster ID '%s' to '%s':\n", newBackupFlags.ClusterID, newBackupFlags.Out)
+	fmt.Printf("\n")
+	for _, f := range files {
+		fmt.Printf("    %s\n", path.Join(dir, f.Name))
+	}
+	fmt.Printf("\n")
+	if newBackupFlags.KeyFile == "" {
+		fmt.Printf("The archive holds no private key, certificates cannot be issued using it.\n")
+	} else {
+		fmt.Printf("The archive holds the private key of the root CA. Store it as safely as\n")
+		fmt.Printf("the root CA itself.\n")
+	}
+
+	return nil
+}
+
+// backupFiles reads the PKI configuration of the cluster from Vault and
+// returns it as files of the backup archive.
+func backupFiles(newBackupFlags *backupFlags, pkiService pki.Service, tokenService token.Service) ([]backupFile, error) {
+	var files []backupFile
+	clusterID := newBackupFlags.ClusterID
+
+	mount, err := pkiService.GetMount(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if mount == nil || mount.Type != "pki" {
+		return nil, maskAnyf(notSetUpError, "PKI backend of cluster ID '%s' not mounted", clusterID)
+	}
+
+	ca, err := pkiService.GetCA(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	files = append(files, backupFile{Name: "ca.pem", Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})})
+
+	caChain, err := pkiService.GetCAChain(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	var chain []byte
+	for _, c := range caChain {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	files = append(files, backupFile{Name: "ca_chain.pem", Data: chain})
+
+	if newBackupFlags.KeyFile != "" {
+		key, err := ioutil.ReadFile(newBackupFlags.KeyFile)
+		if err != nil {
+			return nil, maskAnyf(invalidConfigError, "--include-exported-key %s", err.Error())
+		}
+		err = pki.VerifyCAKey(ca, string(key))
+		if pki.IsInvalidConfig(err) {
+			return nil, maskAnyf(invalidConfigError, "--include-exported-key must be the PEM encoded private key of the root CA '%s'", ca.Subject.CommonName)
+		} else if err != nil {
+			return nil, maskAny(err)
+		}
+		files = append(files, backupFile{Name: "ca_key.pem", Data: key})
+	}
+
+	// The shared PKI backend holds the roles of all clusters, of which only
+	// the cluster's role belongs to the cluster.
+	var roles []string
+	if newBackupFlags.Vault.sharedMount() != "" {
+		created, err := pkiService.IsRoleCreated(clusterID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if !created {
+			return nil, maskAnyf(notSetUpError, "cluster ID '%s' has no PKI role in the shared PKI backend '%s'", clusterID, mount.Path)
+		}
+		roles = []string{pkiService.RoleName(clusterID)}
+	} else {
+		roles, err = pkiService.ListRoles(clusterID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+	for _, name := range roles {
+		role, err := pkiService.GetNamedRole(clusterID, name)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		b, err := json.MarshalIndent(role.Data, "", "  ")
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		files = append(files, backupFile{Name: path.Join("roles", name+".json"), Data: append(b, '\n')})
+	}
+
+	policyCreated, err := tokenService.IsPolicyCreated(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if policyCreated {
+		rules, err := tokenService.GetPolicy(clusterID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		files = append(files, backupFile{Name: "policy.hcl", Data: []byte(rules)})
+	}
+
+	tuning, err := pkiService.GetMountTuning(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	m := backupMount{
+		Path:            mount.Path,
+		Type:            mount.Type,
+		Description:     mount.Description,
+		DefaultLeaseTTL: formatDuration(tuning.DefaultLeaseTTL),
+		MaxLeaseTTL:     formatDuration(tuning.MaxLeaseTTL),
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	files = append(files, backupFile{Name: "mount.json", Data: append(b, '\n')})
+
+	urls, err := pkiService.GetURLs(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	b, err = json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	files = append(files, backupFile{Name: "urls.json", Data: append(b, '\n')})
+
+	return files, nil
+}
+
+// backupDir returns the directory of the backup archive all files are located
+// in. It is named like the cluster's PKI backend, e.g. pki-<cluster-id>. Using
+// the shared PKI backend, it is named like the cluster's role within it, e.g.
+// pki/role-<cluster-id>, so the backups of different clusters do not collide.
+func backupDir(newBackupFlags *backupFlags, pkiService pki.Service) string {
+	clusterID := newBackupFlags.ClusterID
+	if newBackupFlags.Vault.sharedMount() != "" {
+		return path.Join(pkiService.MountPKIPath(clusterID), pkiService.RoleName(clusterID))
+	}
+
+	return pkiService.MountPKIPath(clusterID)
+}
+
+// backupArchive returns the given files as gzipped tar archive. The archive is
+// built in memory, so nothing is written in case reading from Vault fails.
+func backupArchive(dir string, files []backupFile) ([]byte, error) {
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gw)
+
+	now := time.Now()
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    path.Join(dir, f.Name),
+			Mode:    0600,
+			Size:    int64(len(f.Data)),
+			ModTime: now,
+		}
+		err := tw.WriteHeader(header)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		_, err = tw.Write(f.Data)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	err = gw.Close()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b.Bytes(), nil
+}
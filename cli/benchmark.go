@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+const (
+	// benchmarkTidyMaxTTL is the maximum --ttl of throwaway certificates in
+	// case they are tidied, since the benchmark waits for them to expire.
+	benchmarkTidyMaxTTL = 10 * time.Minute
+
+	// benchmarkTidySafetyBuffer is the safety buffer of the tidy operation
+	// started after the benchmark. The benchmark waits twice as long after the
+	// certificates expired, allowing for clock skew between certctl and Vault.
+	benchmarkTidySafetyBuffer = 5 * time.Second
+)
+
+type benchmarkIssueFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Certificate
+	CommonName string
+	TTL        string
+
+	// Load
+	Duration    time.Duration
+	Concurrency int
+
+	// Cleanup
+	Tidy bool
+
+	// Output
+	Output string
+}
+
+var (
+	benchmarkCmd = &cobra.Command{
+		Use:   "benchmark",
+		Short: "Measure the performance of Vault's PKI backends.",
+		RunE:  groupRun,
+	}
+
+	benchmarkIssueCmd = &cobra.Command{
+		Use:   "issue",
+		Short: "Measure latency and throughput of issuing certificates for a cluster.",
+		Long: `Measure latency and throughput of issuing certificates for a cluster. Throwaway
+certificates are issued concurrently using the same path the issue command
+uses until --duration passed. Requests per second, latency percentiles and the
+error rate are reported afterwards. Requests are subject to --rate-limit like
+any other request.
+
+Every issued certificate occupies storage in Vault unless the cluster's PKI
+role was set up with --no-store. Use --tidy to remove them from storage after
+the benchmark. Vault only tidies expired certificates, so the benchmark then
+waits for --ttl to pass before starting a tidy operation. --ttl must be at
+most 10m in this case.`,
+		RunE: benchmarkIssueRun,
+	}
+
+	newBenchmarkIssueFlags = &benchmarkIssueFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(benchmarkCmd)
+	benchmarkCmd.AddCommand(benchmarkIssueCmd)
+	configValidators["benchmark issue"] = func() []error { return benchmarkIssueValidate(newBenchmarkIssueFlags) }
+
+	newBenchmarkIssueFlags.Vault.register(benchmarkIssueCmd.Flags())
+
+	benchmarkIssueCmd.Flags().StringVar(&newBenchmarkIssueFlags.ClusterID, "cluster-id", "", "Cluster ID used to issue the throwaway certificates for.")
+
+	benchmarkIssueCmd.Flags().StringVar(&newBenchmarkIssueFlags.CommonName, "common-name", "", "Common name of the throwaway certificates. Must be allowed by the cluster's PKI role.")
+	benchmarkIssueCmd.Flags().StringVar(&newBenchmarkIssueFlags.TTL, "ttl", "5m", "TTL of the throwaway certificates. Short TTLs allow tidying them soon.")
+
+	benchmarkIssueCmd.Flags().DurationVar(&newBenchmarkIssueFlags.Duration, "duration", 30*time.Second, "Duration the certificates are issued for.")
+	benchmarkIssueCmd.Flags().IntVar(&newBenchmarkIssueFlags.Concurrency, "concurrency", 16, "Number of certificates issued in parallel.")
+
+	benchmarkIssueCmd.Flags().BoolVar(&newBenchmarkIssueFlags.Tidy, "tidy", false, "Wait for the throwaway certificates to expire after the benchmark and start a tidy operation of the cluster's PKI backend removing them. Requires --ttl of at most 10m. (Default false)")
+
+	benchmarkIssueCmd.Flags().StringVar(&newBenchmarkIssueFlags.Output, "output", "text", "Output format of the benchmark results. One of text or json.")
+}
+
+func benchmarkIssueValidate(newBenchmarkIssueFlags *benchmarkIssueFlags) []error {
+	var errs []error
+
+	errs = append(errs, newBenchmarkIssueFlags.Vault.validate()...)
+	if newBenchmarkIssueFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newBenchmarkIssueFlags.CommonName == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--common-name must not be empty"))
+	}
+	if err := validateDuration("--ttl", newBenchmarkIssueFlags.TTL); err != nil {
+		errs = append(errs, err)
+	} else if ttl, _ := time.ParseDuration(newBenchmarkIssueFlags.TTL); newBenchmarkIssueFlags.Tidy && ttl > benchmarkTidyMaxTTL {
+		errs = append(errs, maskAnyf(invalidConfigError, "--ttl must be at most %s when using --tidy", benchmarkTidyMaxTTL))
+	}
+	if newBenchmarkIssueFlags.Duration <= 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--duration must be greater than zero"))
+	}
+	if newBenchmarkIssueFlags.Concurrency < 1 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--concurrency must be at least 1"))
+	}
+	if err := validateOutput(newBenchmarkIssueFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// benchmarkResult summarizes the requests made during a benchmark.
+// Latencies are given in milliseconds.
+type benchmarkResult struct {
+	ClusterID         string  `json:"cluster_id"`
+	Duration          string  `json:"duration"`
+	Concurrency       int     `json:"concurrency"`
+	Requests          int     `json:"requests"`
+	Errors            int     `json:"errors"`
+	ErrorRate         float64 `json:"error_rate"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	LatencyP50        float64 `json:"latency_p50_ms"`
+	LatencyP95        float64 `json:"latency_p95_ms"`
+	LatencyP99        float64 `json:"latency_p99_ms"`
+	LastError         string  `json:"last_error,omitempty"`
+	Tidied            bool    `json:"tidied"`
+}
+
+// benchmarkSample is the outcome of a single request.
+type benchmarkSample struct {
+	Latency time.Duration
+	Err     error
+}
+
+func benchmarkIssueRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(benchmarkIssueValidate(newBenchmarkIssueFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided token.
+	newVaultClient, err := createVaultClient(&newBenchmarkIssueFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a certificate signer to issue the throwaway certificates.
+	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Tracer = tracer
+	newCertSignerConfig.VaultClient = newVaultClient
+	newCertSignerConfig.SharedMount = newBenchmarkIssueFlags.Vault.sharedMount()
+	newCertSigner, err := certsigner.New(newCertSignerConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:  newBenchmarkIssueFlags.ClusterID,
+		CommonName: newBenchmarkIssueFlags.CommonName,
+		TTL:        newBenchmarkIssueFlags.TTL,
+	}
+
+	var samples []benchmarkSample
+	var elapsed time.Duration
+	{
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+
+		start := time.Now()
+		deadline := start.Add(newBenchmarkIssueFlags.Duration)
+		for i := 0; i < newBenchmarkIssueFlags.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for time.Now().Before(deadline) {
+					t := time.Now()
+					_, err := newCertSigner.Issue(newIssueConfig)
+					sample := benchmarkSample{Latency: time.Since(t), Err: err}
+
+					mutex.Lock()
+					samples = append(samples, sample)
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		elapsed = time.Since(start)
+	}
+
+	result := benchmarkSummary(samples, elapsed)
+	result.ClusterID = newBenchmarkIssueFlags.ClusterID
+	result.Duration = newBenchmarkIssueFlags.Duration.String()
+	result.Concurrency = newBenchmarkIssueFlags.Concurrency
+
+	if newBenchmarkIssueFlags.Tidy {
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newBenchmarkIssueFlags.Vault.sharedMount()
+		pkiService, err := pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+
+		// Vault only tidies certificates expired for longer than the safety
+		// buffer, so the ones issued last must expire first. The wait is
+		// reported on stderr, so JSON output stays parsable.
+		ttl, err := time.ParseDuration(newBenchmarkIssueFlags.TTL)
+		if err != nil {
+			return maskAny(err)
+		}
+		wait := ttl + 2*benchmarkTidySafetyBuffer
+		fmt.Fprintf(os.Stderr, "Waiting %s for the throwaway certificates to expire before tidying them.\n", wait)
+		time.Sleep(wait)
+
+		err = pkiService.Tidy(newBenchmarkIssueFlags.ClusterID, benchmarkTidySafetyBuffer)
+		if err != nil {
+			return maskAny(err)
+		}
+		result.Tidied = true
+	}
+
+	if newBenchmarkIssueFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+	} else {
+		fmt.Printf("Benchmarked issuing certificates for cluster ID '%s':\n", result.ClusterID)
+		fmt.Printf("\n")
+		fmt.Printf("    Duration:     %s\n", result.Duration)
+		fmt.Printf("    Concurrency:  %d\n", result.Concurrency)
+		fmt.Printf("    Requests:     %d\n", result.Requests)
+		fmt.Printf("    Errors:       %d (%.1f%%)\n", result.Errors, result.ErrorRate*100)
+		fmt.Printf("    Requests/sec: %.1f\n", result.RequestsPerSecond)
+		fmt.Printf("    Latency p50:  %.1fms\n", result.LatencyP50)
+		fmt.Printf("    Latency p95:  %.1fms\n", result.LatencyP95)
+		fmt.Printf("    Latency p99:  %.1fms\n", result.LatencyP99)
+		if result.LastError != "" {
+			fmt.Printf("    Last error:   %s\n", result.LastError)
+		}
+		fmt.Printf("\n")
+		if result.Tidied {
+			fmt.Printf("Tidy operation started for the PKI backend of cluster ID '%s'.\n", result.ClusterID)
+			fmt.Printf("\n")
+		}
+	}
+
+	// In case nothing could be issued the numbers are meaningless, so the
+	// benchmark fails.
+	if result.Requests > 0 && result.Errors == result.Requests {
+		return maskAny(samples[len(samples)-1].Err)
+	}
+
+	return nil
+}
+
+// benchmarkSummary computes the statistics of the given samples collected
+// within the given time. Only successful requests count towards latencies
+// and throughput.
+func benchmarkSummary(samples []benchmarkSample, elapsed time.Duration) benchmarkResult {
+	result := benchmarkResult{
+		Requests: len(samples),
+	}
+
+	var latencies []time.Duration
+	for _, s := range samples {
+		if s.Err != nil {
+			result.Errors++
+			result.LastError = s.Err.Error()
+			continue
+		}
+		latencies = append(latencies, s.Latency)
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(result.Errors) / float64(result.Requests)
+	}
+	if elapsed > 0 {
+		result.RequestsPerSecond = float64(len(latencies)) / elapsed.Seconds()
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.LatencyP50 = percentileMillis(latencies, 50)
+	result.LatencyP95 = percentileMillis(latencies, 95)
+	result.LatencyP99 = percentileMillis(latencies, 99)
+
+	return result
+}
+
+// percentileMillis returns the given percentile of the sorted latencies in
+// milliseconds using the nearest rank method.
+func percentileMillis(sorted []time.Duration, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return float64(sorted[rank-1]) / float64(time.Millisecond)
+}
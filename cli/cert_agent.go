@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// certAgentRetryInterval is the time the cert agent waits before retrying to
+// issue a certificate after a failure.
+const certAgentRetryInterval = time.Minute
+
+type certAgentFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Certificate
+	CommonName string
+	IPSANs     string
+	AltNames   string
+	TTL        string
+
+	// Renewal
+	RenewBefore time.Duration
+
+	// Path
+	CrtFilePath string
+	KeyFilePath string
+	CAFilePath  string
+	FileModes   fileModeFlags
+
+	// Reload
+	Reload reloadFlags
+}
+
+var (
+	certAgentCmd = &cobra.Command{
+		Use:   "cert-agent",
+		Short: "Issue a certificate to files and renew it before it expires.",
+		Long: `Issue a certificate to files and renew it before it expires. The agent runs
+until it receives SIGTERM or SIGINT. Certificates are renewed once
+--renew-before is left of their validity, or right away when receiving
+SIGHUP. Files are replaced atomically, so consumers never read partially
+written certificates.
+
+In case valid files already exist when the agent starts, e.g. after a
+restart, the certificate is only renewed when due, unless it was issued for
+another --common-name, --alt-names or --ip-sans. Failed renewals are
+retried every minute. After each renewal --reload-cmd is run, e.g. to make a
+web server pick up the new certificate. It runs with a clean environment
+unless --reload-inherit-env is given, and is killed after --reload-timeout.`,
+		RunE: certAgentRun,
+	}
+
+	newCertAgentFlags = &certAgentFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(certAgentCmd)
+	configValidators["cert-agent"] = func() []error { return certAgentValidate(newCertAgentFlags) }
+
+	newCertAgentFlags.Vault.register(certAgentCmd.Flags())
+
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate the signed certificate for.")
+
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.CommonName, "common-name", "", "Common name used to generate the signed certificate for.")
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.IPSANs, "ip-sans", "", "IPSANs used to generate the signed certificate for.")
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.AltNames, "alt-names", "", "Alternative names used to generate the signed certificate for.")
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.TTL, "ttl", "720h", "TTL used to generate the signed certificate for.")
+
+	certAgentCmd.Flags().DurationVar(&newCertAgentFlags.RenewBefore, "renew-before", 0, "Remaining validity at which the certificate is renewed. Must be shorter than --ttl. Defaults to a third of the certificate's validity.")
+
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.CrtFilePath, "crt-file", "", "File path used to write the generated public key to.")
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.KeyFilePath, "key-file", "", "File path used to write the generated private key to.")
+	certAgentCmd.Flags().StringVar(&newCertAgentFlags.CAFilePath, "ca-file", "", "File path used to write the issuing root CA to.")
+	newCertAgentFlags.FileModes.register(certAgentCmd.Flags(), true)
+
+	newCertAgentFlags.Reload.register(certAgentCmd.Flags())
+}
+
+func certAgentValidate(newCertAgentFlags *certAgentFlags) []error {
+	var errs []error
+
+	errs = append(errs, newCertAgentFlags.Vault.validate()...)
+	errs = append(errs, newCertAgentFlags.Reload.validate()...)
+	errs = append(errs, newCertAgentFlags.FileModes.validate()...)
+	if newCertAgentFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newCertAgentFlags.CommonName == "" && newCertAgentFlags.AltNames == "" && newCertAgentFlags.IPSANs == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--common-name must not be empty unless --alt-names or --ip-sans is given"))
+	}
+	if err := validateDuration("--ttl", newCertAgentFlags.TTL); err != nil {
+		errs = append(errs, err)
+	} else if ttl, _ := time.ParseDuration(newCertAgentFlags.TTL); newCertAgentFlags.RenewBefore < 0 || newCertAgentFlags.RenewBefore >= ttl {
+		errs = append(errs, maskAnyf(invalidConfigError, "--renew-before must not be negative and must be shorter than --ttl"))
+	}
+	if newCertAgentFlags.CrtFilePath == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--crt-file must not be empty"))
+	}
+	if newCertAgentFlags.KeyFilePath == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--key-file must not be empty"))
+	}
+	if newCertAgentFlags.CAFilePath == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--ca-file must not be empty"))
+	}
+
+	return errs
+}
+
+func certAgentRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(certAgentValidate(newCertAgentFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	for _, w := range newCertAgentFlags.FileModes.warnings() {
+		printWarning("%s", w)
+	}
+
+	logger := log.New(os.Stderr, "cert-agent: ", log.LstdFlags)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	// Existing files are only replaced when due, so restarting the agent does
+	// not issue a new certificate every time.
+	var next time.Time
+	if crt, err := readCertAgentFiles(newCertAgentFlags); err == nil {
+		if certAgentNamesMatch(crt, newCertAgentFlags) {
+			next = certRenewalTime(crt, newCertAgentFlags.RenewBefore)
+			logger.Printf("found certificate with serial number '%s' expiring at %s, renewing at %s", pki.FormatSerialNumber(crt.SerialNumber), crt.NotAfter.UTC().Format(time.RFC3339), next.UTC().Format(time.RFC3339))
+		} else {
+			logger.Printf("found certificate with serial number '%s' not matching --common-name, --alt-names or --ip-sans, renewing now", pki.FormatSerialNumber(crt.SerialNumber))
+		}
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case s := <-signals:
+			timer.Stop()
+			if s != syscall.SIGHUP {
+				logger.Printf("received %s, shutting down", s)
+				return nil
+			}
+			logger.Printf("received %s, renewing certificate", s)
+		case <-timer.C:
+		}
+
+		crt, err := certAgentIssue(newCertAgentFlags)
+		if err != nil {
+			logger.Printf("issuing certificate failed, retrying in %s: %s", certAgentRetryInterval, err.Error())
+			next = time.Now().Add(certAgentRetryInterval)
+			continue
+		}
+		next = certRenewalTime(crt, newCertAgentFlags.RenewBefore)
+		logger.Printf("issued certificate with serial number '%s' expiring at %s, renewing at %s", pki.FormatSerialNumber(crt.SerialNumber), crt.NotAfter.UTC().Format(time.RFC3339), next.UTC().Format(time.RFC3339))
+
+		newCertAgentFlags.Reload.run(logger)
+	}
+}
+
+// certAgentIssue issues a certificate as configured by the given flags and
+// writes it to the configured files. It returns the parsed certificate.
+func certAgentIssue(newCertAgentFlags *certAgentFlags) (*x509.Certificate, error) {
+	// Create a Vault client configured with the provided token. Clients are
+	// forgotten on authentication failures, so a rotated token is picked up
+	// on retry.
+	newVaultClient, err := createVaultClient(&newCertAgentFlags.Vault)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Create a certificate signer to generate a new signed certificate.
+	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Tracer = tracer
+	newCertSignerConfig.VaultClient = newVaultClient
+	newCertSignerConfig.SharedMount = newCertAgentFlags.Vault.sharedMount()
+	newCertSigner, err := certsigner.New(newCertSignerConfig)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:  newCertAgentFlags.ClusterID,
+		CommonName: newCertAgentFlags.CommonName,
+		IPSANs:     newCertAgentFlags.IPSANs,
+		AltNames:   newCertAgentFlags.AltNames,
+		TTL:        newCertAgentFlags.TTL,
+	}
+	newIssueResponse, err := newCertSigner.Issue(newIssueConfig)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	crt, err := parseCertPEM([]byte(newIssueResponse.Certificate))
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// The files are replaced one after another, so consumers reading them
+	// meanwhile may see the new certificate next to the old private key. They
+	// are expected to pick up the files once --reload-cmd runs, after all of
+	// them were written.
+	err = writeOutputFile(newCertAgentFlags.CAFilePath, []byte(newIssueResponse.IssuingCA), newCertAgentFlags.FileModes.certMode())
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	err = writeOutputFile(newCertAgentFlags.CrtFilePath, []byte(newIssueResponse.Certificate), newCertAgentFlags.FileModes.certMode())
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	err = writeOutputFile(newCertAgentFlags.KeyFilePath, []byte(newIssueResponse.PrivateKey), newCertAgentFlags.FileModes.keyMode())
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return crt, nil
+}
+
+// readCertAgentFiles returns the certificate written by a previous run of the
+// agent. It fails in case any of the files is missing or the certificate
+// cannot be parsed.
+func readCertAgentFiles(newCertAgentFlags *certAgentFlags) (*x509.Certificate, error) {
+	for _, p := range []string{newCertAgentFlags.KeyFilePath, newCertAgentFlags.CAFilePath} {
+		if _, err := os.Stat(p); err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(newCertAgentFlags.CrtFilePath)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	crt, err := parseCertPEM(b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return crt, nil
+}
+
+// certAgentNamesMatch checks whether the given certificate was issued for the
+// common name, alt names and IP SANs configured by the given flags, so that
+// changing them issues a new certificate instead of reusing the existing one.
+// Vault adds the common name to the SANs, so it is expected among them.
+func certAgentNamesMatch(crt *x509.Certificate, newCertAgentFlags *certAgentFlags) bool {
+	if crt.Subject.CommonName != newCertAgentFlags.CommonName {
+		return false
+	}
+
+	names := splitList(newCertAgentFlags.AltNames)
+	ips := splitList(newCertAgentFlags.IPSANs)
+	if cn := newCertAgentFlags.CommonName; cn != "" {
+		if net.ParseIP(cn) != nil {
+			ips = append(ips, cn)
+		} else {
+			names = append(names, cn)
+		}
+	}
+
+	var crtNames []string
+	crtNames = append(crtNames, crt.DNSNames...)
+	crtNames = append(crtNames, crt.EmailAddresses...)
+	var crtIPs []string
+	for _, ip := range crt.IPAddresses {
+		crtIPs = append(crtIPs, ip.String())
+	}
+	for i, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ips[i] = parsed.String()
+		}
+	}
+
+	return equalStringSets(names, crtNames) && equalStringSets(ips, crtIPs)
+}
+
+// equalStringSets checks whether the given lists hold the same items,
+// regardless of their order and duplicates.
+func equalStringSets(a, b []string) bool {
+	set := map[string]bool{}
+	for _, v := range a {
+		set[v] = true
+	}
+	other := map[string]bool{}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+		other[v] = true
+	}
+
+	return len(set) == len(other)
+}
+
+// certRenewalTime returns the time the given certificate is renewed at, i.e.
+// when the given duration is left of its validity. A zero duration means a
+// third of the certificate's validity.
+func certRenewalTime(crt *x509.Certificate, renewBefore time.Duration) time.Time {
+	if renewBefore == 0 {
+		renewBefore = crt.NotAfter.Sub(crt.NotBefore) / 3
+	}
+
+	return crt.NotAfter.Add(-renewBefore)
+}
+
+// parseCertPEM parses the first PEM encoded certificate of the given data.
+func parseCertPEM(b []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, maskAnyf(invalidConfigError, "certificate must be PEM encoded")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return crt, nil
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/health"
+)
+
+type checkClockFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Threshold
+	MaxSkew time.Duration
+
+	// Output
+	Output string
+}
+
+// checkClockResult is the machine readable report printed by check-clock when
+// using --output json.
+type checkClockResult struct {
+	LocalTime   string  `json:"local_time"`
+	VaultTime   string  `json:"vault_time"`
+	Skew        float64 `json:"skew_seconds"`
+	Uncertainty float64 `json:"uncertainty_seconds"`
+	MaxSkew     string  `json:"max_skew"`
+	Exceeded    bool    `json:"exceeded"`
+}
+
+var (
+	checkClockCmd = &cobra.Command{
+		Use:   "check-clock",
+		Short: "Measure the skew of the local clock against the clock of Vault.",
+		Long: `Measure the skew of the local clock against the clock of Vault, using the Date
+header of Vault's response. Certificates are only valid from the time they are
+issued at according to Vault's clock. Vault backdates them by 30s by default,
+so a local clock lagging behind Vault's more than that rejects freshly issued
+certificates as not yet valid. A local clock running ahead of Vault's makes
+certificates expire early.
+
+The Date header has a resolution of one second, so the skew is measured with
+an uncertainty of half a second plus half the round trip to Vault. The command
+exits with code 8 in case the skew exceeds --max-skew beyond the uncertainty.`,
+		RunE: checkClockRun,
+	}
+
+	newCheckClockFlags = &checkClockFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(checkClockCmd)
+	configValidators["check-clock"] = func() []error { return checkClockValidate(newCheckClockFlags) }
+
+	newCheckClockFlags.Vault.register(checkClockCmd.Flags())
+
+	checkClockCmd.Flags().DurationVar(&newCheckClockFlags.MaxSkew, "max-skew", 30*time.Second, "Maximum skew of the local clock against the clock of Vault, in either direction, considered safe.")
+
+	checkClockCmd.Flags().StringVar(&newCheckClockFlags.Output, "output", "text", "Output format of the report. One of text or json.")
+}
+
+func checkClockValidate(newCheckClockFlags *checkClockFlags) []error {
+	var errs []error
+
+	errs = append(errs, newCheckClockFlags.Vault.validate()...)
+	if newCheckClockFlags.MaxSkew <= 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--max-skew must be positive"))
+	}
+	if err := validateOutput(newCheckClockFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func checkClockRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(checkClockValidate(newCheckClockFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided token.
+	newVaultClient, err := createVaultClient(&newCheckClockFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a health service to measure the clock of Vault.
+	var healthService health.Service
+	{
+		healthConfig := health.DefaultServiceConfig()
+		healthConfig.Logger = debugLogger()
+		healthConfig.VaultClient = newVaultClient
+		healthService, err = health.NewService(healthConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	clock, err := healthService.Clock()
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Only skews exceeding the threshold regardless of the uncertainty are
+	// reported as dangerous, so a slow connection does not fail the check.
+	skew := clock.Skew
+	if skew < 0 {
+		skew = -skew
+	}
+	result := checkClockResult{
+		LocalTime:   clock.LocalTime.UTC().Format(time.RFC3339),
+		VaultTime:   clock.VaultTime.UTC().Format(time.RFC3339),
+		Skew:        clock.Skew.Seconds(),
+		Uncertainty: clock.Uncertainty().Seconds(),
+		MaxSkew:     newCheckClockFlags.MaxSkew.String(),
+		Exceeded:    skew-clock.Uncertainty() > newCheckClockFlags.MaxSkew,
+	}
+
+	if newCheckClockFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+	} else {
+		fmt.Printf("Measured the clock of Vault against the local clock:\n")
+		fmt.Printf("\n")
+		fmt.Printf("    - Local time: %s\n", result.LocalTime)
+		fmt.Printf("    - Vault time: %s\n", result.VaultTime)
+		fmt.Printf("    - Skew: %s (±%s)\n", formatClockSkew(clock.Skew), clock.Uncertainty().Round(time.Millisecond))
+		fmt.Printf("\n")
+		if !result.Exceeded && skew > newCheckClockFlags.MaxSkew {
+			printWarning("skew of %s may exceed --max-skew %s, the measurement is too uncertain to tell", clock.Skew.Round(time.Millisecond), newCheckClockFlags.MaxSkew)
+		}
+	}
+
+	if result.Exceeded {
+		return maskAnyf(clockSkewError, "local clock is %s, which exceeds --max-skew %s, synchronize it, e.g. using NTP", formatClockSkew(clock.Skew), newCheckClockFlags.MaxSkew)
+	}
+
+	return nil
+}
+
+// formatClockSkew describes the given skew of the local clock against the
+// clock of Vault.
+func formatClockSkew(skew time.Duration) string {
+	if skew < 0 {
+		return fmt.Sprintf("%s ahead of Vault", (-skew).Round(time.Millisecond))
+	}
+
+	return fmt.Sprintf("%s behind Vault", skew.Round(time.Millisecond))
+}
@@ -2,30 +2,32 @@ package cli
 
 import (
 	"fmt"
-	"log"
-	"net/http"
 
 	"github.com/spf13/cobra"
 
-	"github.com/giantswarm/certctl/service/pki"
-	"github.com/giantswarm/certctl/service/token"
-	"github.com/giantswarm/certctl/service/vault-factory"
+	"github.com/giantswarm/certctl/service/certctl"
 )
 
 type cleanupFlags struct {
 	// Vault
-	VaultAddress string
-	VaultToken   string
+	Vault vaultFlags
 
 	// Cluster
 	ClusterID string
+
+	// Safety
+	Force bool
 }
 
 var (
 	cleanupCmd = &cobra.Command{
 		Use:   "cleanup",
 		Short: "Cleanup a Vault PKI backend including all necessary requirements.",
-		Run:   cleanupRun,
+		Long: `Cleanup a Vault PKI backend including all necessary requirements. PKI
+backends not carrying the marker certctl mounts PKI backends with, e.g. mounted
+by other tools, are only unmounted when --force is given. The same holds while
+a maintenance operation, e.g. a rekey or a seal migration, is in progress.`,
+		RunE: cleanupRun,
 	}
 
 	newCleanupFlags = &cleanupFlags{}
@@ -33,84 +35,82 @@ var (
 
 func init() {
 	CLICmd.AddCommand(cleanupCmd)
+	configValidators["cleanup"] = func() []error { return cleanupValidate(newCleanupFlags) }
 
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultAddress, "vault-addr", fromEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	cleanupCmd.Flags().StringVar(&newCleanupFlags.VaultToken, "vault-token", fromEnv("VAULT_TOKEN", ""), "Token used to authenticate against Vault.")
+	newCleanupFlags.Vault.register(cleanupCmd.Flags())
 
 	cleanupCmd.Flags().StringVar(&newCleanupFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
+
+	cleanupCmd.Flags().BoolVar(&newCleanupFlags.Force, "force", false, "Unmount the PKI backend even in case it was not mounted by certctl, or a maintenance operation, e.g. a rekey or a seal migration, is in progress. (Default false)")
 }
 
-func cleanupValidate(newCleanupFlags *cleanupFlags) error {
-	if newCleanupFlags.VaultToken == "" {
-		return maskAnyf(invalidConfigError, "Vault token must not be empty")
-	}
+func cleanupValidate(newCleanupFlags *cleanupFlags) []error {
+	var errs []error
+
+	errs = append(errs, newCleanupFlags.Vault.validate()...)
 	if newCleanupFlags.ClusterID == "" {
-		return maskAnyf(invalidConfigError, "cluster ID must not be empty")
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
 	}
 
-	return nil
+	return errs
 }
 
-func cleanupRun(cmd *cobra.Command, args []string) {
-	err := cleanupValidate(newCleanupFlags)
+func cleanupRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(cleanupValidate(newCleanupFlags))
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.HTTPClient = &http.Client{}
-	newVaultFactoryConfig.Address = newCleanupFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newCleanupFlags.VaultToken
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newCleanupFlags.Vault)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
+	err = verifyNoMaintenance(newVaultClient, newCleanupFlags.Force)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
-	}
-
-	// Create a PKI controller to cleanup PKI backend specific operations.
-	var pkiService pki.Service
-	{
-		pkiConfig := pki.DefaultServiceConfig()
-		pkiConfig.VaultClient = newVaultClient
-		pkiService, err = pki.NewService(pkiConfig)
-		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
-		}
+		return maskAny(err)
 	}
 
-	// Create a token generator to cleanup token specific operations.
-	var tokenService token.Service
+	// Create a certctl service to cleanup the cluster.
+	var certctlService certctl.Service
 	{
-		tokenConfig := token.DefaultServiceConfig()
-		tokenConfig.VaultClient = newVaultClient
-		tokenService, err = token.NewService(tokenConfig)
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = newVaultClient
+		certctlConfig.SharedMount = newCleanupFlags.Vault.sharedMount()
+		certctlService, err = certctl.NewService(certctlConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
 	}
 
-	err = pkiService.Delete(newCleanupFlags.ClusterID)
+	// Mounts created by other tools are left alone unless forced, as their PKI
+	// backend may be used for more than the cluster.
+	mount, err := certctlService.PKI().GetMount(newCleanupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
+	}
+	shared := newCleanupFlags.Vault.sharedMount() != ""
+	if mount != nil && mount.Type == "pki" && !mount.Marked && !newCleanupFlags.Force && !shared {
+		return maskAnyf(invalidConfigError, "PKI backend '%s' with description '%s' was not mounted by certctl, use --force to unmount it anyway", mount.Path, mount.Description)
 	}
-	err = tokenService.DeletePolicy(newCleanupFlags.ClusterID)
+
+	err = certctlService.Cleanup(newCleanupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
 	fmt.Printf("Cleaning up cluster for ID '%s':\n", newCleanupFlags.ClusterID)
 	fmt.Printf("\n")
-	fmt.Printf("    - PKI backend unmounted\n")
-	fmt.Printf("    - Root CA deleted\n")
-	fmt.Printf("    - PKI role deleted\n")
+	if shared {
+		fmt.Printf("    - PKI role deleted, the shared PKI backend '%s' and its root CA are kept\n", newCleanupFlags.Vault.sharedMount())
+	} else {
+		fmt.Printf("    - PKI backend unmounted\n")
+		fmt.Printf("    - Root CA deleted\n")
+		fmt.Printf("    - PKI role deleted\n")
+	}
 	fmt.Printf("    - PKI policy deleted\n")
+	fmt.Printf("    - Token role deleted\n")
 	fmt.Printf("\n")
 	fmt.Printf("Tokens may have been generated for this cluster. Created tokens\n")
 	fmt.Printf("cannot be revoked here as they are secret. Tokens need to be\n")
@@ -119,4 +119,6 @@ func cleanupRun(cmd *cobra.Command, args []string) {
 	fmt.Printf("access this new cluster again. Information about these secrets\n")
 	fmt.Printf("needs to be looked up directly from the location of the cluster's\n")
 	fmt.Printf("installation.\n")
+
+	return nil
 }
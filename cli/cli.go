@@ -1,21 +1,68 @@
 package cli
 
 import (
+	"io/ioutil"
+	"log"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+type cliFlags struct {
+	Debug       bool
+	DumpRequest bool
+	NoColor     bool
+
+	// Tracing
+	OTelEndpoint string
+}
+
 var (
 	CLICmd = &cobra.Command{
 		Use:   "certctl",
 		Short: "A command line tool able to request certificate generation from Vault to write certificate files to the local filesystem.",
 
-		Run: cliRun,
+		RunE: groupRun,
+
+		// Errors are printed and mapped to exit codes by the caller of
+		// Execute. See ExitCode.
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+
+	newCLIFlags = &cliFlags{}
 )
 
-func cliRun(cmd *cobra.Command, args []string) {
+func init() {
+	// Assigned here, since startTracing refers to CLICmd itself.
+	CLICmd.PersistentPreRunE = startTracing
+
+	CLICmd.PersistentFlags().BoolVar(&newCLIFlags.Debug, "debug", false, "Print debug information to stderr. (Default false)")
+	CLICmd.PersistentFlags().BoolVar(&newCLIFlags.DumpRequest, "dump-request", false, "Print the method, path and body of every request sent to Vault, and the status of its response, to stderr. Tokens, private keys and other secrets in request bodies are redacted. Headers and response bodies are never printed. (Default false)")
+	CLICmd.PersistentFlags().BoolVar(&newCLIFlags.NoColor, "no-color", false, "Disable colored output. Colors are also disabled by setting NO_COLOR or when not writing to a terminal. (Default false)")
+	CLICmd.PersistentFlags().StringVar(&newCLIFlags.OTelEndpoint, "otel-endpoint", fromEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "OTLP/HTTP endpoint of an OpenTelemetry collector spans of the command and its Vault requests are exported to, e.g. http://127.0.0.1:4318. Tracing is disabled when empty.")
+	annotateEnv(CLICmd.PersistentFlags(), "otel-endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT")
+
+	CLICmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	})
+}
+
+// groupRun is run by commands only grouping subcommands, e.g. role. It prints
+// the help of the given command and fails, so that a missing subcommand
+// neither passes unnoticed nor exits the shell.
+func groupRun(cmd *cobra.Command, args []string) error {
 	cmd.HelpFunc()(cmd, nil)
-	os.Exit(1)
+
+	return maskAnyf(invalidConfigError, "%s requires a subcommand", cmd.CommandPath())
+}
+
+// debugLogger returns a logger writing to stderr in case --debug is set and
+// discarding everything otherwise.
+func debugLogger() *log.Logger {
+	if newCLIFlags.Debug {
+		return log.New(os.Stderr, "debug: ", log.LstdFlags)
+	}
+
+	return log.New(ioutil.Discard, "", 0)
 }
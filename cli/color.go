@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"os"
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// ColorError colors the given error message red, in case colors are enabled
+// for stderr.
+func ColorError(s string) string {
+	return colorize(os.Stderr, colorRed, s)
+}
+
+// colorize wraps the given string into the given ANSI color, in case colors
+// are enabled for f. Colors are disabled by --no-color, by setting NO_COLOR
+// and in case f is not a terminal, e.g. when output is piped. JSON and other
+// machine readable output must never be colorized.
+func colorize(f *os.File, color, s string) string {
+	if !colorEnabled(f) {
+		return s
+	}
+
+	return color + s + colorReset
+}
+
+func colorEnabled(f *os.File) bool {
+	if newCLIFlags.NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	return isTerminal(f)
+}
+
+// isTerminal returns true in case f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
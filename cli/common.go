@@ -1,7 +1,13 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func fromEnv(key, def string) string {
@@ -13,3 +19,209 @@ func fromEnv(key, def string) string {
 
 	return value
 }
+
+// envErrors holds the errors of environment variables with malformed values,
+// keyed by variable. Flag defaults are read from the environment before flags
+// are parsed, so the errors are reported when validating the flags.
+var envErrors = map[string]error{}
+
+func fromEnvBool(key string, def bool) bool {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		envErrors[key] = maskAnyf(invalidConfigError, "environment variable '%s' must be a boolean, e.g. true or false, got '%s'", key, value)
+		return def
+	}
+
+	return b
+}
+
+// printWarning prints the given message prefixed as warning to stderr.
+func printWarning(f string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", colorize(os.Stderr, colorYellow, "Warning:"), fmt.Sprintf(f, v...))
+}
+
+// parseKeyValues parses flag values of the form key=value into a map. Keys and
+// values must not be empty. Values are never part of errors, because they may
+// be sensitive, e.g. in case of headers.
+func parseKeyValues(flag string, values []string) (map[string]string, error) {
+	m := map[string]string{}
+	for i, kv := range values {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, maskAnyf(invalidConfigError, "%s must be of the form key=value, got malformed value #%d", flag, i+1)
+		}
+		if strings.TrimSpace(parts[1]) == "" {
+			return nil, maskAnyf(invalidConfigError, "%s value of key '%s' must not be empty", flag, parts[0])
+		}
+		m[strings.TrimSpace(parts[0])] = parts[1]
+	}
+
+	return m, nil
+}
+
+// splitList splits a comma separated flag value into its trimmed, non-empty
+// items.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// printJSON writes the given value as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return maskAny(err)
+	}
+	fmt.Printf("%s\n", b)
+
+	return nil
+}
+
+// validateOutput checks the value of an --output flag.
+func validateOutput(output string) error {
+	switch output {
+	case "text", "json":
+		return nil
+	default:
+		return maskAnyf(invalidConfigError, "--output must be one of text or json")
+	}
+}
+
+// validateDuration checks that the value of the given duration flag is a
+// golang time string.
+func validateDuration(flag, value string) error {
+	// Plain numbers are easily mistaken for seconds or hours. Require a unit to
+	// make the intention explicit.
+	if _, err := strconv.Atoi(value); err == nil {
+		return maskAnyf(invalidConfigError, "%s must include a unit like %sh", flag, value)
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return maskAnyf(invalidConfigError, "%s must be a duration like 720h: %s", flag, err.Error())
+	}
+
+	return nil
+}
+
+// validateTTL checks that the value of the given TTL flag is either a golang
+// time string or an RFC3339 timestamp lying in the future.
+func validateTTL(flag, value string) error {
+	if _, err := time.Parse(time.RFC3339, value); err == nil {
+		_, err = resolveTTL(flag, value, time.Now())
+		return err
+	}
+
+	return validateDuration(flag, value)
+}
+
+// resolveTTL returns the given TTL as golang time string. An RFC3339 timestamp
+// is converted to the time remaining from now until then, so a certificate
+// issued now expires at the timestamp.
+func resolveTTL(flag, value string, now time.Time) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value, nil
+	}
+	ttl := t.Sub(now).Truncate(time.Second)
+	if ttl <= 0 {
+		return "", maskAnyf(invalidConfigError, "%s '%s' must lie in the future", flag, value)
+	}
+
+	return ttl.String(), nil
+}
+
+// durationWarning returns a warning in case the duration of the given flag is
+// shorter than min or longer than max. A zero bound is not checked. The
+// warning is empty in case the duration is plausible or invalid.
+func durationWarning(flag, value string, min, max time.Duration) string {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return ""
+	}
+
+	if min != 0 && d < min {
+		return fmt.Sprintf("%s of %s is shorter than %s", flag, value, formatDuration(min))
+	}
+	if max != 0 && d > max {
+		return fmt.Sprintf("%s of %s is longer than %s", flag, value, formatDuration(max))
+	}
+
+	return ""
+}
+
+// formatDuration formats the given duration omitting trailing zero units,
+// e.g. 24h instead of 24h0m0s.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+// confirmWarnings prints the given warnings. Unless yes is set, an invalid
+// config error is returned in case there are any warnings.
+func confirmWarnings(warnings []string, yes bool) error {
+	for _, w := range warnings {
+		printWarning("%s", w)
+	}
+	if len(warnings) > 0 && !yes {
+		return maskAnyf(invalidConfigError, "%d warning(s) found, use --yes to proceed anyway", len(warnings))
+	}
+
+	return nil
+}
+
+// validateDomains checks that the value of the given flag is a comma separated
+// list of domain names.
+func validateDomains(flag, value string) error {
+	for _, d := range strings.Split(value, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			return maskAnyf(invalidConfigError, "%s must not contain empty domains", flag)
+		}
+		if strings.ContainsAny(d, " \t/:") {
+			return maskAnyf(invalidConfigError, "%s contains invalid domain '%s'", flag, d)
+		}
+	}
+
+	return nil
+}
+
+// validateFD checks that the file descriptor of the given flag refers to an
+// open file other than stdin, stdout or stderr.
+func validateFD(flag string, fd int) error {
+	if fd <= 2 {
+		return maskAnyf(invalidConfigError, "%s must be greater than 2, stdin, stdout and stderr are not supported", flag)
+	}
+	if runtime.GOOS == "windows" {
+		return maskAnyf(invalidConfigError, "%s is not supported on Windows", flag)
+	}
+	if !isOpenFD(fd) {
+		return maskAnyf(invalidConfigError, "%s %d is not an open file descriptor", flag, fd)
+	}
+
+	return nil
+}
+
+// sinkWritesStdout returns true in case the sink of the given reference writes
+// to stdout.
+func sinkWritesStdout(ref string) bool {
+	return ref == "stdout" || ref == "env" || ref == "env:"
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration of certctl commands.",
+		RunE:  groupRun,
+	}
+
+	configCheckCmd = &cobra.Command{
+		Use:   "check <command> [flags]",
+		Short: "Validate the flags of a command without contacting Vault.",
+		Long: `Validate the flags of a command without contacting Vault. All problems are
+reported at once. The command exits non-zero if any validation fails, e.g.
+
+    certctl config check setup --cluster-id foo --common-name foo.example.com`,
+		RunE: configCheckRun,
+
+		// Flags are parsed by the checked command.
+		DisableFlagParsing: true,
+	}
+
+	// configValidators maps command paths, e.g. setup, to the validation of the
+	// command's flags. Commands register their validation in their init
+	// function.
+	configValidators = map[string]func() []error{}
+)
+
+func init() {
+	CLICmd.AddCommand(configCmd)
+	configCmd.AddCommand(configCheckCmd)
+}
+
+func configCheckRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" {
+		cmd.HelpFunc()(cmd, nil)
+
+		return maskAnyf(invalidConfigError, "config check requires a command, e.g. config check setup")
+	}
+
+	checkedCmd, flags, err := CLICmd.Find(args)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+	path := commandPath(checkedCmd)
+	validate, ok := configValidators[path]
+	if !ok {
+		return maskAnyf(invalidConfigError, "command '%s' has no configuration to check", strings.Join(args, " "))
+	}
+	err = checkedCmd.ParseFlags(flags)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+
+	errs := validate()
+	if len(errs) == 0 {
+		fmt.Printf("Configuration of '%s' is valid.\n", path)
+		return nil
+	}
+
+	fmt.Printf("Configuration of '%s' is invalid:\n", path)
+	fmt.Printf("\n")
+	for _, err := range errs {
+		fmt.Printf("    - %s\n", err.Error())
+	}
+	fmt.Printf("\n")
+
+	return maskAnyf(invalidConfigError, "configuration of '%s' is invalid", path)
+}
+
+// commandPath returns the path of the given command without the name of the
+// root command, e.g. setup.
+func commandPath(cmd *cobra.Command) string {
+	return strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), CLICmd.Name()), " ")
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// envAnnotation is the flag annotation naming the environment variable the
+	// default of a flag is read from.
+	envAnnotation = "certctl_env"
+
+	// secretAnnotation is the flag annotation marking flags whose values must
+	// never be shown.
+	secretAnnotation = "certctl_secret"
+)
+
+type configShowFlags struct {
+	// Output
+	Output string
+}
+
+// configShowValue is the resolved value of a single flag as shown by config
+// show.
+type configShowValue struct {
+	Flag   string `json:"flag"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+var (
+	configShowCmd = &cobra.Command{
+		Use:   "show [flags] <command> [command flags]",
+		Short: "Show the effective configuration of a command without contacting Vault.",
+		Long: `Show the effective configuration of a command without contacting Vault. For
+every flag of the command the resolved value is printed together with its
+source, which is one of flag, env or default. Values of secret flags, e.g.
+--vault-token, are redacted. Flags of config show must be given before the
+command, e.g.
+
+    certctl config show --output json setup --cluster-id foo`,
+		RunE: configShowRun,
+	}
+
+	newConfigShowFlags = &configShowFlags{}
+)
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+
+	// Everything following the shown command belongs to it.
+	configShowCmd.Flags().SetInterspersed(false)
+	configShowCmd.Flags().StringVar(&newConfigShowFlags.Output, "output", "text", "Output format of the configuration. One of text or json.")
+}
+
+// annotateEnv records the environment variable the default of the given flag
+// is read from, so config show can report it as source.
+func annotateEnv(flags *pflag.FlagSet, name, env string) {
+	flags.SetAnnotation(name, envAnnotation, []string{env})
+}
+
+// annotateSecret marks the given flag as secret, so config show redacts its
+// value.
+func annotateSecret(flags *pflag.FlagSet, name string) {
+	flags.SetAnnotation(name, secretAnnotation, []string{"true"})
+}
+
+func configShowRun(cmd *cobra.Command, args []string) error {
+	err := validateOutput(newConfigShowFlags.Output)
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(args) == 0 {
+		return maskAnyf(invalidConfigError, "command to show must be given")
+	}
+
+	shownCmd, flags, err := CLICmd.Find(args)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+	path := commandPath(shownCmd)
+	if _, ok := configValidators[path]; !ok {
+		return maskAnyf(invalidConfigError, "command '%s' has no configuration to show", strings.Join(args, " "))
+	}
+	err = shownCmd.ParseFlags(flags)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+
+	values := configShowValues(shownCmd.Flags())
+
+	if newConfigShowFlags.Output == "json" {
+		err = printJSON(values)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	width := 0
+	for _, v := range values {
+		if len(v.Flag) > width {
+			width = len(v.Flag)
+		}
+	}
+
+	fmt.Printf("Configuration of '%s':\n", path)
+	fmt.Printf("\n")
+	for _, v := range values {
+		value := v.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Printf("    --%-*s  %s (%s)\n", width, v.Flag, value, v.Source)
+	}
+	fmt.Printf("\n")
+
+	return nil
+}
+
+// configShowValues returns the resolved values of all given flags in
+// alphabetical order, along with their sources.
+func configShowValues(flags *pflag.FlagSet) []configShowValue {
+	var values []configShowValue
+
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+
+		v := configShowValue{
+			Flag:   f.Name,
+			Value:  f.Value.String(),
+			Source: "default",
+		}
+		if env := f.Annotations[envAnnotation]; len(env) == 1 && os.Getenv(env[0]) != "" {
+			v.Source = "env " + env[0]
+		}
+		if f.Changed {
+			v.Source = "flag"
+		}
+		if len(f.Annotations[secretAnnotation]) > 0 && v.Value != "" {
+			v.Value = "<redacted>"
+		}
+
+		values = append(values, v)
+	})
+
+	return values
+}
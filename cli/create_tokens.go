@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/giantswarm/certctl/service/certctl"
+	"github.com/giantswarm/certctl/service/secret-sink"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type createTokensFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Token
+	NumTokens     int
+	TokenTTL      string
+	TokenMaxTTL   string
+	TokenJitter   time.Duration
+	TokenPolicies string
+	TokenRole     string
+
+	// Output
+	Sink string
+
+	// flags is the flag set the flags are registered with, used to tell
+	// whether token flags were given explicitly.
+	flags *pflag.FlagSet
+}
+
+var (
+	createTokensCmd = &cobra.Command{
+		Use:   "create-tokens",
+		Short: "Create additional tokens for an already set up cluster.",
+		Long: `Create additional tokens for an already set up cluster, e.g. to top up its
+token pool. Existing tokens are not touched. The PKI role and policies of the
+cluster are only read, never created or changed. Tokens are created against
+the cluster's token role in case setup created one, and are attached to the
+cluster's PKI issue policy otherwise.
+
+Only the new tokens are written to --sink, one per line by default.`,
+		RunE: createTokensRun,
+	}
+
+	newCreateTokensFlags = &createTokensFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(createTokensCmd)
+	configValidators["create-tokens"] = func() []error { return createTokensValidate(newCreateTokensFlags) }
+
+	newCreateTokensFlags.register(createTokensCmd.Flags())
+}
+
+// register registers the flags of creating tokens for an already set up
+// cluster, shared by create-tokens and rotate-tokens.
+func (f *createTokensFlags) register(flags *pflag.FlagSet) {
+	f.flags = flags
+	f.Vault.register(flags)
+
+	flags.StringVar(&f.ClusterID, "cluster-id", "", "Cluster ID the tokens are created for.")
+
+	flags.IntVar(&f.NumTokens, "num", 1, "Number of tokens to create.")
+	flags.StringVar(&f.TokenTTL, "token-ttl", "720h", "TTL used to create the tokens. Defaults to the TTL of the cluster's existing tokens, if any.")
+	flags.StringVar(&f.TokenMaxTTL, "token-max-ttl", "", "Explicit max TTL the tokens can be renewed up to. Must not be shorter than --token-ttl. Defaults to the one of the cluster's existing tokens or token role, and to the max TTL configured in Vault otherwise.")
+	flags.DurationVar(&f.TokenJitter, "ttl-jitter", 0, "Window each token's TTL is randomly shortened within, e.g. 24h, so expiries of many tokens spread out. Must be shorter than --token-ttl. Zero disables jitter.")
+	flags.StringVar(&f.TokenPolicies, "token-policies", "", "Comma separated existing policies attached to the tokens. Defaults to the policies of the cluster's existing tokens or token role, and to the cluster's PKI issue policy otherwise.")
+	flags.StringVar(&f.TokenRole, "token-role", "", "Existing token role the tokens are created against. Defaults to the cluster's token role, if any.")
+
+	flags.StringVar(&f.Sink, "sink", "stdout", "Sink the new tokens are written to. One of stdout, file:<path>, fd:<n>, env[:<path>], k8s:<namespace>/<name> or systemd-creds:<dir>. File, Kubernetes and systemd credentials sinks only hold the new tokens afterwards.")
+}
+
+func createTokensValidate(newCreateTokensFlags *createTokensFlags) []error {
+	var errs []error
+
+	errs = append(errs, newCreateTokensFlags.Vault.validate()...)
+	if newCreateTokensFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newCreateTokensFlags.NumTokens < 1 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--num must be at least 1"))
+	}
+	if err := validateDuration("--token-ttl", newCreateTokensFlags.TokenTTL); err != nil {
+		errs = append(errs, err)
+	}
+	if newCreateTokensFlags.TokenMaxTTL != "" {
+		if err := validateDuration("--token-max-ttl", newCreateTokensFlags.TokenMaxTTL); err != nil {
+			errs = append(errs, err)
+		} else if ttl, err := time.ParseDuration(newCreateTokensFlags.TokenTTL); err == nil {
+			if maxTTL, _ := time.ParseDuration(newCreateTokensFlags.TokenMaxTTL); maxTTL < ttl {
+				errs = append(errs, maskAnyf(invalidConfigError, "--token-max-ttl must not be shorter than --token-ttl"))
+			}
+		}
+	}
+	if newCreateTokensFlags.TokenJitter != 0 {
+		if ttl, err := time.ParseDuration(newCreateTokensFlags.TokenTTL); err == nil && (newCreateTokensFlags.TokenJitter < 0 || newCreateTokensFlags.TokenJitter >= ttl) {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ttl-jitter must not be negative and must be shorter than --token-ttl"))
+		}
+	}
+	if _, _, err := secretsink.ParseRef(newCreateTokensFlags.Sink); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func createTokensRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(createTokensValidate(newCreateTokensFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Open the sink before touching Vault, so misconfigured sinks fail early.
+	sink, err := secretsink.Open(newCreateTokensFlags.Sink)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newCreateTokensFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a certctl service to create the tokens for the set up cluster.
+	var certctlService certctl.Service
+	{
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = newVaultClient
+		certctlConfig.SharedMount = newCreateTokensFlags.Vault.sharedMount()
+		certctlService, err = certctl.NewService(certctlConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	tokenResult, err := createClusterTokens(newCreateTokensFlags, certctlService)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = sink.WriteTokens(newCreateTokensFlags.ClusterID, tokenResult.IDs())
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// createClusterTokens creates the tokens configured by the given flags for an
+// already set up cluster. The PKI role and policies of the cluster are only
+// read. Tokens created before a failure are reported using
+// printPartialTokens.
+func createClusterTokens(newCreateTokensFlags *createTokensFlags, certctlService certctl.Service) (token.CreateResult, error) {
+	tokenService := certctlService.Token()
+
+	// New tokens are created like the existing tokens of the cluster, unless
+	// flags are given explicitly. The given flags are not modified, so they
+	// can be used again.
+	conventionFlags := *newCreateTokensFlags
+	newCreateTokensFlags = &conventionFlags
+	err := applyTokenConvention(newCreateTokensFlags, tokenService)
+	if err != nil {
+		return token.CreateResult{}, maskAny(err)
+	}
+
+	roleName := newCreateTokensFlags.TokenRole
+	if roleName == "" {
+		roleName, err = certctlService.ClusterTokenRole(newCreateTokensFlags.ClusterID)
+		if err != nil {
+			return token.CreateResult{}, maskAny(err)
+		}
+	}
+
+	createConfig := token.CreateConfig{
+		ClusterID: newCreateTokensFlags.ClusterID,
+		Num:       newCreateTokensFlags.NumTokens,
+		Policies:  splitList(newCreateTokensFlags.TokenPolicies),
+		TTL:       newCreateTokensFlags.TokenTTL,
+		MaxTTL:    newCreateTokensFlags.TokenMaxTTL,
+		TTLJitter: newCreateTokensFlags.TokenJitter,
+	}
+
+	// Token TTLs are silently capped by Vault, so the effective max TTL is
+	// looked up to make capping explicit.
+	maxTTL, err := tokenService.MaxTTL(roleName)
+	if err != nil {
+		return token.CreateResult{}, maskAny(err)
+	}
+	createConfig.TTL = capTokenTTL("--token-ttl", createConfig.TTL, maxTTL)
+	if createConfig.MaxTTL != "" {
+		createConfig.MaxTTL = capTokenTTL("--token-max-ttl", createConfig.MaxTTL, maxTTL)
+	}
+
+	// The PKI role and policies of the cluster are checked to exist by the
+	// certctl service.
+	createTokensConfig := certctl.CreateTokensConfig{
+		Tokens:    createConfig,
+		TokenRole: roleName,
+	}
+	tokenResult, err := certctlService.CreateTokens(createTokensConfig)
+	if err != nil {
+		printPartialTokens(tokenResult)
+		return token.CreateResult{}, maskAny(err)
+	}
+	for _, w := range tokenResult.Warnings {
+		printWarning("Vault: %s", w)
+	}
+
+	return tokenResult, nil
+}
+
+// applyTokenConvention sets the TTL, max TTL and policies of the given flags to
+// the ones the existing tokens of the cluster are created with, as far as they
+// are not given explicitly and a convention is discoverable. The applied
+// settings are reported on stderr.
+func applyTokenConvention(f *createTokensFlags, tokenService token.Service) error {
+	changed := func(name string) bool {
+		return f.flags != nil && f.flags.Changed(name)
+	}
+	if changed("token-ttl") && changed("token-max-ttl") && changed("token-policies") {
+		return nil
+	}
+
+	convention, ok, err := tokenService.ReadConvention(f.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	for _, w := range convention.Warnings {
+		printWarning("token convention: %s", w)
+	}
+	if !ok {
+		return nil
+	}
+
+	var applied []string
+	if !changed("token-ttl") && convention.TTL > 0 {
+		f.TokenTTL = convention.TTL.String()
+		applied = append(applied, "TTL "+formatDuration(convention.TTL))
+	}
+	// The max TTL must not be shorter than the TTL, which may be given
+	// explicitly.
+	if ttl, err := time.ParseDuration(f.TokenTTL); err == nil && !changed("token-max-ttl") && convention.MaxTTL >= ttl {
+		f.TokenMaxTTL = convention.MaxTTL.String()
+		applied = append(applied, "max TTL "+formatDuration(convention.MaxTTL))
+	}
+	if !changed("token-policies") && len(convention.Policies) > 0 {
+		f.TokenPolicies = strings.Join(convention.Policies, ",")
+		applied = append(applied, "policies "+f.TokenPolicies)
+	}
+	if len(applied) > 0 {
+		fmt.Fprintf(os.Stderr, "Using %s of %s.\n", strings.Join(applied, ", "), convention.Source)
+	}
+
+	return nil
+}
+
+// printPartialTokens reports the tokens created before creating further tokens
+// failed. They exist in Vault but are not written anywhere, so their accessors
+// are printed to revoke them.
+func printPartialTokens(tokenResult token.CreateResult) {
+	if len(tokenResult.Tokens) == 0 {
+		return
+	}
+
+	printWarning("%d token(s) were created before the failure and are not written anywhere. Revoke them using their accessors, e.g. 'vault token revoke -accessor <accessor>':", len(tokenResult.Tokens))
+	for _, t := range tokenResult.Tokens {
+		fmt.Fprintf(os.Stderr, "    %s\n", t.Accessor)
+	}
+}
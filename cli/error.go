@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/juju/errgo"
 )
@@ -28,3 +29,81 @@ var invalidConfigError = errgo.New("invalid config")
 func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
+
+// joinErrors combines the given validation errors into a single invalid config
+// error listing every problem. It returns nil in case there are no errors.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for _, err := range errs {
+		problems = append(problems, "    - "+strings.TrimPrefix(err.Error(), invalidConfigError.Error()+": "))
+	}
+
+	return maskAnyf(invalidConfigError, "%d problem(s) found:\n%s", len(errs), strings.Join(problems, "\n"))
+}
+
+var caExpiredError = errgo.New("CA expired")
+
+// IsCAExpired asserts caExpiredError.
+func IsCAExpired(err error) bool {
+	return errgo.Cause(err) == caExpiredError
+}
+
+var invalidCertificateError = errgo.New("invalid certificate")
+
+// IsInvalidCertificate asserts invalidCertificateError.
+func IsInvalidCertificate(err error) bool {
+	return errgo.Cause(err) == invalidCertificateError
+}
+
+var batchFailedError = errgo.New("batch failed")
+
+// IsBatchFailed asserts batchFailedError.
+func IsBatchFailed(err error) bool {
+	return errgo.Cause(err) == batchFailedError
+}
+
+var invalidCSRError = errgo.New("invalid CSR")
+
+// IsInvalidCSR asserts invalidCSRError.
+func IsInvalidCSR(err error) bool {
+	return errgo.Cause(err) == invalidCSRError
+}
+
+var driftDetectedError = errgo.New("drift detected")
+
+// IsDriftDetected asserts driftDetectedError.
+func IsDriftDetected(err error) bool {
+	return errgo.Cause(err) == driftDetectedError
+}
+
+var certsExpiringError = errgo.New("certs expiring")
+
+// IsCertsExpiring asserts certsExpiringError.
+func IsCertsExpiring(err error) bool {
+	return errgo.Cause(err) == certsExpiringError
+}
+
+var clockSkewError = errgo.New("clock skew")
+
+// IsClockSkew asserts clockSkewError.
+func IsClockSkew(err error) bool {
+	return errgo.Cause(err) == clockSkewError
+}
+
+var notSetUpError = errgo.New("not set up")
+
+// IsNotSetUp asserts notSetUpError.
+func IsNotSetUp(err error) bool {
+	return errgo.Cause(err) == notSetUpError
+}
+
+var applyCancelledError = errgo.New("apply cancelled")
+
+// IsApplyCancelled asserts applyCancelledError.
+func IsApplyCancelled(err error) bool {
+	return errgo.Cause(err) == applyCancelledError
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errgo"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/certctl"
+	"github.com/giantswarm/certctl/service/health"
+	"github.com/giantswarm/certctl/service/k8s-secret"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/state"
+	"github.com/giantswarm/certctl/service/token"
+	"github.com/giantswarm/certctl/service/vault-factory"
+)
+
+// Exit codes returned by certctl. Automation can rely on them to distinguish
+// failure categories.
+//
+//	0  success
+//	1  unexpected error
+//	2  invalid config, e.g. missing or malformed flags
+//	3  Vault rejected the request due to missing authentication or permissions
+//	4  Vault could not be reached
+//	5  a requested resource was not found
+//	6  the live state drifted from the desired state
+//	7  certificates expire within the checked window
+//	8  the local clock deviates from Vault's more than allowed
+const (
+	ExitSuccess       = 0
+	ExitUnexpected    = 1
+	ExitInvalidConfig = 2
+	ExitPermission    = 3
+	ExitConnectivity  = 4
+	ExitNotFound      = 5
+	ExitDrift         = 6
+	ExitExpiring      = 7
+	ExitClockSkew     = 8
+)
+
+var vaultStatusCodeExpr = regexp.MustCompile(`Code: (\d+)\.`)
+
+// ExitCode returns the exit code certctl terminates with in case the given
+// error is returned by a command.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	switch {
+	case isInvalidConfig(err):
+		return ExitInvalidConfig
+	case isPermissionDenied(err):
+		return ExitPermission
+	case isConnectivity(err):
+		return ExitConnectivity
+	case isNotFound(err):
+		return ExitNotFound
+	case IsDriftDetected(err):
+		return ExitDrift
+	case IsCertsExpiring(err):
+		return ExitExpiring
+	case IsClockSkew(err):
+		return ExitClockSkew
+	}
+
+	return ExitUnexpected
+}
+
+func isInvalidConfig(err error) bool {
+	return IsInvalidConfig(err) ||
+		IsInvalidCSR(err) ||
+		certsigner.IsInvalidConfig(err) ||
+		certctl.IsInvalidConfig(err) ||
+		k8ssecret.IsInvalidConfig(err) ||
+		pki.IsInvalidCABundle(err) ||
+		pki.IsInvalidConfig(err) ||
+		state.IsInvalidConfig(err) ||
+		token.IsInvalidConfig(err) ||
+		vaultfactory.IsInvalidConfig(err)
+}
+
+func isPermissionDenied(err error) bool {
+	switch vaultStatusCode(err) {
+	case 401, 403:
+		return true
+	}
+
+	return false
+}
+
+func isConnectivity(err error) bool {
+	if vaultfactory.IsNoReachableAddress(err) || health.IsVaultSealed(err) || health.IsMaintenance(err) || health.IsWaitTimeout(err) {
+		return true
+	}
+
+	switch errgo.Cause(err).(type) {
+	case *url.Error, net.Error:
+		return true
+	}
+
+	return false
+}
+
+func isNotFound(err error) bool {
+	return IsNotSetUp(err) ||
+		certctl.IsNotSetUp(err) ||
+		certsigner.IsKeyPairNotFound(err) ||
+		k8ssecret.IsSecretNotFound(err) ||
+		pki.IsCANotFound(err) ||
+		pki.IsCertNotFound(err) ||
+		pki.IsKeyNotFound(err) ||
+		pki.IsRoleNotFound(err) ||
+		token.IsRoleNotFound(err) ||
+		vaultStatusCode(err) == 404
+}
+
+// vaultStatusCode extracts the HTTP status code from errors returned by the
+// Vault client. This is a dirty string matching due to the poor error
+// handling design of the Vault library we are using. It returns 0 in case err
+// does not carry a status code.
+func vaultStatusCode(err error) int {
+	cause := errgo.Cause(err)
+	if cause == nil || !strings.Contains(cause.Error(), "Error making API request") {
+		return 0
+	}
+
+	matches := vaultStatusCodeExpr.FindStringSubmatch(cause.Error())
+	if matches == nil {
+		return 0
+	}
+	code, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0
+	}
+
+	return code
+}
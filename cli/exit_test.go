@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func Test_ExitCode(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Err      error
+		Expected int
+	}{
+		{
+			Name:     "no error",
+			Err:      nil,
+			Expected: ExitSuccess,
+		},
+		{
+			Name:     "unknown error",
+			Err:      errors.New("something went wrong"),
+			Expected: ExitUnexpected,
+		},
+		{
+			Name:     "invalid config",
+			Err:      maskAnyf(invalidConfigError, "--cluster-id must not be empty"),
+			Expected: ExitInvalidConfig,
+		},
+		{
+			Name:     "invalid CSR",
+			Err:      maskAnyf(invalidCSRError, "CSR is malformed"),
+			Expected: ExitInvalidConfig,
+		},
+		{
+			Name:     "Vault permission denied",
+			Err:      maskAny(errors.New("Error making API request.\n\nURL: GET http://127.0.0.1:8200/v1/pki-123/cert/ca\nCode: 403. Errors:\n\n* permission denied")),
+			Expected: ExitPermission,
+		},
+		{
+			Name:     "Vault missing authentication",
+			Err:      maskAny(errors.New("Error making API request.\n\nURL: GET http://127.0.0.1:8200/v1/pki-123/cert/ca\nCode: 401. Errors:\n\n* missing client token")),
+			Expected: ExitPermission,
+		},
+		{
+			Name:     "Vault not reachable",
+			Err:      maskAny(&url.Error{Op: "Get", URL: "http://127.0.0.1:8200/v1/sys/health", Err: errors.New("connection refused")}),
+			Expected: ExitConnectivity,
+		},
+		{
+			Name:     "cluster not set up",
+			Err:      maskAnyf(notSetUpError, "cluster ID '123' has no PKI role"),
+			Expected: ExitNotFound,
+		},
+		{
+			Name:     "Vault resource not found",
+			Err:      maskAny(errors.New("Error making API request.\n\nURL: GET http://127.0.0.1:8200/v1/pki-123/roles/role-123\nCode: 404. Errors:")),
+			Expected: ExitNotFound,
+		},
+		{
+			Name:     "drift detected",
+			Err:      maskAnyf(driftDetectedError, "PKI role of cluster ID '123' drifted"),
+			Expected: ExitDrift,
+		},
+		{
+			Name:     "certs expiring",
+			Err:      maskAnyf(certsExpiringError, "1 certificate(s) expiring"),
+			Expected: ExitExpiring,
+		},
+		{
+			Name:     "clock skew",
+			Err:      maskAnyf(clockSkewError, "local clock is 1m0s behind Vault"),
+			Expected: ExitClockSkew,
+		},
+		{
+			Name:     "Vault internal error",
+			Err:      maskAny(errors.New("Error making API request.\n\nURL: GET http://127.0.0.1:8200/v1/pki-123/cert/ca\nCode: 500. Errors:")),
+			Expected: ExitUnexpected,
+		},
+	}
+
+	for _, tc := range testCases {
+		code := ExitCode(tc.Err)
+		if code != tc.Expected {
+			t.Fatalf("%s: expected exit code %d, got %d", tc.Name, tc.Expected, code)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type expiringFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Window
+	Within string
+
+	// Output
+	Output string
+}
+
+// expiringCert is a single certificate printed by expiring.
+type expiringCert struct {
+	Serial        string `json:"serial_number"`
+	CommonName    string `json:"common_name"`
+	NotAfter      string `json:"not_after"`
+	DaysRemaining int    `json:"days_remaining"`
+	CA            bool   `json:"ca,omitempty"`
+}
+
+// expiringResult is the machine readable report printed by expiring when using
+// --output json.
+type expiringResult struct {
+	ClusterID string         `json:"cluster_id"`
+	Within    string         `json:"within"`
+	Certs     []expiringCert `json:"certs"`
+}
+
+var (
+	expiringCmd = &cobra.Command{
+		Use:   "expiring",
+		Short: "List the certificates of a specific cluster expiring soon.",
+		Long: `List the certificates of a specific cluster expiring within the window given by
+--within, sorted by the soonest expiry. All certificates stored by the PKI
+backend are read, including its CAs and certificates expired already. Revoked
+certificates are skipped. Certificates issued with no_store enabled are not
+stored by Vault and therefore not checked.
+
+The command exits with code 7 in case any certificate expires within the
+window, so it can be used as alert, e.g. by a cron job.`,
+		RunE: expiringRun,
+	}
+
+	newExpiringFlags = &expiringFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(expiringCmd)
+	configValidators["expiring"] = func() []error { return expiringValidate(newExpiringFlags) }
+
+	newExpiringFlags.Vault.register(expiringCmd.Flags())
+
+	expiringCmd.Flags().StringVar(&newExpiringFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend whose certificates are checked.")
+
+	expiringCmd.Flags().StringVar(&newExpiringFlags.Within, "within", "720h", "Window certificates expiring within are reported.")
+
+	expiringCmd.Flags().StringVar(&newExpiringFlags.Output, "output", "text", "Output format of the report. One of text or json.")
+}
+
+func expiringValidate(newExpiringFlags *expiringFlags) []error {
+	var errs []error
+
+	errs = append(errs, newExpiringFlags.Vault.validate()...)
+	if newExpiringFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if err := validateDuration("--within", newExpiringFlags.Within); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateOutput(newExpiringFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func expiringRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(expiringValidate(newExpiringFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+	within, err := time.ParseDuration(newExpiringFlags.Within)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newExpiringFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to read the certificates.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newExpiringFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	serials, err := pkiService.ListCerts(newExpiringFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	now := time.Now()
+	result := expiringResult{
+		ClusterID: newExpiringFlags.ClusterID,
+		Within:    newExpiringFlags.Within,
+		Certs:     []expiringCert{},
+	}
+	for _, serial := range serials {
+		cert, err := pkiService.GetCert(newExpiringFlags.ClusterID, serial)
+		if err != nil {
+			return maskAny(err)
+		}
+		crt := cert.Certificate
+		if cert.Revoked || crt.NotAfter.After(now.Add(within)) {
+			continue
+		}
+		result.Certs = append(result.Certs, expiringCert{
+			Serial:        cert.Serial,
+			CommonName:    crt.Subject.CommonName,
+			NotAfter:      crt.NotAfter.UTC().Format(time.RFC3339),
+			DaysRemaining: int(crt.NotAfter.Sub(now) / (24 * time.Hour)),
+			CA:            crt.IsCA,
+		})
+	}
+	// RFC3339 timestamps in UTC sort chronologically.
+	sort.SliceStable(result.Certs, func(i, j int) bool { return result.Certs[i].NotAfter < result.Certs[j].NotAfter })
+
+	if newExpiringFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+	} else if len(result.Certs) == 0 {
+		fmt.Printf("No certificates of cluster ID '%s' expire within %s.\n", result.ClusterID, result.Within)
+	} else {
+		fmt.Printf("Found %d certificate(s) of cluster ID '%s' expiring within %s:\n", len(result.Certs), result.ClusterID, result.Within)
+		fmt.Printf("\n")
+		for _, c := range result.Certs {
+			fmt.Printf("    %s: %s, %s\n", c.Serial, formatExpiringCert(c), formatDaysRemaining(c.DaysRemaining))
+		}
+		fmt.Printf("\n")
+	}
+
+	if len(result.Certs) > 0 {
+		return maskAnyf(certsExpiringError, "%d certificate(s) of cluster ID '%s' expire within %s", len(result.Certs), result.ClusterID, result.Within)
+	}
+
+	return nil
+}
+
+// formatExpiringCert describes the given certificate by its common name,
+// marking CAs.
+func formatExpiringCert(c expiringCert) string {
+	name := c.CommonName
+	if name == "" {
+		name = "no common name"
+	}
+	if c.CA {
+		name += " (CA)"
+	}
+
+	return name
+}
+
+// formatDaysRemaining describes the number of days until a certificate
+// expires.
+func formatDaysRemaining(days int) string {
+	switch {
+	case days < 0:
+		return fmt.Sprintf("expired %d day(s) ago", -days)
+	case days == 0:
+		return "expires today"
+	}
+
+	return fmt.Sprintf("expires in %d day(s)", days)
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/state"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type exportFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Spec
+	File   string
+	Format string
+}
+
+var (
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the PKI setup of a cluster as spec file for the apply command.",
+		Long: `Export the PKI setup of a cluster as spec file for the apply command. The
+subject of the root CA, the tuning of the PKI backend, the configuration of the
+PKI role and the rules of the PKI issue policy are read from Vault. Policy
+rules are only exported in case they differ from the ones certctl generates,
+and the tuning is not exported using a shared PKI backend. Secrets, like the
+private key of the root CA and tokens, are not exported. Applying the spec for another cluster ID clones the PKI setup, e.g.
+to a new environment.
+
+The spec is written as YAML document, unless --format hcl is given or --file
+does not end in .yaml or .yml. The exported spec is checked to round-trip before it is written, i.e. a dry
+run of applying it against the exported cluster shows no PKI changes.`,
+		RunE: exportRun,
+	}
+
+	newExportFlags = &exportFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(exportCmd)
+	configValidators["export"] = func() []error { return exportValidate(newExportFlags) }
+
+	newExportFlags.Vault.register(exportCmd.Flags())
+
+	exportCmd.Flags().StringVar(&newExportFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI setup being exported.")
+
+	exportCmd.Flags().StringVarP(&newExportFlags.File, "file", "f", "", "File the spec is written to. Defaults to printing it to stdout.")
+	exportCmd.Flags().StringVar(&newExportFlags.Format, "format", "", "Format of the spec. One of yaml or hcl. Defaults to the format given by the extension of --file, or yaml.")
+}
+
+func exportValidate(newExportFlags *exportFlags) []error {
+	var errs []error
+
+	errs = append(errs, newExportFlags.Vault.validate()...)
+	if newExportFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	switch newExportFlags.Format {
+	case "", specFormatYAML, specFormatHCL:
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--format must be one of %s or %s", specFormatYAML, specFormatHCL))
+	}
+
+	return errs
+}
+
+func exportRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(exportValidate(newExportFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newExportFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to read the PKI backend specific resources.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newExportFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a token generator needed to plan the policy of the cluster.
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = tracer
+		tokenConfig.VaultClient = newVaultClient
+		tokenConfig.SharedMount = newExportFlags.Vault.sharedMount()
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a state service to export the cluster.
+	var stateService state.Service
+	{
+		stateConfig := state.DefaultServiceConfig()
+		stateConfig.PKIService = pkiService
+		stateConfig.TokenService = tokenService
+		stateConfig.SharedMount = newExportFlags.Vault.sharedMount()
+		stateService, err = state.NewService(stateConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	clusterSpec, err := stateService.Export(newExportFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	spec := state.Spec{Clusters: []state.ClusterSpec{clusterSpec}}
+
+	// Make sure applying the spec as it is read back does not change the
+	// exported cluster. Clusters set up without PKI issue policy get one when
+	// the spec is applied, so that is ignored.
+	var b []byte
+	var parsed state.Spec
+	if exportFormat(newExportFlags) == specFormatYAML {
+		b, err = state.FormatYAML(spec)
+		if err != nil {
+			return maskAny(err)
+		}
+		parsed, err = state.ParseYAML(b)
+	} else {
+		b = state.Format(spec)
+		parsed, err = state.Parse(b)
+	}
+	if err != nil {
+		return maskAny(err)
+	}
+	plan, err := stateService.Plan(parsed)
+	if err != nil {
+		return maskAny(err)
+	}
+	for _, a := range plan.Actions {
+		if a.Resource == state.ResourcePolicy && a.Type == state.ActionCreate {
+			continue
+		}
+		printPlan(plan)
+		return maskAnyf(invalidConfigError, "exported spec of cluster ID '%s' does not round-trip, applying it would %s the %s", newExportFlags.ClusterID, a.Type, a.Resource)
+	}
+
+	if newExportFlags.File == "" {
+		fmt.Printf("%s", b)
+		return nil
+	}
+
+	err = writeOutputFile(newExportFlags.File, b, os.FileMode(0644))
+	if err != nil {
+		return maskAny(err)
+	}
+	fmt.Printf("Spec of cluster ID '%s' written to '%s'.\n", newExportFlags.ClusterID, newExportFlags.File)
+
+	return nil
+}
+
+const (
+	// specFormatYAML writes spec files as YAML documents.
+	specFormatYAML = "yaml"
+	// specFormatHCL writes spec files as HCL documents.
+	specFormatHCL = "hcl"
+)
+
+// exportFormat returns the format the spec is exported in, which is given by
+// --format or the extension of --file.
+func exportFormat(newExportFlags *exportFlags) string {
+	switch {
+	case newExportFlags.Format != "":
+		return newExportFlags.Format
+	case newExportFlags.File != "" && !state.IsYAMLFile(newExportFlags.File):
+		return specFormatHCL
+	}
+
+	return specFormatYAML
+}
@@ -0,0 +1,7 @@
+package cli
+
+// isOpenFD checks whether the given file descriptor is open. Windows has no
+// file descriptors handed down to child processes, so there are none.
+func isOpenFD(fd int) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/giantswarm/certctl/service/atomic-file"
+)
+
+// writeOutputFile replaces the file at the given path atomically with the
+// given data, creating its directory if necessary. See atomicfile.Write.
+func writeOutputFile(path string, data []byte, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), os.FileMode(0744))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = atomicfile.WriteFile(path, data, mode)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
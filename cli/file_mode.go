@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/spf13/pflag"
+)
+
+// fileModeFlags are the flags shared by all commands writing certificates or
+// private keys to files. Modes are given as octal values like chmod takes
+// them.
+type fileModeFlags struct {
+	KeyMode  string
+	CertMode string
+}
+
+// register defines the mode flags with the given flag set. The key mode flag
+// is only defined in case the command writes private keys.
+func (f *fileModeFlags) register(flags *pflag.FlagSet, keys bool) {
+	if keys {
+		flags.StringVar(&f.KeyMode, "key-mode", "0600", "Octal permissions private key files are written with.")
+	}
+	flags.StringVar(&f.CertMode, "cert-mode", "0644", "Octal permissions certificate and CA files are written with.")
+}
+
+func (f *fileModeFlags) validate() []error {
+	var errs []error
+
+	if f.KeyMode != "" {
+		if _, err := parseFileMode("--key-mode", f.KeyMode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := parseFileMode("--cert-mode", f.CertMode); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// warnings returns warnings about modes which are valid but likely not safe.
+func (f *fileModeFlags) warnings() []string {
+	var warnings []string
+
+	if f.KeyMode != "" && f.keyMode()&0044 != 0 {
+		warnings = append(warnings, "--key-mode "+f.KeyMode+" makes private keys readable by group or others")
+	}
+
+	return warnings
+}
+
+// keyMode returns the mode private key files are written with.
+func (f *fileModeFlags) keyMode() os.FileMode {
+	mode, err := parseFileMode("--key-mode", f.KeyMode)
+	if err != nil {
+		return os.FileMode(0600)
+	}
+
+	return mode
+}
+
+// certMode returns the mode certificate and CA files are written with.
+func (f *fileModeFlags) certMode() os.FileMode {
+	mode, err := parseFileMode("--cert-mode", f.CertMode)
+	if err != nil {
+		return os.FileMode(0644)
+	}
+
+	return mode
+}
+
+// parseFileMode parses the octal file mode given by the flag of the given
+// name. Only permission bits are allowed, and the owner must be able to read
+// the file.
+func parseFileMode(flag, value string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, maskAnyf(invalidConfigError, "%s must be an octal mode like 0600", flag)
+	}
+	if m > 0777 {
+		return 0, maskAnyf(invalidConfigError, "%s must only hold permission bits, i.e. not exceed 0777", flag)
+	}
+	if m&0400 == 0 {
+		return 0, maskAnyf(invalidConfigError, "%s must allow the owner to read the file", flag)
+	}
+
+	return os.FileMode(m), nil
+}
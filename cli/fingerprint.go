@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type fingerprintFlags struct {
+	// Certificate
+	CertFile string
+
+	// Output
+	SPKIFingerprint bool
+	Output          string
+}
+
+// fingerprintResult is the machine readable result printed by fingerprint
+// when using --output json.
+type fingerprintResult struct {
+	CertFile     string           `json:"cert_file"`
+	SerialNumber string           `json:"serial_number"`
+	Fingerprints pki.Fingerprints `json:"fingerprints"`
+}
+
+var (
+	fingerprintCmd = &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Print the fingerprints of a certificate.",
+		Long: `Print the fingerprints of a certificate. The SHA-1 and SHA-256 fingerprints
+are formatted as colon separated upper case hex bytes, the same way openssl
+prints them. The public key hash given by --spki-fingerprint is base64 encoded,
+as used for public key pinning. The certificate may be PEM or DER encoded. In
+case of PEM, the first certificate is used. Vault is not contacted.`,
+		RunE: fingerprintRun,
+	}
+
+	newFingerprintFlags = &fingerprintFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(fingerprintCmd)
+	configValidators["fingerprint"] = func() []error { return fingerprintValidate(newFingerprintFlags) }
+
+	fingerprintCmd.Flags().StringVar(&newFingerprintFlags.CertFile, "cert-file", "", "File path of the certificate to print the fingerprints of.")
+
+	fingerprintCmd.Flags().BoolVar(&newFingerprintFlags.SPKIFingerprint, "spki-fingerprint", false, "Print the SHA-256 hash of the certificate's public key in addition. (Default false)")
+	fingerprintCmd.Flags().StringVar(&newFingerprintFlags.Output, "output", "text", "Output format of the fingerprints. One of text or json.")
+}
+
+func fingerprintValidate(newFingerprintFlags *fingerprintFlags) []error {
+	var errs []error
+
+	if newFingerprintFlags.CertFile == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cert-file must not be empty"))
+	}
+	if err := validateOutput(newFingerprintFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func fingerprintRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(fingerprintValidate(newFingerprintFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	b, err := ioutil.ReadFile(newFingerprintFlags.CertFile)
+	if err != nil {
+		return maskAny(err)
+	}
+	crt, err := parseCertificateData(b)
+	if err != nil {
+		return maskAnyf(invalidCertificateError, "--cert-file '%s': %s", newFingerprintFlags.CertFile, strings.TrimPrefix(err.Error(), invalidCertificateError.Error()+": "))
+	}
+
+	result := fingerprintResult{
+		CertFile:     newFingerprintFlags.CertFile,
+		SerialNumber: pki.FormatSerialNumber(crt.SerialNumber),
+		Fingerprints: pki.ComputeFingerprints(crt, newFingerprintFlags.SPKIFingerprint),
+	}
+	if newFingerprintFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Fingerprints of certificate with serial number '%s':\n", result.SerialNumber)
+	fmt.Printf("\n")
+	printFingerprints(result.Fingerprints)
+	fmt.Printf("\n")
+
+	return nil
+}
+
+// parseCertificateData parses the first certificate of the given PEM data. In
+// case the data is not PEM encoded it is parsed as DER.
+func parseCertificateData(b []byte) (*x509.Certificate, error) {
+	rest := b
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+			return crt, nil
+		}
+	}
+	if len(rest) != len(b) {
+		return nil, maskAnyf(invalidCertificateError, "PEM data holds no certificate")
+	}
+
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return crt, nil
+}
+
+// printFingerprints prints the given fingerprints indented, one per line.
+func printFingerprints(fingerprints pki.Fingerprints) {
+	fmt.Printf("    SHA-1:        %s\n", fingerprints.SHA1)
+	fmt.Printf("    SHA-256:      %s\n", fingerprints.SHA256)
+	if fingerprints.SPKISHA256 != "" {
+		fmt.Printf("    SPKI SHA-256: %s\n", fingerprints.SPKISHA256)
+	}
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// stringArrayValue is a pflag.Value collecting every value of a flag given
+// multiple times, like pflag's string array flags. In contrast to them it can
+// be reset, so flags can be parsed multiple times within a single process,
+// e.g. by the shell command.
+type stringArrayValue struct {
+	value   *[]string
+	changed bool
+}
+
+// stringArrayVar defines a string array flag with the given name and usage
+// storing its values in p. The default is empty.
+func stringArrayVar(flags *pflag.FlagSet, p *[]string, name, usage string) {
+	*p = nil
+	flags.Var(&stringArrayValue{value: p}, name, usage)
+}
+
+func (s *stringArrayValue) Set(val string) error {
+	if !s.changed {
+		*s.value = []string{val}
+		s.changed = true
+	} else {
+		*s.value = append(*s.value, val)
+	}
+
+	return nil
+}
+
+func (s *stringArrayValue) Type() string {
+	return "stringArray"
+}
+
+func (s *stringArrayValue) String() string {
+	// Empty values are shown as empty string, so help output omits the
+	// default.
+	if len(*s.value) == 0 {
+		return ""
+	}
+
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	w.Write(*s.value)
+	w.Flush()
+
+	return "[" + strings.TrimSuffix(b.String(), "\n") + "]"
+}
+
+// Reset removes all values, as if the flag was never given.
+func (s *stringArrayValue) Reset() {
+	*s.value = nil
+	s.changed = false
+}
+
+// resetFlags restores the default of every given flag, so a command can be
+// executed again without inheriting flags of a previous execution.
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if r, ok := f.Value.(interface {
+			Reset()
+		}); ok {
+			r.Reset()
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+// flagChanged checks whether the flag of the given name was set explicitly for
+// the command of the given path, e.g. setup. The command is looked up at
+// runtime, so validations can use it without causing initialization cycles.
+func flagChanged(path, name string) bool {
+	cmd, _, err := CLICmd.Find(strings.Fields(path))
+	if err != nil {
+		return false
+	}
+
+	return cmd.Flags().Changed(name)
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type importCAFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// PKI
+	CABundleFile string
+	CATTL        string
+}
+
+var (
+	importCACmd = &cobra.Command{
+		Use:   "import-ca",
+		Short: "Import an existing root CA into the Vault PKI backend of a specific cluster.",
+		RunE:  importCARun,
+	}
+
+	newImportCAFlags = &importCAFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(importCACmd)
+	configValidators["import-ca"] = func() []error { return importCAValidate(newImportCAFlags) }
+
+	newImportCAFlags.Vault.register(importCACmd.Flags())
+
+	importCACmd.Flags().StringVar(&newImportCAFlags.ClusterID, "cluster-id", "", "Cluster ID used to import the root CA for.")
+
+	importCACmd.Flags().StringVar(&newImportCAFlags.CABundleFile, "ca-bundle-file", "", "File path of a PEM bundle containing the certificate and private key of the root CA.")
+	importCACmd.Flags().StringVar(&newImportCAFlags.CATTL, "ca-ttl", "86400h", "Max lease TTL of the PKI backend in case it needs to be mounted.") // 10 years
+}
+
+func importCAValidate(newImportCAFlags *importCAFlags) []error {
+	var errs []error
+
+	errs = append(errs, newImportCAFlags.Vault.validate()...)
+	if newImportCAFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newImportCAFlags.CABundleFile == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--ca-bundle-file must not be empty"))
+	}
+	if err := validateDuration("--ca-ttl", newImportCAFlags.CATTL); err != nil {
+		errs = append(errs, err)
+	}
+	if newImportCAFlags.Vault.sharedMount() != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "import-ca must not be used with --pki-path-style shared, the root CA of the shared PKI backend is the one of all clusters"))
+	}
+
+	return errs
+}
+
+func importCARun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(importCAValidate(newImportCAFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	bundle, err := readCABundle("--ca-bundle-file", newImportCAFlags.CABundleFile)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newImportCAFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to import the root CA.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newImportCAFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	importConfig := pki.ImportCAConfig{
+		CABundle:  bundle,
+		ClusterID: newImportCAFlags.ClusterID,
+		TTL:       newImportCAFlags.CATTL,
+	}
+	err = pkiService.ImportCA(importConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	ca, err := pkiService.GetCA(newImportCAFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Imported root CA for cluster ID '%s':\n", newImportCAFlags.ClusterID)
+	fmt.Printf("\n")
+	fmt.Printf("    Mount path:       %s\n", pkiService.MountPKIPath(newImportCAFlags.ClusterID))
+	fmt.Printf("    CA subject:       %s\n", ca.Subject.String())
+	fmt.Printf("    CA serial number: %s\n", pki.FormatSerialNumber(ca.SerialNumber))
+	fmt.Printf("    CA expiration:    %s\n", ca.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("\n")
+	fmt.Printf("The PKI role and policy are not created. Run setup for the same\n")
+	fmt.Printf("cluster ID to complete the PKI backend.\n")
+
+	return nil
+}
+
+// readCABundle reads and validates the PEM bundle of the given file passed
+// using the given flag.
+func readCABundle(flag, path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "%s: %s", flag, err.Error())
+	}
+	err = pki.ValidateCABundle(string(b))
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "%s: %s", flag, err.Error())
+	}
+
+	return string(b), nil
+}
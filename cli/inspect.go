@@ -2,20 +2,16 @@ package cli
 
 import (
 	"fmt"
-	"log"
-	"net/http"
 
 	"github.com/spf13/cobra"
 
 	"github.com/giantswarm/certctl/service/pki"
 	"github.com/giantswarm/certctl/service/token"
-	"github.com/giantswarm/certctl/service/vault-factory"
 )
 
 type inspectFlags struct {
 	// Vault
-	VaultAddress string
-	VaultToken   string
+	Vault vaultFlags
 
 	// Cluster
 	ClusterID string
@@ -25,7 +21,7 @@ var (
 	inspectCmd = &cobra.Command{
 		Use:   "inspect",
 		Short: "Inspect a Vault PKI backend including all necessary requirements.",
-		Run:   inspectRun,
+		RunE:  inspectRun,
 	}
 
 	newInspectFlags = &inspectFlags{}
@@ -33,55 +29,46 @@ var (
 
 func init() {
 	CLICmd.AddCommand(inspectCmd)
+	configValidators["inspect"] = func() []error { return inspectValidate(newInspectFlags) }
 
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultAddress, "vault-addr", fromEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	inspectCmd.Flags().StringVar(&newInspectFlags.VaultToken, "vault-token", fromEnv("VAULT_TOKEN", ""), "Token used to authenticate against Vault.")
+	newInspectFlags.Vault.register(inspectCmd.Flags())
 
 	inspectCmd.Flags().StringVar(&newInspectFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
 }
 
-func inspectValidate(newInspectFlags *inspectFlags) error {
-	if newInspectFlags.VaultToken == "" {
-		return maskAnyf(invalidConfigError, "Vault token must not be empty")
-	}
+func inspectValidate(newInspectFlags *inspectFlags) []error {
+	var errs []error
+
+	errs = append(errs, newInspectFlags.Vault.validate()...)
 	if newInspectFlags.ClusterID == "" {
-		return maskAnyf(invalidConfigError, "cluster ID must not be empty")
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
 	}
 
-	return nil
+	return errs
 }
 
-func inspectRun(cmd *cobra.Command, args []string) {
-	err := inspectValidate(newInspectFlags)
-	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
-	}
-
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.HTTPClient = &http.Client{}
-	newVaultFactoryConfig.Address = newInspectFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newInspectFlags.VaultToken
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+func inspectRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(inspectValidate(newInspectFlags))
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newInspectFlags.Vault)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
 	// Create a PKI controller to check for PKI backend specific operations.
 	var pkiService pki.Service
 	{
 		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
 		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newInspectFlags.Vault.sharedMount()
 		pkiService, err = pki.NewService(pkiConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
 	}
 
@@ -89,28 +76,30 @@ func inspectRun(cmd *cobra.Command, args []string) {
 	var tokenService token.Service
 	{
 		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = tracer
 		tokenConfig.VaultClient = newVaultClient
+		tokenConfig.SharedMount = newInspectFlags.Vault.sharedMount()
 		tokenService, err = token.NewService(tokenConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
 	}
 
 	mounted, err := pkiService.IsMounted(newInspectFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 	generated, err := pkiService.IsCAGenerated(newInspectFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 	roleCreated, err := pkiService.IsRoleCreated(newInspectFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 	policyCreated, err := tokenService.IsPolicyCreated(newInspectFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
 	fmt.Printf("Inspecting cluster for ID '%s':\n", newInspectFlags.ClusterID)
@@ -124,4 +113,6 @@ func inspectRun(cmd *cobra.Command, args []string) {
 	fmt.Printf("cannot be shown as they are secret. Information about these\n")
 	fmt.Printf("secrets needs to be looked up directly from the location of the\n")
 	fmt.Printf("cluster's installation.\n")
+
+	return nil
 }
@@ -1,44 +1,110 @@
 package cli
 
 import (
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/k8s-secret"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/secret-sink"
 	"github.com/giantswarm/certctl/service/spec"
-	"github.com/giantswarm/certctl/service/vault-factory"
 )
 
 type issueFlags struct {
-	VaultAddress string
-	VaultToken   string
+	// Vault
+	Vault vaultFlags
 
 	// Cluster
 	ClusterID string
 
 	// Certificate
-	CommonName string
-	IPSANs     string
-	AltNames   string
-	TTL        string
+	CommonName   string
+	IPSANs       string
+	AltNames     string
+	ExcludeCN    bool
+	SerialNumber string
+	Subject      pki.Subject
+	TTL          string
+	TTLCapToCA   bool
+
+	// Checks
+	SkipNameCheck bool
+	MinCATTL      time.Duration
+
+	// Encoding
+	Format           string
+	PrivateKeyFormat string
 
 	// Path
 	CrtFilePath string
 	KeyFilePath string
 	CAFilePath  string
+	FileModes   fileModeFlags
+
+	// Kubernetes
+	K8sSecret string
+
+	// Sink
+	Sink string
+
+	// Batch
+	FromFile    string
+	OutputDir   string
+	Concurrency int
+
+	// Output
+	SPKIFingerprint   bool
+	Output            string
+	IncludePrivateKey bool
+}
+
+// issueResult is the machine readable result printed by issue when using
+// --output json.
+type issueResult struct {
+	ClusterID    string           `json:"cluster_id"`
+	SerialNumber string           `json:"serial_number"`
+	Expiration   time.Time        `json:"expiration"`
+	NotAfter     time.Time        `json:"not_after"`
+	RequestedTTL string           `json:"requested_ttl"`
+	ActualTTL    string           `json:"actual_ttl"`
+	TTLDiverged  bool             `json:"ttl_diverged"`
+	Fingerprints pki.Fingerprints `json:"fingerprints"`
+	CrtFile      string           `json:"crt_file,omitempty"`
+	KeyFile      string           `json:"key_file,omitempty"`
+	CAFile       string           `json:"ca_file,omitempty"`
+	K8sSecret    string           `json:"k8s_secret,omitempty"`
+	Sink         string           `json:"sink,omitempty"`
+
+	// Certificate and CAChain are encoded according to --format. PrivateKey is
+	// only set when using --include-private-key, so the summary can be logged
+	// safely otherwise.
+	Certificate string   `json:"certificate"`
+	CAChain     []string `json:"ca_chain"`
+	PrivateKey  string   `json:"private_key,omitempty"`
 }
 
 var (
 	issueCmd = &cobra.Command{
 		Use:   "issue",
 		Short: "Generate signed certificates for a specific cluster.",
-		Run:   issueRun,
+		Long: `Generate signed certificates for a specific cluster.
+
+Multiple certificates can be issued at once using --from-file. Each line of
+the file requests a certificate using the whitespace separated fields
+
+    <common-name> [<alt-names> [<ttl>]]
+
+where alt names are comma separated and "-" leaves a field empty. The TTL
+defaults to --ttl. Empty lines and lines starting with # are ignored. The
+certificate, private key and issuing root CA of each common name are written
+to <common-name>.crt, <common-name>.key and <common-name>-ca.crt within
+--output-dir.`,
+		RunE: issueRun,
 	}
 
 	newIssueFlags = &issueFlags{}
@@ -46,119 +112,582 @@ var (
 
 func init() {
 	CLICmd.AddCommand(issueCmd)
+	configValidators["issue"] = func() []error { return issueValidate(newIssueFlags) }
 
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultAddress, "vault-addr", fromEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	issueCmd.Flags().StringVar(&newIssueFlags.VaultToken, "vault-token", fromEnv("VAULT_TOKEN", ""), "Token used to authenticate against Vault.")
+	newIssueFlags.Vault.register(issueCmd.Flags())
 
 	issueCmd.Flags().StringVar(&newIssueFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new signed certificate for.")
 
-	issueCmd.Flags().StringVar(&newIssueFlags.CommonName, "common-name", "", "Common name used to generate a new signed certificate for.")
+	issueCmd.Flags().StringVar(&newIssueFlags.CommonName, "common-name", "", "Common name used to generate a new signed certificate for. May be omitted when the cluster's PKI role does not require a common name and --alt-names or --ip-sans is given.")
 	issueCmd.Flags().StringVar(&newIssueFlags.IPSANs, "ip-sans", "", "IPSANs used to generate a new signed certificate for.")
 	issueCmd.Flags().StringVar(&newIssueFlags.AltNames, "alt-names", "", "Alternative names used to generate a new signed certificate for.")
-	issueCmd.Flags().StringVar(&newIssueFlags.TTL, "ttl", "8640h", "TTL used to generate a new signed certificate for.") // 1 year
+	issueCmd.Flags().BoolVar(&newIssueFlags.ExcludeCN, "exclude-cn-from-sans", false, "Do not add the common name to the DNS SANs of the certificate, e.g. for TLS libraries rejecting the common name duplicated as SAN. Only --alt-names are added then. (Default false)")
+	issueCmd.Flags().StringVar(&newIssueFlags.SerialNumber, "serial-number", "", "Value of the serialNumber RDN of the certificate's subject, e.g. a device identity. Must be allowed by the cluster's PKI role.")
+	issueCmd.Flags().StringVar(&newIssueFlags.Subject.Country, "country", "", "Comma separated countries (C) the certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	issueCmd.Flags().StringVar(&newIssueFlags.Subject.Locality, "locality", "", "Comma separated localities (L) the certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	issueCmd.Flags().StringVar(&newIssueFlags.Subject.Organization, "organization", "", "Comma separated organizations (O) the certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	issueCmd.Flags().StringVar(&newIssueFlags.Subject.OrganizationalUnit, "ou", "", "Comma separated organizational units (OU) the certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	issueCmd.Flags().StringVar(&newIssueFlags.Subject.Province, "province", "", "Comma separated provinces (ST) the certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	issueCmd.Flags().StringVar(&newIssueFlags.TTL, "ttl", "8640h", "TTL used to generate a new signed certificate for. Either a duration or an RFC3339 timestamp, e.g. 2030-12-31T23:59:59Z, the certificate expires at.") // 1 year
+	issueCmd.Flags().BoolVar(&newIssueFlags.SkipNameCheck, "skip-name-check", false, "Do not check the common name and alternative names against the allowed domains of the cluster's PKI role before issuing. (Default false)")
+	issueCmd.Flags().BoolVar(&newIssueFlags.TTLCapToCA, "ttl-cap-to-ca", false, "Reduce the TTL in case the certificate would outlive the issuing root CA. (Default false)")
+	issueCmd.Flags().DurationVar(&newIssueFlags.MinCATTL, "min-ca-ttl", 0, "Minimum remaining validity of the issuing root CA. Issuing fails in case the root CA expires sooner. Zero disables the check.")
+
+	issueCmd.Flags().StringVar(&newIssueFlags.Format, "format", "pem", "Encoding of the issued certificate data. One of pem, pem_bundle or der. With der the decoded binary DER is written to the files.")
+	issueCmd.Flags().StringVar(&newIssueFlags.PrivateKeyFormat, "private-key-format", "", "Encoding of the issued private key. One of der, pkcs8 or pkcs1. Vault does not support pkcs1, so RSA keys are converted locally. Defaults to Vault's default.")
 
 	issueCmd.Flags().StringVar(&newIssueFlags.CrtFilePath, "crt-file", "", "File path used to write the generated public key to.")
 	issueCmd.Flags().StringVar(&newIssueFlags.KeyFilePath, "key-file", "", "File path used to write the generated private key to.")
 	issueCmd.Flags().StringVar(&newIssueFlags.CAFilePath, "ca-file", "", "File path used to write the issuing root CA to.")
+	newIssueFlags.FileModes.register(issueCmd.Flags(), true)
+
+	issueCmd.Flags().StringVar(&newIssueFlags.K8sSecret, "k8s-secret", "", "Kubernetes TLS Secret of the form namespace/name used to store the generated certificate in. Requires running inside a Kubernetes cluster. The file flags are optional when given.")
+
+	issueCmd.Flags().StringVar(&newIssueFlags.Sink, "sink", "", "Sink the generated certificate is written to additionally. One of stdout, file:<path>, fd:<n>, env[:<path>], k8s:<namespace>/<name> or systemd-creds:<dir>. The file flags are optional when given.")
+
+	issueCmd.Flags().StringVar(&newIssueFlags.FromFile, "from-file", "", "File listing multiple certificates to generate instead of --common-name. Requires --output-dir.")
+	issueCmd.Flags().StringVar(&newIssueFlags.OutputDir, "output-dir", "", "Directory the certificates generated using --from-file are written to.")
+	issueCmd.Flags().IntVar(&newIssueFlags.Concurrency, "concurrency", 4, "Number of certificates generated using --from-file in parallel.")
+
+	issueCmd.Flags().BoolVar(&newIssueFlags.SPKIFingerprint, "spki-fingerprint", false, "Print the SHA-256 hash of the certificate's public key in addition to its fingerprints. (Default false)")
+	issueCmd.Flags().StringVar(&newIssueFlags.Output, "output", "text", "Output format of the issued certificate's summary. One of text or json. The JSON summary holds the certificate and its CA chain, so writing files is optional.")
+	issueCmd.Flags().BoolVar(&newIssueFlags.IncludePrivateKey, "include-private-key", false, "Include the private key in the JSON summary given by --output json. (Default false)")
 }
 
-func issueValidate(newIssueFlags *issueFlags) error {
-	if newIssueFlags.VaultToken == "" {
-		return maskAnyf(invalidConfigError, "Vault token must not be empty")
-	}
+func issueValidate(newIssueFlags *issueFlags) []error {
+	var errs []error
+
+	errs = append(errs, newIssueFlags.Vault.validate()...)
+	errs = append(errs, newIssueFlags.FileModes.validate()...)
 	if newIssueFlags.ClusterID == "" {
-		return maskAnyf(invalidConfigError, "cluster ID must not be empty")
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
 	}
-	if newIssueFlags.CommonName == "" {
-		return maskAnyf(invalidConfigError, "--common-name must not be empty")
+	if err := validateOutput(newIssueFlags.Output); err != nil {
+		errs = append(errs, err)
 	}
-	if newIssueFlags.CrtFilePath == "" {
-		return maskAnyf(invalidConfigError, "--crt-file name must not be empty")
+	if newIssueFlags.MinCATTL < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--min-ca-ttl must not be negative"))
 	}
-	if newIssueFlags.KeyFilePath == "" {
-		return maskAnyf(invalidConfigError, "--key-file name must not be empty")
+	if newIssueFlags.FromFile != "" {
+		errs = append(errs, issueBatchValidate(newIssueFlags)...)
+		return errs
 	}
-	if newIssueFlags.CAFilePath == "" {
-		return maskAnyf(invalidConfigError, "--ca-file name must not be empty")
+	if newIssueFlags.OutputDir != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--output-dir must only be given with --from-file"))
+	}
+	if newIssueFlags.CommonName == "" && newIssueFlags.AltNames == "" && newIssueFlags.IPSANs == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--common-name must not be empty unless --alt-names or --ip-sans is given"))
+	}
+	if newIssueFlags.ExcludeCN && newIssueFlags.CommonName == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--exclude-cn-from-sans must only be given with --common-name"))
+	}
+	errs = append(errs, issueFormatValidate(newIssueFlags)...)
+	if newIssueFlags.K8sSecret != "" {
+		if _, err := k8ssecret.ParseSecretRef(newIssueFlags.K8sSecret); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--k8s-secret must be of the form namespace/name"))
+		}
+		if newIssueFlags.Format != "pem" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--format must be pem when using --k8s-secret"))
+		}
+	}
+	if newIssueFlags.Sink != "" {
+		if _, _, err := secretsink.ParseRef(newIssueFlags.Sink); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--sink %s", err.Error()))
+		}
+		if newIssueFlags.Format != "pem" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--format must be pem when using --sink"))
+		}
+		if newIssueFlags.Output == "json" && sinkWritesStdout(newIssueFlags.Sink) {
+			errs = append(errs, maskAnyf(invalidConfigError, "--output json must not be given with a --sink writing to stdout"))
+		}
+	}
+	if newIssueFlags.IncludePrivateKey && newIssueFlags.Output != "json" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--include-private-key must only be given with --output json"))
+	}
+	// Files are optional when storing the certificate in a Secret or sink, or
+	// when printing it as JSON, but either all or none of them must be given.
+	noFiles := newIssueFlags.CrtFilePath == "" && newIssueFlags.KeyFilePath == "" && newIssueFlags.CAFilePath == ""
+	if noFiles && newIssueFlags.K8sSecret == "" && newIssueFlags.Sink == "" && newIssueFlags.Output == "json" {
+		if !newIssueFlags.IncludePrivateKey {
+			errs = append(errs, maskAnyf(invalidConfigError, "--include-private-key must be given when issuing to --output json only, otherwise the private key is lost"))
+		}
+	} else if (newIssueFlags.K8sSecret == "" && newIssueFlags.Sink == "") || !noFiles {
+		if newIssueFlags.CrtFilePath == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--crt-file must not be empty"))
+		}
+		if newIssueFlags.KeyFilePath == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--key-file must not be empty"))
+		}
+		if newIssueFlags.CAFilePath == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ca-file must not be empty"))
+		}
 	}
 
-	return nil
+	return errs
 }
 
-func issueRun(cmd *cobra.Command, args []string) {
-	err := issueValidate(newIssueFlags)
-	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+// issueFormatValidate validates the flags shared by issuing a single
+// certificate and issuing multiple certificates using --from-file.
+func issueFormatValidate(newIssueFlags *issueFlags) []error {
+	var errs []error
+
+	if err := validateTTL("--ttl", newIssueFlags.TTL); err != nil {
+		errs = append(errs, err)
 	}
+	switch newIssueFlags.Format {
+	case "pem", "pem_bundle", "der":
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--format must be one of pem, pem_bundle or der"))
+	}
+	switch newIssueFlags.PrivateKeyFormat {
+	case "", "der", "pkcs8", "pkcs1":
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--private-key-format must be one of der, pkcs8 or pkcs1"))
+	}
+
+	return errs
+}
+
+// issueBatchValidate validates the flags used when issuing multiple
+// certificates using --from-file.
+func issueBatchValidate(newIssueFlags *issueFlags) []error {
+	var errs []error
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.HTTPClient = &http.Client{}
-	newVaultFactoryConfig.Address = newIssueFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newIssueFlags.VaultToken
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	exclusive := []struct {
+		Flag  string
+		Given bool
+	}{
+		{"--common-name", newIssueFlags.CommonName != ""},
+		{"--alt-names", newIssueFlags.AltNames != ""},
+		{"--serial-number", newIssueFlags.SerialNumber != ""},
+		{"--crt-file", newIssueFlags.CrtFilePath != ""},
+		{"--key-file", newIssueFlags.KeyFilePath != ""},
+		{"--ca-file", newIssueFlags.CAFilePath != ""},
+		{"--k8s-secret", newIssueFlags.K8sSecret != ""},
+		{"--sink", newIssueFlags.Sink != ""},
+		{"--spki-fingerprint", newIssueFlags.SPKIFingerprint},
+		{"--output json", newIssueFlags.Output == "json"},
+	}
+	for _, e := range exclusive {
+		if e.Given {
+			errs = append(errs, maskAnyf(invalidConfigError, "%s must not be given with --from-file", e.Flag))
+		}
+	}
+	if newIssueFlags.OutputDir == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--output-dir must not be empty when using --from-file"))
+	}
+	if newIssueFlags.Concurrency < 1 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--concurrency must be at least 1"))
+	}
+	errs = append(errs, issueFormatValidate(newIssueFlags)...)
+
+	return errs
+}
+
+func issueRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(issueValidate(newIssueFlags))
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
+	}
+	for _, w := range newIssueFlags.FileModes.warnings() {
+		printWarning("%s", w)
 	}
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
+	// Open the sink before issuing, so misconfigured sinks fail early.
+	var sink spec.SecretSink
+	if newIssueFlags.Sink != "" {
+		sink, err = secretsink.Open(newIssueFlags.Sink)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newIssueFlags.Vault)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
 	// Create a certificate signer to generate a new signed certificate.
 	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Tracer = tracer
 	newCertSignerConfig.VaultClient = newVaultClient
+	newCertSignerConfig.SharedMount = newIssueFlags.Vault.sharedMount()
 	newCertSigner, err := certsigner.New(newCertSignerConfig)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to run checks against the cluster's PKI backend.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newIssueFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Check the requested subject locally, since Vault silently issues
+	// certificates with the subject configured on the role.
+	if !newIssueFlags.Subject.Empty() {
+		err = pkiService.VerifySubject(newIssueFlags.ClusterID, newIssueFlags.Subject)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Refuse to issue from a root CA about to expire, before any certificate
+	// is issued.
+	if newIssueFlags.MinCATTL > 0 {
+		ca, err := pkiService.GetCA(newIssueFlags.ClusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		err = checkMinCATTL(ca, newIssueFlags.MinCATTL, time.Now())
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// PKCS#1 only exists for RSA keys, so check the key type of the role
+	// before any certificate is issued.
+	if newIssueFlags.PrivateKeyFormat == "pkcs1" {
+		role, err := pkiService.GetRole(newIssueFlags.ClusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		if role.KeyType != "rsa" {
+			return maskAnyf(invalidConfigError, "--private-key-format pkcs1 requires RSA keys, but role '%s' has key type '%s'", pkiService.RoleName(newIssueFlags.ClusterID), role.KeyType)
+		}
+	}
+
+	skipNameCheck, err := issueSkipNameCheck(newIssueFlags, pkiService)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if newIssueFlags.FromFile != "" {
+		batchFlags := *newIssueFlags
+		batchFlags.SkipNameCheck = skipNameCheck
+		err = issueBatch(&batchFlags, newCertSigner, pkiService)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	// Check the requested names locally, so disallowed names are reported
+	// precisely instead of being rejected by Vault.
+	if !skipNameCheck {
+		err = pkiService.VerifyCommonName(newIssueFlags.ClusterID, newIssueFlags.CommonName)
+		if err != nil {
+			return maskAny(err)
+		}
+		err = pkiService.VerifyNames(newIssueFlags.ClusterID, splitList(newIssueFlags.AltNames))
+		if err != nil {
+			return maskAny(err)
+		}
+		if newIssueFlags.SerialNumber != "" {
+			err = pkiService.VerifySerialNumber(newIssueFlags.ClusterID, newIssueFlags.SerialNumber)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	}
+
+	requestedTTL, err := resolveTTL("--ttl", newIssueFlags.TTL, time.Now())
+	if err != nil {
+		return maskAny(err)
+	}
+	ttl, err := issueTTL(newIssueFlags, pkiService, requestedTTL)
+	if err != nil {
+		return maskAny(err)
 	}
 
-	// Generate a new signed certificate.
+	// Generate a new signed certificate. The time of issuing is recorded to
+	// compare the actual validity of the certificate with the requested TTL.
+	issuedAt := time.Now()
 	newIssueConfig := spec.IssueConfig{
 		ClusterID:  newIssueFlags.ClusterID,
 		CommonName: newIssueFlags.CommonName,
 		IPSANs:     newIssueFlags.IPSANs,
 		AltNames:   newIssueFlags.AltNames,
-		TTL:        newIssueFlags.TTL,
+		TTL:        ttl,
+
+		ExcludeCNFromSANs: newIssueFlags.ExcludeCN,
+		SerialNumber:      newIssueFlags.SerialNumber,
+
+		Format:           newIssueFlags.Format,
+		PrivateKeyFormat: newIssueFlags.PrivateKeyFormat,
+	}
+	var newIssueResponse spec.IssueResponse
+	if newIssueFlags.K8sSecret != "" {
+		// Issue the certificate and store it in the Kubernetes Secret.
+		secretRef, err := k8ssecret.ParseSecretRef(newIssueFlags.K8sSecret)
+		if err != nil {
+			return maskAny(err)
+		}
+		k8sConfig, err := k8ssecret.InClusterServiceConfig()
+		if err != nil {
+			return maskAny(err)
+		}
+		k8sService, err := k8ssecret.NewService(k8sConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+		newIssueResponse, err = k8sService.IssueAndStore(newCertSigner, newIssueConfig, secretRef)
+		if err != nil {
+			return maskAny(err)
+		}
+	} else {
+		newIssueResponse, err = newCertSigner.Issue(newIssueConfig)
+		if err != nil {
+			return maskAny(err)
+		}
 	}
-	newIssueResponse, err := newCertSigner.Issue(newIssueConfig)
+
+	writeFiles := newIssueFlags.CrtFilePath != ""
+	if writeFiles {
+		err = writeIssueFiles(newIssueFlags, newIssueResponse)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	if sink != nil {
+		err = sink.WriteCert(newIssueResponse)
+		if err != nil {
+			return maskAny(err)
+		}
+		// Do not mix the summary with the certificate written to stdout.
+		if sinkWritesStdout(newIssueFlags.Sink) {
+			return nil
+		}
+	}
+
+	crt, err := issuedCertificate(newIssueFlags.Format, newIssueResponse.Certificate)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
+	}
+	actualTTL, diverged := issuedTTL(crt, requestedTTL, issuedAt)
+	result := issueResult{
+		ClusterID:    newIssueFlags.ClusterID,
+		SerialNumber: newIssueResponse.SerialNumber,
+		Expiration:   crt.NotAfter.UTC(),
+		NotAfter:     crt.NotAfter.UTC(),
+		RequestedTTL: newIssueFlags.TTL,
+		ActualTTL:    formatDuration(actualTTL),
+		TTLDiverged:  diverged,
+		Fingerprints: pki.ComputeFingerprints(crt, newIssueFlags.SPKIFingerprint),
+		K8sSecret:    newIssueFlags.K8sSecret,
+		Sink:         newIssueFlags.Sink,
+		Certificate:  newIssueResponse.Certificate,
+		CAChain:      newIssueResponse.CAChain,
+	}
+	if newIssueFlags.IncludePrivateKey {
+		result.PrivateKey = newIssueResponse.PrivateKey
+	}
+	if writeFiles {
+		result.CrtFile = newIssueFlags.CrtFilePath
+		result.KeyFile = newIssueFlags.KeyFilePath
+		result.CAFile = newIssueFlags.CAFilePath
+	}
+	// Reducing the TTL using --ttl-cap-to-ca is reported already.
+	if diverged && ttl == requestedTTL {
+		printWarning("certificate expires at %s, after %s instead of the requested --ttl %s, likely capped by the max TTL of the PKI role or backend", result.Expiration.Format(time.RFC3339), result.ActualTTL, newIssueFlags.TTL)
+	}
+	if newIssueFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Issued new signed certificate with the following serial number.\n")
+	fmt.Printf("\n")
+	fmt.Printf("    %s\n", newIssueResponse.SerialNumber)
+	fmt.Printf("\n")
+	fmt.Printf("The certificate has the following fingerprints.\n")
+	fmt.Printf("\n")
+	printFingerprints(result.Fingerprints)
+	fmt.Printf("\n")
+	fmt.Printf("The certificate expires at %s, after %s (requested %s).\n", result.Expiration.Format(time.RFC3339), result.ActualTTL, result.RequestedTTL)
+	if newIssueFlags.K8sSecret != "" {
+		fmt.Printf("Certificate stored in Kubernetes Secret '%s'.\n", newIssueFlags.K8sSecret)
+	}
+	if sink != nil {
+		fmt.Printf("Certificate written to sink '%s'.\n", newIssueFlags.Sink)
+	}
+	if writeFiles {
+		fmt.Printf("Public key written to '%s'.\n", newIssueFlags.CrtFilePath)
+		fmt.Printf("Private key written to '%s'.\n", newIssueFlags.KeyFilePath)
+		fmt.Printf("Root CA written to '%s'.\n", newIssueFlags.CAFilePath)
+	}
+
+	return nil
+}
+
+// issuedTTL returns the actual validity of the given certificate issued at the
+// given time. Vault caps the requested TTL to the max TTL of the PKI role and
+// backend, so the validity is reported as diverged when it differs from the
+// requested TTL by more than a minute, which covers the time spent issuing.
+func issuedTTL(crt *x509.Certificate, requested string, issuedAt time.Time) (time.Duration, bool) {
+	actual := crt.NotAfter.Sub(issuedAt).Round(time.Minute)
+	d, err := time.ParseDuration(requested)
+	if err != nil {
+		return actual, false
+	}
+	diff := actual - d
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return actual, diff > time.Minute
+}
+
+// issueSkipNameCheck tells whether checking the requested names against the
+// PKI role is skipped. Besides --skip-name-check, the check is skipped in case
+// the token may not read the PKI role. Tokens of PKI issue policies created
+// before reading the PKI role was granted can only issue, so Vault checks the
+// names on its own then.
+func issueSkipNameCheck(newIssueFlags *issueFlags, pkiService pki.Service) (bool, error) {
+	if newIssueFlags.SkipNameCheck {
+		return true, nil
+	}
+
+	_, err := pkiService.GetRole(newIssueFlags.ClusterID)
+	if isPermissionDenied(err) {
+		printWarning("token may not read PKI role '%s', so the requested names are only checked by Vault, run setup --idempotent to update the PKI issue policy", pkiService.RoleName(newIssueFlags.ClusterID))
+		return true, nil
+	} else if err != nil {
+		return false, maskAny(err)
+	}
+
+	return false, nil
+}
+
+// issueTTL returns the TTL used to issue a certificate requesting the given
+// TTL. It is reduced to the remaining validity of the root CA when
+// --ttl-cap-to-ca is given.
+func issueTTL(newIssueFlags *issueFlags, pkiService pki.Service, ttl string) (string, error) {
+	if !newIssueFlags.TTLCapToCA {
+		return ttl, nil
+	}
+
+	ca, err := pkiService.GetCA(newIssueFlags.ClusterID)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	capped, err := capTTLToCA(ttl, ca, time.Now())
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if capped != ttl {
+		printWarning("root CA expires at %s, reducing TTL from %s to %s", ca.NotAfter.UTC().Format(time.RFC3339), ttl, capped)
 	}
 
-	err = os.MkdirAll(filepath.Dir(newIssueFlags.CrtFilePath), os.FileMode(0744))
+	return capped, nil
+}
+
+// capTTLToCA returns the given TTL reduced to the remaining validity of the
+// given CA in case a certificate issued at now would otherwise outlive it.
+func capTTLToCA(ttl string, ca *x509.Certificate, now time.Time) (string, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "--ttl must be a valid duration")
+	}
+
+	remaining := ca.NotAfter.Sub(now).Truncate(time.Second)
+	if remaining <= 0 {
+		return "", maskAnyf(caExpiredError, "root CA expired at %s", ca.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if d <= remaining {
+		return ttl, nil
+	}
+
+	return remaining.String(), nil
+}
+
+// checkMinCATTL ensures the given CA is valid for at least the given duration
+// after now.
+func checkMinCATTL(ca *x509.Certificate, min time.Duration, now time.Time) error {
+	remaining := ca.NotAfter.Sub(now).Truncate(time.Second)
+	if remaining <= 0 {
+		return maskAnyf(caExpiredError, "root CA expired at %s", ca.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if remaining < min {
+		return maskAnyf(caExpiredError, "root CA expires at %s, in %s, which is less than --min-ca-ttl %s", ca.NotAfter.UTC().Format(time.RFC3339), remaining, min)
+	}
+
+	return nil
+}
+
+// writeIssueFiles writes the certificate, private key and issuing CA of the
+// given issue response to the files configured by the given flags.
+func writeIssueFiles(newIssueFlags *issueFlags, newIssueResponse spec.IssueResponse) error {
+	crt, err := issueFileContent(newIssueFlags.Format, newIssueResponse.Certificate)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-	err = ioutil.WriteFile(newIssueFlags.CrtFilePath, []byte(newIssueResponse.Certificate), os.FileMode(0644))
+	key, err := issueFileContent(newIssueFlags.Format, newIssueResponse.PrivateKey)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-	err = os.MkdirAll(filepath.Dir(newIssueFlags.KeyFilePath), os.FileMode(0744))
+	ca, err := issueFileContent(newIssueFlags.Format, newIssueResponse.IssuingCA)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-	err = ioutil.WriteFile(newIssueFlags.KeyFilePath, []byte(newIssueResponse.PrivateKey), os.FileMode(0644))
+
+	err = writeOutputFile(newIssueFlags.CrtFilePath, crt, newIssueFlags.FileModes.certMode())
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-	err = os.MkdirAll(filepath.Dir(newIssueFlags.CAFilePath), os.FileMode(0744))
+	err = writeOutputFile(newIssueFlags.KeyFilePath, key, newIssueFlags.FileModes.keyMode())
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
-	err = ioutil.WriteFile(newIssueFlags.CAFilePath, []byte(newIssueResponse.IssuingCA), os.FileMode(0644))
+	err = writeOutputFile(newIssueFlags.CAFilePath, ca, newIssueFlags.FileModes.certMode())
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return maskAny(err)
 	}
 
-	fmt.Printf("Issued new signed certificate with the following serial number.\n")
-	fmt.Printf("\n")
-	fmt.Printf("    %s\n", newIssueResponse.SerialNumber)
-	fmt.Printf("\n")
-	fmt.Printf("Public key written to '%s'.\n", newIssueFlags.CrtFilePath)
-	fmt.Printf("Private key written to '%s'.\n", newIssueFlags.KeyFilePath)
-	fmt.Printf("Root CA written to '%s'.\n", newIssueFlags.CAFilePath)
+	return nil
+}
+
+// issuedCertificate parses the certificate of an issue response requested
+// using the given format. PEM bundles hold the private key as well, which is
+// skipped.
+func issuedCertificate(format, value string) (*x509.Certificate, error) {
+	b, err := issueFileContent(format, value)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	crt, err := parseCertificateData(b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return crt, nil
+}
+
+// issueFileContent returns the bytes written to an output file for the given
+// value of an issue response. Vault returns DER encoded data as base64 strings,
+// which is decoded here so the written files contain the raw binary DER. All
+// other formats are written as they are returned.
+func issueFileContent(format, value string) ([]byte, error) {
+	if format != "der" {
+		return []byte(value), nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
 }
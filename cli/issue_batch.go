@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// issueBatchEntry is a single certificate requested by the file given with
+// --from-file.
+type issueBatchEntry struct {
+	CommonName string
+	AltNames   string
+	TTL        string
+
+	// Line is the line of the entry within the file, used for error messages.
+	Line int
+}
+
+// issueBatchResult is the outcome of issuing the certificate of a single
+// issueBatchEntry.
+type issueBatchResult struct {
+	SerialNumber string
+	Err          error
+}
+
+// parseIssueBatchFile reads the certificates requested by the file given with
+// --from-file. Each line has the whitespace separated fields
+//
+//	<common-name> [<alt-names> [<ttl>]]
+//
+// where alt names are comma separated and "-" leaves a field empty. The TTL
+// defaults to the given TTL. Empty lines and lines starting with # are ignored.
+func parseIssueBatchFile(path, defaultTTL string) ([]issueBatchEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, maskAnyf(invalidConfigError, "--from-file: %s", err.Error())
+	}
+	defer f.Close()
+
+	var entries []issueBatchEntry
+	seen := map[string]int{}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 3 {
+			return nil, maskAnyf(invalidConfigError, "--from-file line %d must have at most 3 fields", n)
+		}
+		for len(fields) < 3 {
+			fields = append(fields, "-")
+		}
+		for i, v := range fields {
+			if v == "-" {
+				fields[i] = ""
+			}
+		}
+
+		entry := issueBatchEntry{
+			CommonName: fields[0],
+			AltNames:   fields[1],
+			TTL:        fields[2],
+			Line:       n,
+		}
+		if entry.CommonName == "" {
+			return nil, maskAnyf(invalidConfigError, "--from-file line %d must have a common name", n)
+		}
+		if entry.TTL == "" {
+			entry.TTL = defaultTTL
+		}
+		if err := validateTTL(fmt.Sprintf("--from-file line %d TTL", n), entry.TTL); err != nil {
+			return nil, maskAny(err)
+		}
+		// Common names only differing in characters replaced in file names
+		// would overwrite each other's files.
+		name := issueBatchFileName(entry.CommonName)
+		if l, ok := seen[name]; ok {
+			return nil, maskAnyf(invalidConfigError, "--from-file line %d repeats the file name '%s' of the common name of line %d", n, name, l)
+		}
+		seen[name] = n
+
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, maskAnyf(invalidConfigError, "--from-file: %s", err.Error())
+	}
+	if len(entries) == 0 {
+		return nil, maskAnyf(invalidConfigError, "--from-file must request at least one certificate")
+	}
+
+	return entries, nil
+}
+
+// issueBatchFileName returns the base name of the files the certificate of
+// the given common name is written to. Only letters, digits, dashes,
+// underscores and dots are kept, all other characters, e.g. wildcards and path
+// separators, are replaced. Leading and repeated dots are replaced as well, so
+// the name never refers to a parent directory or a hidden file.
+func issueBatchFileName(commonName string) string {
+	runes := []rune(commonName)
+	name := make([]rune, len(runes))
+	for i, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			name[i] = r
+		case r == '.' && i > 0 && runes[i-1] != '.':
+			name[i] = r
+		default:
+			name[i] = '_'
+		}
+	}
+
+	return string(name)
+}
+
+// issueBatchFilePath returns the path of the given file name within the given
+// directory. It fails in case the path is not located within the directory.
+func issueBatchFilePath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", maskAnyf(invalidConfigError, "file '%s' is not located within --output-dir '%s'", name, dir)
+	}
+
+	return path, nil
+}
+
+// issueBatch issues the certificates requested by the file given with
+// --from-file concurrently and writes each of them to its own files within
+// --output-dir. Failures do not stop the batch. All of them are reported and
+// combined into a single error.
+func issueBatch(newIssueFlags *issueFlags, certSigner spec.CertSigner, pkiService pki.Service) error {
+	entries, err := parseIssueBatchFile(newIssueFlags.FromFile, newIssueFlags.TTL)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	results := make([]issueBatchResult, len(entries))
+	{
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < newIssueFlags.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range work {
+					serialNumber, err := issueBatchEntryRun(newIssueFlags, certSigner, pkiService, entries[j])
+					results[j] = issueBatchResult{SerialNumber: serialNumber, Err: err}
+				}
+			}()
+		}
+		for i := range entries {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+	}
+
+	var failed int
+	fmt.Printf("Issued new signed certificates for cluster ID '%s':\n", newIssueFlags.ClusterID)
+	fmt.Printf("\n")
+	for i, e := range entries {
+		if results[i].Err != nil {
+			failed++
+			fmt.Printf("    %s: failed: %s\n", e.CommonName, results[i].Err.Error())
+			continue
+		}
+		fmt.Printf("    %s: %s\n", e.CommonName, results[i].SerialNumber)
+	}
+	fmt.Printf("\n")
+	fmt.Printf("Certificates written to '%s'.\n", newIssueFlags.OutputDir)
+
+	if failed > 0 {
+		return maskAnyf(batchFailedError, "%d of %d certificates failed", failed, len(entries))
+	}
+
+	return nil
+}
+
+// issueBatchEntryRun issues the certificate of the given entry the same way a
+// single certificate is issued and returns its serial number.
+func issueBatchEntryRun(newIssueFlags *issueFlags, certSigner spec.CertSigner, pkiService pki.Service, entry issueBatchEntry) (string, error) {
+	if !newIssueFlags.SkipNameCheck {
+		names := append([]string{entry.CommonName}, splitList(entry.AltNames)...)
+		err := pkiService.VerifyNames(newIssueFlags.ClusterID, names)
+		if err != nil {
+			return "", maskAny(err)
+		}
+	}
+
+	// The files are written using the paths derived from the common name,
+	// which are checked before the certificate is issued.
+	name := issueBatchFileName(entry.CommonName)
+	entryFlags := *newIssueFlags
+	for _, f := range []struct {
+		Path   *string
+		Suffix string
+	}{
+		{Path: &entryFlags.CrtFilePath, Suffix: ".crt"},
+		{Path: &entryFlags.KeyFilePath, Suffix: ".key"},
+		{Path: &entryFlags.CAFilePath, Suffix: "-ca.crt"},
+	} {
+		path, err := issueBatchFilePath(newIssueFlags.OutputDir, name+f.Suffix)
+		if err != nil {
+			return "", maskAny(err)
+		}
+		*f.Path = path
+	}
+
+	ttl, err := resolveTTL("--from-file TTL", entry.TTL, time.Now())
+	if err != nil {
+		return "", maskAny(err)
+	}
+	ttl, err = issueTTL(newIssueFlags, pkiService, ttl)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	newIssueConfig := spec.IssueConfig{
+		ClusterID:  newIssueFlags.ClusterID,
+		CommonName: entry.CommonName,
+		IPSANs:     newIssueFlags.IPSANs,
+		AltNames:   entry.AltNames,
+		TTL:        ttl,
+
+		ExcludeCNFromSANs: newIssueFlags.ExcludeCN,
+
+		Format:           newIssueFlags.Format,
+		PrivateKeyFormat: newIssueFlags.PrivateKeyFormat,
+	}
+	newIssueResponse, err := certSigner.Issue(newIssueConfig)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	err = writeIssueFiles(&entryFlags, newIssueResponse)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return newIssueResponse.SerialNumber, nil
+}
@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type keyListFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Output
+	Output string
+}
+
+type keyDeleteFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Key
+	KeyRef string
+
+	// Confirmation
+	Yes bool
+
+	// Safety
+	Force bool
+}
+
+// keyListResult is the machine readable key list printed by key list when
+// using --output json.
+type keyListResult struct {
+	ClusterID string    `json:"cluster_id"`
+	Keys      []pki.Key `json:"keys"`
+}
+
+var (
+	keyCmd = &cobra.Command{
+		Use:   "key",
+		Short: "Manage the keys of PKI backends supporting multiple issuers.",
+		RunE:  groupRun,
+	}
+
+	keyListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the keys of the PKI backend of a specific cluster.",
+		Long: `List the keys of the PKI backend of a specific cluster together with the
+issuers using them. Keys are first-class objects of PKI backends supporting
+multiple issuers, i.e. Vault 1.11 and later. Keys not used by any issuer can be
+deleted using key delete.`,
+		RunE: keyListRun,
+	}
+
+	keyDeleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Delete an unused key of the PKI backend of a specific cluster.",
+		Long: `Delete an unused key of the PKI backend of a specific cluster. Keys used by any
+issuer are never deleted. Deleting a key cannot be undone, so it must be
+confirmed using --yes. Without --yes the key is only shown.`,
+		RunE: keyDeleteRun,
+	}
+
+	newKeyListFlags   = &keyListFlags{}
+	newKeyDeleteFlags = &keyDeleteFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(keyListCmd)
+	keyCmd.AddCommand(keyDeleteCmd)
+	configValidators["key list"] = func() []error { return keyListValidate(newKeyListFlags) }
+	configValidators["key delete"] = func() []error { return keyDeleteValidate(newKeyDeleteFlags) }
+
+	newKeyListFlags.Vault.register(keyListCmd.Flags())
+
+	keyListCmd.Flags().StringVar(&newKeyListFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend whose keys are listed.")
+
+	keyListCmd.Flags().StringVar(&newKeyListFlags.Output, "output", "text", "Output format of the key list. One of text or json.")
+
+	newKeyDeleteFlags.Vault.register(keyDeleteCmd.Flags())
+
+	keyDeleteCmd.Flags().StringVar(&newKeyDeleteFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend holding the key.")
+
+	keyDeleteCmd.Flags().StringVar(&newKeyDeleteFlags.KeyRef, "key-ref", "", "ID or name of the key being deleted.")
+
+	keyDeleteCmd.Flags().BoolVar(&newKeyDeleteFlags.Yes, "yes", false, "Confirm deleting the key. (Default false)")
+	keyDeleteCmd.Flags().BoolVar(&newKeyDeleteFlags.Force, "force", false, "Change Vault even in case a maintenance operation, e.g. a rekey or a seal migration, is in progress. (Default false)")
+}
+
+func keyListValidate(newKeyListFlags *keyListFlags) []error {
+	var errs []error
+
+	errs = append(errs, newKeyListFlags.Vault.validate()...)
+	if newKeyListFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if err := validateOutput(newKeyListFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func keyDeleteValidate(newKeyDeleteFlags *keyDeleteFlags) []error {
+	var errs []error
+
+	errs = append(errs, newKeyDeleteFlags.Vault.validate()...)
+	if newKeyDeleteFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newKeyDeleteFlags.KeyRef == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--key-ref must not be empty"))
+	} else if newKeyDeleteFlags.KeyRef == "default" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--key-ref must name a key by its ID or name, not default"))
+	}
+
+	return errs
+}
+
+func keyListRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(keyListValidate(newKeyListFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	pkiService, err := newKeyPKIService(&newKeyListFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	keys, err := pkiService.ListKeys(newKeyListFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if newKeyListFlags.Output == "json" {
+		err = printJSON(keyListResult{ClusterID: newKeyListFlags.ClusterID, Keys: keys})
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	if len(keys) == 0 {
+		fmt.Printf("No keys found for cluster ID '%s'.\n", newKeyListFlags.ClusterID)
+		return nil
+	}
+
+	fmt.Printf("Found %d key(s) for cluster ID '%s':\n", len(keys), newKeyListFlags.ClusterID)
+	fmt.Printf("\n")
+	for _, k := range keys {
+		fmt.Printf("    %s: %s\n", k.ID, formatKey(k))
+	}
+	fmt.Printf("\n")
+
+	return nil
+}
+
+func keyDeleteRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(keyDeleteValidate(newKeyDeleteFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	newVaultClient, err := createVaultClient(&newKeyDeleteFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = verifyNoMaintenance(newVaultClient, newKeyDeleteFlags.Force)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	pkiService, err := newKeyPKIService(&newKeyDeleteFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	key, err := pkiService.GetKey(newKeyDeleteFlags.ClusterID, newKeyDeleteFlags.KeyRef)
+	if err != nil {
+		return maskAny(err)
+	}
+	if key.Used() {
+		return maskAnyf(invalidConfigError, "key '%s' is used by the issuer(s) %s and must not be deleted", newKeyDeleteFlags.KeyRef, strings.Join(key.IssuerIDs, ","))
+	}
+
+	warning := fmt.Sprintf("deleting key '%s' (%s) of cluster ID '%s' cannot be undone", key.ID, formatKey(key), newKeyDeleteFlags.ClusterID)
+	err = confirmWarnings([]string{warning}, newKeyDeleteFlags.Yes)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = pkiService.DeleteKey(newKeyDeleteFlags.ClusterID, key.ID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Deleted key '%s' of cluster ID '%s'.\n", key.ID, newKeyDeleteFlags.ClusterID)
+
+	return nil
+}
+
+// newKeyPKIService creates a PKI controller using a Vault client configured
+// by the given flags.
+func newKeyPKIService(f *vaultFlags) (pki.Service, error) {
+	newVaultClient, err := createVaultClient(f)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	pkiConfig := pki.DefaultServiceConfig()
+	pkiConfig.Tracer = tracer
+	pkiConfig.VaultClient = newVaultClient
+	pkiConfig.SharedMount = f.sharedMount()
+	pkiService, err := pki.NewService(pkiConfig)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return pkiService, nil
+}
+
+// formatKey describes the given key by its name, type and the issuers using
+// it.
+func formatKey(k pki.Key) string {
+	name := k.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	usage := "unused"
+	if k.Used() {
+		usage = "used by issuer(s) " + strings.Join(k.IssuerIDs, ",")
+	}
+
+	return fmt.Sprintf("%s, %s, %s", name, k.Type, usage)
+}
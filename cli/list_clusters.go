@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type listClustersFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Output
+	Output string
+}
+
+// listClustersResult is a single cluster printed by list-clusters when using
+// --output json.
+type listClustersResult struct {
+	pki.ClusterMount
+
+	// CAExpiry is the time the cluster's root CA expires at. It is empty in
+	// case no root CA is generated yet.
+	CAExpiry string `json:"ca_expiry"`
+}
+
+var (
+	listClustersCmd = &cobra.Command{
+		Use:   "list-clusters",
+		Short: "List the clusters having a PKI backend set up.",
+		Long: `List the clusters having a PKI backend set up. PKI backends mounted at paths
+following the naming convention of certctl, pki-<cluster-id>, are listed
+together with the expiry of their root CA. Mounts not carrying the marker
+certctl:cluster=<cluster-id> in their description are flagged, as they were
+mounted by someone else. Using --pki-path-style shared, the clusters having a
+PKI role role-<cluster-id> in the shared PKI backend are listed instead.`,
+		RunE: listClustersRun,
+	}
+
+	newListClustersFlags = &listClustersFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(listClustersCmd)
+	configValidators["list-clusters"] = func() []error { return listClustersValidate(newListClustersFlags) }
+
+	newListClustersFlags.Vault.register(listClustersCmd.Flags())
+
+	listClustersCmd.Flags().StringVar(&newListClustersFlags.Output, "output", "text", "Output format of the cluster list. One of text or json.")
+}
+
+func listClustersValidate(newListClustersFlags *listClustersFlags) []error {
+	var errs []error
+
+	errs = append(errs, newListClustersFlags.Vault.validate()...)
+	if err := validateOutput(newListClustersFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func listClustersRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(listClustersValidate(newListClustersFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newListClustersFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to list the PKI backends.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newListClustersFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	clusters, err := pkiService.ListClusters()
+	if err != nil {
+		return maskAny(err)
+	}
+
+	results := []listClustersResult{}
+	for _, c := range clusters {
+		result := listClustersResult{ClusterMount: c}
+		// The PKI backend may be mounted without a root CA being generated yet.
+		ca, err := pkiService.GetCA(c.ClusterID)
+		if err == nil {
+			result.CAExpiry = ca.NotAfter.UTC().Format(time.RFC3339)
+		} else if !pki.IsCANotFound(err) {
+			return maskAny(err)
+		}
+		results = append(results, result)
+	}
+
+	if newListClustersFlags.Output == "json" {
+		err = printJSON(results)
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	if len(results) == 0 {
+		fmt.Printf("No clusters found.\n")
+		return nil
+	}
+
+	fmt.Printf("Found %d cluster(s):\n", len(results))
+	fmt.Printf("\n")
+	for _, r := range results {
+		expiry := "root CA not generated"
+		if r.CAExpiry != "" {
+			expiry = "root CA expires at " + r.CAExpiry
+		}
+		marker := ""
+		if !r.Marked {
+			marker = ", not mounted by certctl"
+		}
+		fmt.Printf("    %s: %s, %s%s\n", r.ClusterID, r.Path, expiry, marker)
+	}
+	fmt.Printf("\n")
+
+	return nil
+}
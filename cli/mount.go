@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type mountFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// PKI
+	CATTL            string
+	OnConflict       string
+	MountDescription string
+}
+
+var (
+	mountCmd = &cobra.Command{
+		Use:   "mount",
+		Short: "Mount the Vault PKI backend of a specific cluster without creating a root CA.",
+		Long: `Mount the Vault PKI backend of a specific cluster without generating a root CA
+or creating the PKI role. This allows to mount and tune the PKI backend first and
+generate the root CA in a separate step, e.g. by running setup or import-ca
+afterwards. Mounting is idempotent. An existing PKI backend is reused according
+to --on-conflict and its max lease TTL is tuned to --ca-ttl. mount cannot be used
+with --pki-path-style shared.`,
+		RunE: mountRun,
+	}
+
+	newMountFlags = &mountFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(mountCmd)
+	configValidators["mount"] = func() []error { return mountValidate(newMountFlags) }
+
+	newMountFlags.Vault.register(mountCmd.Flags())
+
+	mountCmd.Flags().StringVar(&newMountFlags.ClusterID, "cluster-id", "", "Cluster ID used to mount the PKI backend for.")
+
+	mountCmd.Flags().StringVar(&newMountFlags.CATTL, "ca-ttl", "86400h", "Max lease TTL of the PKI backend, limiting the TTL of the root CA and issued certs. Existing PKI backends are tuned to it.") // 10 years
+	mountCmd.Flags().StringVar(&newMountFlags.OnConflict, "on-conflict", pki.OnConflictReuse, "How an existing mount at the PKI backend's path is handled. One of reuse, fail or error. reuse reuses any PKI backend, fail only PKI backends mounted by certctl, error fails for every existing mount.")
+	mountCmd.Flags().StringVar(&newMountFlags.MountDescription, "mount-description", "", "Description the PKI backend is mounted with. The marker certctl:cluster=<cluster-id> identifying PKI backends mounted by certctl is always appended. Defaults to a description naming the cluster ID.")
+}
+
+func mountValidate(newMountFlags *mountFlags) []error {
+	var errs []error
+
+	errs = append(errs, newMountFlags.Vault.validate()...)
+	if newMountFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if err := validateDuration("--ca-ttl", newMountFlags.CATTL); err != nil {
+		errs = append(errs, err)
+	}
+	switch newMountFlags.OnConflict {
+	case pki.OnConflictReuse, pki.OnConflictFail, pki.OnConflictError:
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--on-conflict must be one of reuse, fail or error"))
+	}
+	if newMountFlags.Vault.sharedMount() != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "mount must not be used with --pki-path-style shared, the shared PKI backend is the one of all clusters and mounted by the first setup"))
+	}
+
+	return errs
+}
+
+func mountRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(mountValidate(newMountFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newMountFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to mount the PKI backend.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newMountFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	mountConfig := pki.MountConfig{
+		ClusterID:   newMountFlags.ClusterID,
+		TTL:         newMountFlags.CATTL,
+		Description: newMountFlags.MountDescription,
+		OnConflict:  newMountFlags.OnConflict,
+		Tune:        true,
+	}
+	result, err := pkiService.Mount(mountConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	switch {
+	case result.Mounted:
+		fmt.Printf("Mounted PKI backend for cluster ID '%s' at '%s'.\n", newMountFlags.ClusterID, result.MountPath)
+	case result.Tuned:
+		fmt.Printf("Tuned max lease TTL of existing PKI backend for cluster ID '%s' at '%s' to %s.\n", newMountFlags.ClusterID, result.MountPath, newMountFlags.CATTL)
+	default:
+		fmt.Printf("PKI backend for cluster ID '%s' already mounted at '%s'.\n", newMountFlags.ClusterID, result.MountPath)
+	}
+	fmt.Printf("\n")
+	fmt.Printf("The root CA, PKI role and policy are not created. Run setup or\n")
+	fmt.Printf("import-ca for the same cluster ID to complete the PKI backend.\n")
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// reloadFlags are the flags shared by all agent commands running a hook after
+// renewing secrets, e.g. to reload the service consuming them.
+type reloadFlags struct {
+	Cmd        string
+	Timeout    time.Duration
+	Env        []string
+	InheritEnv bool
+}
+
+func (f *reloadFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&f.Cmd, "reload-cmd", "", "Shell command run after each successful renewal, e.g. 'systemctl reload nginx'. Its output is logged. Failures are reported as warnings.")
+	flags.DurationVar(&f.Timeout, "reload-timeout", 30*time.Second, "Maximum time --reload-cmd may run before it is killed.")
+	stringArrayVar(flags, &f.Env, "reload-env", "Environment variable of the form key=value set for --reload-cmd. Can be given multiple times.")
+	flags.BoolVar(&f.InheritEnv, "reload-inherit-env", false, "Run --reload-cmd with the environment of certctl, e.g. including VAULT_TOKEN, instead of a clean one holding PATH and --reload-env only. (Default false)")
+}
+
+func (f *reloadFlags) validate() []error {
+	var errs []error
+
+	if f.Timeout <= 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--reload-timeout must be greater than zero"))
+	}
+	if _, err := parseKeyValues("--reload-env", f.Env); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// run executes the configured reload command, in case there is one, and logs
+// its output line by line using the given logger. Reloading is best effort,
+// so failures, including timeouts, are reported as warnings only.
+func (f *reloadFlags) run(logger *log.Logger) {
+	if f.Cmd == "" {
+		return
+	}
+
+	// The environment is clean by default, so secrets like the Vault token do
+	// not leak to the reload command. PATH is kept to resolve commands.
+	c := exec.Command("sh", "-c", f.Cmd)
+	if f.InheritEnv {
+		c.Env = os.Environ()
+	} else {
+		c.Env = []string{"PATH=" + os.Getenv("PATH")}
+	}
+	c.Env = append(c.Env, f.Env...)
+
+	var out bytes.Buffer
+	c.Stdout = &out
+	c.Stderr = &out
+
+	// The command runs in its own process group, so processes it started are
+	// killed on timeout as well, instead of keeping its output open.
+	setProcessGroup(c)
+	err := c.Start()
+	if err != nil {
+		printWarning("--reload-cmd failed: %s", err.Error())
+		return
+	}
+	var timedOut int32
+	timer := time.AfterFunc(f.Timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		killProcessGroup(c)
+	})
+	err = c.Wait()
+	timer.Stop()
+
+	s := bufio.NewScanner(&out)
+	for s.Scan() {
+		logger.Printf("reload: %s", s.Text())
+	}
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		printWarning("--reload-cmd timed out after %s", f.Timeout)
+	} else if err != nil {
+		printWarning("--reload-cmd failed: %s", err.Error())
+	} else {
+		logger.Printf("reload command succeeded")
+	}
+}
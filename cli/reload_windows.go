@@ -0,0 +1,15 @@
+package cli
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, which has no process groups.
+func setProcessGroup(c *exec.Cmd) {
+}
+
+// killProcessGroup kills the given started command. Processes it started are
+// not killed on Windows.
+func killProcessGroup(c *exec.Cmd) {
+	c.Process.Kill()
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+type renewCertFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// CSR
+	CSRFile string
+
+	// Certificate
+	TTL string
+
+	// Path
+	CrtFilePath string
+	CAFilePath  string
+	FileModes   fileModeFlags
+}
+
+var (
+	renewCertCmd = &cobra.Command{
+		Use:   "renew-cert",
+		Short: "Renew a certificate by re-signing its stored certificate signing request.",
+		Long: `Renew a certificate by re-signing its stored certificate signing request with
+a fresh TTL. The renewed certificate is issued for the same key as before, so
+no new key pair has to be generated and distributed, e.g. for pinned keys.
+
+The CSR is checked against the current allowed domains of the cluster's PKI
+role before re-signing, since the role may have changed since the certificate
+was signed. Unlike sign, the names of the CSR are taken as they are, i.e. no
+names can be added to the renewed certificate.`,
+		RunE: renewCertRun,
+	}
+
+	newRenewCertFlags = &renewCertFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(renewCertCmd)
+	configValidators["renew-cert"] = func() []error { return renewCertValidate(newRenewCertFlags) }
+
+	newRenewCertFlags.Vault.register(renewCertCmd.Flags())
+
+	renewCertCmd.Flags().StringVar(&newRenewCertFlags.ClusterID, "cluster-id", "", "Cluster ID used to re-sign the certificate signing request for.")
+
+	renewCertCmd.Flags().StringVar(&newRenewCertFlags.CSRFile, "csr-file", "", "File path of the stored certificate signing request, PEM or base64 encoded DER.")
+
+	renewCertCmd.Flags().StringVar(&newRenewCertFlags.TTL, "ttl", "8640h", "TTL of the renewed certificate. Either a duration or an RFC3339 timestamp the certificate expires at.") // 1 year
+
+	renewCertCmd.Flags().StringVar(&newRenewCertFlags.CrtFilePath, "crt-file", "", "File path used to write the renewed certificate to. Defaults to printing it to stdout.")
+	renewCertCmd.Flags().StringVar(&newRenewCertFlags.CAFilePath, "ca-file", "", "File path used to write the issuing root CA to.")
+	newRenewCertFlags.FileModes.register(renewCertCmd.Flags(), false)
+}
+
+func renewCertValidate(newRenewCertFlags *renewCertFlags) []error {
+	var errs []error
+
+	errs = append(errs, newRenewCertFlags.Vault.validate()...)
+	errs = append(errs, newRenewCertFlags.FileModes.validate()...)
+	if newRenewCertFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newRenewCertFlags.CSRFile == "" || newRenewCertFlags.CSRFile == "-" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--csr-file must be the file path of the stored certificate signing request"))
+	} else if _, err := os.Stat(newRenewCertFlags.CSRFile); err != nil {
+		errs = append(errs, maskAnyf(invalidConfigError, "--csr-file %s", err.Error()))
+	}
+	if err := validateTTL("--ttl", newRenewCertFlags.TTL); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func renewCertRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(renewCertValidate(newRenewCertFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Read and validate the CSR before contacting Vault.
+	csr, err := readCSR(newRenewCertFlags.CSRFile)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	ttl, err := resolveTTL("--ttl", newRenewCertFlags.TTL, time.Now())
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided token.
+	newVaultClient, err := createVaultClient(&newRenewCertFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a certificate signer to re-sign the CSR.
+	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Tracer = tracer
+	newCertSignerConfig.VaultClient = newVaultClient
+	newCertSignerConfig.SharedMount = newRenewCertFlags.Vault.sharedMount()
+	newCertSigner, err := certsigner.New(newCertSignerConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to check the CSR against the cluster's PKI role.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newRenewCertFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// The role may have changed since the CSR was signed the last time, so its
+	// names are always checked, unlike using sign.
+	err = pkiService.VerifyCommonName(newRenewCertFlags.ClusterID, csr.Subject.CommonName)
+	if err == nil {
+		err = pkiService.VerifyNames(newRenewCertFlags.ClusterID, csr.DNSNames)
+	}
+	if pki.IsNameNotAllowed(err) {
+		return maskAnyf(invalidCSRError, "'%s' no longer satisfies the PKI role of cluster ID '%s', %s", newRenewCertFlags.CSRFile, newRenewCertFlags.ClusterID, err.Error())
+	} else if err != nil {
+		return maskAny(err)
+	}
+
+	newSignConfig := spec.SignConfig{
+		ClusterID: newRenewCertFlags.ClusterID,
+		CSR:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		TTL:       ttl,
+	}
+	newSignResponse, err := newCertSigner.Sign(newSignConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Make sure the renewed certificate is issued for the key of the CSR, since
+	// keeping the key is the point of renewing this way.
+	crt, err := parseCertPEM([]byte(newSignResponse.Certificate))
+	if err != nil {
+		return maskAny(err)
+	}
+	if !bytes.Equal(crt.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) {
+		return maskAnyf(invalidCSRError, "renewed certificate '%s' is not issued for the key of '%s'", newSignResponse.SerialNumber, newRenewCertFlags.CSRFile)
+	}
+
+	if newRenewCertFlags.CAFilePath != "" {
+		err = writeOutputFile(newRenewCertFlags.CAFilePath, []byte(newSignResponse.IssuingCA), newRenewCertFlags.FileModes.certMode())
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Print the certificate only, so the output can be piped.
+	if newRenewCertFlags.CrtFilePath == "" {
+		fmt.Printf("%s\n", newSignResponse.Certificate)
+		return nil
+	}
+
+	err = writeOutputFile(newRenewCertFlags.CrtFilePath, []byte(newSignResponse.Certificate), newRenewCertFlags.FileModes.certMode())
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Renewed certificate with the following serial number.\n")
+	fmt.Printf("\n")
+	fmt.Printf("    %s (expires %s)\n", newSignResponse.SerialNumber, crt.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("\n")
+	fmt.Printf("Public key written to '%s'.\n", newRenewCertFlags.CrtFilePath)
+	if newRenewCertFlags.CAFilePath != "" {
+		fmt.Printf("Root CA written to '%s'.\n", newRenewCertFlags.CAFilePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+type resignIntermediateFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID       string
+	ParentClusterID string
+
+	// PKI
+	KeyFile string
+	TTL     string
+}
+
+var (
+	resignIntermediateCmd = &cobra.Command{
+		Use:   "resign-intermediate",
+		Short: "Extend the validity of an intermediate CA by re-signing it with its parent CA.",
+		Long: `Extend the validity of an intermediate CA by re-signing it with its parent CA.
+The key of the intermediate CA is kept, so certificates issued by it stay
+valid. Preconditions are:
+
+    - The intermediate CA and its parent CA are both managed in Vault, each
+      in the PKI backend of a cluster ID.
+    - The private key of the intermediate CA is available, because Vault does
+      not expose it. It is only available in case it was exported when the
+      intermediate CA was generated.`,
+		RunE: resignIntermediateRun,
+	}
+
+	newResignIntermediateFlags = &resignIntermediateFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(resignIntermediateCmd)
+	configValidators["resign-intermediate"] = func() []error { return resignIntermediateValidate(newResignIntermediateFlags) }
+
+	newResignIntermediateFlags.Vault.register(resignIntermediateCmd.Flags())
+
+	resignIntermediateCmd.Flags().StringVar(&newResignIntermediateFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI backend holding the intermediate CA.")
+	resignIntermediateCmd.Flags().StringVar(&newResignIntermediateFlags.ParentClusterID, "parent-cluster-id", "", "Cluster ID of the PKI backend holding the parent CA signing the intermediate CA.")
+
+	resignIntermediateCmd.Flags().StringVar(&newResignIntermediateFlags.KeyFile, "key-file", "", "File path of the PEM encoded private key of the intermediate CA.")
+	resignIntermediateCmd.Flags().StringVar(&newResignIntermediateFlags.TTL, "ttl", "43800h", "TTL of the re-signed intermediate CA.") // 5 years
+}
+
+func resignIntermediateValidate(newResignIntermediateFlags *resignIntermediateFlags) []error {
+	var errs []error
+
+	errs = append(errs, newResignIntermediateFlags.Vault.validate()...)
+	if newResignIntermediateFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newResignIntermediateFlags.ParentClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--parent-cluster-id must not be empty"))
+	}
+	if newResignIntermediateFlags.ClusterID != "" && newResignIntermediateFlags.ClusterID == newResignIntermediateFlags.ParentClusterID {
+		errs = append(errs, maskAnyf(invalidConfigError, "--parent-cluster-id must differ from --cluster-id"))
+	}
+	if newResignIntermediateFlags.KeyFile == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--key-file must not be empty"))
+	}
+	if err := validateDuration("--ttl", newResignIntermediateFlags.TTL); err != nil {
+		errs = append(errs, err)
+	}
+	if newResignIntermediateFlags.Vault.sharedMount() != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "resign-intermediate must not be used with --pki-path-style shared, the CA of the shared PKI backend is the one of all clusters"))
+	}
+
+	return errs
+}
+
+func resignIntermediateRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(resignIntermediateValidate(newResignIntermediateFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	key, err := ioutil.ReadFile(newResignIntermediateFlags.KeyFile)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "--key-file: %s", err.Error())
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newResignIntermediateFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to re-sign the intermediate CA.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newResignIntermediateFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	previous, err := pkiService.GetCA(newResignIntermediateFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	resignConfig := pki.ResignIntermediateConfig{
+		ClusterID:       newResignIntermediateFlags.ClusterID,
+		ParentClusterID: newResignIntermediateFlags.ParentClusterID,
+		PrivateKey:      string(key),
+		TTL:             newResignIntermediateFlags.TTL,
+	}
+	resigned, err := pkiService.ResignIntermediate(resignConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Re-signed intermediate CA for cluster ID '%s':\n", newResignIntermediateFlags.ClusterID)
+	fmt.Printf("\n")
+	fmt.Printf("    Previous serial number: %s\n", pki.FormatSerialNumber(previous.SerialNumber))
+	fmt.Printf("    Previous expiration:    %s\n", previous.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("    New serial number:      %s\n", pki.FormatSerialNumber(resigned.SerialNumber))
+	fmt.Printf("    New expiration:         %s\n", resigned.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("\n")
+
+	return nil
+}
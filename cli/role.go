@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/state"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type roleDiffFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// Spec
+	FromFile string
+
+	// Output
+	Output string
+}
+
+// roleDiffResult is the machine readable drift report printed by role diff
+// when using --output json.
+type roleDiffResult struct {
+	ClusterID string         `json:"cluster_id"`
+	Drifted   bool           `json:"drifted"`
+	Changes   []state.Change `json:"changes"`
+}
+
+var (
+	roleCmd = &cobra.Command{
+		Use:   "role",
+		Short: "Inspect the PKI roles of clusters.",
+		RunE:  groupRun,
+	}
+
+	roleDiffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the live PKI role of a cluster against a spec file.",
+		Long: `Compare the live PKI role of a cluster against a spec file. The spec is
+written in the same HCL, JSON or YAML format the apply command reads. The role
+of the cluster block labeled with --cluster-id is used, or the role of the only
+cluster block in case there is no such block, e.g. to compare a template
+against a cluster. Nothing is changed in Vault.
+
+Only fields given by the spec are compared. Fields the live role lacks are
+shown as additions, fields the spec sets empty as removals. The command exits
+with code 6 in case the role drifted, so it can guard CI pipelines.`,
+		RunE: roleDiffRun,
+	}
+
+	newRoleDiffFlags = &roleDiffFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(roleCmd)
+	roleCmd.AddCommand(roleDiffCmd)
+	configValidators["role diff"] = func() []error { return roleDiffValidate(newRoleDiffFlags) }
+
+	newRoleDiffFlags.Vault.register(roleDiffCmd.Flags())
+
+	roleDiffCmd.Flags().StringVar(&newRoleDiffFlags.ClusterID, "cluster-id", "", "Cluster ID of the PKI role being compared.")
+
+	roleDiffCmd.Flags().StringVarP(&newRoleDiffFlags.FromFile, "from-file", "f", "", "Spec file describing the desired PKI role.")
+
+	roleDiffCmd.Flags().StringVar(&newRoleDiffFlags.Output, "output", "text", "Output format of the drift report. One of text or json.")
+}
+
+func roleDiffValidate(newRoleDiffFlags *roleDiffFlags) []error {
+	var errs []error
+
+	errs = append(errs, newRoleDiffFlags.Vault.validate()...)
+	if newRoleDiffFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if newRoleDiffFlags.FromFile == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--from-file must not be empty"))
+	}
+	if err := validateOutput(newRoleDiffFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func roleDiffRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(roleDiffValidate(newRoleDiffFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	spec, err := state.ParseFile(newRoleDiffFlags.FromFile)
+	if err != nil {
+		return maskAny(err)
+	}
+	clusterSpec, err := roleDiffClusterSpec(spec, newRoleDiffFlags.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newRoleDiffFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to read the live PKI role.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newRoleDiffFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a token generator, which the state service depends on.
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = tracer
+		tokenConfig.VaultClient = newVaultClient
+		tokenConfig.SharedMount = newRoleDiffFlags.Vault.sharedMount()
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a state service to compare the role.
+	var stateService state.Service
+	{
+		stateConfig := state.DefaultServiceConfig()
+		stateConfig.PKIService = pkiService
+		stateConfig.TokenService = tokenService
+		stateConfig.SharedMount = newRoleDiffFlags.Vault.sharedMount()
+		stateService, err = state.NewService(stateConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	changes, err := stateService.DiffRole(clusterSpec)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	result := roleDiffResult{
+		ClusterID: newRoleDiffFlags.ClusterID,
+		Drifted:   len(changes) > 0,
+		Changes:   changes,
+	}
+	if newRoleDiffFlags.Output == "json" {
+		err = printJSON(result)
+		if err != nil {
+			return maskAny(err)
+		}
+	} else if !result.Drifted {
+		fmt.Printf("PKI role of cluster ID '%s' matches '%s'.\n", result.ClusterID, newRoleDiffFlags.FromFile)
+	} else {
+		fmt.Printf("PKI role of cluster ID '%s' drifted from '%s':\n", result.ClusterID, newRoleDiffFlags.FromFile)
+		fmt.Printf("\n")
+		for _, c := range changes {
+			switch {
+			case c.Before == "":
+				fmt.Printf("    + %s: '%s'\n", c.Field, c.After)
+			case c.After == "":
+				fmt.Printf("    - %s: '%s'\n", c.Field, c.Before)
+			default:
+				fmt.Printf("    ~ %s: '%s' -> '%s'\n", c.Field, c.Before, c.After)
+			}
+		}
+		fmt.Printf("\n")
+	}
+
+	if result.Drifted {
+		return maskAnyf(driftDetectedError, "PKI role of cluster ID '%s' has %d change(s)", result.ClusterID, len(changes))
+	}
+
+	return nil
+}
+
+// roleDiffClusterSpec returns the cluster spec of the given cluster ID within
+// the given spec. In case there is no such cluster, the only cluster of the
+// spec is used for the given cluster ID.
+func roleDiffClusterSpec(spec state.Spec, clusterID string) (state.ClusterSpec, error) {
+	for _, c := range spec.Clusters {
+		if c.ID == clusterID {
+			return c, nil
+		}
+	}
+	if len(spec.Clusters) == 1 {
+		c := spec.Clusters[0]
+		c.ID = clusterID
+		return c, nil
+	}
+
+	return state.ClusterSpec{}, maskAnyf(invalidConfigError, "--from-file must hold a cluster block labeled '%s' or a single cluster block", clusterID)
+}
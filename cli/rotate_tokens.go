@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/certctl"
+	"github.com/giantswarm/certctl/service/secret-sink"
+)
+
+type rotateTokensFlags struct {
+	// Token
+	Tokens createTokensFlags
+
+	// Rotation
+	RevokeOld bool
+
+	// Safety
+	Force bool
+}
+
+var (
+	rotateTokensCmd = &cobra.Command{
+		Use:   "rotate-tokens",
+		Short: "Replace the tokens of an already set up cluster with new ones.",
+		Long: `Replace the tokens of an already set up cluster with new ones. The new tokens
+are created the same way create-tokens creates them and written to --sink
+before any old token is revoked, so consumers never run out of valid tokens.
+
+Old tokens are the tokens created by certctl for the cluster, identified by
+their cluster-id metadata. They are looked up before the new tokens are created
+and only revoked when --revoke-old is given. Otherwise their accessors are
+reported, so they can be revoked once all consumers use the new tokens.`,
+		RunE: rotateTokensRun,
+	}
+
+	newRotateTokensFlags = &rotateTokensFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(rotateTokensCmd)
+	configValidators["rotate-tokens"] = func() []error { return rotateTokensValidate(newRotateTokensFlags) }
+
+	newRotateTokensFlags.Tokens.register(rotateTokensCmd.Flags())
+
+	rotateTokensCmd.Flags().BoolVar(&newRotateTokensFlags.RevokeOld, "revoke-old", false, "Revoke the old tokens of the cluster after the new tokens are written. (Default false)")
+
+	rotateTokensCmd.Flags().BoolVar(&newRotateTokensFlags.Force, "force", false, "Change Vault even in case a maintenance operation, e.g. a rekey or a seal migration, is in progress. (Default false)")
+}
+
+func rotateTokensValidate(newRotateTokensFlags *rotateTokensFlags) []error {
+	return createTokensValidate(&newRotateTokensFlags.Tokens)
+}
+
+func rotateTokensRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(rotateTokensValidate(newRotateTokensFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+	clusterID := newRotateTokensFlags.Tokens.ClusterID
+
+	// Open the sink before touching Vault, so misconfigured sinks fail early.
+	sink, err := secretsink.Open(newRotateTokensFlags.Tokens.Sink)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newRotateTokensFlags.Tokens.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = verifyNoMaintenance(newVaultClient, newRotateTokensFlags.Force)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a certctl service to create and revoke the tokens of the set up
+	// cluster.
+	var certctlService certctl.Service
+	{
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = newVaultClient
+		certctlConfig.SharedMount = newRotateTokensFlags.Tokens.Vault.sharedMount()
+		certctlService, err = certctl.NewService(certctlConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+	tokenService := certctlService.Token()
+
+	// The old tokens are looked up first, so the new tokens are not part of
+	// them.
+	oldAccessors, err := tokenService.ListAccessors(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	tokenResult, err := createClusterTokens(&newRotateTokensFlags.Tokens, certctlService)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = sink.WriteTokens(clusterID, tokenResult.IDs())
+	if err != nil {
+		printPartialTokens(tokenResult)
+		return maskAny(err)
+	}
+
+	// The summary is printed to stderr, since the new tokens may be written to
+	// stdout.
+	fmt.Fprintf(os.Stderr, "Created %d new token(s) for cluster ID '%s'.\n", len(tokenResult.Tokens), clusterID)
+
+	if len(oldAccessors) == 0 {
+		fmt.Fprintf(os.Stderr, "No old tokens found.\n")
+		return nil
+	}
+	if !newRotateTokensFlags.RevokeOld {
+		printWarning("%d old token(s) are still valid. Revoke them using --revoke-old or their accessors, e.g. 'vault token revoke -accessor <accessor>':", len(oldAccessors))
+		for _, a := range oldAccessors {
+			fmt.Fprintf(os.Stderr, "    %s\n", a)
+		}
+		return nil
+	}
+
+	err = tokenService.RevokeAccessors(oldAccessors)
+	if err != nil {
+		return maskAny(err)
+	}
+	fmt.Fprintf(os.Stderr, "Revoked %d old token(s).\n", len(oldAccessors))
+
+	return nil
+}
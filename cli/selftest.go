@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/giantswarm/go-uuid/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/certctl"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+type selftestFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cleanup
+	Keep bool
+}
+
+var (
+	selftestCmd = &cobra.Command{
+		Use:   "selftest",
+		Short: "Verify Vault is able to serve certctl using a temporary cluster.",
+		Long: `Verify Vault is able to serve certctl using a temporary cluster. A scratch
+cluster is set up, a certificate is issued using a generated token, verified
+against the root CA and revoked. The scratch cluster is cleaned up afterwards,
+even in case a step failed.`,
+		RunE: selftestRun,
+	}
+
+	newSelftestFlags = &selftestFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(selftestCmd)
+	configValidators["selftest"] = func() []error { return selftestValidate(newSelftestFlags) }
+
+	newSelftestFlags.Vault.register(selftestCmd.Flags())
+
+	selftestCmd.Flags().BoolVar(&newSelftestFlags.Keep, "keep", false, "Keep the scratch cluster for inspection instead of cleaning it up. (Default false)")
+}
+
+func selftestValidate(newSelftestFlags *selftestFlags) []error {
+	return newSelftestFlags.Vault.validate()
+}
+
+func selftestRun(cmd *cobra.Command, args []string) (err error) {
+	err = joinErrors(selftestValidate(newSelftestFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newSelftestFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	var certctlService certctl.Service
+	{
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = newVaultClient
+		certctlConfig.SharedMount = newSelftestFlags.Vault.sharedMount()
+		certctlService, err = certctl.NewService(certctlConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	clusterID := "selftest-" + uuid.New()[:8]
+	commonName := clusterID + ".certctl.local"
+
+	fmt.Printf("Running self test using scratch cluster ID '%s':\n", clusterID)
+	fmt.Printf("\n")
+
+	var tokens []string
+	defer func() {
+		if newSelftestFlags.Keep {
+			fmt.Printf("\n")
+			fmt.Printf("Keeping scratch cluster '%s' for inspection.\n", clusterID)
+			if len(tokens) > 0 {
+				fmt.Printf("Generated token: %s\n", tokens[0])
+			}
+			return
+		}
+
+		cleanupErr := selftestStep("cleanup", func() error {
+			if len(tokens) > 0 {
+				err := certctlService.Token().Revoke(tokens)
+				if err != nil {
+					return maskAny(err)
+				}
+			}
+			err := certctlService.Cleanup(clusterID)
+			if err != nil {
+				return maskAny(err)
+			}
+
+			return nil
+		})
+		if err == nil {
+			err = cleanupErr
+		}
+	}()
+
+	err = selftestStep("setup", func() error {
+		setupConfig := certctl.SetupConfig{
+			PKI: pki.CreateConfig{
+				AllowedDomains: commonName,
+				ClusterID:      clusterID,
+				CommonName:     commonName,
+				TTL:            "24h",
+			},
+			Tokens: token.CreateConfig{
+				Num: 1,
+				TTL: "1h",
+			},
+			// The chain is verified against the issued certificate later on.
+			SkipVerify: true,
+		}
+		// Tokens created before a failure are revoked on cleanup as well.
+		setupResult, err := certctlService.Setup(setupConfig)
+		tokens = setupResult.Tokens.IDs()
+		if err != nil {
+			return maskAny(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Issue the certificate using the generated token to verify the PKI issue
+	// policy grants the necessary permissions.
+	var issueResponse spec.IssueResponse
+	err = selftestStep("issue", func() error {
+		tokenFlags := newSelftestFlags.Vault
+		tokenFlags.Token = tokens[0]
+		tokenFlags.TokenEnv = ""
+		tokenFlags.TokenSink = ""
+		tokenVaultClient, err := createVaultClient(&tokenFlags)
+		if err != nil {
+			return maskAny(err)
+		}
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = tokenVaultClient
+		certctlConfig.SharedMount = tokenFlags.sharedMount()
+		tokenCertctlService, err := certctl.NewService(certctlConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+
+		issueConfig := spec.IssueConfig{
+			ClusterID:  clusterID,
+			CommonName: "selftest." + commonName,
+			TTL:        "1h",
+		}
+		issueResponse, err = tokenCertctlService.Issue(issueConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = selftestStep("verify", func() error {
+		return verifyChain(issueResponse, "selftest."+commonName)
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = selftestStep("revoke", func() error {
+		return certctlService.Revoke(clusterID, issueResponse.SerialNumber)
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// selftestStep runs the given self test step and reports its result.
+func selftestStep(name string, f func() error) error {
+	err := f()
+	if err != nil {
+		fmt.Printf("    %-8s FAIL: %s\n", name, err.Error())
+		return maskAny(err)
+	}
+
+	fmt.Printf("    %-8s ok\n", name)
+
+	return nil
+}
+
+// verifyChain verifies the certificate of the given issue response is valid
+// for the given DNS name and signed by the issuing CA of the response.
+func verifyChain(issueResponse spec.IssueResponse, dnsName string) error {
+	crt, err := parseCertificate(issueResponse.Certificate)
+	if err != nil {
+		return maskAny(err)
+	}
+	ca, err := parseCertificate(issueResponse.IssuingCA)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err = crt.Verify(x509.VerifyOptions{
+		DNSName: dnsName,
+		Roots:   roots,
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// parseCertificate parses the given PEM encoded certificate.
+func parseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, maskAnyf(invalidCertificateError, "no PEM data found")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, maskAnyf(invalidCertificateError, "%s", err.Error())
+	}
+
+	return crt, nil
+}
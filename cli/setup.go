@@ -2,40 +2,147 @@ package cli
 
 import (
 	"fmt"
-	"log"
-	"net/http"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/giantswarm/certctl/service/certctl"
+	"github.com/giantswarm/certctl/service/health"
+	"github.com/giantswarm/certctl/service/k8s-secret"
 	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/secret-sink"
+	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/state"
 	"github.com/giantswarm/certctl/service/token"
-	"github.com/giantswarm/certctl/service/vault-factory"
 )
 
 type setupFlags struct {
 	// Vault
-	VaultAddress string
-	VaultToken   string
+	Vault vaultFlags
 
 	// Cluster
 	ClusterID string
 
 	// PKI
 	AllowedDomains   string
+	DomainsFromCert  string
 	CommonName       string
+	CNTemplate       string
+	CASubject        pki.Subject
+	LeafSubject      pki.Subject
+	CAType           string
+	OnConflict       string
+	MountDescription string
+	CABundleFile     string
+	CAKeyRef         string
 	CATTL            string
+	NotAfter         string
+	AutoTuneMount    bool
+	RegenerateCA     time.Duration
 	AllowBareDomains bool
+	AllowedSerials   string
+	KeyUsage         string
+	RequireCN        bool
+	UsePSS           bool
+	SignatureBits    int
+	GenerateLease    bool
+	NoStore          bool
+	RoleParams       []string
+	Roles            []string
+
+	// Policy
+	SkipPolicy bool
 
 	// Token
-	NumTokens int
-	TokenTTL  string
+	NumTokens     int
+	TokenTTL      string
+	TokenMaxTTL   string
+	TokenJitter   time.Duration
+	TokenPolicies string
+	TokenRole     string
+	CreateRole    bool
+	CreateEntity  bool
+
+	// Kubernetes
+	TokensK8sSecret string
+
+	// Handoff
+	TokensFD           int
+	TokensSink         string
+	TokensSystemdCreds string
+
+	// Output
+	Output string
+
+	// Plan
+	DryRun     bool
+	Idempotent bool
+
+	// Rollback
+	RollbackOnFailure bool
+
+	// Verification
+	SkipVerify bool
+
+	// Readiness
+	WaitForUnseal   bool
+	Timeout         string
+	PollInterval    string
+	PollMaxInterval string
+
+	// Safety
+	Force bool
+
+	// Confirmation
+	Yes bool
+
+	// Progress
+	Quiet bool
+}
+
+// setupResult is the machine readable summary printed by setup when using
+// --output json.
+type setupResult struct {
+	ClusterID      string   `json:"cluster_id"`
+	MountPath      string   `json:"mount_path"`
+	RoleName       string   `json:"role_name"`
+	RolePath       string   `json:"role_path"`
+	RoleCreated    bool     `json:"role_created"`
+	NamedRoles     []string `json:"named_role_paths,omitempty"`
+	NamedCreated   []string `json:"named_roles_created,omitempty"`
+	PolicyName     string   `json:"policy_name,omitempty"`
+	TokenRole      string   `json:"token_role,omitempty"`
+	EntityID       string   `json:"entity_id,omitempty"`
+	CACert         string   `json:"ca_cert"`
+	CASerial       string   `json:"ca_serial_number"`
+	CAExpiration   string   `json:"ca_expiration"`
+	CAGenerated    bool     `json:"ca_generated"`
+	CAImported     bool     `json:"ca_imported,omitempty"`
+	IssuerID       string   `json:"issuer_id,omitempty"`
+	IssuerDefault  bool     `json:"issuer_default,omitempty"`
+	MountTuned     bool     `json:"mount_tuned,omitempty"`
+	CARegenerated  bool     `json:"ca_regenerated,omitempty"`
+	PreviousCAExp  string   `json:"previous_ca_expiration,omitempty"`
+	CAChainLength  int      `json:"ca_chain_verified_length,omitempty"`
+	Tokens         []string `json:"tokens,omitempty"`
+	TokenAccessors []string `json:"token_accessors,omitempty"`
+	TokensSecret   string   `json:"tokens_k8s_secret,omitempty"`
+	TokensFD       int      `json:"tokens_fd,omitempty"`
+	TokensSink     string   `json:"tokens_sink,omitempty"`
+	TokensCredsDir string   `json:"tokens_systemd_creds,omitempty"`
+	TokensSkipped  bool     `json:"tokens_skipped,omitempty"`
+	Updated        []string `json:"updated,omitempty"`
 }
 
 var (
 	setupCmd = &cobra.Command{
 		Use:   "setup",
 		Short: "Setup a Vault PKI backend including all necessary requirements.",
-		Run:   setupRun,
+		RunE:  setupRun,
 	}
 
 	newSetupFlags = &setupFlags{}
@@ -43,124 +150,1145 @@ var (
 
 func init() {
 	CLICmd.AddCommand(setupCmd)
+	configValidators["setup"] = func() []error { return setupValidate(newSetupFlags) }
 
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultAddress, "vault-addr", fromEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "Address used to connect to Vault.")
-	setupCmd.Flags().StringVar(&newSetupFlags.VaultToken, "vault-token", fromEnv("VAULT_TOKEN", ""), "Token used to authenticate against Vault.")
+	newSetupFlags.Vault.register(setupCmd.Flags())
 
 	setupCmd.Flags().StringVar(&newSetupFlags.ClusterID, "cluster-id", "", "Cluster ID used to generate a new root CA for.")
 
 	setupCmd.Flags().StringVar(&newSetupFlags.AllowedDomains, "allowed-domains", "", "Comma separated domains allowed to authenticate against the cluster's root CA.")
+	setupCmd.Flags().StringVar(&newSetupFlags.DomainsFromCert, "allowed-domains-from-cert", "", "File path of a PEM encoded certificate whose DNS SANs are added to --allowed-domains, e.g. when migrating. The extracted domains must be confirmed using --yes.")
 	setupCmd.Flags().StringVar(&newSetupFlags.CommonName, "common-name", "", "Common name used to generate a new root CA for.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CNTemplate, "common-name-template", "", "Go template rendering the common name of a new root CA in case --common-name is not given, e.g. '{{.ClusterID}} Root CA'. .ClusterID is the only field.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CASubject.Country, "ca-country", "", "Comma separated countries (C) of the root CA's subject.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CASubject.Locality, "ca-locality", "", "Comma separated localities (L) of the root CA's subject.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CASubject.Organization, "ca-organization", "", "Comma separated organizations (O) of the root CA's subject.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CASubject.OrganizationalUnit, "ca-ou", "", "Comma separated organizational units (OU) of the root CA's subject.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CASubject.Province, "ca-province", "", "Comma separated provinces (ST) of the root CA's subject.")
+	setupCmd.Flags().StringVar(&newSetupFlags.LeafSubject.Country, "country", "", "Comma separated countries (C) of issued certs' subjects.")
+	setupCmd.Flags().StringVar(&newSetupFlags.LeafSubject.Locality, "locality", "", "Comma separated localities (L) of issued certs' subjects.")
+	setupCmd.Flags().StringVar(&newSetupFlags.LeafSubject.Organization, "organization", "", "Comma separated organizations (O) of issued certs' subjects.")
+	setupCmd.Flags().StringVar(&newSetupFlags.LeafSubject.OrganizationalUnit, "ou", "", "Comma separated organizational units (OU) of issued certs' subjects.")
+	setupCmd.Flags().StringVar(&newSetupFlags.LeafSubject.Province, "province", "", "Comma separated provinces (ST) of issued certs' subjects.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CAType, "ca-type", "", "How the root CA is set up. One of generate, existing or import. existing uses the root CA of the already mounted PKI backend, import requires --ca-bundle-file. Defaults to import when --ca-bundle-file is given, generate otherwise.")
+	setupCmd.Flags().StringVar(&newSetupFlags.OnConflict, "on-conflict", pki.OnConflictReuse, "How an existing mount at the PKI backend's path is handled. One of reuse, fail or error. reuse reuses any PKI backend, fail only PKI backends mounted by certctl, error fails for every existing mount.")
+	setupCmd.Flags().StringVar(&newSetupFlags.MountDescription, "mount-description", "", "Description the PKI backend is mounted with. The marker certctl:cluster=<cluster-id> identifying PKI backends mounted by certctl is always appended. Defaults to a description naming the cluster ID.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CABundleFile, "ca-bundle-file", "", "File path of a PEM bundle containing the certificate and private key of an existing root CA to import instead of generating a new one.")
+	setupCmd.Flags().StringVar(&newSetupFlags.CAKeyRef, "ca-key-ref", "", "ID or name of an existing key of the PKI backend the root CA is generated with, e.g. a key imported beforehand. A new root CA issuer becoming the default issuer is generated even when a root CA exists, unless an issuer uses the key already. Requires Vault supporting multiple issuers.")
 	setupCmd.Flags().StringVar(&newSetupFlags.CATTL, "ca-ttl", "86400h", "TTL used to generate a new root CA.") // 10 years
+	setupCmd.Flags().StringVar(&newSetupFlags.NotAfter, "not-after", "", "RFC3339 timestamp, e.g. 2030-12-31T23:59:59Z, the generated root CA expires at instead of after --ca-ttl. Must lie in the future.")
+	setupCmd.Flags().DurationVar(&newSetupFlags.RegenerateCA, "regenerate-ca-if-expiring-within", 0, "Replace the root CA by a newly generated root CA issuer in case the existing one expires within the given duration, e.g. 2160h. Otherwise the root CA is left as it is. Certificates issued by the previous root CA are not trusted by the new one. Requires --yes and Vault supporting multiple issuers. Zero disables regenerating.")
+	setupCmd.Flags().BoolVar(&newSetupFlags.AutoTuneMount, "auto-tune-mount", false, "Raise the max lease TTL of an existing PKI backend to the TTL of the generated root CA in case it is lower. Otherwise setup warns about the root CA being capped by it. (Default false)")
 	setupCmd.Flags().BoolVar(&newSetupFlags.AllowBareDomains, "allow-bare-domains", false, "Allow issuing certs for bare domains. (Default false)")
+	setupCmd.Flags().BoolVar(&newSetupFlags.RequireCN, "require-cn", true, "Require a common name for issued certs. Disable to allow certs identified by their alt names or IP SANs only.")
+	setupCmd.Flags().StringVar(&newSetupFlags.KeyUsage, "key-usage", "", "Comma separated key usages of issued certs, e.g. DigitalSignature,KeyEncipherment. none, or an explicitly empty value, issues certs without key usage. Defaults to Vault's default when not given.")
+	setupCmd.Flags().BoolVar(&newSetupFlags.UsePSS, "use-pss", false, "Sign issued certs, and a generated root CA, using RSA-PSS signatures. Requires an RSA root CA. (Default false)")
+	setupCmd.Flags().IntVar(&newSetupFlags.SignatureBits, "signature-bits", 0, "Bits of the hash algorithm used to sign issued certs and a generated root CA. One of 256, 384 or 512. Defaults to Vault's default for the key type of the root CA.")
+	setupCmd.Flags().StringVar(&newSetupFlags.AllowedSerials, "allowed-serial-numbers", "", "Comma separated values allowed for the serialNumber RDN of issued certs' subjects, e.g. device identities. Values may contain * globs.")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.GenerateLease, "generate-lease", false, "Generate a Vault lease for every issued cert. Leases are costly for roles issuing many certs. (Default false)")
+	setupCmd.Flags().BoolVar(&newSetupFlags.NoStore, "no-store", false, "Do not store issued certs in Vault. Keeps storage cheap for many short lived certs, but issued certs can not be revoked via Vault. (Default false)")
+	stringArrayVar(setupCmd.Flags(), &newSetupFlags.RoleParams, "role-param", "Additional PKI role parameter of the form key=value. Can be given multiple times. Typed flags take precedence on conflict.")
+	stringArrayVar(setupCmd.Flags(), &newSetupFlags.Roles, "role", "Additional named PKI role of the form name=<name>,domains=<domains>[,ttl=<ttl>][,key_usage=<usages>][,allow_bare_domains=<bool>], e.g. for separate server and client roles. Options not given are taken from the flags configuring the default role. Can be given multiple times.")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.SkipPolicy, "skip-policy", false, "Do not create the PKI issue policy. Policies are then managed by the operator. (Default false)")
 
 	setupCmd.Flags().IntVar(&newSetupFlags.NumTokens, "num-tokens", 1, "Number of tokens to generate.")
 	setupCmd.Flags().StringVar(&newSetupFlags.TokenTTL, "token-ttl", "720h", "TTL used to generate new tokens.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TokenMaxTTL, "token-max-ttl", "", "Explicit max TTL new tokens can be renewed up to. Must not be shorter than --token-ttl. Defaults to the max TTL configured in Vault.")
+	setupCmd.Flags().DurationVar(&newSetupFlags.TokenJitter, "ttl-jitter", 0, "Window each token's TTL is randomly shortened within, e.g. 24h, so expiries of many tokens spread out. Must be shorter than --token-ttl. Zero disables jitter.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TokenPolicies, "token-policies", "", "Comma separated existing policies attached to generated tokens. Defaults to the cluster's PKI issue policy.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TokenRole, "token-role", "", "Existing token role new tokens are created against.")
+	setupCmd.Flags().BoolVar(&newSetupFlags.CreateRole, "create-token-role", false, "Create a token role for the cluster and create new tokens against it. (Default false)")
+	setupCmd.Flags().BoolVar(&newSetupFlags.CreateEntity, "create-entity", false, "Create an identity entity for the cluster and associate new tokens with it using an entity alias. Requires --create-token-role. (Default false)")
+
+	setupCmd.Flags().StringVar(&newSetupFlags.TokensK8sSecret, "tokens-k8s-secret", "", "Kubernetes Secret of the form namespace/name used to store the generated tokens in instead of printing them. Requires running inside a Kubernetes cluster.")
+
+	setupCmd.Flags().IntVar(&newSetupFlags.TokensFD, "tokens-fd", 0, "File descriptor, e.g. a pipe supplied by the parent process, used to write the generated tokens to instead of printing them. One token per line.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TokensSystemdCreds, "tokens-systemd-creds", "", "Existing directory, e.g. /etc/credstore, the generated tokens are written to as systemd credentials instead of printing them. Each token is written to vault-token-<n> with mode 0400, so units can load it using LoadCredential.")
+	setupCmd.Flags().StringVar(&newSetupFlags.TokensSink, "sink", "stdout", "Sink the generated tokens are written to. One of stdout, file:<path>, fd:<n>, env[:<path>], k8s:<namespace>/<name> or systemd-creds:<dir>. --tokens-k8s-secret, --tokens-fd and --tokens-systemd-creds are shortcuts for the k8s, fd and systemd-creds sinks.")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.DryRun, "dry-run", false, "Print the changes setup would make to Vault without making them. Combined with --idempotent, changed fields of existing roles and the policy are shown as well. (Default false)")
+	setupCmd.Flags().BoolVar(&newSetupFlags.Idempotent, "idempotent", false, "Update existing PKI roles and the PKI policy of a cluster set up before to match the given flags. Tokens are only generated in case the cluster was not set up before, so running setup again changes nothing. (Default false)")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.RollbackOnFailure, "rollback-on-failure", false, "Remove the resources created by setup in reverse order in case a step fails, e.g. unmount a newly mounted PKI backend and revoke created tokens. Resources existing before are not touched. (Default false)")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.SkipVerify, "skip-verify", false, "Do not verify the CA chain of the cluster is internally consistent after setting up the PKI backend. (Default false)")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.WaitForUnseal, "wait-for-unseal", false, "Wait until Vault is reachable, unsealed and active before setting up the cluster. Otherwise setup fails on a sealed Vault. (Default false)")
+	setupCmd.Flags().StringVar(&newSetupFlags.Timeout, "timeout", "5m", "Maximum time to wait for Vault when using --wait-for-unseal.")
+	setupCmd.Flags().StringVar(&newSetupFlags.PollInterval, "poll-interval", "1s", "Time between the first two health checks when using --wait-for-unseal. It doubles after every further check up to --poll-max-interval.")
+	setupCmd.Flags().StringVar(&newSetupFlags.PollMaxInterval, "poll-max-interval", "30s", "Maximum time between two health checks when using --wait-for-unseal.")
+
+	setupCmd.Flags().BoolVar(&newSetupFlags.Force, "force", false, "Change Vault even in case a maintenance operation, e.g. a rekey or a seal migration, is in progress. (Default false)")
+	setupCmd.Flags().BoolVar(&newSetupFlags.Yes, "yes", false, "Proceed despite warnings about implausible configuration and confirm replacing the root CA using --regenerate-ca-if-expiring-within. Not required using --dry-run. (Default false)")
+
+	setupCmd.Flags().BoolVarP(&newSetupFlags.Quiet, "quiet", "q", false, "Do not print progress information to stderr. (Default false)")
+
+	setupCmd.Flags().StringVar(&newSetupFlags.Output, "output", "text", "Output format of the setup summary. One of text or json.")
 }
 
-func setupValidate(newSetupFlags *setupFlags) error {
-	if newSetupFlags.VaultToken == "" {
-		return maskAnyf(invalidConfigError, "Vault token must not be empty")
+func setupValidate(newSetupFlags *setupFlags) []error {
+	var errs []error
+
+	errs = append(errs, newSetupFlags.Vault.validate()...)
+	if newSetupFlags.DomainsFromCert != "" {
+		if domains, _, err := certSANs(newSetupFlags.DomainsFromCert); err != nil {
+			errs = append(errs, err)
+		} else if len(domains) == 0 && newSetupFlags.AllowedDomains == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--allowed-domains must not be empty, --allowed-domains-from-cert has no DNS SANs"))
+		}
 	}
-	if newSetupFlags.AllowedDomains == "" {
-		return maskAnyf(invalidConfigError, "allowed domains must not be empty")
+	if newSetupFlags.AllowedDomains == "" && newSetupFlags.DomainsFromCert == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--allowed-domains must not be empty unless --allowed-domains-from-cert is given"))
+	} else if newSetupFlags.AllowedDomains != "" {
+		if err := validateDomains("--allowed-domains", newSetupFlags.AllowedDomains); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	if newSetupFlags.ClusterID == "" {
-		return maskAnyf(invalidConfigError, "cluster ID must not be empty")
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	// The common name is optional in case the root CA's subject is built from
+	// other components. It is not used at all in case an existing root CA is
+	// used or imported.
+	switch setupCAType(newSetupFlags) {
+	case "generate":
+		if newSetupFlags.CNTemplate != "" {
+			if _, err := setupCommonName(newSetupFlags); err != nil {
+				errs = append(errs, err)
+			}
+		} else if newSetupFlags.CommonName == "" && newSetupFlags.CASubject.Empty() {
+			errs = append(errs, maskAnyf(invalidConfigError, "--common-name must not be empty unless --common-name-template or any of --ca-country, --ca-locality, --ca-organization, --ca-ou or --ca-province is given"))
+		}
+		if newSetupFlags.CABundleFile != "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ca-bundle-file must not be given with --ca-type generate"))
+		}
+	case "existing":
+		if newSetupFlags.CommonName != "" || newSetupFlags.CNTemplate != "" || !newSetupFlags.CASubject.Empty() {
+			errs = append(errs, maskAnyf(invalidConfigError, "--common-name, --common-name-template and the --ca-* subject flags must not be given with --ca-type existing"))
+		}
+		if newSetupFlags.CABundleFile != "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ca-bundle-file must not be given with --ca-type existing"))
+		}
+	case "import":
+		if newSetupFlags.CommonName != "" || newSetupFlags.CNTemplate != "" || !newSetupFlags.CASubject.Empty() {
+			errs = append(errs, maskAnyf(invalidConfigError, "--common-name, --common-name-template and the --ca-* subject flags must not be given when using --ca-bundle-file"))
+		}
+		if newSetupFlags.CABundleFile == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ca-bundle-file must not be empty with --ca-type import"))
+		} else if _, err := readCABundle("--ca-bundle-file", newSetupFlags.CABundleFile); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--ca-type must be one of generate, existing or import"))
+	}
+	switch newSetupFlags.OnConflict {
+	case pki.OnConflictReuse, pki.OnConflictFail, pki.OnConflictError:
+		if newSetupFlags.OnConflict == pki.OnConflictError && setupCAType(newSetupFlags) == "existing" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--on-conflict error must not be given with --ca-type existing, which requires a mounted PKI backend"))
+		}
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--on-conflict must be one of reuse, fail or error"))
+	}
+	if newSetupFlags.RegenerateCA < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--regenerate-ca-if-expiring-within must not be negative"))
+	} else if newSetupFlags.RegenerateCA > 0 {
+		if setupCAType(newSetupFlags) != "generate" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--regenerate-ca-if-expiring-within must only be given with --ca-type generate"))
+		}
+		if newSetupFlags.CAKeyRef != "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--regenerate-ca-if-expiring-within and --ca-key-ref must not be given together"))
+		}
+		if newSetupFlags.Vault.sharedMount() != "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--regenerate-ca-if-expiring-within must not be given with --pki-path-style shared, the root CA of the shared PKI backend is the one of all clusters"))
+		}
+		// Scheduled jobs confirm replacing the root CA once, up front, instead
+		// of failing only when it is about to expire.
+		if !newSetupFlags.Yes && !newSetupFlags.DryRun {
+			errs = append(errs, maskAnyf(invalidConfigError, "--regenerate-ca-if-expiring-within replaces the root CA, use --yes to confirm it"))
+		}
+	}
+	if newSetupFlags.AutoTuneMount && setupCAType(newSetupFlags) == "existing" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--auto-tune-mount must not be given with --ca-type existing, which does not generate a root CA"))
+	}
+	if newSetupFlags.AutoTuneMount && newSetupFlags.Vault.sharedMount() != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--auto-tune-mount must not be given with --pki-path-style shared, the max lease TTL of the shared PKI backend caps all clusters"))
+	}
+	if newSetupFlags.CAKeyRef != "" {
+		if setupCAType(newSetupFlags) != "generate" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ca-key-ref must only be given with --ca-type generate"))
+		}
+		if newSetupFlags.OnConflict == pki.OnConflictError {
+			errs = append(errs, maskAnyf(invalidConfigError, "--on-conflict error must not be given with --ca-key-ref, which requires a mounted PKI backend"))
+		}
+	}
+	if err := validateDuration("--ca-ttl", newSetupFlags.CATTL); err != nil {
+		errs = append(errs, err)
+	}
+	if newSetupFlags.NotAfter != "" {
+		if flagChanged("setup", "ca-ttl") {
+			errs = append(errs, maskAnyf(invalidConfigError, "--not-after and --ca-ttl must not be given together"))
+		}
+		if setupCAType(newSetupFlags) != "generate" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--not-after must only be given with --ca-type generate"))
+		}
+		if _, err := pki.NotAfterTTL(newSetupFlags.NotAfter, time.Now()); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--not-after must be an RFC3339 timestamp in the future"))
+		}
+	}
+	if err := validateDuration("--timeout", newSetupFlags.Timeout); err != nil {
+		errs = append(errs, err)
+	}
+	errPoll := validateDuration("--poll-interval", newSetupFlags.PollInterval)
+	if errPoll != nil {
+		errs = append(errs, errPoll)
+	}
+	errPollMax := validateDuration("--poll-max-interval", newSetupFlags.PollMaxInterval)
+	if errPollMax != nil {
+		errs = append(errs, errPollMax)
+	}
+	if errPoll == nil && errPollMax == nil {
+		pollInterval, _ := time.ParseDuration(newSetupFlags.PollInterval)
+		pollMaxInterval, _ := time.ParseDuration(newSetupFlags.PollMaxInterval)
+		if pollMaxInterval < pollInterval {
+			errs = append(errs, maskAnyf(invalidConfigError, "--poll-max-interval must not be shorter than --poll-interval"))
+		}
+	}
+	if newSetupFlags.NumTokens < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--num-tokens must not be negative"))
+	}
+	if err := validateDuration("--token-ttl", newSetupFlags.TokenTTL); err != nil {
+		errs = append(errs, err)
+	}
+	if newSetupFlags.TokenMaxTTL != "" {
+		if err := validateDuration("--token-max-ttl", newSetupFlags.TokenMaxTTL); err != nil {
+			errs = append(errs, err)
+		} else if ttl, err := time.ParseDuration(newSetupFlags.TokenTTL); err == nil {
+			if maxTTL, _ := time.ParseDuration(newSetupFlags.TokenMaxTTL); maxTTL < ttl {
+				errs = append(errs, maskAnyf(invalidConfigError, "--token-max-ttl must not be shorter than --token-ttl"))
+			}
+		}
+	}
+	if newSetupFlags.TokenJitter != 0 {
+		if ttl, err := time.ParseDuration(newSetupFlags.TokenTTL); err == nil && (newSetupFlags.TokenJitter < 0 || newSetupFlags.TokenJitter >= ttl) {
+			errs = append(errs, maskAnyf(invalidConfigError, "--ttl-jitter must not be negative and must be shorter than --token-ttl"))
+		}
+	}
+	roleParams, err := parseKeyValues("--role-param", newSetupFlags.RoleParams)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateKeyUsage("--key-usage", newSetupFlags.KeyUsage); err != nil {
+		errs = append(errs, err)
+	}
+	_, roleErrs := setupRoles(newSetupFlags)
+	errs = append(errs, roleErrs...)
+	if len(newSetupFlags.Roles) > 0 && newSetupFlags.Vault.sharedMount() != "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--role must not be given with --pki-path-style shared, named roles are not specific to a cluster"))
+	}
+	switch newSetupFlags.SignatureBits {
+	case 0, 256, 384, 512:
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--signature-bits must be one of 256, 384 or 512"))
+	}
+	if keyType, ok := roleParams["key_type"]; ok && newSetupFlags.UsePSS && keyType != "rsa" && keyType != "any" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--use-pss requires RSA keys, but --role-param key_type is '%s'", keyType))
+	}
+	if newSetupFlags.SkipPolicy && newSetupFlags.NumTokens > 0 && newSetupFlags.TokenPolicies == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--token-policies must not be empty when using --skip-policy"))
+	}
+	if newSetupFlags.TokenRole != "" && newSetupFlags.CreateRole {
+		errs = append(errs, maskAnyf(invalidConfigError, "--token-role and --create-token-role must not be given together"))
+	}
+	if newSetupFlags.CreateRole && newSetupFlags.SkipPolicy {
+		errs = append(errs, maskAnyf(invalidConfigError, "--create-token-role must not be given with --skip-policy"))
+	}
+	if newSetupFlags.CreateEntity && !newSetupFlags.CreateRole {
+		errs = append(errs, maskAnyf(invalidConfigError, "--create-entity requires --create-token-role"))
+	}
+	if newSetupFlags.TokensK8sSecret != "" {
+		if _, err := k8ssecret.ParseSecretRef(newSetupFlags.TokensK8sSecret); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--tokens-k8s-secret must be of the form namespace/name"))
+		}
+	}
+	if newSetupFlags.TokensFD != 0 {
+		if err := validateFD("--tokens-fd", newSetupFlags.TokensFD); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if newSetupFlags.TokensSystemdCreds != "" {
+		if fi, err := os.Stat(newSetupFlags.TokensSystemdCreds); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--tokens-systemd-creds %s", err.Error()))
+		} else if !fi.IsDir() {
+			errs = append(errs, maskAnyf(invalidConfigError, "--tokens-systemd-creds '%s' must be a directory", newSetupFlags.TokensSystemdCreds))
+		}
 	}
-	if newSetupFlags.CommonName == "" {
-		return maskAnyf(invalidConfigError, "common name must not be empty")
+	if _, _, err := secretsink.ParseRef(newSetupFlags.TokensSink); err != nil {
+		errs = append(errs, maskAnyf(invalidConfigError, "--sink %s", err.Error()))
+	}
+	var sinks int
+	for _, given := range []bool{newSetupFlags.TokensK8sSecret != "", newSetupFlags.TokensFD != 0, newSetupFlags.TokensSystemdCreds != "", newSetupFlags.TokensSink != "stdout"} {
+		if given {
+			sinks++
+		}
+	}
+	if sinks > 1 {
+		errs = append(errs, maskAnyf(invalidConfigError, "only one of --sink, --tokens-k8s-secret, --tokens-fd and --tokens-systemd-creds must be given"))
+	}
+	if err := validateOutput(newSetupFlags.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// keyUsages are the key usages Vault accepts for issued certificates, in
+// lower case and without their optional KeyUsage prefix.
+var keyUsages = map[string]bool{
+	"digitalsignature":  true,
+	"contentcommitment": true,
+	"keyencipherment":   true,
+	"dataencipherment":  true,
+	"keyagreement":      true,
+	"certsign":          true,
+	"crlsign":           true,
+	"encipheronly":      true,
+	"decipheronly":      true,
+}
+
+// validateKeyUsage checks that the value of the given key usage flag lists
+// known key usages, or is none.
+func validateKeyUsage(flag, value string) error {
+	usages := splitList(value)
+	for _, u := range usages {
+		if strings.EqualFold(u, "none") {
+			if len(usages) > 1 {
+				return maskAnyf(invalidConfigError, "%s none must not be combined with other key usages", flag)
+			}
+			continue
+		}
+		if !keyUsages[strings.TrimPrefix(strings.ToLower(u), "keyusage")] {
+			return maskAnyf(invalidConfigError, "%s '%s' is not a key usage", flag, u)
+		}
 	}
 
 	return nil
 }
 
-func setupRun(cmd *cobra.Command, args []string) {
-	err := setupValidate(newSetupFlags)
+// setupRequireCN returns the require_cn option of the PKI roles. Not giving
+// the flag means Vault's default, returned as nil.
+func setupRequireCN(newSetupFlags *setupFlags) *bool {
+	if !flagChanged("setup", "require-cn") {
+		return nil
+	}
+
+	return &newSetupFlags.RequireCN
+}
+
+// setupKeyUsage returns the key usages of the PKI role given by --key-usage.
+// Not giving the flag means Vault's default, returned as nil. none or an
+// explicitly empty value means no key usage, returned as empty list.
+func setupKeyUsage(newSetupFlags *setupFlags) []string {
+	usages := splitList(newSetupFlags.KeyUsage)
+	if len(usages) == 1 && strings.EqualFold(usages[0], "none") {
+		return []string{}
+	}
+	if len(usages) == 0 {
+		if flagChanged("setup", "key-usage") {
+			return []string{}
+		}
+		return nil
+	}
+
+	return usages
+}
+
+// setupWarnings returns warnings about flag values which are valid but likely
+// not intended, e.g. due to typos.
+func setupWarnings(newSetupFlags *setupFlags) []string {
+	var warnings []string
+
+	// Domains read from a certificate are reported for confirmation, so
+	// unexpected SANs do not silently end up in the PKI role.
+	if newSetupFlags.DomainsFromCert != "" {
+		domains, ips, err := certSANs(newSetupFlags.DomainsFromCert)
+		if err == nil {
+			if len(domains) > 0 {
+				warnings = append(warnings, fmt.Sprintf("--allowed-domains-from-cert adds the allowed domains %s", strings.Join(domains, ",")))
+			}
+			if len(domains) > 0 && !newSetupFlags.AllowBareDomains {
+				warnings = append(warnings, "--allowed-domains-from-cert without --allow-bare-domains only allows subdomains of the certificate's SANs, not the SANs themselves")
+			}
+			if len(ips) > 0 {
+				warnings = append(warnings, fmt.Sprintf("--allowed-domains-from-cert found the IP SANs %s, which PKI roles can not restrict, any IP SAN is allowed", strings.Join(ips, ",")))
+			}
+		}
+	}
+
+	// Domain options contradicting each other result in a PKI role not able
+	// to issue what it appears to allow.
+	if roleParams, err := parseKeyValues("--role-param", newSetupFlags.RoleParams); err == nil {
+		extraRoleParams := map[string]interface{}{}
+		for k, v := range roleParams {
+			extraRoleParams[k] = v
+		}
+		createConfig := pki.CreateConfig{
+			AllowedDomains:   setupAllowedDomains(newSetupFlags),
+			AllowBareDomains: newSetupFlags.AllowBareDomains,
+			ExtraRoleParams:  extraRoleParams,
+		}
+		for _, w := range pki.RoleDomainWarnings(createConfig) {
+			warnings = append(warnings, "PKI role: "+w)
+		}
+		roles, _ := setupRoles(newSetupFlags)
+		for _, r := range roles {
+			createConfig.AllowedDomains = r.AllowedDomains
+			createConfig.AllowBareDomains = r.AllowBareDomains
+			for _, w := range pki.RoleDomainWarnings(createConfig) {
+				warnings = append(warnings, fmt.Sprintf("PKI role '%s': %s", r.Name, w))
+			}
+		}
+	}
+
+	// The existing root CA is not affected by --ca-ttl.
+	if setupCAType(newSetupFlags) == "existing" {
+		return warnings
+	}
+
+	caTTLFlag, caTTL := "--ca-ttl", newSetupFlags.CATTL
+	if newSetupFlags.NotAfter != "" {
+		ttl, err := pki.NotAfterTTL(newSetupFlags.NotAfter, time.Now())
+		if err != nil {
+			return warnings
+		}
+		caTTLFlag, caTTL = "--not-after", formatDuration(ttl)
+	}
+
+	if w := durationWarning(caTTLFlag, caTTL, 24*time.Hour, 0); w != "" {
+		warnings = append(warnings, w)
+	}
+	if d, err := time.ParseDuration(caTTL); err == nil && newSetupFlags.NumTokens > 0 {
+		if w := durationWarning("--token-ttl", newSetupFlags.TokenTTL, 0, d); w != "" {
+			warnings = append(warnings, w+" given by "+caTTLFlag)
+		}
+	}
+
+	return warnings
+}
+
+// setupMaxLeaseWarning returns a warning in case the root CA about to be
+// generated is capped by the max lease TTL of an existing PKI backend. Vault
+// silently issues the root CA with the max lease TTL then, e.g. 768h instead
+// of 10 years.
+func setupMaxLeaseWarning(newSetupFlags *setupFlags, pkiService pki.Service) ([]string, error) {
+	if setupCAType(newSetupFlags) != "generate" {
+		return nil, nil
+	}
+
+	mounted, err := pkiService.IsMounted(newSetupFlags.ClusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if !mounted {
+		return nil, nil
+	}
+	generated, err := pkiService.IsCAGenerated(newSetupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return nil, maskAny(err)
+	}
+	if generated && newSetupFlags.CAKeyRef == "" {
+		return nil, nil
 	}
 
-	// Create a Vault client factory.
-	newVaultFactoryConfig := vaultfactory.DefaultConfig()
-	newVaultFactoryConfig.HTTPClient = &http.Client{}
-	newVaultFactoryConfig.Address = newSetupFlags.VaultAddress
-	newVaultFactoryConfig.AdminToken = newSetupFlags.VaultToken
-	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	caTTLFlag := "--ca-ttl"
+	caTTL, err := time.ParseDuration(newSetupFlags.CATTL)
+	if newSetupFlags.NotAfter != "" {
+		caTTLFlag = "--not-after"
+		caTTL, err = pki.NotAfterTTL(newSetupFlags.NotAfter, time.Now())
+	}
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	maxLeaseTTL, err := pkiService.MaxLeaseTTL(newSetupFlags.ClusterID)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return nil, maskAny(err)
+	}
+	if maxLeaseTTL >= caTTL {
+		return nil, nil
+	}
+
+	w := fmt.Sprintf("the max lease TTL %s of the existing PKI backend caps the root CA TTL %s given by %s, use --auto-tune-mount to raise it", formatDuration(maxLeaseTTL), formatDuration(caTTL), caTTLFlag)
+
+	return []string{w}, nil
+}
+
+// printTokenProgress prints the number of generated tokens to stderr,
+// overwriting the previous progress line.
+func printTokenProgress(done, total int) {
+	fmt.Fprintf(os.Stderr, "\rgenerated %d/%d tokens", done, total)
+	if done == total {
+		fmt.Fprintf(os.Stderr, "\n")
 	}
+}
+
+// printUnsealProgress returns a progress function for health.WaitConfig
+// printing the state of Vault to stderr whenever it changes.
+func printUnsealProgress() func(health.Status, error) {
+	var last string
+
+	return func(status health.Status, err error) {
+		var state string
+		switch {
+		case err != nil:
+			state = "not reachable"
+		case !status.Initialized:
+			state = "not initialized"
+		case status.Sealed:
+			state = "sealed"
+		case status.Standby:
+			state = "standby"
+		}
+		if state != last {
+			fmt.Fprintf(os.Stderr, "waiting for Vault to become active, Vault is %s\n", state)
+			last = state
+		}
+	}
+}
 
-	// Create a Vault client and configure it with the provided admin token
-	// through the factory.
-	newVaultClient, err := newVaultFactory.NewClient()
+// capTokenTTL returns the given TTL reduced to the given effective max TTL of
+// tokens, printing a warning in case it exceeds it. Zero max TTL means no
+// limit.
+func capTokenTTL(flag, ttl string, maxTTL time.Duration) string {
+	d, err := time.ParseDuration(ttl)
+	if err != nil || maxTTL == 0 || d <= maxTTL {
+		return ttl
+	}
+	printWarning("%s %s exceeds the max TTL configured in Vault, reducing it to %s", flag, ttl, formatDuration(maxTTL))
+
+	return formatDuration(maxTTL)
+}
+
+// setupAllowedDomains returns the effective allowed domains, i.e. the domains
+// of --allowed-domains followed by the domains read from
+// --allowed-domains-from-cert not given already.
+func setupAllowedDomains(newSetupFlags *setupFlags) string {
+	domains := splitList(newSetupFlags.AllowedDomains)
+	if newSetupFlags.DomainsFromCert == "" {
+		return strings.Join(domains, ",")
+	}
+
+	fromCert, _, err := certSANs(newSetupFlags.DomainsFromCert)
 	if err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+		return strings.Join(domains, ",")
+	}
+	seen := map[string]bool{}
+	for _, d := range domains {
+		seen[d] = true
+	}
+	for _, d := range fromCert {
+		if !seen[d] {
+			domains = append(domains, d)
+			seen[d] = true
+		}
 	}
 
-	// Create a PKI controller to setup the cluster's PKI backend including its
-	// root CA and role.
-	var pkiService pki.Service
-	{
-		pkiConfig := pki.DefaultServiceConfig()
-		pkiConfig.VaultClient = newVaultClient
-		pkiService, err = pki.NewService(pkiConfig)
+	return strings.Join(domains, ",")
+}
+
+// certSANs reads the PEM encoded certificate at the given path and returns its
+// DNS SANs as allowed domains and its IP SANs. Wildcards are removed, since
+// the PKI role allows subdomains of its allowed domains anyway.
+func certSANs(path string) ([]string, []string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, maskAnyf(invalidConfigError, "--allowed-domains-from-cert %s", err.Error())
+	}
+	crt, err := parseCertPEM(b)
+	if err != nil {
+		return nil, nil, maskAnyf(invalidConfigError, "--allowed-domains-from-cert must be a PEM encoded certificate: %s", err.Error())
+	}
+	if len(crt.DNSNames) == 0 && len(crt.IPAddresses) == 0 {
+		return nil, nil, maskAnyf(invalidConfigError, "--allowed-domains-from-cert must have DNS or IP SANs")
+	}
+
+	var domains []string
+	seen := map[string]bool{}
+	for _, n := range crt.DNSNames {
+		n = strings.TrimPrefix(n, "*.")
+		if !seen[n] {
+			domains = append(domains, n)
+			seen[n] = true
+		}
+	}
+	var ips []string
+	for _, ip := range crt.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+
+	return domains, ips, nil
+}
+
+// setupCommonNameContext is the template context provided to the rendering of
+// --common-name-template.
+type setupCommonNameContext struct {
+	ClusterID string
+}
+
+// setupCommonName returns the effective common name of the root CA. In case
+// --common-name is not given it is rendered from --common-name-template, if
+// any.
+func setupCommonName(newSetupFlags *setupFlags) (string, error) {
+	if newSetupFlags.CommonName != "" || newSetupFlags.CNTemplate == "" {
+		return newSetupFlags.CommonName, nil
+	}
+
+	tmpl, err := template.New("common-name").Parse(newSetupFlags.CNTemplate)
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "--common-name-template: %s", err.Error())
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, setupCommonNameContext{ClusterID: newSetupFlags.ClusterID})
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "--common-name-template: %s", err.Error())
+	}
+	commonName := strings.TrimSpace(b.String())
+	if commonName == "" {
+		return "", maskAnyf(invalidConfigError, "--common-name-template must not render an empty common name")
+	}
+
+	return commonName, nil
+}
+
+// setupCAType returns the effective value of --ca-type, which defaults to
+// import in case --ca-bundle-file is given.
+func setupCAType(newSetupFlags *setupFlags) string {
+	if newSetupFlags.CAType != "" {
+		return newSetupFlags.CAType
+	}
+	if newSetupFlags.CABundleFile != "" {
+		return "import"
+	}
+
+	return "generate"
+}
+
+// setupSinkRef returns the reference of the sink the generated tokens are
+// written to, resolving the --tokens-k8s-secret, --tokens-fd and
+// --tokens-systemd-creds shortcuts.
+func setupSinkRef(newSetupFlags *setupFlags) string {
+	switch {
+	case newSetupFlags.TokensK8sSecret != "":
+		return "k8s:" + newSetupFlags.TokensK8sSecret
+	case newSetupFlags.TokensFD != 0:
+		return fmt.Sprintf("fd:%d", newSetupFlags.TokensFD)
+	case newSetupFlags.TokensSystemdCreds != "":
+		return "systemd-creds:" + newSetupFlags.TokensSystemdCreds
+	}
+
+	return newSetupFlags.TokensSink
+}
+
+// setupPlanHasTokens returns whether the given setup plan generates tokens.
+func setupPlanHasTokens(plan state.Plan) bool {
+	for _, a := range plan.Actions {
+		if a.Resource == state.ResourceTokens {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printSetupPlan prints the changes setup would make according to the given
+// plan, using --dry-run.
+func printSetupPlan(newSetupFlags *setupFlags, plan state.Plan) error {
+	if plan.Actions == nil {
+		plan.Actions = []state.Action{}
+	}
+	if newSetupFlags.Output == "json" {
+		return maskAny(printJSON(plan))
+	}
+
+	if len(plan.Actions) == 0 {
+		fmt.Printf("Cluster ID '%s' matches the given flags. No changes necessary.\n", newSetupFlags.ClusterID)
+		return nil
+	}
+	fmt.Printf("The following changes would be made:\n")
+	fmt.Printf("\n")
+	printPlan(plan)
+	fmt.Printf("%s\n", formatPlanSummary(plan))
+	if !newSetupFlags.Idempotent {
+		fmt.Printf("\n")
+		fmt.Printf("Existing roles and the policy are not compared, use --idempotent to update them.\n")
+	}
+
+	return nil
+}
+
+// setupConfirmed returns whether setup proceeds despite warnings. Using
+// --dry-run, warnings are only printed, so the plan is shown regardless.
+func setupConfirmed(newSetupFlags *setupFlags) bool {
+	return newSetupFlags.Yes || newSetupFlags.DryRun
+}
+
+func setupRun(cmd *cobra.Command, args []string) (err error) {
+	err = joinErrors(setupValidate(newSetupFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+	err = confirmWarnings(setupWarnings(newSetupFlags), setupConfirmed(newSetupFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Resources created by the steps below are recorded, so they can be
+	// removed again in case a later step fails.
+	rollback := &setupRollback{}
+	defer func() {
+		if err != nil && newSetupFlags.RollbackOnFailure {
+			rollback.run(newSetupFlags.ClusterID)
+		}
+	}()
+
+	// Open the sink before touching Vault, so misconfigured sinks fail early.
+	// Nothing is written using --dry-run.
+	sinkRef := setupSinkRef(newSetupFlags)
+	var sink spec.SecretSink
+	if !newSetupFlags.DryRun {
+		sink, err = secretsink.Open(sinkRef)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
 	}
 
-	// Create a token generator to create new tokens for the current cluster.
-	var tokenService token.Service
+	// Create a Vault client configured with the provided admin token.
+	newVaultClient, err := createVaultClient(&newSetupFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Make sure Vault can serve requests before changing anything, so a sealed
+	// Vault is reported clearly instead of failing in the middle of the setup.
 	{
-		tokenConfig := token.DefaultServiceConfig()
-		tokenConfig.VaultClient = newVaultClient
-		tokenService, err = token.NewService(tokenConfig)
+		healthConfig := health.DefaultServiceConfig()
+		healthConfig.Logger = debugLogger()
+		healthConfig.VaultClient = newVaultClient
+		healthService, err := health.NewService(healthConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
+		}
+
+		if newSetupFlags.WaitForUnseal {
+			timeout, _ := time.ParseDuration(newSetupFlags.Timeout)
+			pollInterval, _ := time.ParseDuration(newSetupFlags.PollInterval)
+			pollMaxInterval, _ := time.ParseDuration(newSetupFlags.PollMaxInterval)
+			waitConfig := health.WaitConfig{
+				Interval:    pollInterval,
+				MaxInterval: pollMaxInterval,
+				Timeout:     timeout,
+			}
+			if !newSetupFlags.Quiet {
+				waitConfig.Progress = printUnsealProgress()
+			}
+			err = healthService.WaitForUnseal(waitConfig)
+		} else {
+			err = healthService.VerifyUnsealed()
+		}
+		if health.IsVaultSealed(err) {
+			return maskAnyf(err, "use --wait-for-unseal to wait for it")
+		} else if err != nil {
+			return maskAny(err)
 		}
 	}
 
-	// Setup PKI backend for cluster.
+	if !newSetupFlags.DryRun {
+		err = verifyNoMaintenance(newVaultClient, newSetupFlags.Force)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create a certctl service to setup the cluster's PKI backend including its
+	// root CA and role, and to create new tokens for the current cluster. Its
+	// setup hooks record the steps, so they can be rolled back and reported.
+	var certctlService certctl.Service
 	{
-		createConfig := pki.CreateConfig{
-			AllowedDomains:   newSetupFlags.AllowedDomains,
-			ClusterID:        newSetupFlags.ClusterID,
-			CommonName:       newSetupFlags.CommonName,
-			TTL:              newSetupFlags.CATTL,
-			AllowBareDomains: newSetupFlags.AllowBareDomains,
+		certctlConfig := certctl.DefaultServiceConfig()
+		certctlConfig.Tracer = tracer
+		certctlConfig.VaultClient = newVaultClient
+		certctlConfig.SharedMount = newSetupFlags.Vault.sharedMount()
+		certctlService, err = certctl.NewService(certctlConfig)
+		if err != nil {
+			return maskAny(err)
 		}
-		err = pkiService.Create(createConfig)
+	}
+	pkiService := certctlService.PKI()
+	tokenService := certctlService.Token()
+
+	// Create a state service to compare the cluster with the given flags.
+	var stateService state.Service
+	{
+		stateConfig := state.DefaultServiceConfig()
+		stateConfig.PKIService = pkiService
+		stateConfig.TokenService = tokenService
+		stateConfig.SharedMount = newSetupFlags.Vault.sharedMount()
+		stateService, err = state.NewService(stateConfig)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
 	}
 
-	// Generate tokens for the cluster VMs.
-	var tokens []string
+	// Configure the PKI backend of the cluster.
+	numTokens := newSetupFlags.NumTokens
+	var pkiConfig pki.CreateConfig
+	var statePlanConfig state.SetupConfig
+	var plan state.Plan
 	{
-		createConfig := token.CreateConfig{
-			ClusterID: newSetupFlags.ClusterID,
-			Num:       newSetupFlags.NumTokens,
-			TTL:       newSetupFlags.TokenTTL,
+		roleParams, err := parseKeyValues("--role-param", newSetupFlags.RoleParams)
+		if err != nil {
+			return maskAny(err)
+		}
+		extraRoleParams := map[string]interface{}{}
+		for k, v := range roleParams {
+			extraRoleParams[k] = v
+		}
+
+		var caBundle string
+		if newSetupFlags.CABundleFile != "" {
+			caBundle, err = readCABundle("--ca-bundle-file", newSetupFlags.CABundleFile)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+
+		commonName, err := setupCommonName(newSetupFlags)
+		if err != nil {
+			return maskAny(err)
+		}
+
+		// The named roles have been validated by setupValidate already.
+		roles, _ := setupRoles(newSetupFlags)
+
+		createConfig := pki.CreateConfig{
+			AllowedDomains:       setupAllowedDomains(newSetupFlags),
+			CABundle:             caBundle,
+			UseExistingCA:        setupCAType(newSetupFlags) == "existing",
+			KeyRef:               newSetupFlags.CAKeyRef,
+			OnConflict:           newSetupFlags.OnConflict,
+			MountDescription:     newSetupFlags.MountDescription,
+			ClusterID:            newSetupFlags.ClusterID,
+			CommonName:           commonName,
+			Subject:              newSetupFlags.CASubject,
+			LeafSubject:          newSetupFlags.LeafSubject,
+			TTL:                  newSetupFlags.CATTL,
+			NotAfter:             newSetupFlags.NotAfter,
+			AutoTuneMount:        newSetupFlags.AutoTuneMount,
+			RegenerateCAWithin:   newSetupFlags.RegenerateCA,
+			AllowBareDomains:     newSetupFlags.AllowBareDomains,
+			AllowedSerialNumbers: splitList(newSetupFlags.AllowedSerials),
+			RequireCN:            setupRequireCN(newSetupFlags),
+			KeyUsage:             setupKeyUsage(newSetupFlags),
+			UsePSS:               newSetupFlags.UsePSS,
+			SignatureBits:        newSetupFlags.SignatureBits,
+			GenerateLease:        newSetupFlags.GenerateLease,
+			NoStore:              newSetupFlags.NoStore,
+			ExtraRoleParams:      extraRoleParams,
+			Roles:                roles,
+		}
+		for _, k := range pki.OverriddenRoleParams(createConfig) {
+			printWarning("--role-param '%s' is overridden by a typed flag", k)
+		}
+		if !newSetupFlags.AutoTuneMount {
+			w, err := setupMaxLeaseWarning(newSetupFlags, pkiService)
+			if err != nil {
+				return maskAny(err)
+			}
+			err = confirmWarnings(w, setupConfirmed(newSetupFlags))
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+
+		// The plan is computed before changing anything, so it describes the
+		// cluster as it was before.
+		if newSetupFlags.DryRun || newSetupFlags.Idempotent {
+			statePlanConfig = state.SetupConfig{
+				Create:     createConfig,
+				NumTokens:  newSetupFlags.NumTokens,
+				SkipPolicy: newSetupFlags.SkipPolicy,
+				Reconcile:  newSetupFlags.Idempotent,
+			}
+			plan, err = stateService.PlanSetup(statePlanConfig)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+		if newSetupFlags.DryRun {
+			return maskAny(printSetupPlan(newSetupFlags, plan))
+		}
+		if newSetupFlags.Idempotent && !setupPlanHasTokens(plan) {
+			numTokens = 0
+		}
+
+		pkiConfig = createConfig
+	}
+
+	// Configure the tokens for the cluster VMs.
+	tokenConfig := token.CreateConfig{
+		ClusterID:  newSetupFlags.ClusterID,
+		Num:        numTokens,
+		Policies:   splitList(newSetupFlags.TokenPolicies),
+		SkipPolicy: newSetupFlags.SkipPolicy,
+		TTL:        newSetupFlags.TokenTTL,
+		MaxTTL:     newSetupFlags.TokenMaxTTL,
+		TTLJitter:  newSetupFlags.TokenJitter,
+	}
+	if !newSetupFlags.Quiet && newSetupFlags.Output != "json" && isTerminal(os.Stderr) {
+		tokenConfig.Progress = printTokenProgress
+	}
+
+	// Run the steps of the setup, which records their resources for the
+	// rollback and updates existing roles along the way.
+	var updated []string
+	setupConfig := certctl.SetupConfig{
+		PKI:             pkiConfig,
+		Tokens:          tokenConfig,
+		TokenRole:       newSetupFlags.TokenRole,
+		CreateTokenRole: newSetupFlags.CreateRole,
+		CreateEntity:    newSetupFlags.CreateEntity,
+		SkipVerify:      newSetupFlags.SkipVerify,
+		Hooks: certctl.SetupHooks{
+			BeforePKI: func() error {
+				if !newSetupFlags.RollbackOnFailure {
+					return nil
+				}
+				return maskAny(setupRecordPKIRollback(rollback, pkiService))
+			},
+			AfterPKI: func(pki.CreateResult) error {
+				// Create leaves existing roles as they are, so they are updated
+				// to match the flags afterwards.
+				if !newSetupFlags.Idempotent {
+					return nil
+				}
+				err := stateService.ApplySetup(statePlanConfig, plan)
+				if err != nil {
+					return maskAny(err)
+				}
+				for _, a := range plan.Actions {
+					if a.Type == state.ActionUpdate && a.Resource != state.ResourceMount && a.Resource != state.ResourceCA {
+						updated = append(updated, a.Path)
+					}
+				}
+				return nil
+			},
+			BeforeTokens: func() error {
+				if !newSetupFlags.RollbackOnFailure {
+					return nil
+				}
+				return maskAny(setupRecordTokenRollback(rollback, tokenService))
+			},
+			// Token TTLs are silently capped by Vault, so the effective max TTL
+			// is looked up to make capping explicit.
+			TokenConfig: func(roleName string, config token.CreateConfig) (token.CreateConfig, error) {
+				if config.Num == 0 {
+					return config, nil
+				}
+				maxTTL, err := tokenService.MaxTTL(roleName)
+				if err != nil {
+					return token.CreateConfig{}, maskAny(err)
+				}
+				config.TTL = capTokenTTL("--token-ttl", config.TTL, maxTTL)
+				if config.MaxTTL != "" {
+					config.MaxTTL = capTokenTTL("--token-max-ttl", config.MaxTTL, maxTTL)
+				}
+				return config, nil
+			},
+			AfterTokens: func(tokenResult token.CreateResult) {
+				if newSetupFlags.RollbackOnFailure && len(tokenResult.Tokens) > 0 {
+					ids := tokenResult.IDs()
+					rollback.add(fmt.Sprintf("%d token(s) revoked", len(ids)), func() error { return tokenService.Revoke(ids) })
+				}
+			},
+		},
+	}
+	certctlResult, err := certctlService.Setup(setupConfig)
+	if err != nil {
+		if !newSetupFlags.RollbackOnFailure {
+			printPartialTokens(certctlResult.Tokens)
 		}
-		tokens, err = tokenService.Create(createConfig)
+		return maskAny(err)
+	}
+	pkiResult := certctlResult.PKI
+	caChain := certctlResult.CAChain
+	tokenResult := certctlResult.Tokens
+	entityID := certctlResult.EntityID
+	for _, w := range tokenResult.Warnings {
+		printWarning("Vault: %s", w)
+	}
+
+	// Write the tokens to the sink, unless they are printed as part of the
+	// summary. Tokens handed out before are not replaced in case none have
+	// been generated using --idempotent.
+	tokensSkipped := newSetupFlags.Idempotent && numTokens == 0 && newSetupFlags.NumTokens > 0
+	if sinkRef != "stdout" && !tokensSkipped {
+		err = sink.WriteTokens(newSetupFlags.ClusterID, tokenResult.IDs())
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	result := setupResult{
+		ClusterID:     newSetupFlags.ClusterID,
+		MountPath:     pkiResult.MountPath,
+		RoleName:      pkiResult.RoleName,
+		RolePath:      pkiResult.RolePath,
+		RoleCreated:   pkiResult.RoleCreated,
+		NamedRoles:    pkiResult.NamedRolePaths,
+		NamedCreated:  pkiResult.NamedRolesCreated,
+		PolicyName:    tokenResult.PolicyName,
+		CACert:        pkiResult.CACert,
+		CASerial:      pkiResult.CASerial,
+		CAExpiration:  pkiResult.CAExpiration.Format(time.RFC3339),
+		CAGenerated:   pkiResult.CAGenerated,
+		CAImported:    pkiResult.CAImported,
+		IssuerID:      pkiResult.IssuerID,
+		IssuerDefault: pkiResult.IssuerDefault,
+		MountTuned:    pkiResult.MountTuned,
+		CARegenerated: pkiResult.CARegenerated,
+		CAChainLength: len(caChain),
+		TokensSkipped: tokensSkipped,
+		Updated:       updated,
+	}
+	if pkiResult.CARegenerated {
+		result.PreviousCAExp = pkiResult.PreviousCAExpiration.Format(time.RFC3339)
+	}
+	for _, t := range tokenResult.Tokens {
+		result.TokenAccessors = append(result.TokenAccessors, t.Accessor)
+	}
+	switch {
+	case tokensSkipped:
+	case newSetupFlags.TokensK8sSecret != "":
+		result.TokensSecret = newSetupFlags.TokensK8sSecret
+	case newSetupFlags.TokensFD != 0:
+		result.TokensFD = newSetupFlags.TokensFD
+	case newSetupFlags.TokensSystemdCreds != "":
+		result.TokensCredsDir = newSetupFlags.TokensSystemdCreds
+	case sinkRef != "stdout":
+		result.TokensSink = sinkRef
+	default:
+		result.Tokens = tokenResult.IDs()
+	}
+	if newSetupFlags.CreateRole {
+		result.TokenRole = tokenService.RoleName(newSetupFlags.ClusterID)
+	}
+	result.EntityID = entityID
+
+	if newSetupFlags.Output == "json" {
+		err = printJSON(result)
 		if err != nil {
-			log.Fatalf("%#v\n", maskAny(err))
+			return maskAny(err)
 		}
+		return nil
 	}
 
-	fmt.Printf("Set up cluster for ID '%s':\n", newSetupFlags.ClusterID)
+	fmt.Printf("Set up cluster for ID '%s':\n", result.ClusterID)
 	fmt.Printf("\n")
-	fmt.Printf("    - PKI backend mounted\n")
-	fmt.Printf("    - Root CA generated\n")
-	fmt.Printf("    - PKI role created\n")
-	fmt.Printf("    - PKI policy created\n")
+	if newSetupFlags.Vault.sharedMount() != "" {
+		fmt.Printf("    - Shared PKI backend used at '%s'\n", result.MountPath)
+	} else {
+		fmt.Printf("    - PKI backend mounted at '%s'\n", result.MountPath)
+	}
+	if result.MountTuned {
+		fmt.Printf("    - Max lease TTL of PKI backend raised to the root CA's TTL\n")
+	}
+	switch {
+	case result.CARegenerated:
+		fmt.Printf("    - Root CA regenerated as issuer '%s' with serial number '%s', the previous one expired at %s\n", result.IssuerID, result.CASerial, result.PreviousCAExp)
+	case newSetupFlags.RegenerateCA > 0 && !result.CAGenerated:
+		fmt.Printf("    - Root CA kept, it expires at %s, not within %s\n", result.CAExpiration, formatDuration(newSetupFlags.RegenerateCA))
+	case result.CAGenerated:
+		fmt.Printf("    - Root CA generated with serial number '%s'\n", result.CASerial)
+	case result.CAImported:
+		fmt.Printf("    - Root CA imported with serial number '%s'\n", result.CASerial)
+	case setupCAType(newSetupFlags) == "existing":
+		fmt.Printf("    - Existing root CA used with serial number '%s'\n", result.CASerial)
+	default:
+		fmt.Printf("    - Root CA with serial number '%s' already existed\n", result.CASerial)
+	}
+	if result.IssuerID != "" && newSetupFlags.CAKeyRef != "" {
+		fmt.Printf("    - Root CA issuer '%s' generated using key '%s'\n", result.IssuerID, newSetupFlags.CAKeyRef)
+	}
+	if result.RoleCreated {
+		fmt.Printf("    - PKI role created at '%s'\n", result.RolePath)
+	} else {
+		fmt.Printf("    - PKI role already existed at '%s'\n", result.RolePath)
+	}
+	namedCreated := map[string]bool{}
+	for _, p := range result.NamedCreated {
+		namedCreated[p] = true
+	}
+	for _, p := range result.NamedRoles {
+		if namedCreated[p] {
+			fmt.Printf("    - Named PKI role created at '%s'\n", p)
+		} else {
+			fmt.Printf("    - Named PKI role already existed at '%s'\n", p)
+		}
+	}
+	for _, p := range result.Updated {
+		fmt.Printf("    - Updated '%s' to match the given flags\n", p)
+	}
+	if result.CAChainLength > 0 {
+		fmt.Printf("    - CA chain of %d certificate(s) verified\n", result.CAChainLength)
+	}
+	if newSetupFlags.SkipPolicy {
+		fmt.Printf("    - PKI policy skipped, no policy created\n")
+	} else {
+		fmt.Printf("    - PKI policy created as '%s'\n", result.PolicyName)
+	}
+	if result.TokenRole != "" {
+		fmt.Printf("    - Token role created as '%s'\n", result.TokenRole)
+	}
+	if result.EntityID != "" {
+		fmt.Printf("    - Identity entity created as '%s' with ID '%s'\n", tokenService.EntityName(result.ClusterID), result.EntityID)
+	}
 	fmt.Printf("\n")
+	if result.TokensSkipped {
+		fmt.Printf("No tokens generated, cluster ID '%s' has been set up before.\n", result.ClusterID)
+		fmt.Printf("The tokens handed out before remain valid.\n")
+		fmt.Printf("\n")
+		return nil
+	}
+	if result.TokensSecret != "" {
+		fmt.Printf("The tokens generated for this cluster have been stored in the\n")
+		fmt.Printf("Kubernetes Secret '%s'.\n", result.TokensSecret)
+		fmt.Printf("\n")
+		return nil
+	}
+	if result.TokensFD != 0 {
+		fmt.Printf("The tokens generated for this cluster have been written to\n")
+		fmt.Printf("file descriptor %d.\n", result.TokensFD)
+		fmt.Printf("\n")
+		return nil
+	}
+	if result.TokensCredsDir != "" {
+		fmt.Printf("The tokens generated for this cluster have been written to the\n")
+		fmt.Printf("systemd credentials directory '%s' as vault-token-<n>.\n", result.TokensCredsDir)
+		fmt.Printf("\n")
+		return nil
+	}
+	if result.TokensSink != "" {
+		fmt.Printf("The tokens generated for this cluster have been written to\n")
+		fmt.Printf("sink '%s'.\n", result.TokensSink)
+		fmt.Printf("\n")
+		return nil
+	}
 	fmt.Printf("The following tokens have been generated for this cluster:\n")
 	fmt.Printf("\n")
-	for _, t := range tokens {
+	for _, t := range result.Tokens {
 		fmt.Printf("    %s\n", t)
 	}
 	fmt.Printf("\n")
+
+	return nil
 }
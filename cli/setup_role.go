@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+// setupRoleOptions are the options of --role values. Options marked true hold
+// comma separated lists.
+var setupRoleOptions = map[string]bool{
+	"name":               false,
+	"domains":            true,
+	"ttl":                false,
+	"key_usage":          true,
+	"allow_bare_domains": false,
+}
+
+// parseRoleOptions parses the given --role value of the form
+// name=<name>,domains=<domains>,ttl=<ttl>. Lists are comma separated as well,
+// so items not starting with an option continue the list of the previous
+// option, e.g. domains=a.example.com,b.example.com.
+func parseRoleOptions(i int, value string) (map[string]string, error) {
+	options := map[string]string{}
+
+	var last string
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) == 1 && setupRoleOptions[last] {
+			options[last] += "," + item
+			continue
+		}
+		if len(parts) == 1 {
+			return nil, maskAnyf(invalidConfigError, "--role must be of the form name=<name>,domains=<domains>[,ttl=<ttl>], got malformed value #%d", i+1)
+		}
+		if _, ok := setupRoleOptions[key]; !ok {
+			return nil, maskAnyf(invalidConfigError, "--role value #%d has unknown option '%s'", i+1, key)
+		}
+		if _, ok := options[key]; ok {
+			return nil, maskAnyf(invalidConfigError, "--role value #%d gives option '%s' more than once", i+1, key)
+		}
+		options[key] = parts[1]
+		last = key
+	}
+
+	return options, nil
+}
+
+// setupRoles returns the named roles given by --role. Every role is validated
+// on its own and all problems of all roles are returned. Options not given are
+// taken from the flags configuring the default role.
+func setupRoles(newSetupFlags *setupFlags) ([]pki.RoleConfig, []error) {
+	var roles []pki.RoleConfig
+	var errs []error
+
+	seen := map[string]bool{}
+	for i, v := range newSetupFlags.Roles {
+		options, err := parseRoleOptions(i, v)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		name := strings.TrimSpace(options["name"])
+		if name == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "--role value #%d must have a name", i+1))
+			continue
+		}
+		flag := fmt.Sprintf("--role '%s'", name)
+
+		var roleErrs []error
+		if strings.ContainsAny(name, " \t/") {
+			roleErrs = append(roleErrs, maskAnyf(invalidConfigError, "%s name must not contain whitespace or slashes", flag))
+		}
+		if seen[name] {
+			roleErrs = append(roleErrs, maskAnyf(invalidConfigError, "%s must be given once", flag))
+		}
+		seen[name] = true
+
+		r := pki.RoleConfig{
+			Name:             name,
+			AllowedDomains:   strings.Join(splitList(options["domains"]), ","),
+			AllowBareDomains: newSetupFlags.AllowBareDomains,
+			TTL:              strings.TrimSpace(options["ttl"]),
+		}
+		if r.AllowedDomains == "" {
+			roleErrs = append(roleErrs, maskAnyf(invalidConfigError, "%s domains must not be empty", flag))
+		} else if err := validateDomains(flag+" domains", options["domains"]); err != nil {
+			roleErrs = append(roleErrs, err)
+		}
+		if r.TTL != "" {
+			if err := validateDuration(flag+" ttl", r.TTL); err != nil {
+				roleErrs = append(roleErrs, err)
+			}
+		}
+		if v, ok := options["key_usage"]; ok {
+			if err := validateKeyUsage(flag+" key_usage", v); err != nil {
+				roleErrs = append(roleErrs, err)
+			}
+			// none, or an explicitly empty value, means no key usage, the same
+			// way as --key-usage.
+			r.KeyUsage = []string{}
+			if usages := splitList(v); len(usages) != 1 || !strings.EqualFold(usages[0], "none") {
+				r.KeyUsage = append(r.KeyUsage, usages...)
+			}
+		}
+		if v, ok := options["allow_bare_domains"]; ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				roleErrs = append(roleErrs, maskAnyf(invalidConfigError, "%s allow_bare_domains must be a boolean", flag))
+			}
+			r.AllowBareDomains = b
+		}
+
+		errs = append(errs, roleErrs...)
+		if len(roleErrs) == 0 {
+			roles = append(roles, r)
+		}
+	}
+
+	return roles, errs
+}
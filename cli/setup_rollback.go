@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+// setupRollback records the resources created by setup, so they can be
+// removed in reverse order in case a later step fails. Resources which
+// existed before setup ran are never recorded.
+type setupRollback struct {
+	steps []setupRollbackStep
+}
+
+type setupRollbackStep struct {
+	// Description describes the undone step within the rollback report, e.g.
+	// "PKI backend unmounted".
+	Description string
+	Undo        func() error
+}
+
+// add records the given step undoing the creation of a resource.
+func (r *setupRollback) add(description string, undo func() error) {
+	r.steps = append(r.steps, setupRollbackStep{Description: description, Undo: undo})
+}
+
+// run undoes all recorded steps in reverse order and reports them on stderr.
+// Failing steps are reported as warnings and do not stop the remaining steps
+// from being undone.
+func (r *setupRollback) run(clusterID string) {
+	if len(r.steps) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Rolling back setup of cluster for ID '%s':\n", clusterID)
+	fmt.Fprintf(os.Stderr, "\n")
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		s := r.steps[i]
+		err := s.Undo()
+		if err != nil {
+			printWarning("rollback failed, not %s: %s", s.Description, err.Error())
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "    - %s\n", s.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+// setupRecordPKIRollback records the removal of the PKI backend setup is about
+// to mount, as far as it is not mounted yet. Using the shared PKI backend only
+// the cluster's PKI role is recorded. The shared PKI backend is kept in any
+// case, since other clusters might start using it meanwhile.
+func setupRecordPKIRollback(rollback *setupRollback, pkiService pki.Service) error {
+	clusterID := newSetupFlags.ClusterID
+
+	if newSetupFlags.Vault.sharedMount() != "" {
+		created, err := pkiService.IsRoleCreated(clusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		if !created {
+			rollback.add("PKI role deleted from the shared PKI backend", func() error { return pkiService.Delete(clusterID) })
+		}
+		return nil
+	}
+
+	mounted, err := pkiService.IsMounted(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	if !mounted {
+		rollback.add("PKI backend unmounted, including its root CA and PKI role", func() error { return pkiService.Delete(clusterID) })
+	}
+
+	return nil
+}
+
+// setupRecordTokenRollback records the removal of the token specific
+// resources setup is about to create, i.e. the PKI policy, the token role and
+// the identity entity, as far as they do not exist yet.
+func setupRecordTokenRollback(rollback *setupRollback, tokenService token.Service) error {
+	clusterID := newSetupFlags.ClusterID
+
+	if !newSetupFlags.SkipPolicy {
+		created, err := tokenService.IsPolicyCreated(clusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		if !created {
+			rollback.add("PKI policy deleted", func() error { return tokenService.DeletePolicy(clusterID) })
+		}
+	}
+	if newSetupFlags.CreateRole {
+		created, err := tokenService.IsRoleCreated(clusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		if !created {
+			rollback.add("token role deleted", func() error { return tokenService.DeleteRole(clusterID) })
+		}
+	}
+	if newSetupFlags.CreateEntity {
+		created, err := tokenService.IsEntityCreated(clusterID)
+		if err != nil {
+			return maskAny(err)
+		}
+		if !created {
+			rollback.add("identity entity deleted", func() error { return tokenService.DeleteEntity(clusterID) })
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type shellFlags struct {
+	// History
+	HistoryFile string
+}
+
+var (
+	shellCmd = &cobra.Command{
+		Use:   "shell",
+		Short: "Run certctl commands interactively.",
+		Long: `Run certctl commands interactively. Each line is executed like the arguments
+of certctl, e.g.
+
+    certctl> inspect --cluster-id foo
+
+Vault clients are kept across commands, so repeated commands do not set up
+their connection again. Flags do not carry over between commands. The values
+of secret flags, e.g. --vault-token, are redacted in the history file. Besides
+the certctl commands the shell understands
+
+    history    list the commands of the history
+    !<n>       run command <n> of the history again
+    exit       leave the shell, as does EOF`,
+		RunE: shellRun,
+	}
+
+	newShellFlags = &shellFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(shellCmd)
+
+	shellCmd.Flags().StringVar(&newShellFlags.HistoryFile, "history-file", defaultHistoryFile(), "File the command history is read from and appended to. Empty disables the persistent history.")
+}
+
+// defaultHistoryFile returns the path of the history file within the home
+// directory of the current user, or an empty path in case it is unknown.
+func defaultHistoryFile() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+
+	return filepath.Join(home, ".certctl_history")
+}
+
+func shellRun(cmd *cobra.Command, args []string) error {
+	// The flags of the shell are reset by executing commands, so they are
+	// copied first.
+	historyFile := newShellFlags.HistoryFile
+
+	history, err := readHistory(historyFile)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	interactive := isTerminal(os.Stdin)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Printf("certctl> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "!"))
+			if err != nil || n < 1 || n > len(history) {
+				printShellError(maskAnyf(invalidConfigError, "history has no command '%s'", line))
+				continue
+			}
+			line = history[n-1]
+			fmt.Printf("%s\n", line)
+		}
+
+		switch line {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		case "history":
+			for i, h := range history {
+				fmt.Printf("%5d  %s\n", i+1, h)
+			}
+			continue
+		}
+
+		words, err := splitShellWords(line)
+		if err != nil {
+			printShellError(err)
+			continue
+		}
+
+		// The history kept for the current session holds the command as given,
+		// so it can be run again, while the history file only holds it with the
+		// values of secret flags redacted.
+		history = append(history, line)
+		err = appendHistory(historyFile, redactHistory(line, words))
+		if err != nil {
+			printShellError(err)
+		}
+
+		err = shellExecute(words)
+		if err != nil {
+			printShellError(err)
+		}
+	}
+	if interactive {
+		fmt.Printf("\n")
+	}
+
+	return nil
+}
+
+// shellExecute runs the certctl command given by the given arguments within the
+// current process.
+func shellExecute(args []string) error {
+	c, _, err := CLICmd.Find(args)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+	if commandPath(c) == "shell" {
+		return maskAnyf(invalidConfigError, "shell must not be nested")
+	}
+
+	// Flags are stored in package variables, so values given to a previous
+	// command must be reset explicitly. Commands like config show parse flags
+	// of other commands, so all of them are reset.
+	resetCommandFlags(CLICmd)
+
+	CLICmd.SetArgs(args)
+	running := len(commandSpans)
+	err = CLICmd.Execute()
+	endCommandSpans(running, err)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// resetCommandFlags resets the flags of the given command and all of its
+// subcommands.
+func resetCommandFlags(cmd *cobra.Command) {
+	resetFlags(cmd.PersistentFlags())
+	resetFlags(cmd.Flags())
+	for _, c := range cmd.Commands() {
+		resetCommandFlags(c)
+	}
+}
+
+// printShellError prints the given error of a command the same way certctl
+// prints errors when exiting.
+func printShellError(err error) {
+	fmt.Fprintf(os.Stderr, "%s\n", ColorError(err.Error()))
+}
+
+// readHistory returns the commands of the given history file. A missing file
+// is an empty history.
+func readHistory(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	defer f.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			history = append(history, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, maskAny(err)
+	}
+
+	return history, nil
+}
+
+// appendHistory appends the given command to the given history file. The file
+// may contain commands referring to secrets, e.g. file paths of tokens, so it
+// is only readable by the current user. Existing files readable by others are
+// restricted accordingly.
+func appendHistory(path, line string) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return maskAny(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return maskAny(err)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		err := f.Chmod(0600)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	_, err = fmt.Fprintf(f, "%s\n", line)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// redactHistory returns the given command line, split into the given words,
+// with the values of flags annotated as secret, e.g. --vault-token, replaced,
+// so they are not written to the history file. The line is returned as it is
+// in case it holds no secret flags.
+func redactHistory(line string, words []string) string {
+	c, _, err := CLICmd.Find(words)
+	if err != nil {
+		return line
+	}
+	isSecret := func(name string) bool {
+		f := c.Flags().Lookup(name)
+		if f == nil {
+			f = c.InheritedFlags().Lookup(name)
+		}
+		return f != nil && len(f.Annotations[secretAnnotation]) > 0
+	}
+
+	redacted := make([]string, len(words))
+	copy(redacted, words)
+	var changed bool
+	for i := 0; i < len(redacted); i++ {
+		w := redacted[i]
+		if w == "--" {
+			break
+		}
+		if !strings.HasPrefix(w, "--") {
+			continue
+		}
+		name := strings.TrimPrefix(w, "--")
+		if j := strings.Index(name, "="); j >= 0 {
+			if isSecret(name[:j]) {
+				redacted[i] = "--" + name[:j] + "=<redacted>"
+				changed = true
+			}
+			continue
+		}
+		if isSecret(name) && i+1 < len(redacted) {
+			redacted[i+1] = "<redacted>"
+			changed = true
+			i++
+		}
+	}
+	if !changed {
+		return line
+	}
+
+	for i, w := range redacted {
+		redacted[i] = quoteShellWord(w)
+	}
+
+	return strings.Join(redacted, " ")
+}
+
+// quoteShellWord quotes the given word, so splitShellWords returns it as it is.
+func quoteShellWord(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t'\"\\") {
+		return word
+	}
+
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// splitShellWords splits the given line into arguments the way a POSIX shell
+// does for simple commands. Words are separated by whitespace, single quotes
+// preserve everything literally, double quotes and backslashes escape
+// whitespace and quotes.
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	var inWord bool
+	var quote rune
+	var escaped bool
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, maskAnyf(invalidConfigError, "unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+type signFlags struct {
+	// Vault
+	Vault vaultFlags
+
+	// Cluster
+	ClusterID string
+
+	// CSR
+	CSRFile string
+
+	// Certificate
+	CommonName string
+	IPSANs     string
+	AltNames   string
+	Subject    pki.Subject
+	TTL        string
+
+	// Checks
+	SkipNameCheck bool
+
+	// Path
+	CrtFilePath string
+	CAFilePath  string
+	FileModes   fileModeFlags
+}
+
+var (
+	signCmd = &cobra.Command{
+		Use:   "sign",
+		Short: "Sign a certificate signing request for a specific cluster.",
+		Long: `Sign a certificate signing request for a specific cluster. The private key
+never leaves the client. The CSR is read from --csr-file, or from stdin in case
+it is empty or -, either PEM or base64 encoded DER. The signed certificate is
+printed to stdout unless --crt-file is given, so certctl can be used in
+pipelines, e.g.
+
+    openssl req -new -key key.pem -subj /CN=api.example.com | certctl sign --cluster-id foo`,
+		RunE: signRun,
+	}
+
+	newSignFlags = &signFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(signCmd)
+	configValidators["sign"] = func() []error { return signValidate(newSignFlags) }
+
+	newSignFlags.Vault.register(signCmd.Flags())
+
+	signCmd.Flags().StringVar(&newSignFlags.ClusterID, "cluster-id", "", "Cluster ID used to sign the certificate signing request for.")
+
+	signCmd.Flags().StringVar(&newSignFlags.CSRFile, "csr-file", "", "File path of the certificate signing request, PEM or base64 encoded DER. Empty or - reads it from stdin.")
+
+	signCmd.Flags().StringVar(&newSignFlags.CommonName, "common-name", "", "Common name of the signed certificate. Defaults to the common name of the CSR.")
+	signCmd.Flags().StringVar(&newSignFlags.IPSANs, "ip-sans", "", "IPSANs of the signed certificate in addition to the ones of the CSR.")
+	signCmd.Flags().StringVar(&newSignFlags.AltNames, "alt-names", "", "Alternative names of the signed certificate in addition to the ones of the CSR.")
+	signCmd.Flags().StringVar(&newSignFlags.Subject.Country, "country", "", "Comma separated countries (C) the signed certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	signCmd.Flags().StringVar(&newSignFlags.Subject.Locality, "locality", "", "Comma separated localities (L) the signed certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	signCmd.Flags().StringVar(&newSignFlags.Subject.Organization, "organization", "", "Comma separated organizations (O) the signed certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	signCmd.Flags().StringVar(&newSignFlags.Subject.OrganizationalUnit, "ou", "", "Comma separated organizational units (OU) the signed certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	signCmd.Flags().StringVar(&newSignFlags.Subject.Province, "province", "", "Comma separated provinces (ST) the signed certificate's subject must carry. Must be set by the cluster's PKI role, which Vault takes the subject from.")
+	signCmd.Flags().StringVar(&newSignFlags.TTL, "ttl", "8640h", "TTL of the signed certificate.") // 1 year
+	signCmd.Flags().BoolVar(&newSignFlags.SkipNameCheck, "skip-name-check", false, "Do not check the names of the CSR against the allowed domains of the cluster's PKI role before signing. (Default false)")
+
+	signCmd.Flags().StringVar(&newSignFlags.CrtFilePath, "crt-file", "", "File path used to write the signed certificate to. Defaults to printing it to stdout.")
+	signCmd.Flags().StringVar(&newSignFlags.CAFilePath, "ca-file", "", "File path used to write the issuing root CA to.")
+	newSignFlags.FileModes.register(signCmd.Flags(), false)
+}
+
+func signValidate(newSignFlags *signFlags) []error {
+	var errs []error
+
+	errs = append(errs, newSignFlags.Vault.validate()...)
+	errs = append(errs, newSignFlags.FileModes.validate()...)
+	if newSignFlags.ClusterID == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--cluster-id must not be empty"))
+	}
+	if err := validateDuration("--ttl", newSignFlags.TTL); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func signRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(signValidate(newSignFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Read and validate the CSR before contacting Vault.
+	csr, err := readCSR(newSignFlags.CSRFile)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a Vault client configured with the provided token.
+	newVaultClient, err := createVaultClient(&newSignFlags.Vault)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a certificate signer to sign the CSR.
+	newCertSignerConfig := certsigner.DefaultConfig()
+	newCertSignerConfig.Tracer = tracer
+	newCertSignerConfig.VaultClient = newVaultClient
+	newCertSignerConfig.SharedMount = newSignFlags.Vault.sharedMount()
+	newCertSigner, err := certsigner.New(newCertSignerConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create a PKI controller to run checks against the cluster's PKI backend.
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = tracer
+		pkiConfig.VaultClient = newVaultClient
+		pkiConfig.SharedMount = newSignFlags.Vault.sharedMount()
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Check the requested subject locally, since Vault silently signs
+	// certificates with the subject configured on the role.
+	if !newSignFlags.Subject.Empty() {
+		err = pkiService.VerifySubject(newSignFlags.ClusterID, newSignFlags.Subject)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Check the requested names locally, so disallowed names are reported
+	// precisely instead of being rejected by Vault.
+	if !newSignFlags.SkipNameCheck {
+
+		commonName := newSignFlags.CommonName
+		if commonName == "" {
+			commonName = csr.Subject.CommonName
+		}
+		err = pkiService.VerifyCommonName(newSignFlags.ClusterID, commonName)
+		if err != nil {
+			return maskAny(err)
+		}
+		names := append(csr.DNSNames, splitList(newSignFlags.AltNames)...)
+		err = pkiService.VerifyNames(newSignFlags.ClusterID, names)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	newSignConfig := spec.SignConfig{
+		ClusterID:  newSignFlags.ClusterID,
+		CSR:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		CommonName: newSignFlags.CommonName,
+		IPSANs:     newSignFlags.IPSANs,
+		AltNames:   newSignFlags.AltNames,
+		TTL:        newSignFlags.TTL,
+	}
+	newSignResponse, err := newCertSigner.Sign(newSignConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if newSignFlags.CAFilePath != "" {
+		err = writeOutputFile(newSignFlags.CAFilePath, []byte(newSignResponse.IssuingCA), newSignFlags.FileModes.certMode())
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Print the certificate only, so the output can be piped.
+	if newSignFlags.CrtFilePath == "" {
+		fmt.Printf("%s\n", newSignResponse.Certificate)
+		return nil
+	}
+
+	err = writeOutputFile(newSignFlags.CrtFilePath, []byte(newSignResponse.Certificate), newSignFlags.FileModes.certMode())
+	if err != nil {
+		return maskAny(err)
+	}
+
+	fmt.Printf("Signed certificate with the following serial number.\n")
+	fmt.Printf("\n")
+	fmt.Printf("    %s\n", newSignResponse.SerialNumber)
+	fmt.Printf("\n")
+	fmt.Printf("Public key written to '%s'.\n", newSignFlags.CrtFilePath)
+	if newSignFlags.CAFilePath != "" {
+		fmt.Printf("Root CA written to '%s'.\n", newSignFlags.CAFilePath)
+	}
+
+	return nil
+}
+
+// readCSR reads the certificate signing request from the given path, or from
+// stdin in case the path is empty or -. The CSR may be PEM or base64 encoded
+// DER. Its signature is verified to catch corrupted input early.
+func readCSR(path string) (*x509.CertificateRequest, error) {
+	var b []byte
+	var err error
+	source := "stdin"
+	if path == "" || path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		source = fmt.Sprintf("'%s'", path)
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, maskAnyf(invalidCSRError, "reading %s: %s", source, err.Error())
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, maskAnyf(invalidCSRError, "%s is empty", source)
+	}
+
+	var der []byte
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, maskAnyf(invalidCSRError, "%s contains a PEM block of type '%s'", source, block.Type)
+		}
+		der = block.Bytes
+	} else {
+		der, err = base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(b), nil)))
+		if err != nil {
+			return nil, maskAnyf(invalidCSRError, "%s must be PEM or base64 encoded DER", source)
+		}
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, maskAnyf(invalidCSRError, "%s: %s", source, err.Error())
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, maskAnyf(invalidCSRError, "%s: %s", source, err.Error())
+	}
+
+	return csr, nil
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/tracing"
+)
+
+var (
+	// tracer records the spans of the running command and its Vault requests.
+	// It is nil until the first command starts and disabled unless an OTLP
+	// endpoint is configured.
+	tracer *tracing.Tracer
+
+	// defaultTracer is the tracer of the first command, e.g. the shell. Commands
+	// run within the shell use it, unless they give --otel-endpoint of their
+	// own.
+	defaultTracer *tracing.Tracer
+
+	// tracers holds every tracer created, keyed by their endpoint, so all of
+	// them are flushed at the end.
+	tracers = map[string]*tracing.Tracer{}
+
+	// commandSpans holds the spans of the running commands. Commands run within
+	// the shell are nested below the span of the shell, unless they are traced
+	// using another endpoint.
+	commandSpans []*tracing.Span
+)
+
+// startTracing selects the tracer of the given command and starts the span of
+// it. It is the persistent pre run of every command.
+func startTracing(cmd *cobra.Command, args []string) error {
+	if defaultTracer == nil {
+		newTracer, err := createTracer(tracesEndpoint(cmd))
+		if err != nil {
+			return maskAny(err)
+		}
+		defaultTracer = newTracer
+	}
+	tracer = defaultTracer
+	if f := cmd.Flags().Lookup("otel-endpoint"); f != nil && f.Changed {
+		newTracer, err := createTracer(tracesEndpoint(cmd))
+		if err != nil {
+			return maskAny(err)
+		}
+		tracer = newTracer
+	}
+
+	attributes := map[string]string{
+		"certctl.command": commandPath(cmd),
+	}
+	if f := cmd.Flags().Lookup("cluster-id"); f != nil && f.Value.String() != "" {
+		attributes["certctl.cluster_id"] = f.Value.String()
+	}
+	commandSpans = append(commandSpans, tracer.Start(cmd.CommandPath(), attributes))
+
+	return nil
+}
+
+// createTracer returns the tracer exporting spans to the given endpoint. It is
+// created once per endpoint.
+func createTracer(endpoint string) (*tracing.Tracer, error) {
+	if t, ok := tracers[endpoint]; ok {
+		return t, nil
+	}
+
+	newTracerConfig := tracing.DefaultConfig()
+	newTracerConfig.HTTPClient = &http.Client{}
+	newTracerConfig.Logger = debugLogger()
+	newTracerConfig.Endpoint = endpoint
+	newTracerConfig.Headers = parseOTelHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	newTracerConfig.ServiceName = fromEnv("OTEL_SERVICE_NAME", newTracerConfig.ServiceName)
+
+	newTracer, err := tracing.New(newTracerConfig)
+	if tracing.IsInvalidConfig(err) {
+		return nil, maskAnyf(invalidConfigError, "OTLP traces endpoint '%s' given by --otel-endpoint or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT must be a http or https URL", endpoint)
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	tracers[endpoint] = newTracer
+
+	return newTracer, nil
+}
+
+// tracesEndpoint returns the URL spans are exported to. Following the OTel
+// SDKs, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used as is unless --otel-endpoint
+// is given explicitly, and OTEL_SDK_DISABLED disables tracing entirely.
+func tracesEndpoint(cmd *cobra.Command) string {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return ""
+	}
+	if f := cmd.Flags().Lookup("otel-endpoint"); f == nil || !f.Changed {
+		if e := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); e != "" {
+			return e
+		}
+	}
+
+	return tracing.TracesEndpoint(newCLIFlags.OTelEndpoint)
+}
+
+// parseOTelHeaders parses headers given as comma separated key=value pairs
+// having URL encoded values, the format of OTEL_EXPORTER_OTLP_HEADERS.
+// Malformed pairs are ignored.
+func parseOTelHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			continue
+		}
+		headers[strings.TrimSpace(kv[0])] = v
+	}
+
+	return headers
+}
+
+// endCommandSpans ends the spans of all commands started after the given
+// number of spans was running, marking them as failed in case of an error.
+func endCommandSpans(running int, err error) {
+	for len(commandSpans) > running {
+		last := len(commandSpans) - 1
+		commandSpans[last].End(err)
+		commandSpans = commandSpans[:last]
+	}
+}
+
+// EndTracing ends the spans of all running commands and exports all spans not
+// exported yet. It must be called once after CLICmd finished executing. In
+// case the export fails a warning is printed, since tracing must never fail a
+// command.
+func EndTracing(err error) {
+	endCommandSpans(0, err)
+
+	for _, t := range tracers {
+		flushErr := t.Flush()
+		if flushErr != nil {
+			printWarning("exporting spans failed: %s", flushErr.Error())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/giantswarm/certctl/service/state"
+)
+
+type validateFlags struct {
+	// Spec
+	File string
+}
+
+var (
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a declarative spec file without contacting Vault.",
+		Long: `Validate a declarative spec file as used by apply without contacting Vault. The
+schema, durations, domains and cluster IDs of the spec are checked and all
+problems found are reported, e.g. misspelled keys, which apply would silently
+ignore. The command fails in case any problem is found, so spec changes can be
+checked in CI before they are applied.`,
+		RunE: validateRun,
+	}
+
+	newValidateFlags = &validateFlags{}
+)
+
+func init() {
+	CLICmd.AddCommand(validateCmd)
+	configValidators["validate"] = func() []error { return validateValidate(newValidateFlags) }
+
+	validateCmd.Flags().StringVarP(&newValidateFlags.File, "file", "f", "", "Spec file being validated.")
+}
+
+func validateValidate(newValidateFlags *validateFlags) []error {
+	var errs []error
+
+	if newValidateFlags.File == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--file must not be empty"))
+	}
+
+	return errs
+}
+
+func validateRun(cmd *cobra.Command, args []string) error {
+	err := joinErrors(validateValidate(newValidateFlags))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = joinErrors(state.ValidateFile(newValidateFlags.File))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	spec, err := state.ParseFile(newValidateFlags.File)
+	if err != nil {
+		return maskAny(err)
+	}
+	fmt.Printf("Spec file '%s' is valid, describing %d cluster(s).\n", newValidateFlags.File, len(spec.Clusters))
+
+	return nil
+}
@@ -0,0 +1,404 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/spf13/pflag"
+
+	"github.com/giantswarm/certctl/service/health"
+	"github.com/giantswarm/certctl/service/vault-factory"
+)
+
+// vaultFlags are the flags shared by all commands connecting to Vault. Their
+// defaults are read from the same environment variables the Vault CLI uses.
+// Flags given explicitly take precedence over the environment.
+type vaultFlags struct {
+	Address   string
+	Token     string
+	TokenEnv  string
+	TokenSink string
+
+	// Credentials
+	CredsFile string
+
+	// TLS
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	SkipVerify bool
+
+	// Enterprise
+	Namespace string
+
+	// Proxy
+	Headers []string
+
+	// Rate limiting
+	RateLimit float64
+
+	// Audit
+	AuditLog string
+
+	// Timeout
+	RequestTimeout time.Duration
+
+	// Layout
+	PKIPathStyle   string
+	PKISharedMount string
+
+	// flags is the flag set the flags are registered with, used to tell
+	// whether --vault-token was given explicitly.
+	flags *pflag.FlagSet
+}
+
+func (f *vaultFlags) register(flags *pflag.FlagSet) {
+	f.flags = flags
+
+	flags.StringVar(&f.Address, "vault-addr", fromEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "Address used to connect to Vault. Multiple comma separated addresses are tried in order until one is reachable, also in case the one used becomes unreachable later on. Use unix:///path/to/socket to connect via a unix domain socket, or srv+_vault._tcp.example.com to discover Vault using DNS SRV records. Addresses without scheme use http for loopback hosts and https otherwise.")
+	flags.StringVar(&f.Token, "vault-token", fromEnv("VAULT_TOKEN", ""), "Token used to authenticate against Vault.")
+	flags.StringVar(&f.TokenEnv, "vault-token-env", "", "Name of the environment variable the token is read from instead of VAULT_TOKEN, e.g. CI_VAULT_TOKEN. --vault-token takes precedence.")
+	flags.StringVar(&f.TokenSink, "vault-agent-token-sink", "", "Token sink file of a Vault Agent running in auto-auth mode. If the file exists the token is read from it instead of --vault-token and re-read when the agent rotates it.")
+
+	flags.StringVar(&f.CredsFile, "vault-creds-file", "", "JSON file holding the address and token, and optionally the namespace and ca_cert path, used to connect to Vault, e.g. written by credential-provider tooling. Flags given explicitly take precedence over the file, the file over the environment.")
+
+	flags.StringVar(&f.CACert, "vault-cacert", fromEnv("VAULT_CACERT", ""), "Path to a PEM encoded CA cert file used to verify Vault's TLS certificate.")
+	flags.StringVar(&f.ClientCert, "vault-client-cert", fromEnv("VAULT_CLIENT_CERT", ""), "Path to a PEM encoded client certificate used for TLS authentication against Vault.")
+	flags.StringVar(&f.ClientKey, "vault-client-key", fromEnv("VAULT_CLIENT_KEY", ""), "Path to the PEM encoded private key of --vault-client-cert.")
+	flags.BoolVar(&f.SkipVerify, "vault-skip-verify", fromEnvBool("VAULT_SKIP_VERIFY", false), "Do not verify Vault's TLS certificate. (Default false)")
+
+	flags.StringVar(&f.Namespace, "vault-namespace", fromEnv("VAULT_NAMESPACE", ""), "Vault Enterprise namespace used for all requests.")
+
+	stringArrayVar(flags, &f.Headers, "vault-header", "Header of the form key=value sent with every request to Vault, e.g. for authenticating proxies. Can be given multiple times.")
+
+	flags.Float64Var(&f.RateLimit, "rate-limit", 0, "Maximum number of requests per second sent to Vault. Zero means unlimited. Requests rejected by Vault's rate limit quotas are retried regardless.")
+
+	flags.StringVar(&f.AuditLog, "audit-log", "", "File every request changing Vault is appended to as JSON line, holding time, method, path, request hash and Vault's request ID. Request bodies are never written.")
+
+	flags.DurationVar(&f.RequestTimeout, "request-timeout", 0, "Maximum time every single request to Vault may take, e.g. 30s, so a hanging request fails instead of silently using up the time of the whole operation. Independent of the overall --timeout of commands having one. Zero means no timeout.")
+
+	flags.StringVar(&f.PKIPathStyle, "pki-path-style", pkiPathStyleIsolated, "How the PKI backends of clusters are laid out in Vault. One of isolated or shared. isolated mounts a PKI backend per cluster at pki-<cluster-id>, shared uses the single PKI backend --pki-shared-mount with a PKI role and policy per cluster.")
+	flags.StringVar(&f.PKISharedMount, "pki-shared-mount", "pki", "Path of the PKI backend shared by all clusters when using --pki-path-style shared. It is mounted by the first setup.")
+
+	annotateEnv(flags, "vault-addr", "VAULT_ADDR")
+	annotateEnv(flags, "vault-token", "VAULT_TOKEN")
+	annotateEnv(flags, "vault-cacert", "VAULT_CACERT")
+	annotateEnv(flags, "vault-client-cert", "VAULT_CLIENT_CERT")
+	annotateEnv(flags, "vault-client-key", "VAULT_CLIENT_KEY")
+	annotateEnv(flags, "vault-skip-verify", "VAULT_SKIP_VERIFY")
+	annotateEnv(flags, "vault-namespace", "VAULT_NAMESPACE")
+
+	annotateSecret(flags, "vault-token")
+	annotateSecret(flags, "vault-header")
+}
+
+func (f *vaultFlags) validate() []error {
+	var errs []error
+
+	if err := f.loadCredsFile(); err != nil {
+		errs = append(errs, err)
+	}
+	if token, err := f.token(); err != nil {
+		errs = append(errs, err)
+	} else if token == "" && f.TokenSink == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "--vault-token or --vault-agent-token-sink must not be empty"))
+	}
+	for _, a := range strings.Split(f.Address, ",") {
+		if _, _, err := vaultfactory.NormalizeAddress(a, true); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "--vault-addr is invalid, %s", strings.TrimPrefix(err.Error(), invalidConfigError.Error()+": ")))
+		}
+	}
+	// A malformed VAULT_SKIP_VERIFY must not silently fall back to verifying or
+	// not verifying TLS, unless overridden by the flag.
+	if err, ok := envErrors["VAULT_SKIP_VERIFY"]; ok && (f.flags == nil || !f.flags.Changed("vault-skip-verify")) {
+		errs = append(errs, err)
+	}
+	if (f.ClientCert == "") != (f.ClientKey == "") {
+		errs = append(errs, maskAnyf(invalidConfigError, "--vault-client-cert and --vault-client-key must be provided together"))
+	}
+	if f.RateLimit < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--rate-limit must not be negative"))
+	}
+	if f.RequestTimeout < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "--request-timeout must not be negative"))
+	}
+	if _, err := parseKeyValues("--vault-header", f.Headers); err != nil {
+		errs = append(errs, err)
+	}
+	switch f.PKIPathStyle {
+	case pkiPathStyleIsolated:
+	case pkiPathStyleShared:
+		if f.PKISharedMount == "" || strings.Trim(f.PKISharedMount, "/") != f.PKISharedMount || strings.ContainsAny(f.PKISharedMount, " \t") {
+			errs = append(errs, maskAnyf(invalidConfigError, "--pki-shared-mount must be a path without whitespace or leading or trailing slashes"))
+		}
+	default:
+		errs = append(errs, maskAnyf(invalidConfigError, "--pki-path-style must be one of %s or %s", pkiPathStyleIsolated, pkiPathStyleShared))
+	}
+
+	return errs
+}
+
+const (
+	// pkiPathStyleIsolated mounts a PKI backend per cluster.
+	pkiPathStyleIsolated = "isolated"
+	// pkiPathStyleShared uses a single PKI backend with a PKI role per cluster.
+	pkiPathStyleShared = "shared"
+)
+
+// sharedMount returns the path of the PKI backend shared by all clusters the
+// services are configured with, which is empty unless using --pki-path-style
+// shared.
+func (f *vaultFlags) sharedMount() string {
+	if f.PKIPathStyle != pkiPathStyleShared {
+		return ""
+	}
+
+	return f.PKISharedMount
+}
+
+// token returns the token used to authenticate against Vault. In case
+// --vault-token-env is given, the token is read from the named environment
+// variable instead of VAULT_TOKEN, unless --vault-token was given explicitly.
+func (f *vaultFlags) token() (string, error) {
+	if f.TokenEnv == "" || (f.flags != nil && f.flags.Changed("vault-token")) {
+		return f.Token, nil
+	}
+
+	token := os.Getenv(f.TokenEnv)
+	if token == "" {
+		return "", maskAnyf(invalidConfigError, "environment variable '%s' of --vault-token-env must not be empty", f.TokenEnv)
+	}
+
+	return token, nil
+}
+
+// vaultCreds is the content of the credentials file given by
+// --vault-creds-file.
+type vaultCreds struct {
+	Address   string `json:"address"`
+	Token     string `json:"token"`
+	Namespace string `json:"namespace"`
+	CACert    string `json:"ca_cert"`
+}
+
+// loadCredsFile sets the flags not given explicitly to the values of the
+// credentials file given by --vault-creds-file. The file must hold the address
+// and token. It is read every time, so a rewritten file is picked up.
+func (f *vaultFlags) loadCredsFile() error {
+	if f.CredsFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(f.CredsFile)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "--vault-creds-file can not be read: %s", err.Error())
+	}
+	var creds vaultCreds
+	err = json.Unmarshal(b, &creds)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "--vault-creds-file '%s' must be a JSON object: %s", f.CredsFile, err.Error())
+	}
+	if creds.Address == "" {
+		return maskAnyf(invalidConfigError, "--vault-creds-file '%s' misses the field 'address'", f.CredsFile)
+	}
+	if creds.Token == "" {
+		return maskAnyf(invalidConfigError, "--vault-creds-file '%s' misses the field 'token'", f.CredsFile)
+	}
+
+	changed := func(name string) bool { return f.flags != nil && f.flags.Changed(name) }
+	if !changed("vault-addr") {
+		f.Address = creds.Address
+	}
+	if !changed("vault-token") {
+		f.Token = creds.Token
+	}
+	if creds.Namespace != "" && !changed("vault-namespace") {
+		f.Namespace = creds.Namespace
+	}
+	if creds.CACert != "" && !changed("vault-cacert") {
+		f.CACert = creds.CACert
+	}
+
+	return nil
+}
+
+// vaultClients caches the Vault clients created by createVaultClient within the
+// current process, keyed by vaultFlags.cacheKey. Repeated operations, e.g. of
+// batch modes, reuse the client instead of repeating its setup, like probing
+// addresses.
+var (
+	vaultClients      = map[string]*vaultClientEntry{}
+	vaultClientsMutex sync.Mutex
+)
+
+// vaultClientEntry is a cached Vault client. Rejected is set by the client
+// itself once Vault rejected its authentication, e.g. because a token expired,
+// so that the next call to createVaultClient creates a new client, which
+// authenticates again, e.g. by reading a rotated token from the Vault Agent
+// token sink.
+type vaultClientEntry struct {
+	Client   *vaultclient.Client
+	Rejected int32
+}
+
+// cacheKey returns the key of the Vault client configured with the given flags
+// within vaultClients. Clients are only shared in case all of their settings,
+// including the authentication and the tracer, are equal.
+func (f *vaultFlags) cacheKey() string {
+	// Clients record spans using the tracer of the command creating them,
+	// which differs in case commands of the shell give --otel-endpoint.
+	var otelEndpoint string
+	if tracer != nil {
+		otelEndpoint = tracer.Endpoint
+	}
+
+	parts := []string{
+		f.Address,
+		f.Token,
+		f.TokenEnv,
+		f.TokenSink,
+		f.CACert,
+		f.ClientCert,
+		f.ClientKey,
+		strconv.FormatBool(f.SkipVerify),
+		f.Namespace,
+		strconv.FormatFloat(f.RateLimit, 'g', -1, 64),
+		f.AuditLog,
+		f.RequestTimeout.String(),
+		otelEndpoint,
+	}
+	parts = append(parts, f.Headers...)
+
+	return strings.Join(parts, "\x00")
+}
+
+// createVaultClient returns a Vault client configured with the given flags. The
+// client is created using a Vault factory, unless a client with the same
+// configuration was already created within the current process.
+func createVaultClient(f *vaultFlags) (*vaultclient.Client, error) {
+	vaultClientsMutex.Lock()
+	defer vaultClientsMutex.Unlock()
+
+	err := f.loadCredsFile()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	key := f.cacheKey()
+	if e, ok := vaultClients[key]; ok && atomic.LoadInt32(&e.Rejected) == 0 {
+		return e.Client, nil
+	}
+
+	// The entry is flagged instead of removed when Vault rejects the
+	// authentication, since requests may be sent while the mutex is held, e.g.
+	// when probing addresses.
+	e := &vaultClientEntry{}
+	c, err := newVaultClient(f, func() { atomic.StoreInt32(&e.Rejected, 1) })
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	e.Client = c
+	vaultClients[key] = e
+
+	return c, nil
+}
+
+// verifyNoMaintenance refuses changing Vault while a maintenance operation is
+// in progress, e.g. a rekey or a seal migration, since changes made meanwhile
+// may end up inconsistent. In case force is true, maintenance operations are
+// only printed as warning.
+func verifyNoMaintenance(newVaultClient *vaultclient.Client, force bool) error {
+	healthConfig := health.DefaultServiceConfig()
+	healthConfig.Logger = debugLogger()
+	healthConfig.VaultClient = newVaultClient
+	healthService, err := health.NewService(healthConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if force {
+		operations, err := healthService.Maintenance()
+		if err != nil {
+			return maskAny(err)
+		}
+		for _, o := range operations {
+			printWarning("Vault is in maintenance, %s, proceeding due to --force", o)
+		}
+		return nil
+	}
+
+	err = healthService.VerifyNoMaintenance()
+	if health.IsMaintenance(err) {
+		return maskAnyf(err, "retry once it finished or use --force")
+	} else if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// newVaultClient creates a Vault client configured with the given flags using
+// a Vault factory. The given function is called whenever Vault rejects the
+// authentication of the client's requests. It may be nil.
+func newVaultClient(f *vaultFlags, authRejected func()) (*vaultclient.Client, error) {
+	headers, err := parseKeyValues("--vault-header", f.Headers)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	token, err := f.token()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Addresses without scheme are common, e.g. when copying them from Vault's
+	// listener configuration, so a scheme is inferred instead of failing.
+	for _, a := range strings.Split(f.Address, ",") {
+		if n, inferred, err := vaultfactory.NormalizeAddress(a, true); err == nil && inferred {
+			printWarning("--vault-addr '%s' has no scheme, using '%s'", strings.TrimSpace(a), n)
+		}
+	}
+
+	// Create a Vault client factory.
+	newVaultFactoryConfig := vaultfactory.DefaultConfig()
+	newVaultFactoryConfig.HTTPClient = &http.Client{}
+	newVaultFactoryConfig.Logger = debugLogger()
+	newVaultFactoryConfig.Tracer = tracer
+	newVaultFactoryConfig.Address = f.Address
+	newVaultFactoryConfig.AdminToken = token
+	newVaultFactoryConfig.InferScheme = true
+	newVaultFactoryConfig.CACert = f.CACert
+	newVaultFactoryConfig.ClientCert = f.ClientCert
+	newVaultFactoryConfig.ClientKey = f.ClientKey
+	newVaultFactoryConfig.SkipVerify = f.SkipVerify
+	newVaultFactoryConfig.Namespace = f.Namespace
+	newVaultFactoryConfig.Headers = headers
+	newVaultFactoryConfig.TokenSink = f.TokenSink
+	newVaultFactoryConfig.RateLimit = f.RateLimit
+	newVaultFactoryConfig.AuditLog = f.AuditLog
+	newVaultFactoryConfig.RequestTimeout = f.RequestTimeout
+	newVaultFactoryConfig.AuthRejected = authRejected
+	if newCLIFlags.DumpRequest {
+		newVaultFactoryConfig.RequestDump = os.Stderr
+	}
+	newVaultFactory, err := vaultfactory.New(newVaultFactoryConfig)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Create a Vault client and configure it with the provided admin token
+	// through the factory.
+	newVaultClient, err := newVaultFactory.NewClient()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return newVaultClient, nil
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"os"
 
 	"github.com/giantswarm/certctl/cli"
 )
 
 func main() {
-	if err := cli.CLICmd.Execute(); err != nil {
-		log.Fatalf("%#v\n", maskAny(err))
+	err := cli.CLICmd.Execute()
+	cli.EndTracing(err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", cli.ColorError(fmt.Sprintf("%#v", maskAny(err))))
+		os.Exit(cli.ExitCode(err))
 	}
 }
@@ -0,0 +1,93 @@
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces the file at the given path with the given data. See
+// Write.
+func WriteFile(path string, data []byte, mode os.FileMode) error {
+	return Write(path, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return maskAny(err)
+	})
+}
+
+// Write replaces the file at the given path with the content written by f.
+// The content is written to a temporary file next to the given path, which is
+// renamed afterwards, so readers like services consuming a certificate or
+// token see either the old or the new content, even in case certctl crashes
+// while writing. The given mode is applied even in case the file existed
+// before. The owner and group of an existing file are kept, e.g. of a key file
+// owned by the user of a service reading it. The directory of the given path
+// must exist.
+func Write(path string, mode os.FileMode, f func(w io.Writer) error) error {
+	// The temporary file is created with mode 0600, so the content is never
+	// readable by others before the mode is applied.
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return maskAny(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	err = f(file)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = file.Chmod(mode)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = keepOwner(file, path)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = file.Sync()
+	if err != nil {
+		return maskAny(err)
+	}
+	err = file.Close()
+	if err != nil {
+		return maskAny(err)
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// keepOwner changes the owner and group of the given temporary file to the
+// ones of the file at the given path, in case it exists and they differ.
+func keepOwner(file *os.File, path string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return maskAny(err)
+	}
+	uid, gid, ok := owner(fi)
+	if !ok {
+		return nil
+	}
+
+	tmp, err := file.Stat()
+	if err != nil {
+		return maskAny(err)
+	}
+	if tmpUID, tmpGID, _ := owner(tmp); tmpUID == uid && tmpGID == gid {
+		return nil
+	}
+
+	err = file.Chown(uid, gid)
+	if err != nil {
+		return maskAnyf(err, "keeping the owner of '%s'", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package atomicfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the user and group ID owning the file described by the
+// given file info.
+func owner(fi os.FileInfo) (int, int, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(stat.Uid), int(stat.Gid), true
+}
@@ -7,12 +7,21 @@ import (
 	vaultclient "github.com/hashicorp/vault/api"
 
 	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/tracing"
 )
 
 // Config represents the configuration used to create a new certificate signer.
 type Config struct {
 	// Dependencies.
+	Tracer      *tracing.Tracer
 	VaultClient *vaultclient.Client
+
+	// Settings.
+
+	// SharedMount is the path of a PKI backend shared by all clusters, each
+	// having a PKI role of its own. Empty means every cluster has a PKI
+	// backend of its own mounted at pki-<clusterID>.
+	SharedMount string
 }
 
 // DefaultConfig provides a default configuration to create a certificate
@@ -28,7 +37,11 @@ func DefaultConfig() Config {
 
 	newConfig := Config{
 		// Dependencies.
+		Tracer:      nil,
 		VaultClient: newVaultClient,
+
+		// Settings.
+		SharedMount: "",
 	}
 
 	return newConfig
@@ -52,7 +65,10 @@ type certSigner struct {
 	Config
 }
 
-func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error) {
+func (cs *certSigner) Issue(config spec.IssueConfig) (_ spec.IssueResponse, err error) {
+	span := cs.Tracer.StartOperation("cert-signer issue", map[string]string{"certctl.cluster_id": config.ClusterID})
+	defer func() { span.End(err) }()
+
 	// Create a client for issuing a new signed certificate.
 	logicalStore := cs.VaultClient.Logical()
 
@@ -64,6 +80,18 @@ func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error)
 		"ip_sans":     config.IPSANs,
 		"alt_names":   config.AltNames,
 	}
+	if config.Format != "" {
+		data["format"] = config.Format
+	}
+	if config.PrivateKeyFormat != "" && config.PrivateKeyFormat != "pkcs1" {
+		data["private_key_format"] = config.PrivateKeyFormat
+	}
+	if config.SerialNumber != "" {
+		data["serial_number"] = config.SerialNumber
+	}
+	if config.ExcludeCNFromSANs {
+		data["exclude_cn_from_sans"] = true
+	}
 
 	secret, err := logicalStore.Write(cs.SignedPath(config.ClusterID), data)
 	if err != nil {
@@ -81,6 +109,19 @@ func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error)
 		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "private key missing")
 	}
 	key := vKey.(string)
+	if config.PrivateKeyFormat == "pkcs1" {
+		key, err = toPKCS1(config.Format, key)
+		if err != nil {
+			return spec.IssueResponse{}, maskAny(err)
+		}
+		// PEM bundles hold the private key as well.
+		if config.Format == "pem_bundle" {
+			crt, err = toPKCS1(config.Format, crt)
+			if err != nil {
+				return spec.IssueResponse{}, maskAny(err)
+			}
+		}
+	}
 	vCA, ok := secret.Data["issuing_ca"]
 	if !ok {
 		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "root CA missing")
@@ -97,11 +138,113 @@ func (cs *certSigner) Issue(config spec.IssueConfig) (spec.IssueResponse, error)
 		PrivateKey:   key,
 		IssuingCA:    ca,
 		SerialNumber: serial,
+		CAChain:      caChain(secret.Data["ca_chain"], ca),
+	}
+
+	return newIssueResponse, nil
+}
+
+func (cs *certSigner) Sign(config spec.SignConfig) (_ spec.IssueResponse, err error) {
+	span := cs.Tracer.StartOperation("cert-signer sign", map[string]string{"certctl.cluster_id": config.ClusterID})
+	defer func() { span.End(err) }()
+
+	// Create a client for signing the certificate signing request.
+	logicalStore := cs.VaultClient.Logical()
+
+	// The common name and alternative names default to the ones of the CSR, in
+	// case they are not given.
+	data := map[string]interface{}{
+		"csr": config.CSR,
+		"ttl": config.TTL,
+	}
+	if config.CommonName != "" {
+		data["common_name"] = config.CommonName
+	}
+	if config.IPSANs != "" {
+		data["ip_sans"] = config.IPSANs
+	}
+	if config.AltNames != "" {
+		data["alt_names"] = config.AltNames
+	}
+
+	secret, err := logicalStore.Write(cs.SignPath(config.ClusterID), data)
+	if err != nil {
+		return spec.IssueResponse{}, maskAny(err)
+	}
+	if secret == nil {
+		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "certificate missing")
+	}
+
+	// Collect the certificate data from the secret response.
+	crt, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "public key missing")
+	}
+	ca, ok := secret.Data["issuing_ca"].(string)
+	if !ok {
+		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "root CA missing")
+	}
+	serial, ok := secret.Data["serial_number"].(string)
+	if !ok {
+		return spec.IssueResponse{}, maskAnyf(keyPairNotFoundError, "serial number missing")
+	}
+
+	newIssueResponse := spec.IssueResponse{
+		Certificate:  crt,
+		IssuingCA:    ca,
+		SerialNumber: serial,
+		CAChain:      caChain(secret.Data["ca_chain"], ca),
 	}
 
 	return newIssueResponse, nil
 }
 
+// caChain returns the CA chain of the given ca_chain response field. In case
+// Vault returned no chain, it consists of the given issuing CA.
+func caChain(v interface{}, issuingCA string) []string {
+	var chain []string
+	if list, ok := v.([]interface{}); ok {
+		for _, i := range list {
+			if ca, ok := i.(string); ok && ca != "" {
+				chain = append(chain, ca)
+			}
+		}
+	}
+	if len(chain) == 0 && issuingCA != "" {
+		chain = []string{issuingCA}
+	}
+
+	return chain
+}
+
+func (cs *certSigner) Revoke(clusterID, serialNumber string) error {
+	logicalStore := cs.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"serial_number": serialNumber,
+	}
+	_, err := logicalStore.Write(fmt.Sprintf("%s/revoke", cs.mountPath(clusterID)), data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
 func (cs *certSigner) SignedPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/issue/role-%s", clusterID, clusterID)
+	return fmt.Sprintf("%s/issue/role-%s", cs.mountPath(clusterID), clusterID)
+}
+
+func (cs *certSigner) SignPath(clusterID string) string {
+	return fmt.Sprintf("%s/sign/role-%s", cs.mountPath(clusterID), clusterID)
+}
+
+// mountPath returns the path of the PKI backend of the given cluster ID,
+// which is the shared one in case it is configured.
+func (cs *certSigner) mountPath(clusterID string) string {
+	if cs.SharedMount != "" {
+		return cs.SharedMount
+	}
+
+	return fmt.Sprintf("pki-%s", clusterID)
 }
@@ -29,6 +29,13 @@ func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
 
+var unsupportedKeyTypeError = errgo.New("unsupported key type")
+
+// IsUnsupportedKeyType asserts unsupportedKeyTypeError.
+func IsUnsupportedKeyType(err error) bool {
+	return errgo.Cause(err) == unsupportedKeyTypeError
+}
+
 var keyPairNotFoundError = errgo.New("key pair not found")
 
 // IsKeyPairNotFound asserts keyPairNotFoundError.
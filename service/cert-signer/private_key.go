@@ -0,0 +1,76 @@
+package certsigner
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+)
+
+// toPKCS1 converts the private key held by the given value of an issue
+// response, requested using the given format, to PKCS#1. Values of the der
+// format are base64 encoded DER keys. PEM values may hold further blocks, e.g.
+// certificates in case of pem_bundle, which are kept as they are. Only RSA
+// keys can be encoded as PKCS#1.
+func toPKCS1(format, value string) (string, error) {
+	if format == "der" {
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", maskAny(err)
+		}
+		b, err = derToPKCS1(b)
+		if err != nil {
+			return "", maskAny(err)
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+
+	var out []byte
+	rest := []byte(value)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+		case "PRIVATE KEY":
+			b, err := derToPKCS1(block.Bytes)
+			if err != nil {
+				return "", maskAny(err)
+			}
+			block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: b}
+		case "EC PRIVATE KEY":
+			return "", maskAnyf(unsupportedKeyTypeError, "PKCS#1 requires an RSA key, got an EC key")
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+	if len(out) == 0 {
+		return "", maskAnyf(keyPairNotFoundError, "private key is not PEM encoded")
+	}
+
+	return string(out), nil
+}
+
+// derToPKCS1 converts the given DER encoded PKCS#1 or PKCS#8 private key to
+// PKCS#1.
+func derToPKCS1(b []byte) ([]byte, error) {
+	if _, err := x509.ParsePKCS1PrivateKey(b); err == nil {
+		return b, nil
+	}
+	if _, err := x509.ParseECPrivateKey(b); err == nil {
+		return nil, maskAnyf(unsupportedKeyTypeError, "PKCS#1 requires an RSA key, got an EC key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(b)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, maskAnyf(unsupportedKeyTypeError, "PKCS#1 requires an RSA key, got %T", key)
+	}
+
+	return x509.MarshalPKCS1PrivateKey(rsaKey), nil
+}
@@ -0,0 +1,326 @@
+package certctl
+
+import (
+	"net/http"
+
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/service/cert-signer"
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/token"
+	"github.com/giantswarm/certctl/service/tracing"
+)
+
+// ServiceConfig represents the configuration used to create a new certctl
+// service.
+type ServiceConfig struct {
+	// Dependencies.
+	Tracer      *tracing.Tracer
+	VaultClient *vaultclient.Client
+
+	// Settings.
+
+	// SharedMount is the path of a PKI backend shared by all clusters, each
+	// having a PKI role of its own. Empty means every cluster has a PKI
+	// backend of its own mounted at pki-<clusterID>.
+	SharedMount string
+}
+
+// DefaultServiceConfig provides a default configuration to create a certctl
+// service.
+func DefaultServiceConfig() ServiceConfig {
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = "http://127.0.0.1:8200"
+	newClientConfig.HttpClient = http.DefaultClient
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := ServiceConfig{
+		// Dependencies.
+		Tracer:      nil,
+		VaultClient: newVaultClient,
+
+		// Settings.
+		SharedMount: "",
+	}
+
+	return newConfig
+}
+
+// NewService creates a new configured certctl service. The PKI controller,
+// token generator and certificate signer it combines are all created using the
+// tracer and Vault client of the given configuration.
+func NewService(config ServiceConfig) (Service, error) {
+	// Dependencies.
+	if config.VaultClient == nil {
+		return nil, maskAnyf(invalidConfigError, "Vault client must not be empty")
+	}
+
+	var err error
+
+	var pkiService pki.Service
+	{
+		pkiConfig := pki.DefaultServiceConfig()
+		pkiConfig.Tracer = config.Tracer
+		pkiConfig.VaultClient = config.VaultClient
+		pkiConfig.SharedMount = config.SharedMount
+		pkiService, err = pki.NewService(pkiConfig)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	var tokenService token.Service
+	{
+		tokenConfig := token.DefaultServiceConfig()
+		tokenConfig.Tracer = config.Tracer
+		tokenConfig.VaultClient = config.VaultClient
+		tokenConfig.SharedMount = config.SharedMount
+		tokenService, err = token.NewService(tokenConfig)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	var certSigner spec.CertSigner
+	{
+		certSignerConfig := certsigner.DefaultConfig()
+		certSignerConfig.Tracer = config.Tracer
+		certSignerConfig.VaultClient = config.VaultClient
+		certSignerConfig.SharedMount = config.SharedMount
+		certSigner, err = certsigner.New(certSignerConfig)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	newService := &service{
+		ServiceConfig: config,
+
+		pkiService:   pkiService,
+		tokenService: tokenService,
+		certSigner:   certSigner,
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	ServiceConfig
+
+	pkiService   pki.Service
+	tokenService token.Service
+	certSigner   spec.CertSigner
+}
+
+func (s *service) PKI() pki.Service {
+	return s.pkiService
+}
+
+func (s *service) Token() token.Service {
+	return s.tokenService
+}
+
+func (s *service) CertSigner() spec.CertSigner {
+	return s.certSigner
+}
+
+func (s *service) Setup(config SetupConfig) (SetupResult, error) {
+	if config.PKI.ClusterID == "" {
+		return SetupResult{}, maskAnyf(invalidConfigError, "cluster ID must not be empty")
+	}
+	if config.Tokens.ClusterID != "" && config.Tokens.ClusterID != config.PKI.ClusterID {
+		return SetupResult{}, maskAnyf(invalidConfigError, "tokens must be configured for cluster ID '%s'", config.PKI.ClusterID)
+	}
+	if config.CreateEntity && !config.CreateTokenRole {
+		return SetupResult{}, maskAnyf(invalidConfigError, "creating an identity entity requires creating a token role")
+	}
+	clusterID := config.PKI.ClusterID
+	config.Tokens.ClusterID = clusterID
+
+	var result SetupResult
+	var err error
+
+	// Setup the PKI backend of the cluster.
+	if config.Hooks.BeforePKI != nil {
+		err = config.Hooks.BeforePKI()
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+	}
+	result.PKI, err = s.pkiService.Create(config.PKI)
+	if err != nil {
+		return SetupResult{}, maskAny(err)
+	}
+	if config.Hooks.AfterPKI != nil {
+		err = config.Hooks.AfterPKI(result.PKI)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+	}
+
+	// Verify the CA chain before tokens are handed out, so misconfigured
+	// intermediates are caught early.
+	if !config.SkipVerify {
+		result.CAChain, err = s.pkiService.GetCAChain(clusterID)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+		err = pki.VerifyChain(result.CAChain)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+	}
+
+	if config.Hooks.BeforeTokens != nil {
+		err = config.Hooks.BeforeTokens()
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+	}
+	result.TokenRole = config.TokenRole
+	if config.CreateTokenRole {
+		err = s.tokenService.CreateRole(clusterID, config.Tokens.MaxTTL)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+		result.TokenRole = s.tokenService.RoleName(clusterID)
+	}
+	if config.CreateEntity {
+		result.EntityID, err = s.tokenService.CreateEntity(clusterID)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+		config.Tokens.EntityAlias = s.tokenService.EntityName(clusterID)
+	}
+
+	// Generate the tokens of the cluster. The PKI issue policy is created
+	// along the way, unless skipped.
+	if config.Hooks.TokenConfig != nil {
+		config.Tokens, err = config.Hooks.TokenConfig(result.TokenRole, config.Tokens)
+		if err != nil {
+			return SetupResult{}, maskAny(err)
+		}
+	}
+	if result.TokenRole != "" {
+		result.Tokens, err = s.tokenService.CreateFromRole(result.TokenRole, config.Tokens)
+	} else {
+		result.Tokens, err = s.tokenService.Create(config.Tokens)
+	}
+	if config.Hooks.AfterTokens != nil {
+		config.Hooks.AfterTokens(result.Tokens)
+	}
+	if err != nil {
+		return result, maskAny(err)
+	}
+
+	return result, nil
+}
+
+func (s *service) CreateTokens(config CreateTokensConfig) (token.CreateResult, error) {
+	clusterID := config.Tokens.ClusterID
+	if clusterID == "" {
+		return token.CreateResult{}, maskAnyf(invalidConfigError, "cluster ID must not be empty")
+	}
+
+	roleCreated, err := s.pkiService.IsRoleCreated(clusterID)
+	if err != nil {
+		return token.CreateResult{}, maskAny(err)
+	}
+	if !roleCreated {
+		return token.CreateResult{}, maskAnyf(notSetUpError, "cluster ID '%s' has no PKI role, set it up first", clusterID)
+	}
+
+	// The policies are only read. In case none are given, the cluster's PKI
+	// issue policy must exist.
+	if len(config.Tokens.Policies) == 0 {
+		policyCreated, err := s.tokenService.IsPolicyCreated(clusterID)
+		if err != nil {
+			return token.CreateResult{}, maskAny(err)
+		}
+		if !policyCreated {
+			return token.CreateResult{}, maskAnyf(notSetUpError, "cluster ID '%s' has no PKI issue policy, set it up first or give policies explicitly", clusterID)
+		}
+		config.Tokens.Policies = []string{s.tokenService.PolicyName(clusterID)}
+	}
+	config.Tokens.SkipPolicy = true
+
+	roleName := config.TokenRole
+	if roleName == "" {
+		roleName, err = s.ClusterTokenRole(clusterID)
+		if err != nil {
+			return token.CreateResult{}, maskAny(err)
+		}
+	}
+
+	var result token.CreateResult
+	if roleName != "" {
+		result, err = s.tokenService.CreateFromRole(roleName, config.Tokens)
+	} else {
+		result, err = s.tokenService.Create(config.Tokens)
+	}
+	if err != nil {
+		return result, maskAny(err)
+	}
+
+	return result, nil
+}
+
+func (s *service) ClusterTokenRole(clusterID string) (string, error) {
+	created, err := s.tokenService.IsRoleCreated(clusterID)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if !created {
+		return "", nil
+	}
+
+	return s.tokenService.RoleName(clusterID), nil
+}
+
+func (s *service) Issue(config spec.IssueConfig) (spec.IssueResponse, error) {
+	response, err := s.certSigner.Issue(config)
+	if err != nil {
+		return spec.IssueResponse{}, maskAny(err)
+	}
+
+	return response, nil
+}
+
+func (s *service) Sign(config spec.SignConfig) (spec.IssueResponse, error) {
+	response, err := s.certSigner.Sign(config)
+	if err != nil {
+		return spec.IssueResponse{}, maskAny(err)
+	}
+
+	return response, nil
+}
+
+func (s *service) Revoke(clusterID, serialNumber string) error {
+	err := s.certSigner.Revoke(clusterID, serialNumber)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) Cleanup(clusterID string) error {
+	err := s.pkiService.Delete(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = s.tokenService.DeletePolicy(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = s.tokenService.DeleteRole(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package certctl
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+// testVault is a fake Vault setting up cluster ID 123 from scratch, serving
+// CACert as root CA once generated. It records the requests writing to Vault
+// and the bodies of the token create requests. Creating tokens fails in case
+// FailTokens is set.
+type testVault struct {
+	CACert     string
+	FailTokens bool
+
+	mutex       sync.Mutex
+	mounted     bool
+	caGenerated bool
+	writes      []string
+	tokenBodies []map[string]interface{}
+}
+
+func (v *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if r.Method != "GET" {
+		v.writes = append(v.writes, r.Method+" "+r.URL.Path)
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/sys/mounts":
+		mounts := map[string]interface{}{}
+		if v.mounted {
+			mounts["pki-123/"] = map[string]interface{}{"type": "pki", "description": "PKI backend for cluster ID '123'"}
+		}
+		json.NewEncoder(w).Encode(mounts)
+	case r.Method != "GET" && r.URL.Path == "/v1/sys/mounts/pki-123":
+		v.mounted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method != "GET" && r.URL.Path == "/v1/pki-123/root/generate/internal":
+		v.caGenerated = true
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"certificate": v.CACert}})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/cert/ca" && v.caGenerated:
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"certificate": v.CACert}})
+	case r.Method == "GET" && r.URL.Path == "/v1/sys/policy":
+		json.NewEncoder(w).Encode(map[string]interface{}{"policies": []string{"default"}})
+	case r.Method != "GET" && r.URL.Path == "/v1/auth/token/create":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		v.tokenBodies = append(v.tokenBodies, body)
+		if v.FailTokens {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.token", "accessor": "accessor", "lease_duration": 3600}})
+	case r.Method != "GET":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testService(t *testing.T, handler http.Handler) (Service, func()) {
+	server := httptest.NewServer(handler)
+
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = server.URL
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	newServiceConfig := DefaultServiceConfig()
+	newServiceConfig.VaultClient = newVaultClient
+	newService, err := NewService(newServiceConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return newService, server.Close
+}
+
+// testCACert returns a self-signed root CA in PEM format.
+func testCACert(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "123.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(720 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func testSetupConfig() SetupConfig {
+	return SetupConfig{
+		PKI: pki.CreateConfig{
+			AllowedDomains: "123.example.com",
+			ClusterID:      "123",
+			CommonName:     "123.example.com",
+			TTL:            "720h",
+		},
+		Tokens: token.CreateConfig{
+			Num: 1,
+			TTL: "24h",
+		},
+		SkipVerify: true,
+	}
+}
+
+func Test_NewService_VaultClientEmpty(t *testing.T) {
+	newServiceConfig := DefaultServiceConfig()
+	newServiceConfig.VaultClient = nil
+	_, err := NewService(newServiceConfig)
+	if !IsInvalidConfig(err) {
+		t.Fatalf("expected invalid config error, got %#v", err)
+	}
+}
+
+func Test_Service_Setup_InvalidConfig(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config func(config *SetupConfig)
+	}{
+		{
+			Name: "cluster ID empty",
+			Config: func(config *SetupConfig) {
+				config.PKI.ClusterID = ""
+			},
+		},
+		{
+			Name: "tokens of another cluster ID",
+			Config: func(config *SetupConfig) {
+				config.Tokens.ClusterID = "456"
+			},
+		},
+		{
+			Name: "entity without token role",
+			Config: func(config *SetupConfig) {
+				config.CreateEntity = true
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		vault := &testVault{CACert: testCACert(t)}
+		newService, closeServer := testService(t, vault)
+
+		config := testSetupConfig()
+		tc.Config(&config)
+		_, err := newService.Setup(config)
+		closeServer()
+		if !IsInvalidConfig(err) {
+			t.Fatalf("%s: expected invalid config error, got %#v", tc.Name, err)
+		}
+		if len(vault.writes) != 0 {
+			t.Fatalf("%s: expected no writes, got %#v", tc.Name, vault.writes)
+		}
+	}
+}
+
+func Test_Service_Setup_Hooks(t *testing.T) {
+	vault := &testVault{CACert: testCACert(t)}
+	newService, closeServer := testService(t, vault)
+	defer closeServer()
+
+	var called []string
+	config := testSetupConfig()
+	config.Hooks = SetupHooks{
+		BeforePKI: func() error {
+			called = append(called, "BeforePKI")
+			if len(vault.writes) != 0 {
+				t.Fatalf("expected no writes before the PKI backend, got %#v", vault.writes)
+			}
+			return nil
+		},
+		AfterPKI: func(result pki.CreateResult) error {
+			called = append(called, "AfterPKI")
+			if !result.CAGenerated || result.RoleName == "" {
+				t.Fatalf("expected PKI backend to be set up, got %#v", result)
+			}
+			return nil
+		},
+		BeforeTokens: func() error {
+			called = append(called, "BeforeTokens")
+			return nil
+		},
+		TokenConfig: func(roleName string, config token.CreateConfig) (token.CreateConfig, error) {
+			called = append(called, "TokenConfig")
+			if roleName != "" {
+				t.Fatalf("expected no token role, got %q", roleName)
+			}
+			config.TTL = "1h"
+			return config, nil
+		},
+		AfterTokens: func(result token.CreateResult) {
+			called = append(called, "AfterTokens")
+			if len(result.Tokens) != 1 {
+				t.Fatalf("expected 1 token, got %d", len(result.Tokens))
+			}
+		},
+	}
+
+	_, err := newService.Setup(config)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	expected := []string{"BeforePKI", "AfterPKI", "BeforeTokens", "TokenConfig", "AfterTokens"}
+	if !reflect.DeepEqual(called, expected) {
+		t.Fatalf("expected hooks %#v to be called, got %#v", expected, called)
+	}
+	if len(vault.tokenBodies) != 1 {
+		t.Fatalf("expected 1 token create request, got %d", len(vault.tokenBodies))
+	}
+	if vault.tokenBodies[0]["ttl"] != "1h" {
+		t.Fatalf("expected TTL returned by the hook to be used, got %#v", vault.tokenBodies[0]["ttl"])
+	}
+}
+
+func Test_Service_Setup_HookFails(t *testing.T) {
+	hookErr := errors.New("hook failed")
+
+	testCases := []struct {
+		Name           string
+		Hooks          SetupHooks
+		ExpectedWrites bool
+	}{
+		{
+			Name: "before PKI backend",
+			Hooks: SetupHooks{
+				BeforePKI: func() error { return hookErr },
+			},
+			ExpectedWrites: false,
+		},
+		{
+			Name: "after PKI backend",
+			Hooks: SetupHooks{
+				AfterPKI: func(result pki.CreateResult) error { return hookErr },
+			},
+			ExpectedWrites: true,
+		},
+		{
+			Name: "before tokens",
+			Hooks: SetupHooks{
+				BeforeTokens: func() error { return hookErr },
+			},
+			ExpectedWrites: true,
+		},
+		{
+			Name: "token config",
+			Hooks: SetupHooks{
+				TokenConfig: func(roleName string, config token.CreateConfig) (token.CreateConfig, error) {
+					return token.CreateConfig{}, hookErr
+				},
+			},
+			ExpectedWrites: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		vault := &testVault{CACert: testCACert(t)}
+		newService, closeServer := testService(t, vault)
+
+		config := testSetupConfig()
+		config.Hooks = tc.Hooks
+		_, err := newService.Setup(config)
+		closeServer()
+		if err == nil {
+			t.Fatalf("%s: expected error, got nil", tc.Name)
+		}
+		if tc.ExpectedWrites != (len(vault.writes) != 0) {
+			t.Fatalf("%s: expected writes %t, got %#v", tc.Name, tc.ExpectedWrites, vault.writes)
+		}
+		if len(vault.tokenBodies) != 0 {
+			t.Fatalf("%s: expected no tokens to be created, got %d", tc.Name, len(vault.tokenBodies))
+		}
+	}
+}
+
+func Test_Service_Setup_AfterTokens_OnFailure(t *testing.T) {
+	vault := &testVault{CACert: testCACert(t), FailTokens: true}
+	newService, closeServer := testService(t, vault)
+	defer closeServer()
+
+	var afterTokens bool
+	config := testSetupConfig()
+	config.Hooks.AfterTokens = func(result token.CreateResult) {
+		afterTokens = true
+	}
+
+	_, err := newService.Setup(config)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !afterTokens {
+		t.Fatalf("expected AfterTokens to be called in case creating tokens fails")
+	}
+}
+
+func Test_Service_CreateTokens_NotSetUp(t *testing.T) {
+	vault := &testVault{CACert: testCACert(t)}
+	newService, closeServer := testService(t, vault)
+	defer closeServer()
+
+	_, err := newService.CreateTokens(CreateTokensConfig{Tokens: token.CreateConfig{ClusterID: "123", Num: 1}})
+	if !IsNotSetUp(err) {
+		t.Fatalf("expected not set up error, got %#v", err)
+	}
+	if len(vault.writes) != 0 {
+		t.Fatalf("expected no writes, got %#v", vault.writes)
+	}
+}
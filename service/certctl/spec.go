@@ -0,0 +1,146 @@
+package certctl
+
+import (
+	"crypto/x509"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+// SetupConfig is used to configure setting up a cluster using Service.Setup.
+type SetupConfig struct {
+	// PKI configures the PKI backend of the cluster, including its root CA and
+	// PKI roles. Its cluster ID is the one of the cluster set up.
+	PKI pki.CreateConfig
+
+	// Tokens configures the tokens generated for the cluster. Zero tokens
+	// only create the PKI issue policy, unless it is skipped.
+	Tokens token.CreateConfig
+
+	// TokenRole is the name of an existing token role the tokens are created
+	// against. It is ignored in case CreateTokenRole is set.
+	TokenRole string
+
+	// CreateTokenRole configures whether a token role of the cluster is
+	// created, which the tokens are created against then. The token role is
+	// created with the max TTL of Tokens, if given. TTLs of Tokens are not
+	// capped by Setup, Vault silently caps them at the token role's max TTL.
+	// Use Hooks.TokenConfig to cap them explicitly.
+	CreateTokenRole bool
+
+	// CreateEntity configures whether an identity entity of the cluster is
+	// created, which the tokens are associated with using an entity alias. It
+	// requires CreateTokenRole.
+	CreateEntity bool
+
+	// SkipVerify disables verifying the CA chain of the cluster is internally
+	// consistent before the tokens are generated.
+	SkipVerify bool
+
+	// Hooks are called between the steps of setting up the cluster.
+	Hooks SetupHooks
+}
+
+// SetupHooks are called by Service.Setup between its steps, e.g. to record how
+// to roll back the resources about to be created or to report what has been
+// done. Nil hooks are skipped. An error returned by a hook stops Setup.
+type SetupHooks struct {
+	// BeforePKI is called before the PKI backend of the cluster is set up.
+	BeforePKI func() error
+
+	// AfterPKI is called after the PKI backend of the cluster has been set up,
+	// with the result of setting it up.
+	AfterPKI func(result pki.CreateResult) error
+
+	// BeforeTokens is called before the token role, the identity entity and
+	// the tokens of the cluster are created.
+	BeforeTokens func() error
+
+	// TokenConfig is called right before the tokens are generated against the
+	// given token role, which is empty in case there is none. It returns the
+	// configuration the tokens are generated with, e.g. having capped TTLs.
+	TokenConfig func(roleName string, config token.CreateConfig) (token.CreateConfig, error)
+
+	// AfterTokens is called after generating the tokens, also in case it
+	// failed, with the tokens created.
+	AfterTokens func(result token.CreateResult)
+}
+
+// SetupResult represents what has been set up by Service.Setup.
+type SetupResult struct {
+	// PKI is the result of setting up the PKI backend.
+	PKI pki.CreateResult
+
+	// CAChain is the verified CA chain of the cluster. It is empty in case
+	// verifying was skipped.
+	CAChain []*x509.Certificate
+
+	// TokenRole is the name of the token role the tokens were created against.
+	// It is empty in case they were not created against a token role.
+	TokenRole string
+
+	// EntityID is the ID of the created identity entity, if any.
+	EntityID string
+
+	// Tokens is the result of generating the tokens. In case generating fails,
+	// it holds the tokens created before the failure.
+	Tokens token.CreateResult
+}
+
+// CreateTokensConfig is used to configure creating tokens for an already set
+// up cluster using Service.CreateTokens.
+type CreateTokensConfig struct {
+	// Tokens configures the tokens created. In case no policies are given, the
+	// PKI issue policy of the cluster is attached, which must exist. The PKI
+	// issue policy is never created.
+	Tokens token.CreateConfig
+
+	// TokenRole is the name of the token role the tokens are created against.
+	// Empty means the token role of the cluster in case it exists.
+	TokenRole string
+}
+
+// Service combines the services certctl consists of over a single Vault
+// client, so certctl can be embedded without wiring them by hand.
+type Service interface {
+	// PKI returns the PKI controller of the service.
+	PKI() pki.Service
+
+	// Token returns the token generator of the service.
+	Token() token.Service
+
+	// CertSigner returns the certificate signer of the service.
+	CertSigner() spec.CertSigner
+
+	// Setup sets up the cluster of the given configuration, i.e. mounts its
+	// PKI backend, generates its root CA and PKI roles, creates its PKI issue
+	// policy and generates tokens allowed to issue certificates. Existing
+	// resources are reused, so Setup can be called again. The hooks of the
+	// given configuration are called between the steps.
+	Setup(config SetupConfig) (SetupResult, error)
+
+	// CreateTokens creates tokens for the already set up cluster of the given
+	// configuration. It fails in case the cluster has no PKI role.
+	CreateTokens(config CreateTokensConfig) (token.CreateResult, error)
+
+	// ClusterTokenRole returns the name of the token role of the given cluster
+	// ID in case it exists. Otherwise it returns an empty name.
+	ClusterTokenRole(clusterID string) (string, error)
+
+	// Issue generates a new signed certificate with respect to the given
+	// configuration.
+	Issue(config spec.IssueConfig) (spec.IssueResponse, error)
+
+	// Sign signs the certificate signing request of the given configuration.
+	Sign(config spec.SignConfig) (spec.IssueResponse, error)
+
+	// Revoke revokes the certificate of the given serial number issued by the
+	// PKI backend of the given cluster ID.
+	Revoke(clusterID, serialNumber string) error
+
+	// Cleanup removes the PKI backend, the PKI issue policy and the token role
+	// of the given cluster ID. Tokens generated for the cluster are not
+	// revoked, since they are not tracked.
+	Cleanup(clusterID string) error
+}
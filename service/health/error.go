@@ -0,0 +1,58 @@
+package health
+
+import (
+	"fmt"
+
+	"github.com/juju/errgo"
+)
+
+var (
+	maskAny = errgo.MaskFunc(errgo.Any)
+)
+
+func maskAnyf(err error, f string, v ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	f = fmt.Sprintf("%s: %s", err.Error(), f)
+	newErr := errgo.WithCausef(nil, errgo.Cause(err), f, v...)
+	newErr.(*errgo.Err).SetLocation(1)
+
+	return newErr
+}
+
+var invalidConfigError = errgo.New("invalid config")
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return errgo.Cause(err) == invalidConfigError
+}
+
+var vaultSealedError = errgo.New("Vault sealed")
+
+// IsVaultSealed asserts vaultSealedError.
+func IsVaultSealed(err error) bool {
+	return errgo.Cause(err) == vaultSealedError
+}
+
+var waitTimeoutError = errgo.New("wait timeout")
+
+// IsWaitTimeout asserts waitTimeoutError.
+func IsWaitTimeout(err error) bool {
+	return errgo.Cause(err) == waitTimeoutError
+}
+
+var dateMissingError = errgo.New("Date missing")
+
+// IsDateMissing asserts dateMissingError.
+func IsDateMissing(err error) bool {
+	return errgo.Cause(err) == dateMissingError
+}
+
+var maintenanceError = errgo.New("Vault in maintenance")
+
+// IsMaintenance asserts maintenanceError.
+func IsMaintenance(err error) bool {
+	return errgo.Cause(err) == maintenanceError
+}
@@ -0,0 +1,274 @@
+package health
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+// ServiceConfig represents the configuration used to create a new health
+// service.
+type ServiceConfig struct {
+	// Dependencies.
+	Logger      *log.Logger
+	VaultClient *vaultclient.Client
+}
+
+// DefaultServiceConfig provides a default configuration to create a health
+// service.
+func DefaultServiceConfig() ServiceConfig {
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = "http://127.0.0.1:8200"
+	newClientConfig.HttpClient = http.DefaultClient
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	newConfig := ServiceConfig{
+		// Dependencies.
+		Logger:      log.New(ioutil.Discard, "", 0),
+		VaultClient: newVaultClient,
+	}
+
+	return newConfig
+}
+
+// NewService creates a new configured health service.
+func NewService(config ServiceConfig) (Service, error) {
+	// Dependencies.
+	if config.Logger == nil {
+		return nil, maskAnyf(invalidConfigError, "logger must not be empty")
+	}
+	if config.VaultClient == nil {
+		return nil, maskAnyf(invalidConfigError, "Vault client must not be empty")
+	}
+
+	newService := &service{
+		ServiceConfig: config,
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	ServiceConfig
+}
+
+func (s *service) Status() (Status, error) {
+	resp, err := s.VaultClient.RawRequest(s.healthRequest())
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return Status{}, maskAny(err)
+	}
+
+	var status Status
+	err = resp.DecodeJSON(&status)
+	if err != nil {
+		return Status{}, maskAny(err)
+	}
+
+	return status, nil
+}
+
+func (s *service) VerifyUnsealed() error {
+	status, err := s.Status()
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if !status.Initialized {
+		return maskAnyf(vaultSealedError, "Vault is not initialized")
+	}
+	if status.Sealed {
+		return maskAnyf(vaultSealedError, "Vault is sealed")
+	}
+
+	return nil
+}
+
+func (s *service) WaitForUnseal(config WaitConfig) error {
+	if config.Interval <= 0 {
+		return maskAnyf(invalidConfigError, "interval must be positive")
+	}
+
+	deadline := time.Now().Add(config.Timeout)
+	interval := config.Interval
+	for attempt := 1; ; attempt++ {
+		status, err := s.Status()
+		if err == nil && status.Active() {
+			s.Logger.Printf("Vault health check attempt %d: Vault is active", attempt)
+			return nil
+		}
+		if config.Progress != nil {
+			config.Progress(status, err)
+		}
+
+		// The last check is done at the deadline, so waiting never takes
+		// longer than the timeout, regardless of the current interval.
+		wait := interval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		if wait <= 0 {
+			if err != nil {
+				return maskAnyf(waitTimeoutError, "Vault not reachable after %s: %s", config.Timeout, err.Error())
+			}
+			return maskAnyf(waitTimeoutError, "Vault not active after %s", config.Timeout)
+		}
+		if err != nil {
+			s.Logger.Printf("Vault health check attempt %d: %s, checking again in %s", attempt, err.Error(), wait)
+		} else {
+			s.Logger.Printf("Vault health check attempt %d: %s, checking again in %s", attempt, describeStatus(status), wait)
+		}
+		time.Sleep(wait)
+
+		if interval < config.MaxInterval {
+			interval *= 2
+			if interval > config.MaxInterval {
+				interval = config.MaxInterval
+			}
+		}
+	}
+}
+
+func (s *service) Clock() (Clock, error) {
+	start := time.Now()
+	resp, err := s.VaultClient.RawRequest(s.healthRequest())
+	end := time.Now()
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return Clock{}, maskAny(err)
+	}
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return Clock{}, maskAnyf(dateMissingError, "Vault responded without Date header")
+	}
+	vaultTime, err := http.ParseTime(date)
+	if err != nil {
+		return Clock{}, maskAnyf(dateMissingError, "Date header '%s' is malformed", date)
+	}
+
+	// The Date header is truncated to seconds, so Vault's time is estimated
+	// as the middle of the second, compared to the middle of the request.
+	roundTrip := end.Sub(start)
+	localTime := start.Add(roundTrip / 2)
+	clock := Clock{
+		LocalTime: localTime,
+		VaultTime: vaultTime,
+		Skew:      vaultTime.Add(500 * time.Millisecond).Sub(localTime),
+		RoundTrip: roundTrip,
+	}
+
+	return clock, nil
+}
+
+// healthRequest returns a request of sys/health. It reports unhealthy states
+// using status codes, which are all mapped to 200, so the status can be
+// decoded regardless of the state.
+func (s *service) healthRequest() *vaultclient.Request {
+	req := s.VaultClient.NewRequest("GET", "/v1/sys/health")
+	req.Params.Set("standbycode", "200")
+	req.Params.Set("sealedcode", "200")
+	req.Params.Set("uninitcode", "200")
+
+	return req
+}
+
+// describeStatus returns why Vault having the given status is not active.
+func describeStatus(status Status) string {
+	switch {
+	case !status.Initialized:
+		return "Vault is not initialized"
+	case status.Sealed:
+		return "Vault is sealed"
+	case status.Standby:
+		return "Vault is a standby node"
+	}
+
+	return "Vault is active"
+}
+
+func (s *service) Maintenance() ([]string, error) {
+	var operations []string
+
+	var sealStatus struct {
+		Migration    bool `json:"migration"`
+		RecoverySeal bool `json:"recovery_seal"`
+	}
+	err := s.get("/v1/sys/seal-status", &sealStatus)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if sealStatus.Migration {
+		operations = append(operations, "seal migration in progress")
+	}
+
+	var rekeyStatus struct {
+		Started bool `json:"started"`
+	}
+	err = s.get("/v1/sys/rekey/init", &rekeyStatus)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if rekeyStatus.Started {
+		operations = append(operations, "rekey of the barrier key in progress")
+	}
+
+	// Recovery keys only exist for Vaults using auto unseal. Others reject
+	// the request.
+	if sealStatus.RecoverySeal {
+		rekeyStatus.Started = false
+		err = s.get("/v1/sys/rekey-recovery-key/init", &rekeyStatus)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if rekeyStatus.Started {
+			operations = append(operations, "rekey of the recovery key in progress")
+		}
+	}
+
+	return operations, nil
+}
+
+func (s *service) VerifyNoMaintenance() error {
+	operations, err := s.Maintenance()
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(operations) != 0 {
+		return maskAnyf(maintenanceError, "%s", strings.Join(operations, ", "))
+	}
+
+	return nil
+}
+
+// get decodes the response of the given unauthenticated status endpoint into
+// v.
+func (s *service) get(path string, v interface{}) error {
+	req := s.VaultClient.NewRequest("GET", path)
+
+	resp, err := s.VaultClient.RawRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = resp.DecodeJSON(v)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package health
+
+import (
+	"time"
+)
+
+// Status represents the health of Vault as reported by its sys/health
+// endpoint.
+type Status struct {
+	// Initialized is whether Vault is initialized.
+	Initialized bool `json:"initialized"`
+
+	// Sealed is whether Vault is sealed. A sealed Vault can not serve any
+	// requests.
+	Sealed bool `json:"sealed"`
+
+	// Standby is whether the Vault node is a standby node of a HA deployment.
+	// Standby nodes forward requests to the active node.
+	Standby bool `json:"standby"`
+
+	// Version is the version of Vault.
+	Version string `json:"version"`
+}
+
+// Active returns whether Vault is initialized, unsealed and the active node.
+func (s Status) Active() bool {
+	return s.Initialized && !s.Sealed && !s.Standby
+}
+
+// Clock represents the clock of Vault compared to the local clock, as measured
+// by Service.Clock.
+type Clock struct {
+	// LocalTime is the local time in the middle of the request the clock was
+	// measured with.
+	LocalTime time.Time
+
+	// VaultTime is the time of Vault according to the Date header of its
+	// response. It has a resolution of one second.
+	VaultTime time.Time
+
+	// Skew is how far the clock of Vault is ahead of the local clock. It is
+	// negative in case Vault is behind.
+	Skew time.Duration
+
+	// RoundTrip is the duration of the request the clock was measured with.
+	RoundTrip time.Duration
+}
+
+// Uncertainty returns how far Skew may deviate from the actual skew, due to
+// the resolution of the Date header and the unknown time the request spent on
+// the way to Vault.
+func (c Clock) Uncertainty() time.Duration {
+	return 500*time.Millisecond + c.RoundTrip/2
+}
+
+// WaitConfig is used to configure waiting for Vault to become active done by
+// Service.WaitForUnseal.
+type WaitConfig struct {
+	// Interval is the time between the first two health checks. It doubles
+	// after every further check until it reaches MaxInterval, so a recovering
+	// Vault is not polled tightly.
+	Interval time.Duration
+
+	// MaxInterval caps the time between two health checks. In case it is not
+	// greater than Interval, Vault is checked every Interval.
+	MaxInterval time.Duration
+
+	// Timeout is the maximum time to wait for Vault to become active.
+	Timeout time.Duration
+
+	// Progress is called with the status of every health check while Vault is
+	// not active yet. In case Vault is not reachable, the error is given
+	// instead. It is optional.
+	Progress func(status Status, err error)
+}
+
+// Service checks the health of Vault.
+type Service interface {
+	// Status returns the current health of Vault.
+	Status() (Status, error)
+
+	// VerifyUnsealed returns an error in case Vault is not initialized or
+	// sealed. Standby nodes are fine, because they forward requests to the
+	// active node.
+	VerifyUnsealed() error
+
+	// WaitForUnseal checks the health of Vault until it is initialized,
+	// unsealed and active, or the timeout of the given configuration is
+	// reached. Unreachable Vaults are checked again, because Vault may still
+	// be starting, e.g. in bootstrap scenarios.
+	WaitForUnseal(config WaitConfig) error
+
+	// Maintenance returns the maintenance operations in progress on Vault,
+	// e.g. a rekey of the barrier or a seal migration, which changes made
+	// meanwhile could conflict with. It is empty in case there are none.
+	Maintenance() ([]string, error)
+
+	// VerifyNoMaintenance returns an error in case any maintenance operation
+	// is in progress on Vault.
+	VerifyNoMaintenance() error
+
+	// Clock measures the skew of the local clock against the clock of Vault,
+	// using the Date header of its response.
+	Clock() (Clock, error)
+}
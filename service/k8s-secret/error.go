@@ -0,0 +1,51 @@
+package k8ssecret
+
+import (
+	"fmt"
+
+	"github.com/juju/errgo"
+)
+
+var (
+	maskAny = errgo.MaskFunc(errgo.Any)
+)
+
+func maskAnyf(err error, f string, v ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	f = fmt.Sprintf("%s: %s", err.Error(), f)
+	newErr := errgo.WithCausef(nil, errgo.Cause(err), f, v...)
+	newErr.(*errgo.Err).SetLocation(1)
+
+	return newErr
+}
+
+var invalidConfigError = errgo.New("invalid config")
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return errgo.Cause(err) == invalidConfigError
+}
+
+var secretNotOwnedError = errgo.New("secret not owned")
+
+// IsSecretNotOwned asserts secretNotOwnedError.
+func IsSecretNotOwned(err error) bool {
+	return errgo.Cause(err) == secretNotOwnedError
+}
+
+var secretNotFoundError = errgo.New("secret not found")
+
+// IsSecretNotFound asserts secretNotFoundError.
+func IsSecretNotFound(err error) bool {
+	return errgo.Cause(err) == secretNotFoundError
+}
+
+var unexpectedStatusError = errgo.New("unexpected status")
+
+// IsUnexpectedStatus asserts unexpectedStatusError.
+func IsUnexpectedStatus(err error) bool {
+	return errgo.Cause(err) == unexpectedStatusError
+}
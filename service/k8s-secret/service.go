@@ -0,0 +1,330 @@
+package k8ssecret
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+const (
+	// ManagedByLabel is the label set on every Secret written by certctl. Its
+	// value is ManagedByValue.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel.
+	ManagedByValue = "certctl"
+
+	// ClusterIDLabel is the label set on Secrets holding Vault tokens. Its value
+	// is the cluster ID the tokens have been generated for.
+	ClusterIDLabel = "certctl.giantswarm.io/cluster-id"
+	// ComponentLabel is the label describing the content of a Secret.
+	ComponentLabel = "app.kubernetes.io/component"
+
+	// OpaqueSecretType is the type of Secrets holding Vault tokens.
+	OpaqueSecretType = "Opaque"
+	// TLSSecretType is the type of Secrets holding certificate key pairs.
+	TLSSecretType = "kubernetes.io/tls"
+
+	serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// ServiceConfig represents the configuration used to create a new Kubernetes
+// Secret service.
+type ServiceConfig struct {
+	// Dependencies.
+	HTTPClient *http.Client
+
+	// Settings.
+
+	// Address is the address of the Kubernetes API server, e.g.
+	// https://10.0.0.1:443.
+	Address string
+
+	// Token is the bearer token used to authenticate against the Kubernetes API
+	// server.
+	Token string
+}
+
+// DefaultServiceConfig provides a default configuration to create a Kubernetes
+// Secret service.
+func DefaultServiceConfig() ServiceConfig {
+	newConfig := ServiceConfig{
+		// Dependencies.
+		HTTPClient: http.DefaultClient,
+
+		// Settings.
+		Address: "",
+		Token:   "",
+	}
+
+	return newConfig
+}
+
+// InClusterServiceConfig provides a configuration to create a Kubernetes Secret
+// service using the service account of the pod certctl is running in.
+func InClusterServiceConfig() (ServiceConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return ServiceConfig{}, maskAnyf(invalidConfigError, "not running inside a Kubernetes cluster")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountPath + "/token")
+	if err != nil {
+		return ServiceConfig{}, maskAny(err)
+	}
+	ca, err := ioutil.ReadFile(serviceAccountPath + "/ca.crt")
+	if err != nil {
+		return ServiceConfig{}, maskAny(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return ServiceConfig{}, maskAnyf(invalidConfigError, "service account CA must be PEM encoded")
+	}
+
+	newConfig := DefaultServiceConfig()
+	newConfig.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    pool,
+			},
+		},
+	}
+	newConfig.Address = "https://" + net.JoinHostPort(host, port)
+	newConfig.Token = strings.TrimSpace(string(token))
+
+	return newConfig, nil
+}
+
+// NewService creates a new configured Kubernetes Secret service.
+func NewService(config ServiceConfig) (Service, error) {
+	// Dependencies.
+	if config.HTTPClient == nil {
+		return nil, maskAnyf(invalidConfigError, "HTTP client must not be empty")
+	}
+
+	// Settings.
+	if config.Address == "" {
+		return nil, maskAnyf(invalidConfigError, "Kubernetes address must not be empty")
+	}
+	if config.Token == "" {
+		return nil, maskAnyf(invalidConfigError, "Kubernetes token must not be empty")
+	}
+
+	newService := &service{
+		ServiceConfig: config,
+	}
+
+	return newService, nil
+}
+
+// ParseSecretRef parses a Secret reference of the form namespace/name.
+func ParseSecretRef(value string) (SecretRef, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return SecretRef{}, maskAnyf(invalidConfigError, "secret reference must be of the form namespace/name")
+	}
+
+	return SecretRef{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+type service struct {
+	ServiceConfig
+}
+
+// secret is the subset of the Kubernetes Secret resource certctl cares about.
+type secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   secretMetadata    `json:"metadata"`
+	Type       string            `json:"type"`
+	Data       map[string][]byte `json:"data"`
+}
+
+type secretMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+}
+
+func (s *service) IssueAndStore(certSigner spec.CertSigner, issueConfig spec.IssueConfig, secret SecretRef) (spec.IssueResponse, error) {
+	newIssueResponse, err := certSigner.Issue(issueConfig)
+	if err != nil {
+		return spec.IssueResponse{}, maskAny(err)
+	}
+
+	storeConfig := StoreTLSConfig{
+		Secret:        secret,
+		IssueResponse: newIssueResponse,
+	}
+	err = s.StoreTLS(storeConfig)
+	if err != nil {
+		return spec.IssueResponse{}, maskAny(err)
+	}
+
+	return newIssueResponse, nil
+}
+
+func (s *service) StoreTLS(config StoreTLSConfig) error {
+	data := map[string][]byte{
+		"tls.crt": []byte(config.IssueResponse.Certificate),
+		"tls.key": []byte(config.IssueResponse.PrivateKey),
+		"ca.crt":  []byte(config.IssueResponse.IssuingCA),
+	}
+
+	labels := map[string]string{
+		ComponentLabel: "certificate",
+	}
+
+	err := s.store(config.Secret, TLSSecretType, labels, data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) StoreTokens(config StoreTokensConfig) error {
+	labels := map[string]string{
+		ClusterIDLabel: config.ClusterID,
+		ComponentLabel: "vault-tokens",
+	}
+	data := map[string][]byte{}
+	for i, t := range config.Tokens {
+		data[fmt.Sprintf("token-%d", i)] = []byte(t)
+	}
+
+	err := s.store(config.Secret, OpaqueSecretType, labels, data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// store creates the referenced Secret or updates it in case it already exists.
+// Existing Secrets are only updated if they are managed by certctl and are of
+// the same type.
+func (s *service) store(ref SecretRef, secretType string, labels map[string]string, data map[string][]byte) error {
+	newSecret := secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: secretMetadata{
+			Name:      ref.Name,
+			Namespace: ref.Namespace,
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+			},
+		},
+		Type: secretType,
+		Data: data,
+	}
+	for k, v := range labels {
+		newSecret.Metadata.Labels[k] = v
+	}
+
+	existing, found, err := s.get(ref)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if !found {
+		err := s.do("POST", s.secretsPath(ref.Namespace), newSecret, nil, http.StatusCreated)
+		if err != nil {
+			return maskAny(err)
+		}
+
+		return nil
+	}
+
+	if existing.Metadata.Labels[ManagedByLabel] != ManagedByValue {
+		return maskAnyf(secretNotOwnedError, "secret '%s/%s' is not managed by certctl", ref.Namespace, ref.Name)
+	}
+	if existing.Type != secretType {
+		return maskAnyf(secretNotOwnedError, "secret '%s/%s' has type '%s' instead of '%s'", ref.Namespace, ref.Name, existing.Type, secretType)
+	}
+
+	newSecret.Metadata.ResourceVersion = existing.Metadata.ResourceVersion
+	for k, v := range existing.Metadata.Labels {
+		if _, ok := newSecret.Metadata.Labels[k]; !ok {
+			newSecret.Metadata.Labels[k] = v
+		}
+	}
+	err = s.do("PUT", s.secretPath(ref), newSecret, nil, http.StatusOK)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) get(ref SecretRef) (secret, bool, error) {
+	var existing secret
+	err := s.do("GET", s.secretPath(ref), nil, &existing, http.StatusOK)
+	if IsSecretNotFound(err) {
+		return secret{}, false, nil
+	} else if err != nil {
+		return secret{}, false, maskAny(err)
+	}
+
+	return existing, true, nil
+}
+
+func (s *service) do(method, path string, in, out interface{}, expected int) error {
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.Address, "/")+path, &body)
+	if err != nil {
+		return maskAny(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return maskAny(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return maskAnyf(secretNotFoundError, "%s %s", method, path)
+	}
+	if resp.StatusCode != expected {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return maskAnyf(unexpectedStatusError, "%s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		err := json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *service) secretsPath(namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets", namespace)
+}
+
+func (s *service) secretPath(ref SecretRef) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", ref.Namespace, ref.Name)
+}
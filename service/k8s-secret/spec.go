@@ -0,0 +1,58 @@
+package k8ssecret
+
+import (
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// SecretRef references a Kubernetes Secret by namespace and name.
+type SecretRef struct {
+	// Namespace is the namespace the Secret lives in.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+}
+
+// StoreTLSConfig is used to configure the process of storing an issued
+// certificate key pair in a Kubernetes Secret.
+type StoreTLSConfig struct {
+	// Secret references the kubernetes.io/tls Secret being created or updated.
+	Secret SecretRef `json:"secret"`
+
+	// IssueResponse is the issued certificate key pair being stored. The
+	// certificate, private key and issuing CA are written to the tls.crt,
+	// tls.key and ca.crt keys of the Secret.
+	IssueResponse spec.IssueResponse `json:"issue_response"`
+}
+
+// StoreTokensConfig is used to configure the process of storing generated
+// Vault tokens in a Kubernetes Secret.
+type StoreTokensConfig struct {
+	// Secret references the Opaque Secret being created or updated.
+	Secret SecretRef `json:"secret"`
+
+	// ClusterID represents the cluster ID the tokens have been generated for. It
+	// is set as ClusterIDLabel on the Secret.
+	ClusterID string `json:"cluster_id"`
+
+	// Tokens are the generated Vault tokens. Each token is written to its own
+	// key token-<n> of the Secret, starting at 0.
+	Tokens []string `json:"tokens"`
+}
+
+// Service manages Kubernetes Secrets holding material generated by certctl.
+// Secrets are labelled as managed by certctl. Existing Secrets not carrying
+// this label are never modified.
+type Service interface {
+	// IssueAndStore issues a new signed certificate using the given certificate
+	// signer and stores it in the given Secret.
+	IssueAndStore(certSigner spec.CertSigner, issueConfig spec.IssueConfig, secret SecretRef) (spec.IssueResponse, error)
+
+	// StoreTLS creates or updates a kubernetes.io/tls Secret with respect to the
+	// given configuration.
+	StoreTLS(config StoreTLSConfig) error
+
+	// StoreTokens creates or updates an Opaque Secret holding Vault tokens with
+	// respect to the given configuration.
+	StoreTokens(config StoreTokensConfig) error
+}
@@ -0,0 +1,80 @@
+package pki
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+)
+
+func (s *service) ListRoles(clusterID string) ([]string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List(s.ListRolesPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(roleNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	// In case there is not a single role for this PKI backend, secret is nil.
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	names := toStringList(secret.Data["keys"])
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *service) GetMountTuning(clusterID string) (MountTuning, error) {
+	sysBackend := s.VaultClient.Sys()
+
+	current, err := sysBackend.MountConfig(s.MountPKIPath(clusterID))
+	if err != nil {
+		return MountTuning{}, maskAny(err)
+	}
+
+	tuning := MountTuning{
+		DefaultLeaseTTL: time.Duration(current.DefaultLeaseTTL) * time.Second,
+		MaxLeaseTTL:     time.Duration(current.MaxLeaseTTL) * time.Second,
+	}
+
+	return tuning, nil
+}
+
+func (s *service) GetURLs(clusterID string) (URLs, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.URLsPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return URLs{}, maskAnyf(caNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return URLs{}, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return URLs{}, nil
+	}
+
+	urls := URLs{
+		IssuingCertificates:   toStringList(secret.Data["issuing_certificates"]),
+		CRLDistributionPoints: toStringList(secret.Data["crl_distribution_points"]),
+		OCSPServers:           toStringList(secret.Data["ocsp_servers"]),
+	}
+
+	return urls, nil
+}
+
+// VerifyCAKey checks that the given PEM encoded private key, e.g. as exported
+// when the root CA was generated, belongs to the given CA certificate.
+func VerifyCAKey(ca *x509.Certificate, key string) error {
+	signer, err := parsePrivateKey(key)
+	if err != nil {
+		return maskAny(err)
+	}
+	err = matchPublicKey(ca, signer)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "private key does not belong to the CA '%s'", ca.Subject.CommonName)
+	}
+
+	return nil
+}
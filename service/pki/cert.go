@@ -0,0 +1,54 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+)
+
+func (s *service) ListCerts(clusterID string) ([]string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List(s.ListCertsPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(certNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	return toStringList(secret.Data["keys"]), nil
+}
+
+func (s *service) GetCert(clusterID, serial string) (Cert, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.CertPath(clusterID, serial))
+	if IsNoVaultHandlerDefined(err) {
+		return Cert{}, maskAnyf(certNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return Cert{}, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return Cert{}, maskAnyf(certNotFoundError, "cert '%s' not found in PKI backend of cluster ID '%s'", serial, clusterID)
+	}
+
+	block, _ := pem.Decode([]byte(toString(secret.Data["certificate"])))
+	if block == nil {
+		return Cert{}, maskAnyf(certNotFoundError, "cert '%s' must be PEM encoded", serial)
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return Cert{}, maskAny(err)
+	}
+
+	// Vault reports a revocation time of 0 for certificates not revoked.
+	cert := Cert{
+		Serial:      FormatSerialNumber(crt.SerialNumber),
+		Certificate: crt,
+		Revoked:     toDuration(secret.Data["revocation_time"]) > 0,
+	}
+
+	return cert, nil
+}
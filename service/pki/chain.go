@@ -0,0 +1,92 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+)
+
+func (s *service) GetCAChain(clusterID string) ([]*x509.Certificate, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.ReadCAChainPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(caNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var chain []*x509.Certificate
+	if secret != nil {
+		if v, ok := secret.Data["certificate"].(string); ok {
+			chain, err = parseCertificates(v)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+	}
+
+	// Vault does not return a chain for root CAs not being part of one, so the
+	// chain consists of the CA only.
+	if len(chain) == 0 {
+		ca, err := s.GetCA(clusterID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		chain = []*x509.Certificate{ca}
+	}
+
+	return chain, nil
+}
+
+// VerifyChain checks the given CA chain, as returned by
+// Service.GetCAChain, is internally consistent, i.e. every certificate is
+// signed by the next one and a root CA ending the chain is signed by itself.
+// The returned error names the first broken link.
+func VerifyChain(chain []*x509.Certificate) error {
+	for i, crt := range chain {
+		if i+1 < len(chain) {
+			err := crt.CheckSignatureFrom(chain[i+1])
+			if err != nil {
+				return maskAnyf(caChainBrokenError, "certificate %d '%s' is not signed by certificate %d '%s': %s", i, crt.Subject.CommonName, i+1, chain[i+1].Subject.CommonName, err.Error())
+			}
+			continue
+		}
+
+		if crt.Issuer.String() == crt.Subject.String() {
+			err := crt.CheckSignatureFrom(crt)
+			if err != nil {
+				return maskAnyf(caChainBrokenError, "root CA '%s' is not self-signed: %s", crt.Subject.CommonName, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseCertificates parses all PEM encoded certificates of the given data in
+// order.
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var crts []*x509.Certificate
+
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, maskAnyf(caChainBrokenError, "certificate %d: %s", len(crts), err.Error())
+		}
+		crts = append(crts, crt)
+	}
+
+	return crts, nil
+}
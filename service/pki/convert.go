@@ -0,0 +1,73 @@
+package pki
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Vault API returns role data as decoded JSON with numbers being
+// json.Number. Depending on the Vault version, values may also be encoded as
+// strings, e.g. lists as comma separated strings or durations as golang time
+// strings. The helpers below normalize these representations.
+
+func toBool(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		b, _ := strconv.ParseBool(t)
+		return b
+	}
+
+	return false
+}
+
+func toDuration(v interface{}) time.Duration {
+	switch t := v.(type) {
+	case json.Number:
+		i, _ := t.Int64()
+		return time.Duration(i) * time.Second
+	case float64:
+		return time.Duration(t) * time.Second
+	case int:
+		return time.Duration(t) * time.Second
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return time.Duration(i) * time.Second
+		}
+		d, _ := time.ParseDuration(t)
+		return d
+	}
+
+	return 0
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+
+	return s
+}
+
+func toStringList(v interface{}) []string {
+	var list []string
+
+	switch t := v.(type) {
+	case []interface{}:
+		for _, i := range t {
+			list = append(list, fmt.Sprintf("%v", i))
+		}
+	case []string:
+		list = append(list, t...)
+	case string:
+		for _, i := range strings.Split(t, ",") {
+			if i = strings.TrimSpace(i); i != "" {
+				list = append(list, i)
+			}
+		}
+	}
+
+	return list
+}
@@ -30,6 +30,55 @@ func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
 
+var caNotFoundError = errgo.New("CA not found")
+
+// IsCANotFound asserts caNotFoundError.
+func IsCANotFound(err error) bool {
+	return errgo.Cause(err) == caNotFoundError
+}
+
+var caAlreadyExistsError = errgo.New("CA already exists")
+
+// IsCAAlreadyExists asserts caAlreadyExistsError.
+func IsCAAlreadyExists(err error) bool {
+	return errgo.Cause(err) == caAlreadyExistsError
+}
+
+var invalidCABundleError = errgo.New("invalid CA bundle")
+
+// IsInvalidCABundle asserts invalidCABundleError.
+func IsInvalidCABundle(err error) bool {
+	return errgo.Cause(err) == invalidCABundleError
+}
+
+var keyNotFoundError = errgo.New("key not found")
+
+// IsKeyNotFound asserts keyNotFoundError.
+func IsKeyNotFound(err error) bool {
+	return errgo.Cause(err) == keyNotFoundError
+}
+
+var certNotFoundError = errgo.New("cert not found")
+
+// IsCertNotFound asserts certNotFoundError.
+func IsCertNotFound(err error) bool {
+	return errgo.Cause(err) == certNotFoundError
+}
+
+var keyInUseError = errgo.New("key in use")
+
+// IsKeyInUse asserts keyInUseError.
+func IsKeyInUse(err error) bool {
+	return errgo.Cause(err) == keyInUseError
+}
+
+var roleNotFoundError = errgo.New("role not found")
+
+// IsRoleNotFound asserts roleNotFoundError.
+func IsRoleNotFound(err error) bool {
+	return errgo.Cause(err) == roleNotFoundError
+}
+
 // IsNoVaultHandlerDefined asserts a dirty string matching against the error
 // message provided by err. This is necessary due to the poor error handling
 // design of the Vault library we are using.
@@ -42,3 +91,45 @@ func IsNoVaultHandlerDefined(err error) bool {
 
 	return false
 }
+
+var nameNotAllowedError = errgo.New("name not allowed")
+
+// IsNameNotAllowed asserts nameNotAllowedError.
+func IsNameNotAllowed(err error) bool {
+	return errgo.Cause(err) == nameNotAllowedError
+}
+
+var serialNumberNotAllowedError = errgo.New("serial number not allowed")
+
+// IsSerialNumberNotAllowed asserts serialNumberNotAllowedError.
+func IsSerialNumberNotAllowed(err error) bool {
+	return errgo.Cause(err) == serialNumberNotAllowedError
+}
+
+var commonNameRequiredError = errgo.New("common name required")
+
+// IsCommonNameRequired asserts commonNameRequiredError.
+func IsCommonNameRequired(err error) bool {
+	return errgo.Cause(err) == commonNameRequiredError
+}
+
+var subjectMismatchError = errgo.New("subject mismatch")
+
+// IsSubjectMismatch asserts subjectMismatchError.
+func IsSubjectMismatch(err error) bool {
+	return errgo.Cause(err) == subjectMismatchError
+}
+
+var mountConflictError = errgo.New("mount conflict")
+
+// IsMountConflict asserts mountConflictError.
+func IsMountConflict(err error) bool {
+	return errgo.Cause(err) == mountConflictError
+}
+
+var caChainBrokenError = errgo.New("CA chain broken")
+
+// IsCAChainBroken asserts caChainBrokenError.
+func IsCAChainBroken(err error) bool {
+	return errgo.Cause(err) == caChainBrokenError
+}
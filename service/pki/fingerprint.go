@@ -0,0 +1,56 @@
+package pki
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Fingerprints are the hashes certificates are commonly identified by, e.g. in
+// inventory systems.
+type Fingerprints struct {
+	// SHA1 is the SHA-1 hash of the DER encoded certificate, formatted as colon
+	// separated upper case hex bytes like openssl prints it.
+	SHA1 string `json:"sha1"`
+
+	// SHA256 is the SHA-256 hash of the DER encoded certificate, formatted the
+	// same way as SHA1.
+	SHA256 string `json:"sha256"`
+
+	// SPKISHA256 is the base64 encoded SHA-256 hash of the certificate's
+	// subject public key info, as used for public key pinning. It stays the
+	// same when a certificate is renewed using the same key.
+	SPKISHA256 string `json:"spki_sha256,omitempty"`
+}
+
+// ComputeFingerprints returns the fingerprints of the given certificate. The
+// public key hash is only computed in case spki is true.
+func ComputeFingerprints(crt *x509.Certificate, spki bool) Fingerprints {
+	sum1 := sha1.Sum(crt.Raw)
+	sum256 := sha256.Sum256(crt.Raw)
+
+	fingerprints := Fingerprints{
+		SHA1:   formatFingerprint(sum1[:]),
+		SHA256: formatFingerprint(sum256[:]),
+	}
+	if spki {
+		sum := sha256.Sum256(crt.RawSubjectPublicKeyInfo)
+		fingerprints.SPKISHA256 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	return fingerprints
+}
+
+// formatFingerprint formats the given hash as colon separated upper case hex
+// bytes.
+func formatFingerprint(sum []byte) string {
+	var parts []string
+	for _, b := range sum {
+		parts = append(parts, fmt.Sprintf("%02X", b))
+	}
+
+	return strings.Join(parts, ":")
+}
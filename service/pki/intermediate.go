@@ -0,0 +1,138 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+)
+
+func (s *service) ResignIntermediate(config ResignIntermediateConfig) (*x509.Certificate, error) {
+	if config.ClusterID == "" {
+		return nil, maskAnyf(invalidConfigError, "cluster ID must not be empty")
+	}
+	if config.ParentClusterID == "" {
+		return nil, maskAnyf(invalidConfigError, "parent cluster ID must not be empty")
+	}
+	if _, err := time.ParseDuration(config.TTL); err != nil {
+		return nil, maskAnyf(invalidConfigError, "TTL must be a duration: %s", err.Error())
+	}
+
+	current, err := s.GetCA(config.ClusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// The CSR must be created from the key of the current intermediate, so the
+	// re-signed certificate can replace the current one in Vault.
+	key, err := parsePrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	err = matchPublicKey(current, key)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:        current.Subject,
+		DNSNames:       current.DNSNames,
+		EmailAddresses: current.EmailAddresses,
+		IPAddresses:    current.IPAddresses,
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the parent's and the current cluster's PKI backends.
+	logicalBackend := s.VaultClient.Logical()
+
+	// Let the parent CA sign the CSR with a fresh validity window.
+	data := map[string]interface{}{
+		"csr":            string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"common_name":    current.Subject.CommonName,
+		"ttl":            config.TTL,
+		"use_csr_values": true,
+	}
+	secret, err := logicalBackend.Write(s.SignIntermediatePath(config.ParentClusterID), data)
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(caNotFoundError, "PKI backend of parent cluster ID '%s' not mounted", config.ParentClusterID)
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil {
+		return nil, maskAnyf(caNotFoundError, "certificate missing")
+	}
+	signed, ok := secret.Data["certificate"].(string)
+	if !ok || signed == "" {
+		return nil, maskAnyf(caNotFoundError, "certificate missing")
+	}
+
+	// Replace the current intermediate. Vault keeps using the stored key.
+	data = map[string]interface{}{
+		"certificate": signed,
+	}
+	_, err = logicalBackend.Write(s.SetSignedIntermediatePath(config.ClusterID), data)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	resigned, err := s.GetCA(config.ClusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return resigned, nil
+}
+
+// parsePrivateKey parses the given PEM encoded PKCS#1, SEC1 or PKCS#8 private
+// key.
+func parsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, maskAnyf(invalidConfigError, "private key must be PEM encoded")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, maskAnyf(invalidConfigError, "private key: %s", err.Error())
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, maskAnyf(invalidConfigError, "private key type not supported")
+	}
+
+	return signer, nil
+}
+
+// matchPublicKey checks that the given key is the private key of the given
+// certificate.
+func matchPublicKey(crt *x509.Certificate, key crypto.Signer) error {
+	want, err := x509.MarshalPKIXPublicKey(crt.PublicKey)
+	if err != nil {
+		return maskAny(err)
+	}
+	got, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return maskAny(err)
+	}
+	if !bytes.Equal(want, got) {
+		return maskAnyf(invalidConfigError, "private key does not belong to the current intermediate")
+	}
+
+	return nil
+}
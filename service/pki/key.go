@@ -0,0 +1,169 @@
+package pki
+
+import (
+	"strings"
+)
+
+func (s *service) ListKeys(clusterID string) ([]Key, error) {
+	keys, err := s.listKeys(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	issuers, err := s.keyIssuers(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	for i := range keys {
+		keys[i].IssuerIDs = issuers[keys[i].ID]
+	}
+
+	return keys, nil
+}
+
+func (s *service) GetKey(clusterID, keyRef string) (Key, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.KeyPath(clusterID, keyRef))
+	if IsNoVaultHandlerDefined(err) {
+		return Key{}, maskAnyf(keyNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return Key{}, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return Key{}, maskAnyf(keyNotFoundError, "key '%s' not found in PKI backend of cluster ID '%s'", keyRef, clusterID)
+	}
+
+	key := Key{
+		ID:   toString(secret.Data["key_id"]),
+		Name: toString(secret.Data["key_name"]),
+		Type: toString(secret.Data["key_type"]),
+	}
+	issuers, err := s.keyIssuers(clusterID)
+	if err != nil {
+		return Key{}, maskAny(err)
+	}
+	key.IssuerIDs = issuers[key.ID]
+
+	return key, nil
+}
+
+func (s *service) DeleteKey(clusterID, keyRef string) error {
+	key, err := s.GetKey(clusterID, keyRef)
+	if err != nil {
+		return maskAny(err)
+	}
+	if key.Used() {
+		return maskAnyf(keyInUseError, "key '%s' is used by the issuer(s) %s", keyRef, strings.Join(key.IssuerIDs, ","))
+	}
+
+	logicalBackend := s.VaultClient.Logical()
+
+	// The key is deleted by its ID, so a key named like the reference of
+	// another key can not be deleted by accident.
+	_, err = logicalBackend.Delete(s.KeyPath(clusterID, key.ID))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// findKey checks that the PKI backend of the given cluster ID holds the key
+// referenced by the given key ref, i.e. its key ID or key name. The reference
+// default, naming the default key, is accepted as long as any key exists.
+// Keys are only managed by PKI backends supporting multiple issuers.
+func (s *service) findKey(clusterID, keyRef string) error {
+	keys, err := s.listKeys(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if keyRef == "default" && len(keys) > 0 {
+		return nil
+	}
+	for _, k := range keys {
+		if k.ID == keyRef || (k.Name != "" && k.Name == keyRef) {
+			return nil
+		}
+	}
+
+	return maskAnyf(keyNotFoundError, "key '%s' not found in PKI backend of cluster ID '%s'", keyRef, clusterID)
+}
+
+// listKeys lists the keys of the PKI backend of the given cluster ID without
+// looking up the issuers using them.
+func (s *service) listKeys(clusterID string) ([]Key, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List(s.ListKeysPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(keyNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, maskAnyf(keyNotFoundError, "PKI backend of cluster ID '%s' holds no keys, keys require a Vault version supporting multiple issuers", clusterID)
+	}
+
+	info, _ := secret.Data["key_info"].(map[string]interface{})
+
+	var keys []Key
+	for _, id := range toStringList(secret.Data["keys"]) {
+		key := Key{ID: id}
+		if i, ok := info[id].(map[string]interface{}); ok {
+			key.Name = toString(i["key_name"])
+			key.Type = toString(i["key_type"])
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// keyIssuers returns the IDs of the issuers of the PKI backend of the given
+// cluster ID, grouped by the ID of the key they use.
+func (s *service) keyIssuers(clusterID string) (map[string][]string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List(s.ListIssuersPath(clusterID))
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	issuers := map[string][]string{}
+	if secret == nil || secret.Data == nil {
+		return issuers, nil
+	}
+
+	for _, id := range toStringList(secret.Data["keys"]) {
+		issuer, err := logicalBackend.Read(s.IssuerPath(clusterID, id))
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if issuer == nil || issuer.Data == nil {
+			continue
+		}
+		keyID := toString(issuer.Data["key_id"])
+		if keyID != "" {
+			issuers[keyID] = append(issuers[keyID], id)
+		}
+	}
+
+	return issuers, nil
+}
+
+// defaultIssuerID returns the ID of the default issuer of the PKI backend of
+// the given cluster ID. It is empty in case there is none.
+func (s *service) defaultIssuerID(clusterID string) (string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.ConfigIssuersPath(clusterID))
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", nil
+	}
+
+	return toString(secret.Data["default"]), nil
+}
@@ -0,0 +1,245 @@
+package pki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func (s *service) VerifyNames(clusterID string, names []string) error {
+	role, err := s.GetRole(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	for _, n := range names {
+		if !role.AllowsName(n) {
+			return maskAnyf(nameNotAllowedError, "'%s' is not allowed by role '%s', allowed domains are '%s'", n, s.RoleName(clusterID), strings.Join(role.AllowedDomains, ","))
+		}
+	}
+
+	return nil
+}
+
+func (s *service) VerifySerialNumber(clusterID, serialNumber string) error {
+	role, err := s.GetRole(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if len(role.AllowedSerialNumbers) == 0 {
+		return maskAnyf(serialNumberNotAllowedError, "role '%s' does not allow serial numbers", s.RoleName(clusterID))
+	}
+	if !role.AllowsSerialNumber(serialNumber) {
+		return maskAnyf(serialNumberNotAllowedError, "'%s' is not allowed by role '%s', allowed serial numbers are '%s'", serialNumber, s.RoleName(clusterID), strings.Join(role.AllowedSerialNumbers, ","))
+	}
+
+	return nil
+}
+
+func (s *service) VerifyCommonName(clusterID, commonName string) error {
+	if commonName != "" {
+		return maskAny(s.VerifyNames(clusterID, []string{commonName}))
+	}
+
+	role, err := s.GetRole(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	if role.RequireCN {
+		return maskAnyf(commonNameRequiredError, "role '%s' requires a common name", s.RoleName(clusterID))
+	}
+
+	return nil
+}
+
+func (s *service) VerifySubject(clusterID string, subject Subject) error {
+	role, err := s.GetRole(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	components := []struct {
+		Name      string
+		Requested string
+		Role      string
+	}{
+		{"country", subject.Country, role.Subject.Country},
+		{"locality", subject.Locality, role.Subject.Locality},
+		{"organization", subject.Organization, role.Subject.Organization},
+		{"ou", subject.OrganizationalUnit, role.Subject.OrganizationalUnit},
+		{"province", subject.Province, role.Subject.Province},
+	}
+	for _, c := range components {
+		if c.Requested == "" {
+			continue
+		}
+		if !sameList(c.Requested, c.Role) {
+			return maskAnyf(subjectMismatchError, "%s '%s' is not set by role '%s', the role sets '%s'", c.Name, c.Requested, s.RoleName(clusterID), c.Role)
+		}
+	}
+
+	return nil
+}
+
+// sameList checks whether the given comma separated lists hold the same
+// values, regardless of their order.
+func sameList(a, b string) bool {
+	as := splitTrimmed(a)
+	bs := splitTrimmed(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitTrimmed(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// AllowsSerialNumber checks whether the role allows issuing certificates
+// having the given serialNumber RDN. Patterns may contain * globs, like
+// Vault supports them.
+func (r Role) AllowsSerialNumber(serialNumber string) bool {
+	for _, p := range r.AllowedSerialNumbers {
+		if globMatch(p, serialNumber) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsName checks whether the role allows issuing certificates for the given
+// name. The checks mirror the ones Vault does for DNS names.
+func (r Role) AllowsName(name string) bool {
+	name = strings.ToLower(name)
+
+	if r.AllowAnyName {
+		return true
+	}
+	if r.AllowLocalhost && name == "localhost" {
+		return true
+	}
+
+	for _, d := range r.AllowedDomains {
+		d = strings.ToLower(d)
+		if d == "" {
+			continue
+		}
+
+		if name == d && r.AllowBareDomains {
+			return true
+		}
+		// Wildcards like *.example.com are valid subdomains as well.
+		if strings.HasSuffix(name, "."+d) && r.AllowSubdomains {
+			return true
+		}
+		if r.AllowGlobDomains && strings.Contains(d, "*") && globMatch(d, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globMatch matches the given value against the given pattern, where *
+// matches any sequence of characters.
+func globMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, p)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(p):]
+	}
+
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
+
+// DomainWarnings returns warnings about domain options of the role which
+// contradict each other, e.g. allow_bare_domains without any allowed domain.
+// Such roles are valid for Vault but can not issue what they appear to allow.
+func (r Role) DomainWarnings() []string {
+	var warnings []string
+
+	var globs []string
+	for _, d := range r.AllowedDomains {
+		if strings.Contains(d, "*") {
+			globs = append(globs, d)
+		}
+	}
+
+	if r.AllowAnyName {
+		if len(r.AllowedDomains) > 0 {
+			warnings = append(warnings, fmt.Sprintf("allow_any_name allows any name, so the allowed domains '%s' do not restrict anything", strings.Join(r.AllowedDomains, ",")))
+		}
+		return warnings
+	}
+
+	if len(r.AllowedDomains) == 0 {
+		var options []string
+		if r.AllowBareDomains {
+			options = append(options, "allow_bare_domains")
+		}
+		if r.AllowSubdomains {
+			options = append(options, "allow_subdomains")
+		}
+		if r.AllowGlobDomains {
+			options = append(options, "allow_glob_domains")
+		}
+		if len(options) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s have no effect without allowed domains, no domain can be issued", strings.Join(options, ",")))
+		}
+		return warnings
+	}
+
+	if !r.AllowBareDomains && !r.AllowSubdomains && !r.AllowGlobDomains {
+		warnings = append(warnings, fmt.Sprintf("the allowed domains '%s' have no effect without allow_bare_domains, allow_subdomains or allow_glob_domains", strings.Join(r.AllowedDomains, ",")))
+	}
+	if r.AllowBareDomains {
+		var patterns []string
+		for _, d := range r.AllowedDomains {
+			if strings.Contains(d, "*") || strings.HasPrefix(d, ".") {
+				patterns = append(patterns, d)
+			}
+		}
+		if len(patterns) == len(r.AllowedDomains) {
+			warnings = append(warnings, fmt.Sprintf("allow_bare_domains has no effect, since the allowed domains '%s' are no plain domains", strings.Join(patterns, ",")))
+		}
+	}
+	if r.AllowGlobDomains && len(globs) == 0 {
+		warnings = append(warnings, "allow_glob_domains has no effect, since no allowed domain contains a * glob")
+	}
+	if !r.AllowGlobDomains && len(globs) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the allowed domains '%s' contain * globs, which are matched literally without allow_glob_domains", strings.Join(globs, ",")))
+	}
+
+	return warnings
+}
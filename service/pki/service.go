@@ -1,16 +1,32 @@
 package pki
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/service/tracing"
 )
 
 // ServiceConfig represents the configuration used to create a new PKI controller.
 type ServiceConfig struct {
 	// Dependencies.
+	Tracer      *tracing.Tracer
 	VaultClient *vaultclient.Client
+
+	// Settings.
+
+	// SharedMount is the path of a PKI backend shared by all clusters, each
+	// having a PKI role of its own. Empty means every cluster has a PKI
+	// backend of its own mounted at pki-<clusterID>.
+	SharedMount string
 }
 
 // DefaultServiceConfig provides a default configuration to create a PKI controller.
@@ -25,7 +41,11 @@ func DefaultServiceConfig() ServiceConfig {
 
 	newConfig := ServiceConfig{
 		// Dependencies.
+		Tracer:      nil,
 		VaultClient: newVaultClient,
+
+		// Settings.
+		SharedMount: "",
 	}
 
 	return newConfig
@@ -38,6 +58,11 @@ func NewService(config ServiceConfig) (Service, error) {
 		return nil, maskAnyf(invalidConfigError, "Vault client must not be empty")
 	}
 
+	// Settings.
+	if strings.Trim(config.SharedMount, "/") != config.SharedMount || strings.ContainsAny(config.SharedMount, " \t") {
+		return nil, maskAnyf(invalidConfigError, "shared mount '%s' must not contain whitespace or leading or trailing slashes", config.SharedMount)
+	}
+
 	newService := &service{
 		ServiceConfig: config,
 	}
@@ -49,9 +74,22 @@ type service struct {
 	ServiceConfig
 }
 
+// mountPath returns the path of the PKI backend of the given cluster ID,
+// which is the shared one in case it is configured.
+func (s *service) mountPath(clusterID string) string {
+	if s.SharedMount != "" {
+		return s.SharedMount
+	}
+
+	return fmt.Sprintf("pki-%s", clusterID)
+}
+
 // PKI management.
 
-func (s *service) Delete(clusterID string) error {
+func (s *service) Delete(clusterID string) (err error) {
+	span := s.Tracer.StartOperation("pki delete", map[string]string{"certctl.cluster_id": clusterID})
+	defer func() { span.End(err) }()
+
 	// Create a client for the system backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	sysBackend := s.VaultClient.Sys()
@@ -61,6 +99,17 @@ func (s *service) Delete(clusterID string) error {
 	if err != nil {
 		return maskAny(err)
 	}
+
+	// The shared PKI backend is used by other clusters as well, so only the
+	// cluster's PKI role is deleted.
+	if mounted && s.SharedMount != "" {
+		_, err = s.VaultClient.Logical().Delete(s.WriteRolePath(clusterID))
+		if err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
 	if mounted {
 		err = sysBackend.Unmount(s.MountPKIPath(clusterID))
 		if err != nil {
@@ -71,6 +120,128 @@ func (s *service) Delete(clusterID string) error {
 	return nil
 }
 
+func (s *service) Tidy(clusterID string, safetyBuffer time.Duration) error {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"tidy_cert_store":    true,
+		"tidy_revoked_certs": true,
+		"safety_buffer":      safetyBuffer.String(),
+	}
+	_, err := logicalBackend.Write(s.TidyPath(clusterID), data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) GetCA(clusterID string) (*x509.Certificate, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	// Read the root CA for the given cluster ID.
+	secret, err := logicalBackend.Read(s.ReadCAPath(clusterID))
+	if IsNoVaultHandlerDefined(err) {
+		return nil, maskAnyf(caNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil {
+		return nil, maskAnyf(caNotFoundError, "root CA not generated")
+	}
+
+	vCrt, ok := secret.Data["certificate"]
+	if !ok {
+		return nil, maskAnyf(caNotFoundError, "certificate missing")
+	}
+	crt, ok := vCrt.(string)
+	if !ok || crt == "" {
+		return nil, maskAnyf(caNotFoundError, "certificate missing")
+	}
+
+	block, _ := pem.Decode([]byte(crt))
+	if block == nil {
+		return nil, maskAnyf(caNotFoundError, "certificate must be PEM encoded")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return ca, nil
+}
+
+func (s *service) GetRole(clusterID string) (Role, error) {
+	role, err := s.readRole(s.WriteRolePath(clusterID), s.RoleName(clusterID))
+	if err != nil {
+		return Role{}, maskAny(err)
+	}
+
+	return role, nil
+}
+
+func (s *service) GetNamedRole(clusterID, name string) (Role, error) {
+	role, err := s.readRole(s.NamedRolePath(clusterID, name), name)
+	if err != nil {
+		return Role{}, maskAny(err)
+	}
+
+	return role, nil
+}
+
+// readRole reads the PKI role of the given name registered at the given path.
+func (s *service) readRole(path, name string) (Role, error) {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(path)
+	if IsNoVaultHandlerDefined(err) {
+		return Role{}, maskAnyf(roleNotFoundError, "PKI backend not mounted")
+	} else if err != nil {
+		return Role{}, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return Role{}, maskAnyf(roleNotFoundError, "role '%s' not created", name)
+	}
+
+	role := Role{
+		AllowedDomains:   toStringList(secret.Data["allowed_domains"]),
+		AllowBareDomains: toBool(secret.Data["allow_bare_domains"]),
+		AllowSubdomains:  toBool(secret.Data["allow_subdomains"]),
+		AllowAnyName:     toBool(secret.Data["allow_any_name"]),
+		AllowGlobDomains: toBool(secret.Data["allow_glob_domains"]),
+		AllowLocalhost:   toBool(secret.Data["allow_localhost"]),
+		TTL:              toDuration(secret.Data["ttl"]),
+		Data:             secret.Data,
+
+		AllowedSerialNumbers: toStringList(secret.Data["allowed_serial_numbers"]),
+	}
+	role.Subject = Subject{
+		Country:            strings.Join(toStringList(secret.Data["country"]), ","),
+		Locality:           strings.Join(toStringList(secret.Data["locality"]), ","),
+		Organization:       strings.Join(toStringList(secret.Data["organization"]), ","),
+		OrganizationalUnit: strings.Join(toStringList(secret.Data["ou"]), ","),
+		Province:           strings.Join(toStringList(secret.Data["province"]), ","),
+	}
+	// Vault generates RSA keys in case no key type is configured.
+	role.KeyType = "rsa"
+	if v, ok := secret.Data["key_type"].(string); ok && v != "" {
+		role.KeyType = v
+	}
+	// Vault versions not supporting require_cn always require a common name.
+	role.RequireCN = true
+	if v, ok := secret.Data["require_cn"]; ok {
+		role.RequireCN = toBool(v)
+	}
+
+	return role, nil
+}
+
 func (s *service) IsCAGenerated(clusterID string) (bool, error) {
 	// Create a client for the logical backend configured with the Vault token
 	// used for the current cluster's PKI backend.
@@ -119,7 +290,291 @@ func (s *service) IsMounted(clusterID string) (bool, error) {
 	return true, nil
 }
 
+func (s *service) GetMount(clusterID string) (*Mount, error) {
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	mounts, err := sysBackend.ListMounts()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	mountOutput, ok := mounts[s.ListMountsPath(clusterID)+"/"]
+	if !ok || mountOutput == nil {
+		return nil, nil
+	}
+
+	mount := &Mount{
+		Path:        s.MountPKIPath(clusterID),
+		Type:        mountOutput.Type,
+		Description: mountOutput.Description,
+		Marked:      s.isMarked(clusterID, mountOutput.Description),
+	}
+
+	return mount, nil
+}
+
+func (s *service) MaxLeaseTTL(clusterID string) (time.Duration, error) {
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	// The tune endpoint reports the effective max lease TTL, i.e. the system
+	// default in case the PKI backend does not configure its own.
+	current, err := sysBackend.MountConfig(s.MountPKIPath(clusterID))
+	if err != nil {
+		return 0, maskAny(err)
+	}
+
+	return time.Duration(current.MaxLeaseTTL) * time.Second, nil
+}
+
+func (s *service) TuneMount(clusterID string, tuning MountTuning) error {
+	if s.SharedMount != "" {
+		return maskAnyf(invalidConfigError, "tuning must not be configured using the shared PKI backend '%s', it is the one of all clusters", s.SharedMount)
+	}
+
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	var newMountConfig vaultclient.MountConfigInput
+	if tuning.DefaultLeaseTTL > 0 {
+		newMountConfig.DefaultLeaseTTL = tuning.DefaultLeaseTTL.String()
+	}
+	if tuning.MaxLeaseTTL > 0 {
+		newMountConfig.MaxLeaseTTL = tuning.MaxLeaseTTL.String()
+	}
+	if newMountConfig.DefaultLeaseTTL == "" && newMountConfig.MaxLeaseTTL == "" {
+		return nil
+	}
+
+	err := sysBackend.TuneMount(s.MountPKIPath(clusterID), newMountConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) ListClusters() ([]ClusterMount, error) {
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	mounts, err := sysBackend.ListMounts()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if s.SharedMount != "" {
+		clusters, err := s.listSharedClusters(mounts)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		return clusters, nil
+	}
+
+	var clusters []ClusterMount
+	for path, mountOutput := range mounts {
+		if mountOutput == nil || mountOutput.Type != "pki" {
+			continue
+		}
+		clusterID := strings.TrimPrefix(strings.TrimSuffix(path, "/"), "pki-")
+		if clusterID == "" || path != s.ListMountsPath(clusterID)+"/" {
+			continue
+		}
+
+		clusters = append(clusters, ClusterMount{
+			ClusterID: clusterID,
+			Mount: Mount{
+				Path:        s.MountPKIPath(clusterID),
+				Type:        mountOutput.Type,
+				Description: mountOutput.Description,
+				Marked:      isMarkedDescription(clusterID, mountOutput.Description),
+			},
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ClusterID < clusters[j].ClusterID })
+
+	return clusters, nil
+}
+
+// listSharedClusters lists the clusters having a PKI role in the shared PKI
+// backend, using the given mounts.
+func (s *service) listSharedClusters(mounts map[string]*vaultclient.MountOutput) ([]ClusterMount, error) {
+	mountOutput, ok := mounts[s.SharedMount+"/"]
+	if !ok || mountOutput == nil || mountOutput.Type != "pki" {
+		return nil, nil
+	}
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the shared PKI backend.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List(s.SharedMount + "/roles/")
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	list, _ := secret.Data["keys"].([]interface{})
+
+	var clusters []ClusterMount
+	for _, k := range list {
+		name, _ := k.(string)
+		clusterID := strings.TrimPrefix(name, "role-")
+		if clusterID == "" || name != s.RoleName(clusterID) {
+			continue
+		}
+
+		clusters = append(clusters, ClusterMount{
+			ClusterID: clusterID,
+			Mount: Mount{
+				Path:        s.SharedMount,
+				Type:        mountOutput.Type,
+				Description: mountOutput.Description,
+				Marked:      s.isMarked(clusterID, mountOutput.Description),
+			},
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ClusterID < clusters[j].ClusterID })
+
+	return clusters, nil
+}
+
+// checkMountConflict checks the mount at the path of the PKI backend of the
+// given cluster ID according to the given conflict handling. It returns
+// whether a PKI backend is mounted there, so callers do not need to read the
+// mounts again.
+func (s *service) checkMountConflict(clusterID, onConflict string) (bool, error) {
+	switch onConflict {
+	case "", OnConflictReuse, OnConflictFail, OnConflictError:
+	default:
+		return false, maskAnyf(invalidConfigError, "on conflict must be one of %s, %s or %s", OnConflictReuse, OnConflictFail, OnConflictError)
+	}
+
+	mount, err := s.GetMount(clusterID)
+	if err != nil {
+		return false, maskAny(err)
+	}
+	if mount == nil {
+		return false, nil
+	}
+
+	conflict := mount.Type != "pki"
+	switch onConflict {
+	case OnConflictFail:
+		conflict = conflict || !mount.Marked
+	case OnConflictError:
+		conflict = true
+	}
+	if conflict {
+		return false, maskAnyf(mountConflictError, "path '%s' is already mounted as '%s' with description '%s'", mount.Path, mount.Type, mount.Description)
+	}
+
+	return true, nil
+}
+
+// mountMarker returns the marker identifying PKI backends mounted by certctl
+// for the given cluster ID. It is part of their description.
+func mountMarker(clusterID string) string {
+	return fmt.Sprintf("certctl:cluster=%s", clusterID)
+}
+
+// defaultMountDescription returns the description of PKI backends mounted by
+// certctl for the given cluster ID in case the operator gives none.
+func defaultMountDescription(clusterID string) string {
+	return fmt.Sprintf("PKI backend for cluster ID '%s'", clusterID)
+}
+
+// mountDescription returns the description of PKI backends mounted by
+// certctl for the given cluster ID. The given description defaults to one
+// naming the cluster ID. The marker is appended unless already given.
+func mountDescription(clusterID, description string) string {
+	if description == "" {
+		description = defaultMountDescription(clusterID)
+	}
+	if isMarkedDescription(clusterID, description) {
+		return description
+	}
+
+	return description + " " + mountMarker(clusterID)
+}
+
+// sharedMountMarker is the marker identifying shared PKI backends mounted by
+// certctl. It is part of their description.
+const sharedMountMarker = "certctl:shared"
+
+// description returns the description a PKI backend is mounted with for the
+// given cluster ID, see mountDescription. The shared PKI backend is described
+// independent of the cluster mounting it first.
+func (s *service) description(clusterID, description string) string {
+	if s.SharedMount == "" {
+		return mountDescription(clusterID, description)
+	}
+	if description == "" {
+		description = "Shared PKI backend of all clusters"
+	}
+	if s.isMarked(clusterID, description) {
+		return description
+	}
+
+	return description + " " + sharedMountMarker
+}
+
+// isMarked checks whether the given mount description identifies a PKI
+// backend mounted by certctl, see isMarkedDescription.
+func (s *service) isMarked(clusterID, description string) bool {
+	if s.SharedMount == "" {
+		return isMarkedDescription(clusterID, description)
+	}
+	for _, f := range strings.Fields(description) {
+		if f == sharedMountMarker {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMarkedDescription checks whether the given mount description identifies
+// a PKI backend mounted by certctl for the given cluster ID. Mounts created
+// before the marker was introduced carry the default description only.
+func isMarkedDescription(clusterID, description string) bool {
+	if description == defaultMountDescription(clusterID) {
+		return true
+	}
+	for _, f := range strings.Fields(description) {
+		if f == mountMarker(clusterID) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *service) IsRoleCreated(clusterID string) (bool, error) {
+	created, err := s.roleExists(clusterID, s.RoleName(clusterID))
+	if err != nil {
+		return false, maskAny(err)
+	}
+
+	return created, nil
+}
+
+func (s *service) IsNamedRoleCreated(clusterID, name string) (bool, error) {
+	created, err := s.roleExists(clusterID, name)
+	if err != nil {
+		return false, maskAny(err)
+	}
+
+	return created, nil
+}
+
+// roleExists checks whether the role of the given name is registered in the
+// PKI backend of the given cluster ID.
+func (s *service) roleExists(clusterID, name string) (bool, error) {
 	// Create a client for the logical backend configured with the Vault token
 	// used for the current cluster's PKI backend.
 	logicalBackend := s.VaultClient.Logical()
@@ -143,7 +598,7 @@ func (s *service) IsRoleCreated(clusterID string) (bool, error) {
 	if keys, ok := secret.Data["keys"]; ok {
 		if list, ok := keys.([]interface{}); ok {
 			for _, k := range list {
-				if str, ok := k.(string); ok && str == s.RoleName(clusterID) {
+				if str, ok := k.(string); ok && str == name {
 					return true, nil
 				}
 			}
@@ -186,28 +641,64 @@ func (s *service) RoleName(clusterID string) string {
 	return fmt.Sprintf("role-%s", clusterID)
 }
 
-func (s *service) Create(config CreateConfig) error {
-	// Create a client for the system backend configured with the Vault token
-	// used for the current cluster's PKI backend.
-	sysBackend := s.VaultClient.Sys()
+func (s *service) Create(config CreateConfig) (_ CreateResult, err error) {
+	span := s.Tracer.StartOperation("pki create", map[string]string{"certctl.cluster_id": config.ClusterID})
+	defer func() { span.End(err) }()
 
-	// Mount a new PKI backend for the cluster, if it does not already exist.
-	mounted, err := s.IsMounted(config.ClusterID)
+	if config.CABundle != "" && config.UseExistingCA {
+		return CreateResult{}, maskAnyf(invalidConfigError, "CA bundle must not be given when using the existing root CA")
+	}
+	if config.KeyRef != "" && (config.CABundle != "" || config.UseExistingCA) {
+		return CreateResult{}, maskAnyf(invalidConfigError, "key ref must not be given when importing a CA bundle or using the existing root CA")
+	}
+	if config.RegenerateCAWithin > 0 && (config.CABundle != "" || config.UseExistingCA || config.KeyRef != "") {
+		return CreateResult{}, maskAnyf(invalidConfigError, "regenerating the root CA must not be configured when importing a CA bundle, using the existing root CA or a key ref")
+	}
+	if config.RegenerateCAWithin > 0 && s.SharedMount != "" {
+		return CreateResult{}, maskAnyf(invalidConfigError, "regenerating the root CA must not be configured using the shared PKI backend '%s', its root CA is the one of all clusters", s.SharedMount)
+	}
+	if config.CABundle != "" {
+		err := ValidateCABundle(config.CABundle)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+	}
+	err = s.validateRoleConfigs(config)
 	if err != nil {
-		return maskAny(err)
+		return CreateResult{}, maskAny(err)
 	}
-	if !mounted {
-		newMountConfig := &vaultclient.MountInput{
-			Type:        "pki",
-			Description: fmt.Sprintf("PKI backend for cluster ID '%s'", config.ClusterID),
-			Config: vaultclient.MountConfigInput{
-				MaxLeaseTTL: config.TTL,
-			},
+	if config.NotAfter != "" {
+		ttl, err := NotAfterTTL(config.NotAfter, time.Now())
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		config.TTL = ttl.String()
+	}
+
+	// Mount a new PKI backend for the cluster, if it does not already exist.
+	// The existing root CA requires the PKI backend to be there already.
+	var mountTuned bool
+	if config.UseExistingCA {
+		mounted, err := s.checkMountConflict(config.ClusterID, config.OnConflict)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
 		}
-		err = sysBackend.Mount(s.MountPKIPath(config.ClusterID), newMountConfig)
+		if !mounted {
+			return CreateResult{}, maskAnyf(caNotFoundError, "PKI backend of cluster ID '%s' not mounted", config.ClusterID)
+		}
+	} else {
+		mountConfig := MountConfig{
+			ClusterID:   config.ClusterID,
+			TTL:         config.TTL,
+			Description: config.MountDescription,
+			OnConflict:  config.OnConflict,
+			Raise:       config.AutoTuneMount,
+		}
+		mountResult, err := s.Mount(mountConfig)
 		if err != nil {
-			return maskAny(err)
+			return CreateResult{}, maskAny(err)
 		}
+		mountTuned = mountResult.Tuned
 	}
 
 	// Create a client for the logical backend configured with the Vault token
@@ -218,63 +709,714 @@ func (s *service) Create(config CreateConfig) error {
 	// already exist.
 	generated, err := s.IsCAGenerated(config.ClusterID)
 	if err != nil {
-		return maskAny(err)
+		return CreateResult{}, maskAny(err)
 	}
-	if !generated {
+	// A root CA expiring within the threshold is replaced by a new root CA
+	// issuer.
+	var previousCA *x509.Certificate
+	var issuerID string
+	var caGenerated bool
+	var caImported bool
+	if generated && config.RegenerateCAWithin > 0 {
+		ca, err := s.GetCA(config.ClusterID)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		if ca.NotAfter.Sub(time.Now()) < config.RegenerateCAWithin {
+			issuerID, err = s.regenerateCA(config)
+			if err != nil {
+				return CreateResult{}, maskAny(err)
+			}
+			previousCA = ca
+			caGenerated = true
+		}
+	}
+	if config.KeyRef != "" {
+		err := s.findKey(config.ClusterID, config.KeyRef)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		key, err := s.GetKey(config.ClusterID, config.KeyRef)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		// Only keys no issuer uses yet get a root CA issuer, so running the
+		// setup again does not pile up issuers.
+		if !key.Used() {
+			issuerID, err = s.generateKeyIssuer(config)
+			if err != nil {
+				return CreateResult{}, maskAny(err)
+			}
+			caGenerated = true
+		}
+	} else if !generated && config.UseExistingCA {
+		return CreateResult{}, maskAnyf(caNotFoundError, "PKI backend of cluster ID '%s' has no root CA", config.ClusterID)
+	} else if !generated && config.CABundle != "" {
 		data := map[string]interface{}{
-			"ttl":         config.TTL,
-			"common_name": config.CommonName,
+			"pem_bundle": config.CABundle,
 		}
-		_, err = logicalBackend.Write(s.WriteCAPath(config.ClusterID), data)
+		_, err = logicalBackend.Write(s.ImportCAPath(config.ClusterID), data)
 		if err != nil {
-			return maskAny(err)
+			return CreateResult{}, maskAny(err)
 		}
+		caImported = true
+	} else if !generated {
+		_, err = logicalBackend.Write(s.WriteCAPath(config.ClusterID), rootCAData(config))
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		caGenerated = true
+	}
+
+	// Read the root CA to report it, regardless of whether it was generated,
+	// imported or already existed.
+	ca, err := s.GetCA(config.ClusterID)
+	if err != nil {
+		return CreateResult{}, maskAny(err)
+	}
+	// RSA-PSS signatures can only be made with RSA keys, so make sure the role
+	// does not ask for them otherwise.
+	if config.UsePSS && ca.PublicKeyAlgorithm != x509.RSA {
+		return CreateResult{}, maskAnyf(invalidConfigError, "RSA-PSS signatures require an RSA root CA, but the root CA of cluster ID '%s' uses %s", config.ClusterID, ca.PublicKeyAlgorithm)
 	}
 
 	// Create a role for the mounted PKI backend, if it does not already exist.
 	created, err := s.IsRoleCreated(config.ClusterID)
 	if err != nil {
-		return maskAny(err)
+		return CreateResult{}, maskAny(err)
 	}
 	if !created {
-		data := map[string]interface{}{
-			"allowed_domains":    config.AllowedDomains,
-			"allow_subdomains":   "true",
-			"ttl":                config.TTL,
-			"allow_bare_domains": config.AllowBareDomains,
+		_, err = logicalBackend.Write(s.WriteRolePath(config.ClusterID), RoleData(config))
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+	}
+	roleCreated := !created
+
+	// Create the named roles not existing yet.
+	var namedRolePaths []string
+	var namedRolesCreated []string
+	for _, r := range config.Roles {
+		created, err := s.IsNamedRoleCreated(config.ClusterID, r.Name)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		if !created {
+			_, err = logicalBackend.Write(s.NamedRolePath(config.ClusterID, r.Name), NamedRoleData(config, r))
+			if err != nil {
+				return CreateResult{}, maskAny(err)
+			}
+			namedRolesCreated = append(namedRolesCreated, s.NamedRolePath(config.ClusterID, r.Name))
+		}
+		namedRolePaths = append(namedRolePaths, s.NamedRolePath(config.ClusterID, r.Name))
+	}
+
+	result := CreateResult{
+		MountPath:    s.MountPKIPath(config.ClusterID),
+		RoleName:     s.RoleName(config.ClusterID),
+		RolePath:     s.WriteRolePath(config.ClusterID),
+		CACert:       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		CASerial:     FormatSerialNumber(ca.SerialNumber),
+		CAExpiration: ca.NotAfter.UTC(),
+		IssuerID:     issuerID,
+		CAGenerated:  caGenerated,
+		CAImported:   caImported,
+		RoleCreated:  roleCreated,
+		MountTuned:   mountTuned,
+
+		NamedRolePaths:    namedRolePaths,
+		NamedRolesCreated: namedRolesCreated,
+	}
+	if previousCA != nil {
+		result.CARegenerated = true
+		result.PreviousCAExpiration = previousCA.NotAfter.UTC()
+	}
+	if issuerID != "" {
+		defaultID, err := s.defaultIssuerID(config.ClusterID)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		result.IssuerDefault = defaultID == issuerID
+	}
+
+	return result, nil
+}
+
+// regenerateCA replaces the root CA of the PKI backend of the cluster ID given
+// by the given configuration and returns the ID of the new root CA issuer. The
+// new issuer is generated and made the default issuer before the previous one
+// is deleted together with its key, so the PKI backend keeps its root CA in
+// case any step fails. Requires a Vault version supporting multiple issuers.
+func (s *service) regenerateCA(config CreateConfig) (string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	previousID, err := s.defaultIssuerID(config.ClusterID)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if previousID == "" {
+		return "", maskAnyf(invalidConfigError, "regenerating the root CA of cluster ID '%s' requires Vault supporting multiple issuers", config.ClusterID)
+	}
+	previous, err := logicalBackend.Read(s.IssuerPath(config.ClusterID, previousID))
+	if err != nil {
+		return "", maskAny(err)
+	}
+	var previousKeyID string
+	if previous != nil && previous.Data != nil {
+		previousKeyID = toString(previous.Data["key_id"])
+	}
+
+	secret, err := logicalBackend.Write(s.GenerateRootIssuerPath(config.ClusterID), rootCAData(config))
+	if err != nil {
+		return "", maskAny(err)
+	}
+	var issuerID string
+	if secret != nil && secret.Data != nil {
+		issuerID = toString(secret.Data["issuer_id"])
+	}
+	if issuerID == "" {
+		return "", maskAnyf(caNotFoundError, "generating a new root CA issuer for cluster ID '%s' returned no issuer ID", config.ClusterID)
+	}
+
+	_, err = logicalBackend.Write(s.ConfigIssuersPath(config.ClusterID), map[string]interface{}{"default": issuerID})
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	// The previous root CA is not used anymore. Its key is kept in case other
+	// issuers use it.
+	_, err = logicalBackend.Delete(s.IssuerPath(config.ClusterID, previousID))
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if previousKeyID != "" {
+		err = s.DeleteKey(config.ClusterID, previousKeyID)
+		if err != nil && !IsKeyInUse(err) {
+			return "", maskAny(err)
+		}
+	}
+
+	return issuerID, nil
+}
+
+// generateKeyIssuer generates a new root CA issuer using the key referenced by
+// the given configuration and makes it the default issuer, the same way as
+// regenerateCA. It returns the ID of the new issuer. A root CA existing
+// already is kept as non-default issuer.
+func (s *service) generateKeyIssuer(config CreateConfig) (string, error) {
+	logicalBackend := s.VaultClient.Logical()
+
+	data := rootCAData(config)
+	data["key_ref"] = config.KeyRef
+	secret, err := logicalBackend.Write(s.GenerateIssuerPath(config.ClusterID), data)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	var issuerID string
+	if secret != nil && secret.Data != nil {
+		issuerID = toString(secret.Data["issuer_id"])
+	}
+	if issuerID == "" {
+		return "", maskAnyf(caNotFoundError, "generating a root CA issuer using key '%s' for cluster ID '%s' returned no issuer ID", config.KeyRef, config.ClusterID)
+	}
+
+	_, err = logicalBackend.Write(s.ConfigIssuersPath(config.ClusterID), map[string]interface{}{"default": issuerID})
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return issuerID, nil
+}
+
+// rootCAData returns the payload used to generate the root CA.
+func rootCAData(config CreateConfig) map[string]interface{} {
+	data := map[string]interface{}{
+		"ttl": config.TTL,
+	}
+	if config.NotAfter != "" {
+		delete(data, "ttl")
+		data["not_after"] = config.NotAfter
+	}
+	if config.CommonName != "" {
+		data["common_name"] = config.CommonName
+	}
+	for k, v := range subjectData(config.Subject) {
+		data[k] = v
+	}
+	for k, v := range signatureData(config) {
+		data[k] = v
+	}
+
+	return data
+}
+
+func (s *service) ImportCA(config ImportCAConfig) error {
+	err := ValidateCABundle(config.CABundle)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Mount a new PKI backend for the cluster, if it does not already exist.
+	_, err = s.Mount(MountConfig{ClusterID: config.ClusterID, TTL: config.TTL})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Vault silently replaces an existing root CA. Refuse to do so, because
+	// certificates issued by the existing root CA would no longer be trusted.
+	generated, err := s.IsCAGenerated(config.ClusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+	if generated {
+		return maskAnyf(caAlreadyExistsError, "PKI backend of cluster ID '%s' already has a root CA", config.ClusterID)
+	}
+
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's root CA.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"pem_bundle": config.CABundle,
+	}
+	_, err = logicalBackend.Write(s.ImportCAPath(config.ClusterID), data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) Mount(config MountConfig) (_ MountResult, err error) {
+	span := s.Tracer.StartOperation("pki mount", map[string]string{"certctl.cluster_id": config.ClusterID})
+	defer func() { span.End(err) }()
+
+	// Tuning the shared PKI backend to the TTL of one cluster may lower the
+	// max lease TTL capping all other clusters.
+	if (config.Tune || config.Raise) && s.SharedMount != "" {
+		return MountResult{}, maskAnyf(invalidConfigError, "tuning must not be configured using the shared PKI backend '%s', it is the one of all clusters", s.SharedMount)
+	}
+
+	// Create a client for the system backend configured with the Vault token
+	// used for the current cluster's PKI backend.
+	sysBackend := s.VaultClient.Sys()
+
+	mounted, err := s.checkMountConflict(config.ClusterID, config.OnConflict)
+	if err != nil {
+		return MountResult{}, maskAny(err)
+	}
+
+	result := MountResult{
+		MountPath: s.MountPKIPath(config.ClusterID),
+	}
+
+	if !mounted {
+		newMountConfig := &vaultclient.MountInput{
+			Type:        "pki",
+			Description: s.description(config.ClusterID, config.Description),
+			Config: vaultclient.MountConfigInput{
+				MaxLeaseTTL: config.TTL,
+			},
+		}
+		err = sysBackend.Mount(result.MountPath, newMountConfig)
+		if err != nil {
+			return MountResult{}, maskAny(err)
+		}
+		result.Mounted = true
+		return result, nil
+	}
+
+	// Only tune existing PKI backends having a different max lease TTL, so
+	// running the same mount again changes nothing. Raising keeps higher max
+	// lease TTLs.
+	if (config.Tune || config.Raise) && config.TTL != "" {
+		ttl, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return MountResult{}, maskAnyf(invalidConfigError, "TTL '%s' is malformed", config.TTL)
+		}
+		current, err := s.MaxLeaseTTL(config.ClusterID)
+		if err != nil {
+			return MountResult{}, maskAny(err)
+		}
+		if (config.Tune && current != ttl) || (config.Raise && current < ttl) {
+			err = sysBackend.TuneMount(result.MountPath, vaultclient.MountConfigInput{MaxLeaseTTL: config.TTL})
+			if err != nil {
+				return MountResult{}, maskAny(err)
+			}
+			result.Tuned = true
+		}
+	}
+
+	return result, nil
+}
+
+func (s *service) UpdateRole(config CreateConfig) error {
+	// Create a client for the logical backend configured with the Vault token
+	// used for the current cluster's role.
+	logicalBackend := s.VaultClient.Logical()
+
+	_, err := logicalBackend.Write(s.WriteRolePath(config.ClusterID), RoleData(config))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) UpdateNamedRole(config CreateConfig, name string) error {
+	for _, r := range config.Roles {
+		if r.Name != name {
+			continue
 		}
 
-		_, err = logicalBackend.Write(s.WriteRolePath(config.ClusterID), data)
+		// Create a client for the logical backend configured with the Vault
+		// token used for the current cluster's role.
+		logicalBackend := s.VaultClient.Logical()
+
+		_, err := logicalBackend.Write(s.NamedRolePath(config.ClusterID, name), NamedRoleData(config, r))
 		if err != nil {
 			return maskAny(err)
 		}
+
+		return nil
+	}
+
+	return maskAnyf(invalidConfigError, "role '%s' not configured", name)
+}
+
+// validateRoleConfigs checks the named roles of the given configuration. Each
+// must have a unique name other than the default role's and allowed domains.
+// The shared PKI backend has no named roles.
+func (s *service) validateRoleConfigs(config CreateConfig) error {
+	seen := map[string]bool{}
+	for i, r := range config.Roles {
+		switch {
+		case s.SharedMount != "":
+			return maskAnyf(invalidConfigError, "role '%s': named roles are not supported using the shared PKI backend '%s', their names are not specific to a cluster", r.Name, s.SharedMount)
+		case r.Name == "":
+			return maskAnyf(invalidConfigError, "role %d: name must not be empty", i+1)
+		case strings.ContainsAny(r.Name, " \t/"):
+			return maskAnyf(invalidConfigError, "role '%s': name must not contain whitespace or slashes", r.Name)
+		case r.Name == s.RoleName(config.ClusterID):
+			return maskAnyf(invalidConfigError, "role '%s': name is used by the default role", r.Name)
+		case seen[r.Name]:
+			return maskAnyf(invalidConfigError, "role '%s': name must be unique", r.Name)
+		case r.AllowedDomains == "":
+			return maskAnyf(invalidConfigError, "role '%s': allowed domains must not be empty", r.Name)
+		}
+		seen[r.Name] = true
 	}
 
 	return nil
 }
 
+// FormatSerialNumber formats a certificate serial number the same way Vault
+// does, as colon separated hex bytes.
+func FormatSerialNumber(serial *big.Int) string {
+	var parts []string
+	for _, b := range serial.Bytes() {
+		parts = append(parts, fmt.Sprintf("%02x", b))
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// ValidateCABundle checks that the given PEM bundle contains a CA certificate
+// and a private key.
+func ValidateCABundle(bundle string) error {
+	var hasCert, hasKey bool
+
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return maskAnyf(invalidCABundleError, "%s", err.Error())
+			}
+			if !crt.IsCA {
+				return maskAnyf(invalidCABundleError, "certificate '%s' is not a CA", crt.Subject.CommonName)
+			}
+			hasCert = true
+		case "RSA PRIVATE KEY":
+			_, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return maskAnyf(invalidCABundleError, "%s", err.Error())
+			}
+			hasKey = true
+		case "EC PRIVATE KEY":
+			_, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return maskAnyf(invalidCABundleError, "%s", err.Error())
+			}
+			hasKey = true
+		case "PRIVATE KEY":
+			_, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return maskAnyf(invalidCABundleError, "%s", err.Error())
+			}
+			hasKey = true
+		}
+	}
+
+	if !hasCert {
+		return maskAnyf(invalidCABundleError, "certificate missing")
+	}
+	if !hasKey {
+		return maskAnyf(invalidCABundleError, "private key missing")
+	}
+
+	return nil
+}
+
+// subjectData returns the configured components of the given subject keyed by
+// the parameter names of Vault's root generation endpoint.
+func subjectData(subject Subject) map[string]interface{} {
+	data := map[string]interface{}{}
+
+	components := map[string]string{
+		"country":      subject.Country,
+		"locality":     subject.Locality,
+		"organization": subject.Organization,
+		"ou":           subject.OrganizationalUnit,
+		"province":     subject.Province,
+	}
+	for k, v := range components {
+		if v != "" {
+			data[k] = v
+		}
+	}
+
+	return data
+}
+
+// OverriddenRoleParams returns the keys of the extra role parameters of the
+// given configuration which are overridden by its typed fields.
+func OverriddenRoleParams(config CreateConfig) []string {
+	typed := typedRoleData(config)
+
+	var keys []string
+	for k := range config.ExtraRoleParams {
+		if _, ok := typed[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// RoleDomainWarnings returns the warnings about contradicting domain options of
+// the PKI role created using the given configuration. See Role.DomainWarnings.
+func RoleDomainWarnings(config CreateConfig) []string {
+	data := RoleData(config)
+	role := Role{
+		AllowedDomains:   toStringList(data["allowed_domains"]),
+		AllowBareDomains: toBool(data["allow_bare_domains"]),
+		AllowSubdomains:  toBool(data["allow_subdomains"]),
+		AllowAnyName:     toBool(data["allow_any_name"]),
+		AllowGlobDomains: toBool(data["allow_glob_domains"]),
+	}
+
+	return role.DomainWarnings()
+}
+
+// RoleData returns the payload used to create the PKI role. The extra role
+// parameters are merged with the typed fields of the given configuration,
+// where the typed fields take precedence.
+func RoleData(config CreateConfig) map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range config.ExtraRoleParams {
+		data[k] = v
+	}
+	for k, v := range typedRoleData(config) {
+		data[k] = v
+	}
+
+	return data
+}
+
+// NamedRoleData returns the payload used to create the given named role. It is
+// the payload of the default role using the domains, TTL and key usage of the
+// named role.
+func NamedRoleData(config CreateConfig, r RoleConfig) map[string]interface{} {
+	config.AllowedDomains = r.AllowedDomains
+	config.AllowBareDomains = r.AllowBareDomains
+	if r.TTL != "" {
+		config.TTL = r.TTL
+	}
+	if r.KeyUsage != nil {
+		config.KeyUsage = r.KeyUsage
+	}
+
+	return RoleData(config)
+}
+
+// typedRoleData returns the role parameters managed by the typed fields of the
+// given configuration.
+func typedRoleData(config CreateConfig) map[string]interface{} {
+	data := map[string]interface{}{
+		"allowed_domains":    config.AllowedDomains,
+		"allow_subdomains":   "true",
+		"ttl":                config.TTL,
+		"allow_bare_domains": config.AllowBareDomains,
+	}
+	if config.RequireCN != nil {
+		data["require_cn"] = *config.RequireCN
+	}
+	// Only set the storage options when enabled, so Vault's defaults apply
+	// otherwise.
+	if config.GenerateLease {
+		data["generate_lease"] = true
+	}
+	if config.NoStore {
+		data["no_store"] = true
+	}
+	if len(config.AllowedSerialNumbers) > 0 {
+		data["allowed_serial_numbers"] = strings.Join(config.AllowedSerialNumbers, ",")
+	}
+	if config.KeyUsage != nil {
+		// An empty list must be sent as such, so Vault does not use its
+		// default.
+		data["key_usage"] = append([]string{}, config.KeyUsage...)
+	}
+	for k, v := range signatureData(config) {
+		data[k] = v
+	}
+	for k, v := range subjectData(config.LeafSubject) {
+		data[k] = v
+	}
+
+	return data
+}
+
+// NotAfterTTL parses the given RFC3339 timestamp and returns the time
+// remaining until then, rounded up to full hours, so a PKI backend mounted with
+// it covers the timestamp.
+func NotAfterTTL(notAfter string, now time.Time) (time.Duration, error) {
+	t, err := time.Parse(time.RFC3339, notAfter)
+	if err != nil {
+		return 0, maskAnyf(invalidConfigError, "not after '%s' must be an RFC3339 timestamp", notAfter)
+	}
+	if !t.After(now) {
+		return 0, maskAnyf(invalidConfigError, "not after '%s' must lie in the future", notAfter)
+	}
+
+	ttl := t.Sub(now)
+	if r := ttl % time.Hour; r != 0 {
+		ttl += time.Hour - r
+	}
+
+	return ttl, nil
+}
+
+// signatureData returns the signature options of the given configuration. They
+// are only set when configured, so existing signatures stay unchanged and
+// Vault versions not knowing them keep working.
+func signatureData(config CreateConfig) map[string]interface{} {
+	data := map[string]interface{}{}
+	if config.UsePSS {
+		data["use_pss"] = true
+	}
+	if config.SignatureBits != 0 {
+		data["signature_bits"] = config.SignatureBits
+	}
+
+	return data
+}
+
 // Path management.
 
 func (s *service) ReadCAPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/cert/ca", clusterID)
+	return fmt.Sprintf("%s/cert/ca", s.mountPath(clusterID))
+}
+
+func (s *service) ReadCAChainPath(clusterID string) string {
+	return fmt.Sprintf("%s/cert/ca_chain", s.mountPath(clusterID))
+}
+
+func (s *service) ConfigIssuersPath(clusterID string) string {
+	return fmt.Sprintf("%s/config/issuers", s.mountPath(clusterID))
+}
+
+func (s *service) CertPath(clusterID, serial string) string {
+	return fmt.Sprintf("%s/cert/%s", s.mountPath(clusterID), serial)
+}
+
+func (s *service) GenerateIssuerPath(clusterID string) string {
+	return fmt.Sprintf("%s/issuers/generate/root/existing", s.mountPath(clusterID))
+}
+
+func (s *service) GenerateRootIssuerPath(clusterID string) string {
+	return fmt.Sprintf("%s/issuers/generate/root/internal", s.mountPath(clusterID))
+}
+
+func (s *service) ImportCAPath(clusterID string) string {
+	return fmt.Sprintf("%s/config/ca", s.mountPath(clusterID))
+}
+
+func (s *service) IssuerPath(clusterID, issuerRef string) string {
+	return fmt.Sprintf("%s/issuer/%s", s.mountPath(clusterID), issuerRef)
+}
+
+func (s *service) KeyPath(clusterID, keyRef string) string {
+	return fmt.Sprintf("%s/key/%s", s.mountPath(clusterID), keyRef)
+}
+
+func (s *service) ListIssuersPath(clusterID string) string {
+	return fmt.Sprintf("%s/issuers", s.mountPath(clusterID))
+}
+
+func (s *service) ListCertsPath(clusterID string) string {
+	return fmt.Sprintf("%s/certs", s.mountPath(clusterID))
+}
+
+func (s *service) ListKeysPath(clusterID string) string {
+	return fmt.Sprintf("%s/keys", s.mountPath(clusterID))
+}
+
+func (s *service) NamedRolePath(clusterID, name string) string {
+	return fmt.Sprintf("%s/roles/%s", s.mountPath(clusterID), name)
+}
+
+func (s *service) URLsPath(clusterID string) string {
+	return fmt.Sprintf("%s/config/urls", s.mountPath(clusterID))
 }
 
 func (s *service) MountPKIPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s", clusterID)
+	return s.mountPath(clusterID)
 }
 
 func (s *service) ListMountsPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s", clusterID)
+	return s.mountPath(clusterID)
 }
 
 func (s *service) ListRolesPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/roles/", clusterID)
+	return fmt.Sprintf("%s/roles/", s.mountPath(clusterID))
+}
+
+func (s *service) SetSignedIntermediatePath(clusterID string) string {
+	return fmt.Sprintf("%s/intermediate/set-signed", s.mountPath(clusterID))
+}
+
+func (s *service) SignIntermediatePath(clusterID string) string {
+	return fmt.Sprintf("%s/root/sign-intermediate", s.mountPath(clusterID))
+}
+
+func (s *service) TidyPath(clusterID string) string {
+	return fmt.Sprintf("%s/tidy", s.mountPath(clusterID))
 }
 
 func (s *service) WriteCAPath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/root/generate/internal", clusterID)
+	return fmt.Sprintf("%s/root/generate/internal", s.mountPath(clusterID))
 }
 
 func (s *service) WriteRolePath(clusterID string) string {
-	return fmt.Sprintf("pki-%s/roles/%s", clusterID, s.RoleName(clusterID))
+	return fmt.Sprintf("%s/roles/%s", s.mountPath(clusterID), s.RoleName(clusterID))
 }
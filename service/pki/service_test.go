@@ -0,0 +1,357 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	vaultclient "github.com/hashicorp/vault/api"
+)
+
+// testVault is a fake Vault serving the given mounts at sys/mounts. It counts
+// the requests reading the mounts and records mounted paths.
+type testVault struct {
+	Mounts map[string]interface{}
+
+	mutex   sync.Mutex
+	reads   int
+	mounted []string
+}
+
+func (v *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/sys/mounts":
+		v.reads++
+		json.NewEncoder(w).Encode(v.Mounts)
+	case (r.Method == "POST" || r.Method == "PUT") && r.URL.Path == "/v1/sys/mounts/pki-123":
+		v.mounted = append(v.mounted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testService(t *testing.T, handler http.Handler) (Service, func()) {
+	server := httptest.NewServer(handler)
+
+	newClientConfig := vaultclient.DefaultConfig()
+	newClientConfig.Address = server.URL
+	newVaultClient, err := vaultclient.NewClient(newClientConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	newServiceConfig := DefaultServiceConfig()
+	newServiceConfig.VaultClient = newVaultClient
+	newService, err := NewService(newServiceConfig)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return newService, server.Close
+}
+
+func Test_Service_Mount_OnConflict(t *testing.T) {
+	markedPKI := map[string]interface{}{"type": "pki", "description": "PKI backend for cluster ID '123' " + mountMarker("123")}
+	unmarkedPKI := map[string]interface{}{"type": "pki", "description": "hand made"}
+	kv := map[string]interface{}{"type": "kv", "description": "secrets"}
+
+	testCases := []struct {
+		Name            string
+		Mount           map[string]interface{}
+		OnConflict      string
+		ExpectedErr     func(error) bool
+		ExpectedMounted bool
+	}{
+		{
+			Name:            "nothing mounted, reuse",
+			Mount:           nil,
+			OnConflict:      OnConflictReuse,
+			ExpectedMounted: true,
+		},
+		{
+			Name:            "nothing mounted, error",
+			Mount:           nil,
+			OnConflict:      OnConflictError,
+			ExpectedMounted: true,
+		},
+		{
+			Name:       "marked PKI backend, reuse",
+			Mount:      markedPKI,
+			OnConflict: OnConflictReuse,
+		},
+		{
+			Name:       "marked PKI backend, fail",
+			Mount:      markedPKI,
+			OnConflict: OnConflictFail,
+		},
+		{
+			Name:        "marked PKI backend, error",
+			Mount:       markedPKI,
+			OnConflict:  OnConflictError,
+			ExpectedErr: IsMountConflict,
+		},
+		{
+			Name:       "unmarked PKI backend, reuse",
+			Mount:      unmarkedPKI,
+			OnConflict: OnConflictReuse,
+		},
+		{
+			Name:        "unmarked PKI backend, fail",
+			Mount:       unmarkedPKI,
+			OnConflict:  OnConflictFail,
+			ExpectedErr: IsMountConflict,
+		},
+		{
+			Name:        "other secrets engine, reuse",
+			Mount:       kv,
+			OnConflict:  OnConflictReuse,
+			ExpectedErr: IsMountConflict,
+		},
+		{
+			Name:        "invalid conflict handling",
+			Mount:       nil,
+			OnConflict:  "ignore",
+			ExpectedErr: IsInvalidConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		vault := &testVault{
+			Mounts: map[string]interface{}{
+				"secret/": kv,
+			},
+		}
+		if tc.Mount != nil {
+			vault.Mounts["pki-123/"] = tc.Mount
+		}
+		newService, closeServer := testService(t, vault)
+
+		result, err := newService.Mount(MountConfig{ClusterID: "123", TTL: "768h", OnConflict: tc.OnConflict})
+		closeServer()
+
+		if tc.ExpectedErr != nil {
+			if !tc.ExpectedErr(err) {
+				t.Fatalf("%s: expected matching error, got %#v", tc.Name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %#v", tc.Name, err)
+		}
+		if result.Mounted != tc.ExpectedMounted {
+			t.Fatalf("%s: expected mounted %t, got %t", tc.Name, tc.ExpectedMounted, result.Mounted)
+		}
+		if tc.ExpectedMounted != (len(vault.mounted) == 1) {
+			t.Fatalf("%s: expected mounted %t, got mount requests %v", tc.Name, tc.ExpectedMounted, vault.mounted)
+		}
+		// The conflict check and the mounted check share reading the mounts.
+		if vault.reads != 1 {
+			t.Fatalf("%s: expected mounts to be read once, got %d reads", tc.Name, vault.reads)
+		}
+	}
+}
+
+// testRegenerateVault is a fake Vault serving a PKI backend whose root CA is
+// the default issuer old using the key old-key. The key new-key is used by no
+// issuer. Writes to FailPath fail. It records all requests changing the PKI
+// backend.
+type testRegenerateVault struct {
+	CACert   string
+	FailPath string
+
+	mutex   sync.Mutex
+	changes []string
+}
+
+func (v *testRegenerateVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if r.Method != "GET" {
+		v.changes = append(v.changes, r.Method+" "+r.URL.Path)
+	}
+	if r.Method != "GET" && r.URL.Path == v.FailPath {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"internal error"}})
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/sys/mounts":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pki-123/": map[string]interface{}{"type": "pki", "description": mountMarker("123")},
+		})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/cert/ca":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"certificate": v.CACert}})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/config/issuers":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"default": "old"}})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/issuer/old":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"key_id": "old-key"}})
+	case r.Method != "GET" && r.URL.Path == "/v1/pki-123/issuers/generate/root/internal":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"issuer_id": "new"}})
+	case r.Method != "GET" && r.URL.Path == "/v1/pki-123/issuers/generate/root/existing":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"issuer_id": "new"}})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/issuers":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": []string{"old"}}})
+	case r.Method == "GET" && r.URL.Path == "/v1/pki-123/keys":
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": []string{"old-key", "new-key"}}})
+	case r.Method == "GET" && (r.URL.Path == "/v1/pki-123/key/old-key" || r.URL.Path == "/v1/pki-123/key/new-key"):
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"key_id": path.Base(r.URL.Path)}})
+	case r.Method != "GET":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// testCACert returns a self-signed root CA in PEM format expiring after the
+// given duration.
+func testCACert(t *testing.T, ttl time.Duration) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "123.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(ttl),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("expected no error, got %#v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func Test_Service_Create_RegenerateCA_Fails(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		FailPath        string
+		ExpectedChanges []string
+	}{
+		{
+			Name:     "generating the new issuer fails",
+			FailPath: "/v1/pki-123/issuers/generate/root/internal",
+			ExpectedChanges: []string{
+				"PUT /v1/pki-123/issuers/generate/root/internal",
+			},
+		},
+		{
+			Name:     "making the new issuer the default fails",
+			FailPath: "/v1/pki-123/config/issuers",
+			ExpectedChanges: []string{
+				"PUT /v1/pki-123/issuers/generate/root/internal",
+				"PUT /v1/pki-123/config/issuers",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		vault := &testRegenerateVault{
+			CACert:   testCACert(t, time.Hour),
+			FailPath: tc.FailPath,
+		}
+		newService, closeServer := testService(t, vault)
+
+		createConfig := CreateConfig{
+			AllowedDomains:     "123.example.com",
+			ClusterID:          "123",
+			CommonName:         "123.example.com",
+			TTL:                "768h",
+			RegenerateCAWithin: 24 * time.Hour,
+		}
+		_, err := newService.Create(createConfig)
+		closeServer()
+
+		if err == nil {
+			t.Fatalf("%s: expected error, got nil", tc.Name)
+		}
+		// The previous root CA must never be deleted before the new one is the
+		// default issuer.
+		if len(vault.changes) != len(tc.ExpectedChanges) {
+			t.Fatalf("%s: expected changes %v, got %v", tc.Name, tc.ExpectedChanges, vault.changes)
+		}
+		for i, c := range tc.ExpectedChanges {
+			if vault.changes[i] != c {
+				t.Fatalf("%s: expected changes %v, got %v", tc.Name, tc.ExpectedChanges, vault.changes)
+			}
+		}
+	}
+}
+
+func Test_Service_Create_KeyRef(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		KeyRef            string
+		ExpectedGenerated bool
+	}{
+		{
+			Name:              "key used by the root CA",
+			KeyRef:            "old-key",
+			ExpectedGenerated: false,
+		},
+		{
+			Name:              "key used by no issuer",
+			KeyRef:            "new-key",
+			ExpectedGenerated: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		vault := &testRegenerateVault{
+			CACert: testCACert(t, time.Hour),
+		}
+		newService, closeServer := testService(t, vault)
+
+		createConfig := CreateConfig{
+			AllowedDomains: "123.example.com",
+			ClusterID:      "123",
+			CommonName:     "123.example.com",
+			TTL:            "768h",
+			KeyRef:         tc.KeyRef,
+		}
+		result, err := newService.Create(createConfig)
+		closeServer()
+
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %#v", tc.Name, err)
+		}
+		if result.CAGenerated != tc.ExpectedGenerated {
+			t.Fatalf("%s: expected CA generated %t, got %t", tc.Name, tc.ExpectedGenerated, result.CAGenerated)
+		}
+		var generated, madeDefault bool
+		for _, c := range vault.changes {
+			switch c {
+			case "PUT /v1/pki-123/issuers/generate/root/existing":
+				generated = true
+			case "PUT /v1/pki-123/config/issuers":
+				madeDefault = true
+			}
+		}
+		if generated != tc.ExpectedGenerated || madeDefault != tc.ExpectedGenerated {
+			t.Fatalf("%s: expected issuer generated and made default %t, got changes %v", tc.Name, tc.ExpectedGenerated, vault.changes)
+		}
+		if tc.ExpectedGenerated && result.IssuerID != "new" {
+			t.Fatalf("%s: expected issuer ID 'new', got '%s'", tc.Name, result.IssuerID)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package pki
 
+import (
+	"crypto/x509"
+	"time"
+)
+
 // CreateConfig is used to configure the setup of a PKI backend done by the
 // Service.
 type CreateConfig struct {
@@ -23,12 +28,428 @@ type CreateConfig struct {
 	ClusterID string `json:"cluster_id"`
 
 	// CommonName is the common name used to configure the root CA associated
-	// with the current PKI backend.
+	// with the current PKI backend. It may be empty in case Subject provides
+	// at least one other subject component.
 	CommonName string `json:"common_name"`
 
+	// CABundle is a PEM bundle containing the certificate and private key of an
+	// existing root CA. In case it is set, the bundle is imported instead of
+	// generating a new root CA.
+	CABundle string `json:"-"`
+
+	// MountDescription is the description the PKI backend is mounted with.
+	// The marker identifying PKI backends mounted by certctl is always
+	// appended. Defaults to a description naming the cluster ID. Existing
+	// mounts keep their description.
+	MountDescription string `json:"mount_description"`
+
+	// UseExistingCA configures the setup to use the root CA already present in
+	// the mounted PKI backend instead of generating or importing one. This is
+	// useful in case the root CA is managed outside of certctl. The setup fails
+	// in case the PKI backend is not mounted or has no root CA.
+	UseExistingCA bool `json:"use_existing_ca"`
+
+	// KeyRef references an existing key of the PKI backend, by its key ID or
+	// key name, the root CA is generated with instead of a new key. In case it
+	// is set and no issuer uses the key yet, a new root CA issuer is generated
+	// using the key even when a root CA exists already. The new issuer becomes
+	// the default issuer. Requires a Vault version supporting multiple issuers.
+	KeyRef string `json:"key_ref"`
+
+	// RegenerateCAWithin configures an existing root CA to be replaced by a
+	// new root CA issuer in case it expires within the given duration. The new
+	// issuer becomes the default issuer before the previous one is deleted.
+	// Otherwise existing root CAs are left as they are. Zero disables
+	// regenerating. Requires a Vault version supporting multiple issuers. Note
+	// that certificates issued by the previous root CA are not trusted by the
+	// new one.
+	RegenerateCAWithin time.Duration `json:"regenerate_ca_within"`
+
+	// AutoTuneMount configures the max lease TTL of an existing PKI backend to
+	// be raised to TTL in case it is lower, so the root CA is not capped by it.
+	// Otherwise existing PKI backends are left as they are.
+	AutoTuneMount bool `json:"auto_tune_mount"`
+
+	// Subject configures additional components of the subject of the root CA
+	// associated with the current PKI backend.
+	Subject Subject `json:"subject"`
+
+	// NotAfter is an RFC3339 timestamp the generated root CA expires at. It
+	// takes precedence over TTL for the root CA and must lie in the future.
+	// The PKI backend and role are configured with the time remaining until
+	// then. This supports calendar based certificate lifecycle policies.
+	NotAfter string `json:"not_after"`
+
+	// LeafSubject configures the subject components of certificates issued
+	// using the PKI role. Vault takes them from the role, not from single
+	// issue requests.
+	LeafSubject Subject `json:"leaf_subject"`
+
 	// TTL configures the time to live for the root CA being set up. This is a
 	// golang time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
+
+	// RequireCN configures the PKI role to require a common name for issued
+	// certificates. Disabling it allows certificates identified by their
+	// alternative names only. Nil means Vault's default, which is true.
+	RequireCN *bool `json:"require_cn,omitempty"`
+
+	// AllowedSerialNumbers are the values the role allows for the serialNumber
+	// RDN of issued certificates' subjects, e.g. device identities. Values may
+	// contain * globs. Empty means custom serial numbers are not allowed.
+	AllowedSerialNumbers []string `json:"allowed_serial_numbers"`
+
+	// GenerateLease configures the PKI role to generate a Vault lease for every
+	// issued certificate. Leases allow revoking certificates by revoking their
+	// lease, but are costly for roles issuing many certificates. Defaults to
+	// false, Vault's default.
+	GenerateLease bool `json:"generate_lease"`
+
+	// NoStore configures the PKI role to not store issued certificates in
+	// Vault. This keeps storage and tidy operations cheap for roles issuing
+	// many short lived certificates. Certificates not stored can not be listed
+	// or revoked via Vault. Defaults to false, Vault's default.
+	NoStore bool `json:"no_store"`
+
+	// KeyUsage configures the key usages of certificates issued using the PKI
+	// role, e.g. DigitalSignature. Nil means Vault's default. An empty, non-nil
+	// list issues certificates without key usage, as some embedded systems
+	// require.
+	KeyUsage []string `json:"key_usage"`
+
+	// UsePSS configures the PKI role, and the root CA when generated, to sign
+	// certificates using RSA-PSS instead of PKCS#1 v1.5 signatures. Requires
+	// an RSA root CA. Defaults to false, Vault's default.
+	UsePSS bool `json:"use_pss"`
+
+	// SignatureBits is the number of bits of the hash algorithm used for
+	// signatures, one of 256, 384 or 512. Zero means Vault's default, which
+	// depends on the key type of the root CA.
+	SignatureBits int `json:"signature_bits"`
+
+	// ExtraRoleParams are additional parameters merged into the payload used to
+	// create the PKI role. This allows to set role options not explicitly
+	// supported by certctl. Parameters managed by the typed fields of
+	// CreateConfig take precedence on conflict.
+	ExtraRoleParams map[string]interface{} `json:"extra_role_params"`
+
+	// Roles are named PKI roles created in addition to the default role of the
+	// cluster, e.g. separate server and client roles having different domain
+	// policies. Existing named roles are left as they are.
+	Roles []RoleConfig `json:"roles"`
+
+	// OnConflict configures how an existing mount at the path of the PKI
+	// backend is handled. One of OnConflictReuse, OnConflictFail or
+	// OnConflictError. Empty means OnConflictReuse.
+	OnConflict string `json:"on_conflict"`
+}
+
+// RoleConfig describes a named PKI role created in addition to the default role
+// of a cluster. Role options besides the ones given here, e.g. the subject of
+// issued certificates and the extra role parameters, are taken from the
+// CreateConfig of the cluster.
+type RoleConfig struct {
+	// Name is the name the role is registered with. It must not be the name of
+	// the default role.
+	Name string `json:"name"`
+
+	// AllowedDomains is a comma separated list of the domains the role allows
+	// to issue certificates for.
+	AllowedDomains string `json:"allowed_domains"`
+
+	// AllowBareDomains is the allow_bare_domains option of the role, see
+	// CreateConfig.AllowBareDomains.
+	AllowBareDomains bool `json:"allow_bare_domains"`
+
+	// TTL is the time to live of certificates issued using the role. Empty
+	// means CreateConfig.TTL, like the default role.
+	TTL string `json:"ttl"`
+
+	// KeyUsage configures the key usages of certificates issued using the
+	// role, the same way as CreateConfig.KeyUsage. Nil means
+	// CreateConfig.KeyUsage.
+	KeyUsage []string `json:"key_usage"`
+}
+
+const (
+	// OnConflictReuse reuses an existing PKI backend, regardless of who mounted
+	// it. Mounts of other types are conflicts.
+	OnConflictReuse = "reuse"
+	// OnConflictFail reuses an existing PKI backend only in case certctl
+	// mounted it. Other mounts are conflicts.
+	OnConflictFail = "fail"
+	// OnConflictError treats every existing mount as conflict.
+	OnConflictError = "error"
+)
+
+// MountConfig is used to configure mounting a PKI backend using
+// Service.Mount.
+type MountConfig struct {
+	// ClusterID is the cluster ID the PKI backend is mounted for.
+	ClusterID string `json:"cluster_id"`
+
+	// TTL is the max lease TTL the PKI backend is mounted with. It limits the
+	// TTL of the root CA and all certificates issued by the PKI backend.
+	TTL string `json:"ttl"`
+
+	// Description is the description the PKI backend is mounted with. The
+	// marker identifying PKI backends mounted by certctl is always appended.
+	// Defaults to a description naming the cluster ID. Existing mounts keep
+	// their description.
+	Description string `json:"description"`
+
+	// OnConflict configures how an existing mount at the path of the PKI
+	// backend is handled, the same way as CreateConfig.OnConflict.
+	OnConflict string `json:"on_conflict"`
+
+	// Tune configures the max lease TTL of an existing PKI backend to be set to
+	// TTL. Otherwise existing PKI backends are left as they are.
+	Tune bool `json:"tune"`
+
+	// Raise configures the max lease TTL of an existing PKI backend to be
+	// raised to TTL in case it is lower. Unlike Tune, higher max lease TTLs
+	// are kept. Neither Tune nor Raise must be set using the shared PKI
+	// backend.
+	Raise bool `json:"raise"`
+}
+
+// MountResult is the outcome of mounting a PKI backend using Service.Mount.
+type MountResult struct {
+	// MountPath is the path the PKI backend is mounted at.
+	MountPath string `json:"mount_path"`
+
+	// Mounted tells whether the PKI backend was mounted. It is false in case
+	// the PKI backend already existed.
+	Mounted bool `json:"mounted"`
+
+	// Tuned tells whether the max lease TTL of an existing PKI backend was
+	// changed.
+	Tuned bool `json:"tuned"`
+}
+
+// Key describes a key of a PKI backend supporting multiple issuers.
+type Key struct {
+	ID   string `json:"key_id"`
+	Name string `json:"key_name"`
+	Type string `json:"key_type"`
+
+	// IssuerIDs are the IDs of the issuers using the key.
+	IssuerIDs []string `json:"issuer_ids"`
+}
+
+// Used tells whether any issuer uses the key. Keys in use can not be deleted.
+func (k Key) Used() bool {
+	return len(k.IssuerIDs) > 0
+}
+
+// Cert describes a certificate stored by a PKI backend.
+type Cert struct {
+	// Serial is the serial number of the certificate in the colon separated
+	// hex format used by Vault.
+	Serial string `json:"serial_number"`
+
+	// Certificate is the parsed certificate.
+	Certificate *x509.Certificate `json:"-"`
+
+	// Revoked tells whether the certificate was revoked.
+	Revoked bool `json:"revoked"`
+}
+
+// Mount describes a secrets engine mounted at the path of a PKI backend.
+type Mount struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+
+	// Marked tells whether the description carries the marker certctl mounts
+	// PKI backends with, i.e. certctl:cluster=<clusterID>. Unmarked mounts
+	// were mounted by someone else.
+	Marked bool `json:"marked"`
+}
+
+// MountTuning describes the lease TTLs a PKI backend is tuned with. Both are
+// the effective values, i.e. the system defaults in case the PKI backend does
+// not configure its own.
+type MountTuning struct {
+	DefaultLeaseTTL time.Duration `json:"default_lease_ttl"`
+	MaxLeaseTTL     time.Duration `json:"max_lease_ttl"`
+}
+
+// URLs describes the URLs a PKI backend encodes into issued certificates.
+type URLs struct {
+	IssuingCertificates   []string `json:"issuing_certificates"`
+	CRLDistributionPoints []string `json:"crl_distribution_points"`
+	OCSPServers           []string `json:"ocsp_servers"`
+}
+
+// ClusterMount describes the PKI backend of a cluster found by
+// Service.ListClusters.
+type ClusterMount struct {
+	ClusterID string `json:"cluster_id"`
+	Mount
+}
+
+// CreateResult is the outcome of setting up a PKI backend using
+// Service.Create.
+type CreateResult struct {
+	// MountPath is the path the PKI backend is mounted at.
+	MountPath string `json:"mount_path"`
+
+	// RoleName is the name of the PKI role.
+	RoleName string `json:"role_name"`
+
+	// RolePath is the path the PKI role is registered at.
+	RolePath string `json:"role_path"`
+
+	// RoleCreated tells whether the PKI role was created. It is false in case
+	// it existed already.
+	RoleCreated bool `json:"role_created"`
+
+	// NamedRolePaths are the paths the named roles given by CreateConfig.Roles
+	// are registered at, in the same order.
+	NamedRolePaths []string `json:"named_role_paths,omitempty"`
+
+	// NamedRolesCreated are the paths of NamedRolePaths whose named roles were
+	// created. The others existed already.
+	NamedRolesCreated []string `json:"named_roles_created,omitempty"`
+
+	// CACert is the PEM encoded certificate of the root CA.
+	CACert string `json:"ca_cert"`
+
+	// CASerial is the serial number of the root CA in the colon separated hex
+	// format used by Vault.
+	CASerial string `json:"ca_serial_number"`
+
+	// CAExpiration is the time the root CA expires.
+	CAExpiration time.Time `json:"ca_expiration"`
+
+	// IssuerID is the ID of the root CA issuer generated using
+	// CreateConfig.KeyRef or CreateConfig.RegenerateCAWithin. It is empty
+	// otherwise.
+	IssuerID string `json:"issuer_id,omitempty"`
+
+	// IssuerDefault tells whether the issuer given by IssuerID became the
+	// default issuer of the PKI backend, i.e. the root CA reported by the
+	// other fields.
+	IssuerDefault bool `json:"issuer_default,omitempty"`
+
+	// CAGenerated tells whether a new root CA was generated, including
+	// regenerating an existing one and issuers generated using
+	// CreateConfig.KeyRef. It is false for root CAs existing already and
+	// imported root CAs.
+	CAGenerated bool `json:"ca_generated"`
+
+	// CAImported tells whether the root CA given by CreateConfig.CABundle was
+	// imported. It is false in case a root CA existed already.
+	CAImported bool `json:"ca_imported,omitempty"`
+
+	// CARegenerated tells whether an existing root CA was regenerated due to
+	// CreateConfig.RegenerateCAWithin.
+	CARegenerated bool `json:"ca_regenerated,omitempty"`
+
+	// PreviousCAExpiration is the time the regenerated root CA expired at. It
+	// is only set in case CARegenerated is true.
+	PreviousCAExpiration time.Time `json:"previous_ca_expiration"`
+
+	// MountTuned tells whether the max lease TTL of an existing PKI backend
+	// was raised due to CreateConfig.AutoTuneMount.
+	MountTuned bool `json:"mount_tuned,omitempty"`
+}
+
+// ImportCAConfig is used to configure the import of an existing root CA done
+// by Service.ImportCA.
+type ImportCAConfig struct {
+	// CABundle is a PEM bundle containing the certificate and private key of the
+	// root CA being imported.
+	CABundle string `json:"-"`
+
+	// ClusterID represents the cluster ID of the PKI backend the root CA is
+	// imported to.
+	ClusterID string `json:"cluster_id"`
+
+	// TTL configures the maximum lease TTL of the PKI backend, in case it needs
+	// to be mounted. This is a golang time string with the allowed units s, m
+	// and h.
+	TTL string `json:"ttl"`
+}
+
+// ResignIntermediateConfig is used to configure the re-signing of an
+// intermediate CA done by Service.ResignIntermediate.
+type ResignIntermediateConfig struct {
+	// ClusterID represents the cluster ID of the PKI backend holding the
+	// intermediate CA.
+	ClusterID string `json:"cluster_id"`
+
+	// ParentClusterID represents the cluster ID of the PKI backend holding the
+	// CA which signed the intermediate CA.
+	ParentClusterID string `json:"parent_cluster_id"`
+
+	// PrivateKey is the PEM encoded private key of the intermediate CA. Vault
+	// does not expose the key of a CA, so it must be provided, e.g. as exported
+	// when the intermediate CA was generated.
+	PrivateKey string `json:"-"`
+
+	// TTL configures the time to live of the re-signed intermediate CA. This is
+	// a golang time string with the allowed units s, m and h.
+	TTL string `json:"ttl"`
+}
+
+// Subject represents the subject components of a root CA besides its common
+// name. Each component is a comma separated list of values as accepted by
+// Vault.
+type Subject struct {
+	Country            string `json:"country"`
+	Locality           string `json:"locality"`
+	Organization       string `json:"organization"`
+	OrganizationalUnit string `json:"ou"`
+	Province           string `json:"province"`
+}
+
+// Empty returns true in case no subject component is configured.
+func (s Subject) Empty() bool {
+	return s == Subject{}
+}
+
+// Role represents the PKI role of a cluster as read from Vault.
+type Role struct {
+	// AllowedDomains are the domains the role allows to issue certificates for.
+	AllowedDomains []string `json:"allowed_domains"`
+
+	// AllowBareDomains is the allow_bare_domains option of the role.
+	AllowBareDomains bool `json:"allow_bare_domains"`
+
+	// AllowSubdomains is the allow_subdomains option of the role.
+	AllowSubdomains bool `json:"allow_subdomains"`
+
+	// AllowAnyName is the allow_any_name option of the role.
+	AllowAnyName bool `json:"allow_any_name"`
+
+	// AllowGlobDomains is the allow_glob_domains option of the role.
+	AllowGlobDomains bool `json:"allow_glob_domains"`
+
+	// AllowLocalhost is the allow_localhost option of the role.
+	AllowLocalhost bool `json:"allow_localhost"`
+
+	// RequireCN is the require_cn option of the role.
+	RequireCN bool `json:"require_cn"`
+
+	// AllowedSerialNumbers are the patterns of the allowed_serial_numbers
+	// option of the role.
+	AllowedSerialNumbers []string `json:"allowed_serial_numbers"`
+
+	// KeyType is the key_type option of the role, i.e. the type of private
+	// keys generated when issuing certificates, e.g. rsa or ec.
+	KeyType string `json:"key_type"`
+
+	// TTL is the default time to live of certificates issued using the role.
+	TTL time.Duration `json:"ttl"`
+
+	// Subject holds the subject components the role sets on issued
+	// certificates. Components holding multiple values are comma separated.
+	Subject Subject `json:"subject"`
+
+	// Data holds all parameters of the role as returned by Vault.
+	Data map[string]interface{} `json:"data"`
 }
 
 // Service manages the setup of Vault's PKI backends and all other required
@@ -37,11 +458,81 @@ type Service interface {
 	// PKI management.
 
 	// Create sets up a Vault PKI backend according to the given configuration.
-	Create(config CreateConfig) error
+	Create(config CreateConfig) (CreateResult, error)
+
+	// Mount mounts the PKI backend associated with the given cluster ID without
+	// generating a root CA or creating the PKI role. Mounting is idempotent.
+	// Existing PKI backends are reused according to the configured conflict
+	// handling and optionally tuned.
+	Mount(config MountConfig) (MountResult, error)
 
-	// Delete removes the PKI backend associated wit the given cluster ID.
+	// Delete removes the PKI backend associated wit the given cluster ID. Using
+	// a shared mount only the cluster's PKI role is removed.
 	Delete(clusterID string) error
 
+	// Tidy starts a tidy operation of the PKI backend associated with the given
+	// cluster ID. It removes expired certificates, including revoked ones,
+	// whose expiration is older than the given safety buffer from Vault's
+	// storage. The operation runs in the background within Vault.
+	Tidy(clusterID string, safetyBuffer time.Duration) error
+
+	// GetRole reads the PKI role associated with the given cluster ID.
+	GetRole(clusterID string) (Role, error)
+
+	// GetNamedRole reads the named PKI role of the given name of the PKI
+	// backend associated with the given cluster ID.
+	GetNamedRole(clusterID, name string) (Role, error)
+
+	// IsNamedRoleCreated checks whether the named PKI role of the given name
+	// exists in the PKI backend associated with the given cluster ID.
+	IsNamedRoleCreated(clusterID, name string) (bool, error)
+
+	// GetCA reads and parses the root CA associated with the given cluster ID.
+	GetCA(clusterID string) (*x509.Certificate, error)
+
+	// GetCAChain reads and parses the CA chain associated with the given
+	// cluster ID, starting with the cluster's CA followed by the CAs which
+	// signed it. For root CAs not being part of a chain it holds the root CA
+	// only.
+	GetCAChain(clusterID string) ([]*x509.Certificate, error)
+
+	// VerifyNames checks locally whether the PKI role associated with the given
+	// cluster ID allows issuing certificates for all of the given names, e.g. a
+	// common name and alternative names. The returned error names the first
+	// disallowed name. This turns opaque rejections by Vault into actionable
+	// feedback.
+	VerifyNames(clusterID string, names []string) error
+
+	// VerifySerialNumber checks locally whether the PKI role associated with the
+	// given cluster ID allows issuing certificates having the given value as
+	// serialNumber RDN of their subject.
+	VerifySerialNumber(clusterID, serialNumber string) error
+
+	// VerifyCommonName checks locally whether the PKI role associated with the
+	// given cluster ID allows issuing certificates for the given common name.
+	// An empty common name is only allowed when the role does not require one.
+	VerifyCommonName(clusterID, commonName string) error
+
+	// VerifySubject checks locally whether the PKI role associated with the
+	// given cluster ID sets the configured components of the given subject on
+	// issued certificates. Vault takes the subject of issued certificates from
+	// the role, so a mismatch means the certificate would not carry the
+	// expected subject.
+	VerifySubject(clusterID string, subject Subject) error
+
+	// ImportCA imports an existing root CA into the PKI backend associated with
+	// the given cluster ID. The PKI backend is mounted if necessary. Importing
+	// fails in case the PKI backend already has a root CA.
+	ImportCA(config ImportCAConfig) error
+
+	// ResignIntermediate extends the validity of an intermediate CA without
+	// rotating its key. A CSR is created from the given private key of the
+	// intermediate, signed by the parent CA with a fresh TTL and set as the
+	// new certificate of the intermediate. Preconditions are that the private
+	// key belongs to the current intermediate and that the parent CA is
+	// managed in Vault as well. It returns the re-signed intermediate.
+	ResignIntermediate(config ResignIntermediateConfig) (*x509.Certificate, error)
+
 	// IsCAGenerated checks whether the root CA associated with the given cluster
 	// ID is generated.
 	IsCAGenerated(clusterID string) (bool, error)
@@ -50,10 +541,78 @@ type Service interface {
 	// cluster ID is mounted.
 	IsMounted(clusterID string) (bool, error)
 
+	// GetMount looks up the secrets engine mounted at the path of the PKI
+	// backend associated with the given cluster ID, regardless of its type. It
+	// returns nil in case nothing is mounted there.
+	GetMount(clusterID string) (*Mount, error)
+
+	// MaxLeaseTTL returns the effective max lease TTL of the mounted PKI
+	// backend associated with the given cluster ID. It caps the TTL of the
+	// root CA and all certificates issued by the PKI backend.
+	MaxLeaseTTL(clusterID string) (time.Duration, error)
+
+	// ListClusters returns the PKI backends of all clusters, sorted by cluster
+	// ID. These are the PKI backends mounted at paths following the naming
+	// convention of certctl. Using a shared mount these are the clusters having
+	// a PKI role in it.
+	ListClusters() ([]ClusterMount, error)
+
 	// IsRoleCreated checks whether the PKI role associated with the given
 	// cluster ID is created.
 	IsRoleCreated(clusterID string) (bool, error)
 
+	// ListKeys returns the keys of the PKI backend associated with the given
+	// cluster ID together with the issuers using them. Keys are only managed
+	// by PKI backends supporting multiple issuers.
+	ListKeys(clusterID string) ([]Key, error)
+
+	// GetKey reads the key referenced by the given key ref, i.e. its key ID,
+	// its key name or default, of the PKI backend associated with the given
+	// cluster ID.
+	GetKey(clusterID, keyRef string) (Key, error)
+
+	// DeleteKey deletes the key referenced by the given key ref of the PKI
+	// backend associated with the given cluster ID. Keys used by any issuer are
+	// not deleted.
+	DeleteKey(clusterID, keyRef string) error
+
+	// ListCerts returns the serial numbers of all certificates stored by the
+	// PKI backend associated with the given cluster ID, including its CAs.
+	// Certificates issued by roles having no_store enabled are not stored.
+	ListCerts(clusterID string) ([]string, error)
+
+	// GetCert reads and parses the certificate having the given serial number
+	// of the PKI backend associated with the given cluster ID.
+	GetCert(clusterID, serial string) (Cert, error)
+
+	// ListRoles returns the sorted names of all PKI roles of the PKI backend
+	// associated with the given cluster ID, including named roles and roles
+	// not created by certctl.
+	ListRoles(clusterID string) ([]string, error)
+
+	// GetMountTuning reads the lease TTLs the PKI backend associated with the
+	// given cluster ID is tuned with.
+	GetMountTuning(clusterID string) (MountTuning, error)
+
+	// TuneMount tunes the PKI backend associated with the given cluster ID with
+	// the given lease TTLs. Zero TTLs are left as they are. The shared PKI
+	// backend is not tuned, as it is the one of all clusters.
+	TuneMount(clusterID string, tuning MountTuning) error
+
+	// GetURLs reads the URLs the PKI backend associated with the given cluster
+	// ID encodes into issued certificates. They are empty in case none are
+	// configured.
+	GetURLs(clusterID string) (URLs, error)
+
+	// UpdateRole writes the PKI role of the cluster according to the given
+	// configuration, regardless of whether it already exists.
+	UpdateRole(config CreateConfig) error
+
+	// UpdateNamedRole writes the named PKI role of the given name according to
+	// the matching entry of CreateConfig.Roles, regardless of whether it
+	// already exists.
+	UpdateNamedRole(config CreateConfig, name string) error
+
 	// VerifyPKISetup checks if IsMounted, IsCAGenerated and IsRoleCreated are all true
 	// for the given cluster ID.
 	VerifyPKISetup(clusterID string) (bool, error)
@@ -63,14 +622,151 @@ type Service interface {
 
 	// Path management.
 
+	// ReadCAPath returns the path under which a cluster's certificate authority
+	// can be read. This is very specific to Vault. The path structure is the
+	// following.
+	//
+	//     pki-<clusterID>/cert/ca
+	//
+	ReadCAPath(clusterID string) string
+
+	// ReadCAChainPath returns the path under which a cluster's CA chain can be
+	// read. This is very specific to Vault. The path structure is the
+	// following.
+	//
+	//     pki-<clusterID>/cert/ca_chain
+	//
+	ReadCAChainPath(clusterID string) string
+
+	// CertPath returns the path under which a single certificate stored by a
+	// cluster's PKI backend is read. This is very specific to Vault. The path
+	// structure is the following.
+	//
+	//     pki-<clusterID>/cert/<serial>
+	//
+	CertPath(clusterID, serial string) string
+
+	// ConfigIssuersPath returns the path under which the default issuer of a
+	// cluster's PKI backend is configured. This is very specific to Vault. The
+	// path structure is the following.
+	//
+	//     pki-<clusterID>/config/issuers
+	//
+	ConfigIssuersPath(clusterID string) string
+
+	// GenerateIssuerPath returns the path under which a new root CA issuer is
+	// generated using an existing key of a cluster's PKI backend. This is very
+	// specific to Vault. The path structure is the following.
+	//
+	//     pki-<clusterID>/issuers/generate/root/existing
+	//
+	GenerateIssuerPath(clusterID string) string
+
+	// GenerateRootIssuerPath returns the path under which a new root CA issuer
+	// is generated using a new key of a cluster's PKI backend, e.g. replacing
+	// the default issuer. This is very specific to Vault. The path structure is
+	// the following.
+	//
+	//     pki-<clusterID>/issuers/generate/root/internal
+	//
+	GenerateRootIssuerPath(clusterID string) string
+
+	// ImportCAPath returns the path under which an existing certificate
+	// authority can be imported. This is very specific to Vault. The path
+	// structure is the following. See also
+	// https://github.com/hashicorp/vault/blob/6f0f46deb622ba9c7b14b2ec0be24cab3916f3d8/website/source/docs/secrets/pki/index.html.md#pkiconfigca.
+	//
+	//     pki-<clusterID>/config/ca
+	//
+	ImportCAPath(clusterID string) string
+
+	// IssuerPath returns the path under which a single issuer of a cluster's
+	// PKI backend is read. This is very specific to Vault. The path structure
+	// is the following.
+	//
+	//     pki-<clusterID>/issuer/<issuerRef>
+	//
+	IssuerPath(clusterID, issuerRef string) string
+
+	// KeyPath returns the path under which a single key of a cluster's PKI
+	// backend is read and deleted. This is very specific to Vault. The path
+	// structure is the following.
+	//
+	//     pki-<clusterID>/key/<keyRef>
+	//
+	KeyPath(clusterID, keyRef string) string
+
+	// ListIssuersPath returns the path under which the issuers of a cluster's
+	// PKI backend are listed. This is very specific to Vault. The path
+	// structure is the following.
+	//
+	//     pki-<clusterID>/issuers
+	//
+	ListIssuersPath(clusterID string) string
+
+	// ListCertsPath returns the path under which the certificates stored by a
+	// cluster's PKI backend are listed. This is very specific to Vault. The
+	// path structure is the following.
+	//
+	//     pki-<clusterID>/certs
+	//
+	ListCertsPath(clusterID string) string
+
+	// ListKeysPath returns the path under which the keys of a cluster's PKI
+	// backend are listed. This is very specific to Vault. The path structure is
+	// the following.
+	//
+	//     pki-<clusterID>/keys
+	//
+	ListKeysPath(clusterID string) string
+
+	// NamedRolePath returns the path under which a named role is registered.
+	// This is very specific to Vault. The path structure is the following.
+	//
+	//     pki-<clusterID>/roles/<name>
+	//
+	NamedRolePath(clusterID, name string) string
+
+	// URLsPath returns the path under which the URLs encoded into
+	// certificates issued by a cluster's PKI backend are configured. This is
+	// very specific to Vault. The path structure is the following.
+	//
+	//     pki-<clusterID>/config/urls
+	//
+	URLsPath(clusterID string) string
+
 	// MountPKIPath returns the path under which a cluster's PKI backend is
 	// mounted. This is very specific to Vault. The path structure is the
-	// following.
+	// following. All other paths are relative to it. In case a shared mount is
+	// configured, it is the shared mount's path for every cluster ID instead.
 	//
 	//     pki-<clusterID>
 	//
 	MountPKIPath(clusterID string) string
 
+	// SetSignedIntermediatePath returns the path under which a signed
+	// intermediate certificate is set for a cluster's certificate authority.
+	// This is very specific to Vault. The path structure is the following.
+	//
+	//     pki-<clusterID>/intermediate/set-signed
+	//
+	SetSignedIntermediatePath(clusterID string) string
+
+	// SignIntermediatePath returns the path under which a cluster's certificate
+	// authority signs intermediate CSRs. This is very specific to Vault. The
+	// path structure is the following.
+	//
+	//     pki-<clusterID>/root/sign-intermediate
+	//
+	SignIntermediatePath(clusterID string) string
+
+	// TidyPath returns the path under which a cluster's PKI backend is tidied.
+	// This is very specific to Vault. The path structure is the following.
+	//
+	//     pki-<clusterID>/tidy
+	//
+	TidyPath(clusterID string) string
+
 	// WriteCAPath returns the path under which a cluster's certificate authority
 	// can be generated. This is very specific to Vault. The path structure is
 	// the following. See also
@@ -0,0 +1,86 @@
+package secretsink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// EnvConfig represents the configuration used to create a new env sink.
+type EnvConfig struct {
+	// Writer is where the secrets are written to as shell variable
+	// assignments, which can be sourced or used as env file.
+	Writer io.Writer
+}
+
+// DefaultEnvConfig provides a default configuration to create an env sink
+// writing to stdout.
+func DefaultEnvConfig() EnvConfig {
+	newConfig := EnvConfig{
+		Writer: os.Stdout,
+	}
+
+	return newConfig
+}
+
+// NewEnv creates a new configured env sink. Tokens are written as
+// CERTCTL_TOKEN_<n>, starting at 0. Certificates are written as
+// CERTCTL_CERTIFICATE, CERTCTL_PRIVATE_KEY, CERTCTL_ISSUING_CA and
+// CERTCTL_SERIAL_NUMBER.
+func NewEnv(config EnvConfig) (spec.SecretSink, error) {
+	if config.Writer == nil {
+		return nil, maskAnyf(invalidConfigError, "writer must not be empty")
+	}
+
+	newSink := &envSink{
+		EnvConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type envSink struct {
+	EnvConfig
+}
+
+func (s *envSink) WriteCert(issueResponse spec.IssueResponse) error {
+	vars := [][2]string{
+		{"CERTCTL_CERTIFICATE", issueResponse.Certificate},
+		{"CERTCTL_PRIVATE_KEY", issueResponse.PrivateKey},
+		{"CERTCTL_ISSUING_CA", issueResponse.IssuingCA},
+		{"CERTCTL_SERIAL_NUMBER", issueResponse.SerialNumber},
+	}
+
+	return s.write(vars)
+}
+
+func (s *envSink) WriteTokens(clusterID string, tokens []string) error {
+	vars := [][2]string{
+		{"CERTCTL_CLUSTER_ID", clusterID},
+	}
+	for i, t := range tokens {
+		vars = append(vars, [2]string{fmt.Sprintf("CERTCTL_TOKEN_%d", i), t})
+	}
+
+	return s.write(vars)
+}
+
+func (s *envSink) write(vars [][2]string) error {
+	for _, v := range vars {
+		_, err := fmt.Fprintf(s.Writer, "%s=%s\n", v[0], shellQuote(v[1]))
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// shellQuote quotes the given value using single quotes, so it is taken
+// literally when being sourced by a shell.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
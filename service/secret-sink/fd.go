@@ -0,0 +1,88 @@
+package secretsink
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// FDConfig represents the configuration used to create a new file descriptor
+// sink.
+type FDConfig struct {
+	// FD is the file descriptor the secrets are written to, e.g. a pipe
+	// supplied by the parent process. It is closed once the secrets are
+	// written, so the reading end of a pipe sees EOF. Secrets can only be
+	// written once therefore.
+	FD int
+}
+
+// DefaultFDConfig provides a default configuration to create a file
+// descriptor sink.
+func DefaultFDConfig() FDConfig {
+	newConfig := FDConfig{
+		FD: 0,
+	}
+
+	return newConfig
+}
+
+// NewFD creates a new configured file descriptor sink.
+func NewFD(config FDConfig) (spec.SecretSink, error) {
+	if config.FD <= 2 {
+		return nil, maskAnyf(invalidConfigError, "file descriptor must be greater than 2, stdin, stdout and stderr are not supported")
+	}
+	if runtime.GOOS == "windows" {
+		return nil, maskAnyf(invalidConfigError, "file descriptors are not supported on Windows")
+	}
+	if !isOpenFD(config.FD) {
+		return nil, maskAnyf(invalidConfigError, "file descriptor %d is not open", config.FD)
+	}
+
+	newSink := &fdSink{
+		FDConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type fdSink struct {
+	FDConfig
+}
+
+func (s *fdSink) WriteCert(issueResponse spec.IssueResponse) error {
+	return s.write(func(w spec.SecretSink) error { return w.WriteCert(issueResponse) })
+}
+
+func (s *fdSink) WriteTokens(clusterID string, tokens []string) error {
+	return s.write(func(w spec.SecretSink) error { return w.WriteTokens(clusterID, tokens) })
+}
+
+// write wraps the configured file descriptor into a file and calls f with a
+// writer sink writing to it. The file is closed afterwards. It is only wrapped
+// when writing, since the finalizer of an unused file would close the file
+// descriptor before.
+func (s *fdSink) write(f func(w spec.SecretSink) error) error {
+	file := os.NewFile(uintptr(s.FD), fmt.Sprintf("fd:%d", s.FD))
+
+	writerConfig := DefaultWriterConfig()
+	writerConfig.Writer = file
+	writer, err := NewWriter(writerConfig)
+	if err != nil {
+		file.Close()
+		return maskAny(err)
+	}
+
+	err = f(writer)
+	if err != nil {
+		file.Close()
+		return maskAny(err)
+	}
+	err = file.Close()
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package secretsink
+
+import (
+	"syscall"
+)
+
+// isOpenFD checks whether the given file descriptor is open. The file
+// descriptor is not wrapped into an os.File, since its finalizer would close
+// the file descriptor before it is used.
+func isOpenFD(fd int) bool {
+	var stat syscall.Stat_t
+	return syscall.Fstat(fd, &stat) == nil
+}
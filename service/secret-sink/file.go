@@ -0,0 +1,91 @@
+package secretsink
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/giantswarm/certctl/service/atomic-file"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// FileConfig represents the configuration used to create a new file sink.
+type FileConfig struct {
+	// Path is the file the secrets are written to. The file is replaced
+	// atomically on every write.
+	Path string
+
+	// Env configures the content of the file. By default the content is the
+	// same as written by the writer sink. In case Env is true, the content is
+	// the same as written by the env sink.
+	Env bool
+
+	// Mode is the permission the file is created with.
+	Mode os.FileMode
+}
+
+// DefaultFileConfig provides a default configuration to create a file sink.
+func DefaultFileConfig() FileConfig {
+	newConfig := FileConfig{
+		Path: "",
+		Env:  false,
+		Mode: 0600,
+	}
+
+	return newConfig
+}
+
+// NewFile creates a new configured file sink.
+func NewFile(config FileConfig) (spec.SecretSink, error) {
+	if config.Path == "" {
+		return nil, maskAnyf(invalidConfigError, "path must not be empty")
+	}
+
+	newSink := &fileSink{
+		FileConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type fileSink struct {
+	FileConfig
+}
+
+func (s *fileSink) WriteCert(issueResponse spec.IssueResponse) error {
+	return s.write(func(w spec.SecretSink) error { return w.WriteCert(issueResponse) })
+}
+
+func (s *fileSink) WriteTokens(clusterID string, tokens []string) error {
+	return s.write(func(w spec.SecretSink) error { return w.WriteTokens(clusterID, tokens) })
+}
+
+// write replaces the configured file atomically with the content written by
+// a writer or env sink, which is passed to f, so readers never see partially
+// written secrets.
+func (s *fileSink) write(f func(w spec.SecretSink) error) error {
+	err := os.MkdirAll(filepath.Dir(s.Path), 0700)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = atomicfile.Write(s.Path, s.Mode, func(file io.Writer) error {
+		var w spec.SecretSink
+		var err error
+		if s.Env {
+			w, err = NewEnv(EnvConfig{Writer: file})
+		} else {
+			w, err = NewWriter(WriterConfig{Writer: file})
+		}
+		if err != nil {
+			return maskAny(err)
+		}
+
+		return maskAny(f(w))
+	})
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
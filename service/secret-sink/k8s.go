@@ -0,0 +1,83 @@
+package secretsink
+
+import (
+	"github.com/giantswarm/certctl/service/k8s-secret"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// K8sConfig represents the configuration used to create a new Kubernetes
+// Secret sink.
+type K8sConfig struct {
+	// Dependencies.
+	K8sSecretService k8ssecret.Service
+
+	// Settings.
+
+	// Secret references the Secret the secrets are stored in. Certificates are
+	// stored as kubernetes.io/tls Secret, tokens as Opaque Secret.
+	Secret k8ssecret.SecretRef
+}
+
+// DefaultK8sConfig provides a default configuration to create a Kubernetes
+// Secret sink.
+func DefaultK8sConfig() K8sConfig {
+	newConfig := K8sConfig{
+		// Dependencies.
+		K8sSecretService: nil,
+
+		// Settings.
+		Secret: k8ssecret.SecretRef{},
+	}
+
+	return newConfig
+}
+
+// NewK8s creates a new configured Kubernetes Secret sink.
+func NewK8s(config K8sConfig) (spec.SecretSink, error) {
+	// Dependencies.
+	if config.K8sSecretService == nil {
+		return nil, maskAnyf(invalidConfigError, "Kubernetes Secret service must not be empty")
+	}
+
+	// Settings.
+	if config.Secret.Namespace == "" || config.Secret.Name == "" {
+		return nil, maskAnyf(invalidConfigError, "secret must not be empty")
+	}
+
+	newSink := &k8sSink{
+		K8sConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type k8sSink struct {
+	K8sConfig
+}
+
+func (s *k8sSink) WriteCert(issueResponse spec.IssueResponse) error {
+	storeConfig := k8ssecret.StoreTLSConfig{
+		Secret:        s.Secret,
+		IssueResponse: issueResponse,
+	}
+	err := s.K8sSecretService.StoreTLS(storeConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *k8sSink) WriteTokens(clusterID string, tokens []string) error {
+	storeConfig := k8ssecret.StoreTokensConfig{
+		Secret:    s.Secret,
+		ClusterID: clusterID,
+		Tokens:    tokens,
+	}
+	err := s.K8sSecretService.StoreTokens(storeConfig)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package secretsink
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/certctl/service/k8s-secret"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// Factory creates a sink using the argument of a sink reference, e.g. the path
+// of file:/etc/certctl/tokens. The argument is empty in case the reference
+// does not have one.
+type Factory func(arg string) (spec.SecretSink, error)
+
+var (
+	factoriesMutex sync.Mutex
+	factories      = map[string]Factory{}
+)
+
+func init() {
+	Register("stdout", newStdoutSink)
+	Register("file", newFileSink)
+	Register("fd", newFDSink)
+	Register("env", newEnvSink)
+	Register("k8s", newK8sSink)
+	Register("systemd-creds", newSystemdCredsSink)
+}
+
+// Register makes the sink created by the given factory available under the
+// given name. Registering a name twice replaces the former factory. Library
+// users can register custom sinks this way.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	factories[name] = factory
+}
+
+// Names returns the sorted names of all registered sinks.
+func Names() []string {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseRef splits a sink reference of the form name[:arg] into its parts. The
+// name must be registered.
+func ParseRef(ref string) (string, string, error) {
+	name, arg := ref, ""
+	if i := strings.Index(ref, ":"); i >= 0 {
+		name, arg = ref[:i], ref[i+1:]
+	}
+
+	factoriesMutex.Lock()
+	_, ok := factories[name]
+	factoriesMutex.Unlock()
+	if !ok {
+		return "", "", maskAnyf(unknownSinkError, "'%s' must be one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	return name, arg, nil
+}
+
+// Open creates the sink referenced by the given reference of the form
+// name[:arg], e.g. stdout, file:/etc/certctl/tokens, fd:3, env:/etc/certctl/env,
+// k8s:namespace/name or systemd-creds:/etc/credstore.
+func Open(ref string) (spec.SecretSink, error) {
+	name, arg, err := ParseRef(ref)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	factoriesMutex.Lock()
+	factory := factories[name]
+	factoriesMutex.Unlock()
+
+	sink, err := factory(arg)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return sink, nil
+}
+
+func newStdoutSink(arg string) (spec.SecretSink, error) {
+	if arg != "" {
+		return nil, maskAnyf(invalidConfigError, "stdout sink does not take an argument")
+	}
+
+	return NewWriter(DefaultWriterConfig())
+}
+
+func newFileSink(arg string) (spec.SecretSink, error) {
+	fileConfig := DefaultFileConfig()
+	fileConfig.Path = arg
+
+	return NewFile(fileConfig)
+}
+
+func newFDSink(arg string) (spec.SecretSink, error) {
+	fd, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, maskAnyf(invalidConfigError, "fd sink requires a file descriptor number")
+	}
+
+	fdConfig := DefaultFDConfig()
+	fdConfig.FD = fd
+
+	return NewFD(fdConfig)
+}
+
+func newEnvSink(arg string) (spec.SecretSink, error) {
+	if arg == "" {
+		return NewEnv(DefaultEnvConfig())
+	}
+
+	fileConfig := DefaultFileConfig()
+	fileConfig.Path = arg
+	fileConfig.Env = true
+
+	return NewFile(fileConfig)
+}
+
+func newSystemdCredsSink(arg string) (spec.SecretSink, error) {
+	systemdCredsConfig := DefaultSystemdCredsConfig()
+	systemdCredsConfig.Dir = arg
+
+	return NewSystemdCreds(systemdCredsConfig)
+}
+
+func newK8sSink(arg string) (spec.SecretSink, error) {
+	secretRef, err := k8ssecret.ParseSecretRef(arg)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	k8sSecretConfig, err := k8ssecret.InClusterServiceConfig()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	k8sSecretService, err := k8ssecret.NewService(k8sSecretConfig)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	k8sConfig := DefaultK8sConfig()
+	k8sConfig.K8sSecretService = k8sSecretService
+	k8sConfig.Secret = secretRef
+
+	return NewK8s(k8sConfig)
+}
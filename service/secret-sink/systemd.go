@@ -0,0 +1,141 @@
+package secretsink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/certctl/service/atomic-file"
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// systemdTokenPrefix is the prefix of the credential files tokens are written
+// to, e.g. vault-token-1.
+const systemdTokenPrefix = "vault-token-"
+
+// SystemdCredsConfig represents the configuration used to create a new
+// systemd credentials sink.
+type SystemdCredsConfig struct {
+	// Dir is the directory the credential files are written to, e.g.
+	// /etc/credstore. Units load them using LoadCredential. It must exist and
+	// be writable.
+	Dir string
+
+	// Mode is the permission the credential files are created with.
+	Mode os.FileMode
+}
+
+// DefaultSystemdCredsConfig provides a default configuration to create a
+// systemd credentials sink.
+func DefaultSystemdCredsConfig() SystemdCredsConfig {
+	newConfig := SystemdCredsConfig{
+		Dir:  "",
+		Mode: 0400,
+	}
+
+	return newConfig
+}
+
+// NewSystemdCreds creates a new configured systemd credentials sink. Every
+// secret is written to a file of its own, e.g. the tokens to vault-token-<n>,
+// because systemd loads one credential per file.
+func NewSystemdCreds(config SystemdCredsConfig) (spec.SecretSink, error) {
+	if config.Dir == "" {
+		return nil, maskAnyf(invalidConfigError, "directory must not be empty")
+	}
+	err := checkWritableDir(config.Dir)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	newSink := &systemdCredsSink{
+		SystemdCredsConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type systemdCredsSink struct {
+	SystemdCredsConfig
+}
+
+func (s *systemdCredsSink) WriteCert(issueResponse spec.IssueResponse) error {
+	files := []struct {
+		Name string
+		Data string
+	}{
+		{Name: "vault-cert", Data: issueResponse.Certificate},
+		{Name: "vault-key", Data: issueResponse.PrivateKey},
+		{Name: "vault-ca", Data: issueResponse.IssuingCA},
+	}
+	for _, f := range files {
+		err := s.write(f.Name, []byte(f.Data+"\n"))
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// WriteTokens writes every token to vault-token-<n>, counting from 1. Token
+// files of former writes beyond the given tokens are removed, so the directory
+// only holds the given tokens afterwards.
+func (s *systemdCredsSink) WriteTokens(clusterID string, tokens []string) error {
+	for i, t := range tokens {
+		err := s.write(fmt.Sprintf("%s%d", systemdTokenPrefix, i+1), []byte(t))
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.Dir, systemdTokenPrefix+"*"))
+	if err != nil {
+		return maskAny(err)
+	}
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(m), systemdTokenPrefix))
+		if err != nil || n <= len(tokens) {
+			continue
+		}
+		err = os.Remove(m)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// write replaces the credential file of the given name atomically, so units
+// never load partially written secrets. Credential files are read-only, but
+// can still be replaced this way.
+func (s *systemdCredsSink) write(name string, data []byte) error {
+	return maskAny(atomicfile.WriteFile(filepath.Join(s.Dir, name), data, s.Mode))
+}
+
+// checkWritableDir ensures the given path is an existing directory files can
+// be created in.
+func checkWritableDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "credentials directory: %s", err.Error())
+	}
+	if !fi.IsDir() {
+		return maskAnyf(invalidConfigError, "credentials directory '%s' is not a directory", dir)
+	}
+
+	// Permission bits do not tell about read-only file systems, so writing is
+	// actually tried.
+	file, err := ioutil.TempFile(dir, ".certctl-check.")
+	if err != nil {
+		return maskAnyf(invalidConfigError, "credentials directory '%s' is not writable", dir)
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	return nil
+}
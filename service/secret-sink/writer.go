@@ -0,0 +1,66 @@
+package secretsink
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/giantswarm/certctl/service/spec"
+)
+
+// WriterConfig represents the configuration used to create a new writer sink.
+type WriterConfig struct {
+	// Writer is where the secrets are written to. Tokens are written one per
+	// line. Certificates are written as PEM bundle of the certificate, the
+	// issuing CA and the private key.
+	Writer io.Writer
+}
+
+// DefaultWriterConfig provides a default configuration to create a writer
+// sink writing to stdout.
+func DefaultWriterConfig() WriterConfig {
+	newConfig := WriterConfig{
+		Writer: os.Stdout,
+	}
+
+	return newConfig
+}
+
+// NewWriter creates a new configured writer sink.
+func NewWriter(config WriterConfig) (spec.SecretSink, error) {
+	if config.Writer == nil {
+		return nil, maskAnyf(invalidConfigError, "writer must not be empty")
+	}
+
+	newSink := &writerSink{
+		WriterConfig: config,
+	}
+
+	return newSink, nil
+}
+
+type writerSink struct {
+	WriterConfig
+}
+
+func (s *writerSink) WriteCert(issueResponse spec.IssueResponse) error {
+	for _, v := range []string{issueResponse.Certificate, issueResponse.IssuingCA, issueResponse.PrivateKey} {
+		_, err := fmt.Fprintf(s.Writer, "%s\n", v)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *writerSink) WriteTokens(clusterID string, tokens []string) error {
+	for _, t := range tokens {
+		_, err := fmt.Fprintf(s.Writer, "%s\n", t)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
@@ -17,6 +17,55 @@ type IssueConfig struct {
 	// AltNames names represents a comma separate list of alternative names.
 	AltNames string `json:"alt_names"`
 
+	// ExcludeCNFromSANs configures whether the common name is left out of the
+	// DNS SANs of the issued certificate, which Vault adds it to by default.
+	ExcludeCNFromSANs bool `json:"exclude_cn_from_sans"`
+
+	// SerialNumber is the serialNumber RDN of the issued certificate's subject,
+	// e.g. a device identity. It is not the serial number of the certificate.
+	// It must be allowed by the PKI role. Empty means none.
+	SerialNumber string `json:"serial_number"`
+
+	// TTL configures the time to live for the requested certificate. This is a
+	// golang time string with the allowed units s, m and h.
+	TTL string `json:"ttl"`
+
+	// Format configures the encoding of the returned certificate data. Valid
+	// values are pem, pem_bundle and der. With pem_bundle the certificate
+	// contains the PEM encoded certificate followed by its private key. With der
+	// all values are base64 encoded DER. Empty means Vault's default, which is
+	// pem.
+	Format string `json:"format"`
+
+	// PrivateKeyFormat configures the encoding of the returned private key.
+	// Valid values are der, pkcs8 and pkcs1. Empty means Vault's default, which
+	// is der, being a PKCS#1 or SEC1 key when combined with the pem format.
+	// Vault does not know pkcs1, so the key is converted by the CertSigner,
+	// which fails for keys other than RSA.
+	PrivateKeyFormat string `json:"private_key_format"`
+}
+
+// SignConfig is used to configure the process of signing a certificate
+// signing request using the CertSigner.
+type SignConfig struct {
+	// ClusterID represents the cluster ID the certificate signing request
+	// should be signed for.
+	ClusterID string `json:"cluster_id"`
+
+	// CSR is the PEM encoded certificate signing request being signed. The
+	// private key never leaves the client.
+	CSR string `json:"csr"`
+
+	// CommonName is the common name of the signed certificate. Empty means the
+	// common name of the CSR is used.
+	CommonName string `json:"common_name"`
+
+	// IPSANs represents a comma separate lists of IPs.
+	IPSANs string `json:"ip_sans"`
+
+	// AltNames names represents a comma separate list of alternative names.
+	AltNames string `json:"alt_names"`
+
 	// TTL configures the time to live for the requested certificate. This is a
 	// golang time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
@@ -27,6 +76,11 @@ type IssueResponse struct {
 	PrivateKey   string `json:"private_key"`
 	IssuingCA    string `json:"issuing_ca"`
 	SerialNumber string `json:"serial_number"`
+
+	// CAChain holds the CAs which signed the certificate, starting with the
+	// issuing CA. Vault versions not returning the chain only provide the
+	// issuing CA.
+	CAChain []string `json:"ca_chain"`
 }
 
 // CertSigner manages the process of issuing new certificate key pairs
@@ -35,6 +89,15 @@ type CertSigner interface {
 	// configuration.
 	Issue(config IssueConfig) (IssueResponse, error)
 
+	// Sign signs the certificate signing request of the given configuration.
+	// The private key of the returned response is empty, because it is only
+	// known to the client.
+	Sign(config SignConfig) (IssueResponse, error)
+
+	// Revoke revokes the certificate identified by the given serial number on
+	// the Vault PKI backend of the given cluster ID.
+	Revoke(clusterID, serialNumber string) error
+
 	// SignedPath returns the path under which a certificate can be generated.
 	// This is very specific to Vault. The path structure is the following. See
 	// also https://github.com/hashicorp/vault/blob/6f0f46deb622ba9c7b14b2ec0be24cab3916f3d8/website/source/docs/secrets/pki/index.html.md#pkiissue.
@@ -42,4 +105,12 @@ type CertSigner interface {
 	//     pki-<clusterID>/issue/role-<clusterID>
 	//
 	SignedPath(clusterID string) string
+
+	// SignPath returns the path under which a certificate signing request can be
+	// signed. This is very specific to Vault. The path structure is the
+	// following.
+	//
+	//     pki-<clusterID>/sign/role-<clusterID>
+	//
+	SignPath(clusterID string) string
 }
@@ -0,0 +1,12 @@
+package spec
+
+// SecretSink is a destination for secret material generated by certctl, e.g.
+// Vault tokens and issued certificate key pairs.
+type SecretSink interface {
+	// WriteCert writes the certificate key pair of the given issue response.
+	WriteCert(issueResponse IssueResponse) error
+
+	// WriteTokens writes the given Vault tokens generated for the given cluster
+	// ID.
+	WriteTokens(clusterID string, tokens []string) error
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Format encodes the given spec as HCL document, which Parse reads back.
+func Format(spec Spec) []byte {
+	var b bytes.Buffer
+
+	for i, c := range spec.Clusters {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "cluster %s {\n", strconv.Quote(c.ID))
+		fmt.Fprintf(&b, "  common_name = %s\n", strconv.Quote(c.CommonName))
+		fmt.Fprintf(&b, "  ca_ttl      = %s\n", strconv.Quote(c.CATTL))
+		b.WriteString("\n")
+
+		if c.Subject != nil {
+			b.WriteString("  subject {\n")
+			for _, f := range []struct{ Key, Value string }{
+				{"country", c.Subject.Country},
+				{"locality", c.Subject.Locality},
+				{"organization", c.Subject.Organization},
+				{"ou", c.Subject.OrganizationalUnit},
+				{"province", c.Subject.Province},
+			} {
+				if f.Value != "" {
+					fmt.Fprintf(&b, "    %-12s = %s\n", f.Key, strconv.Quote(f.Value))
+				}
+			}
+			b.WriteString("  }\n")
+			b.WriteString("\n")
+		}
+
+		if c.Mount != nil {
+			b.WriteString("  mount {\n")
+			if c.Mount.DefaultLeaseTTL != "" {
+				fmt.Fprintf(&b, "    default_lease_ttl = %s\n", strconv.Quote(c.Mount.DefaultLeaseTTL))
+			}
+			if c.Mount.MaxLeaseTTL != "" {
+				fmt.Fprintf(&b, "    max_lease_ttl     = %s\n", strconv.Quote(c.Mount.MaxLeaseTTL))
+			}
+			b.WriteString("  }\n")
+			b.WriteString("\n")
+		}
+
+		b.WriteString("  role {\n")
+		fmt.Fprintf(&b, "    allowed_domains    = %s\n", formatList(c.Role.AllowedDomains))
+		fmt.Fprintf(&b, "    allow_bare_domains = %t\n", c.Role.AllowBareDomains)
+		if len(c.Role.Params) > 0 {
+			var keys []string
+			width := 0
+			for k := range c.Role.Params {
+				keys = append(keys, k)
+				if len(k) > width {
+					width = len(k)
+				}
+			}
+			sort.Strings(keys)
+
+			b.WriteString("\n")
+			b.WriteString("    params {\n")
+			for _, k := range keys {
+				fmt.Fprintf(&b, "      %-*s = %s\n", width, k, strconv.Quote(c.Role.Params[k]))
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n")
+		b.WriteString("\n")
+
+		for _, r := range c.NamedRoles {
+			fmt.Fprintf(&b, "  named_role %s {\n", strconv.Quote(r.Name))
+			fmt.Fprintf(&b, "    allowed_domains    = %s\n", formatList(r.AllowedDomains))
+			fmt.Fprintf(&b, "    allow_bare_domains = %t\n", r.AllowBareDomains)
+			if r.TTL != "" {
+				fmt.Fprintf(&b, "    ttl                = %s\n", strconv.Quote(r.TTL))
+			}
+			if len(r.KeyUsage) > 0 {
+				fmt.Fprintf(&b, "    key_usage          = %s\n", formatList(r.KeyUsage))
+			}
+			b.WriteString("  }\n")
+			b.WriteString("\n")
+		}
+
+		if c.PolicyRules != "" {
+			fmt.Fprintf(&b, "  policy_rules = %s\n", strconv.Quote(c.PolicyRules))
+			b.WriteString("\n")
+		}
+
+		b.WriteString("  tokens {\n")
+		fmt.Fprintf(&b, "    num = %d\n", c.Tokens.Num)
+		fmt.Fprintf(&b, "    ttl = %s\n", strconv.Quote(c.Tokens.TTL))
+		if len(c.Tokens.Policies) > 0 {
+			fmt.Fprintf(&b, "    policies = %s\n", formatList(c.Tokens.Policies))
+		}
+		b.WriteString("  }\n")
+		b.WriteString("}\n")
+	}
+
+	return b.Bytes()
+}
+
+func formatList(list []string) string {
+	var quoted []string
+	for _, v := range list {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// FormatYAML encodes the given spec as YAML document, which ParseYAML reads
+// back.
+func FormatYAML(spec Spec) ([]byte, error) {
+	// Clusters and named roles are keyed by their cluster ID and name, the
+	// same way as in the JSON form of the HCL spec.
+	type namedRoles map[string]NamedRoleSpec
+	type clusterYAML struct {
+		ClusterSpec
+		NamedRoles namedRoles `json:"named_role,omitempty"`
+	}
+
+	clusters := map[string]clusterYAML{}
+	for _, c := range spec.Clusters {
+		cluster := clusterYAML{ClusterSpec: c}
+		for _, r := range c.NamedRoles {
+			if cluster.NamedRoles == nil {
+				cluster.NamedRoles = namedRoles{}
+			}
+			cluster.NamedRoles[r.Name] = r
+		}
+		clusters[c.ID] = cluster
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{"cluster": clusters})
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,108 @@
+package state
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/hcl"
+)
+
+const (
+	defaultCATTL    = "86400h" // 10 years
+	defaultTokenTTL = "720h"
+)
+
+// Parse decodes a spec from the given HCL or JSON document and applies
+// defaults.
+func Parse(b []byte) (Spec, error) {
+	var spec Spec
+	err := hcl.Decode(&spec, string(b))
+	if err != nil {
+		return Spec{}, maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+
+	for i := range spec.Clusters {
+		c := &spec.Clusters[i]
+		if c.CATTL == "" {
+			c.CATTL = defaultCATTL
+		}
+		if c.Tokens.TTL == "" {
+			c.Tokens.TTL = defaultTokenTTL
+		}
+	}
+
+	return spec, nil
+}
+
+// ParseYAML decodes a spec from the given YAML document and applies defaults.
+// The document is structured like the JSON form of the HCL spec, i.e. clusters
+// and named roles are objects keyed by their cluster ID and name.
+func ParseYAML(b []byte) (Spec, error) {
+	j, err := yamlToJSON(b)
+	if err != nil {
+		return Spec{}, maskAny(err)
+	}
+
+	spec, err := Parse(j)
+	if err != nil {
+		return Spec{}, maskAny(err)
+	}
+
+	return spec, nil
+}
+
+// IsYAMLFile tells whether the spec file at the given path is a YAML document,
+// i.e. whether it ends in .yaml or .yml. All other spec files are HCL or JSON
+// documents.
+func IsYAMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+
+	return false
+}
+
+// ParseFile reads and parses the spec file at the given path.
+func ParseFile(path string) (Spec, error) {
+	b, err := readFile(path)
+	if err != nil {
+		return Spec{}, maskAny(err)
+	}
+
+	spec, err := Parse(b)
+	if err != nil {
+		return Spec{}, maskAny(err)
+	}
+
+	return spec, nil
+}
+
+// readFile reads the spec file at the given path. YAML documents are converted
+// to JSON, which is read the same way as HCL.
+func readFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	if IsYAMLFile(path) {
+		b, err = yamlToJSON(b)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	return b, nil
+}
+
+func yamlToJSON(b []byte) ([]byte, error) {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, maskAnyf(invalidConfigError, "%s", err.Error())
+	}
+
+	return j, nil
+}
@@ -0,0 +1,674 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/certctl/service/pki"
+	"github.com/giantswarm/certctl/service/token"
+)
+
+// ServiceConfig represents the configuration used to create a new state
+// service.
+type ServiceConfig struct {
+	// Dependencies.
+	PKIService   pki.Service
+	TokenService token.Service
+
+	// Settings.
+
+	// SharedMount is the path of a PKI backend shared by all clusters, see
+	// pki.ServiceConfig.SharedMount. It cannot be tuned per cluster.
+	SharedMount string
+}
+
+// DefaultServiceConfig provides a default configuration to create a state
+// service.
+func DefaultServiceConfig() ServiceConfig {
+	newConfig := ServiceConfig{
+		// Dependencies.
+		PKIService:   nil,
+		TokenService: nil,
+
+		// Settings.
+		SharedMount: "",
+	}
+
+	return newConfig
+}
+
+// NewService creates a new configured state service.
+func NewService(config ServiceConfig) (Service, error) {
+	// Dependencies.
+	if config.PKIService == nil {
+		return nil, maskAnyf(invalidConfigError, "PKI service must not be empty")
+	}
+	if config.TokenService == nil {
+		return nil, maskAnyf(invalidConfigError, "token service must not be empty")
+	}
+
+	newService := &service{
+		ServiceConfig: config,
+	}
+
+	return newService, nil
+}
+
+type service struct {
+	ServiceConfig
+}
+
+func (s *service) Plan(spec Spec) (Plan, error) {
+	var plan Plan
+
+	for _, c := range spec.Clusters {
+		if c.ID == "" {
+			return Plan{}, maskAnyf(invalidConfigError, "cluster ID must not be empty")
+		}
+		if c.CommonName == "" {
+			return Plan{}, maskAnyf(invalidConfigError, "cluster '%s': common_name must not be empty", c.ID)
+		}
+		if len(c.Role.AllowedDomains) == 0 {
+			return Plan{}, maskAnyf(invalidConfigError, "cluster '%s': allowed_domains must not be empty", c.ID)
+		}
+
+		actions, err := s.planCluster(c)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		plan.Actions = append(plan.Actions, actions...)
+		plan.Warnings = append(plan.Warnings, roleDomainWarnings(c)...)
+	}
+
+	return plan, nil
+}
+
+// roleDomainWarnings returns the warnings about contradicting domain options
+// of the PKI roles described by the given cluster spec, prefixed by the
+// cluster and role they belong to.
+func roleDomainWarnings(c ClusterSpec) []string {
+	var warnings []string
+
+	createConfig := pkiCreateConfig(c)
+	for _, w := range pki.RoleDomainWarnings(createConfig) {
+		warnings = append(warnings, fmt.Sprintf("cluster '%s': PKI role: %s", c.ID, w))
+	}
+	for _, r := range createConfig.Roles {
+		createConfig.AllowedDomains = r.AllowedDomains
+		createConfig.AllowBareDomains = r.AllowBareDomains
+		for _, w := range pki.RoleDomainWarnings(createConfig) {
+			warnings = append(warnings, fmt.Sprintf("cluster '%s': PKI role '%s': %s", c.ID, r.Name, w))
+		}
+	}
+
+	return warnings
+}
+
+func (s *service) planCluster(c ClusterSpec) ([]Action, error) {
+	var actions []Action
+
+	newAction := func(resource Resource, actionType ActionType, path string, changes []Change) {
+		actions = append(actions, Action{
+			ClusterID: c.ID,
+			Resource:  resource,
+			Type:      actionType,
+			Path:      path,
+			Changes:   changes,
+		})
+	}
+
+	mounted, err := s.PKIService.IsMounted(c.ID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if !mounted {
+		newAction(ResourceMount, ActionCreate, s.PKIService.MountPKIPath(c.ID), nil)
+	}
+	if c.Mount != nil && s.SharedMount != "" {
+		return nil, maskAnyf(invalidConfigError, "cluster '%s': mount must not be given using the shared PKI backend '%s', it is the one of all clusters", c.ID, s.SharedMount)
+	}
+	if c.Mount != nil && mounted {
+		tuning, err := s.PKIService.GetMountTuning(c.ID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		changes, err := mountChanges(tuning, c)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if len(changes) > 0 {
+			newAction(ResourceMount, ActionUpdate, s.PKIService.MountPKIPath(c.ID), changes)
+		}
+	}
+
+	caGenerated := false
+	if mounted {
+		caGenerated, err = s.PKIService.IsCAGenerated(c.ID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+	if !caGenerated {
+		newAction(ResourceCA, ActionCreate, s.PKIService.WriteCAPath(c.ID), nil)
+	}
+
+	roleCreated := false
+	if mounted {
+		roleCreated, err = s.PKIService.IsRoleCreated(c.ID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+	if !roleCreated {
+		newAction(ResourceRole, ActionCreate, s.PKIService.WriteRolePath(c.ID), nil)
+	} else {
+		role, err := s.PKIService.GetRole(c.ID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		changes, err := roleChanges(role, c)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if len(changes) > 0 {
+			newAction(ResourceRole, ActionUpdate, s.PKIService.WriteRolePath(c.ID), changes)
+		}
+	}
+
+	for _, r := range c.NamedRoles {
+		path := s.PKIService.NamedRolePath(c.ID, r.Name)
+		created := false
+		if mounted {
+			created, err = s.PKIService.IsNamedRoleCreated(c.ID, r.Name)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+		if !created {
+			newAction(ResourceRole, ActionCreate, path, nil)
+			continue
+		}
+		role, err := s.PKIService.GetNamedRole(c.ID, r.Name)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		changes, err := namedRoleChanges(role, c, r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if len(changes) > 0 {
+			newAction(ResourceRole, ActionUpdate, path, changes)
+		}
+	}
+
+	policyCreated, err := s.TokenService.IsPolicyCreated(c.ID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if !policyCreated {
+		newAction(ResourcePolicy, ActionCreate, s.TokenService.PolicyName(c.ID), nil)
+	} else {
+		live, err := s.TokenService.GetPolicy(c.ID)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		desired := c.PolicyRules
+		if desired == "" {
+			desired, err = s.TokenService.PolicyRules(c.ID)
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+		if strings.TrimSpace(live) != strings.TrimSpace(desired) {
+			changes := []Change{{Field: "rules", Before: strings.TrimSpace(live), After: strings.TrimSpace(desired)}}
+			newAction(ResourcePolicy, ActionUpdate, s.TokenService.PolicyName(c.ID), changes)
+		}
+	}
+
+	// Tokens are secret and cannot be compared against existing ones. They are
+	// only generated for newly set up clusters. The shared PKI backend exists
+	// once the first cluster is set up, so there a cluster is new as long as it
+	// lacks its PKI role or policy.
+	newCluster := !mounted
+	if s.SharedMount != "" {
+		newCluster = !roleCreated || !policyCreated
+	}
+	if newCluster && c.Tokens.Num > 0 {
+		changes := []Change{{Field: "num", Before: "0", After: strconv.Itoa(c.Tokens.Num)}}
+		newAction(ResourceTokens, ActionCreate, "auth/token/create", changes)
+	}
+
+	return actions, nil
+}
+
+func (s *service) Apply(config ApplyConfig) (Result, error) {
+	result := Result{
+		Tokens: map[string][]string{},
+	}
+
+	for _, c := range config.Spec.Clusters {
+		actions := config.Plan.forCluster(c.ID)
+		if len(actions) == 0 {
+			continue
+		}
+
+		err := s.applyCluster(c, actions, &result)
+		if err != nil && config.ContinueOnError {
+			result.Failures = append(result.Failures, Failure{ClusterID: c.ID, Err: err})
+			continue
+		} else if err != nil {
+			return result, maskAny(err)
+		}
+		result.Plan.Actions = append(result.Plan.Actions, actions...)
+	}
+
+	return result, nil
+}
+
+// applyCluster executes the given actions of the given cluster. Generated
+// tokens are added to the given result.
+func (s *service) applyCluster(c ClusterSpec, actions actions, result *Result) error {
+	createConfig := pkiCreateConfig(c)
+
+	// Create takes care of all missing PKI resources at once.
+	if actions.has(ResourceMount, ActionCreate) || actions.has(ResourceCA, ActionCreate) || actions.has(ResourceRole, ActionCreate) {
+		_, err := s.PKIService.Create(createConfig)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+	// Newly mounted PKI backends are tuned right after being created.
+	if c.Mount != nil && (actions.has(ResourceMount, ActionCreate) || actions.has(ResourceMount, ActionUpdate)) {
+		tuning, err := mountTuning(c)
+		if err != nil {
+			return maskAny(err)
+		}
+		err = s.PKIService.TuneMount(c.ID, tuning)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+	// Role updates are applied per role, the cluster's role or one of its
+	// named roles, identified by the path of the action.
+	for _, a := range actions {
+		if a.Resource != ResourceRole || a.Type != ActionUpdate {
+			continue
+		}
+		if a.Path == s.PKIService.WriteRolePath(c.ID) {
+			err := s.PKIService.UpdateRole(createConfig)
+			if err != nil {
+				return maskAny(err)
+			}
+			continue
+		}
+		for _, r := range c.NamedRoles {
+			if a.Path != s.PKIService.NamedRolePath(c.ID, r.Name) {
+				continue
+			}
+			err := s.PKIService.UpdateNamedRole(createConfig, r.Name)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	}
+	if actions.has(ResourcePolicy, ActionCreate) || actions.has(ResourcePolicy, ActionUpdate) {
+		var err error
+		if c.PolicyRules != "" {
+			err = s.TokenService.WritePolicy(c.ID, c.PolicyRules)
+		} else {
+			err = s.TokenService.CreatePolicy(c.ID)
+		}
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+	if actions.has(ResourceTokens, ActionCreate) {
+		tokenConfig := token.CreateConfig{
+			ClusterID: c.ID,
+			Num:       c.Tokens.Num,
+			Policies:  c.Tokens.Policies,
+			TTL:       c.Tokens.TTL,
+		}
+		tokenResult, err := s.TokenService.Create(tokenConfig)
+		if len(tokenResult.Tokens) > 0 {
+			result.Tokens[c.ID] = tokenResult.IDs()
+		}
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// specRoleFields are the role parameters described by dedicated fields of a
+// cluster spec, or always set by certctl, so they are not exported as params.
+var specRoleFields = map[string]bool{
+	"allowed_domains":    true,
+	"allow_bare_domains": true,
+	"allow_subdomains":   true,
+	"ttl":                true,
+}
+
+func (s *service) Export(clusterID string) (ClusterSpec, error) {
+	ca, err := s.PKIService.GetCA(clusterID)
+	if err != nil {
+		return ClusterSpec{}, maskAny(err)
+	}
+	if ca.Subject.CommonName == "" {
+		return ClusterSpec{}, maskAnyf(invalidConfigError, "cluster '%s': root CA has no common name", clusterID)
+	}
+
+	role, err := s.PKIService.GetRole(clusterID)
+	if err != nil {
+		return ClusterSpec{}, maskAny(err)
+	}
+
+	params := map[string]string{}
+	for k, v := range role.Data {
+		if specRoleFields[k] {
+			continue
+		}
+		params[k] = formatValue(v)
+	}
+
+	c := ClusterSpec{
+		ID:         clusterID,
+		CommonName: ca.Subject.CommonName,
+		CATTL:      formatHours(role.TTL),
+		Role: RoleSpec{
+			AllowedDomains:   role.AllowedDomains,
+			AllowBareDomains: role.AllowBareDomains,
+			Params:           params,
+		},
+		Tokens: TokensSpec{
+			TTL: defaultTokenTTL,
+		},
+	}
+
+	subject := SubjectSpec{
+		Country:            first(ca.Subject.Country),
+		Locality:           first(ca.Subject.Locality),
+		Organization:       first(ca.Subject.Organization),
+		OrganizationalUnit: first(ca.Subject.OrganizationalUnit),
+		Province:           first(ca.Subject.Province),
+	}
+	if subject != (SubjectSpec{}) {
+		c.Subject = &subject
+	}
+
+	// The shared PKI backend is the one of all clusters, so its tuning is not
+	// part of the spec of a single cluster.
+	if s.SharedMount == "" {
+		tuning, err := s.PKIService.GetMountTuning(clusterID)
+		if err != nil {
+			return ClusterSpec{}, maskAny(err)
+		}
+		c.Mount = &MountSpec{
+			DefaultLeaseTTL: formatHours(tuning.DefaultLeaseTTL),
+			MaxLeaseTTL:     formatHours(tuning.MaxLeaseTTL),
+		}
+	}
+
+	// Policy rules are only exported in case they were customized, so the spec
+	// can be applied for other cluster IDs, whose rules name their own paths.
+	policyCreated, err := s.TokenService.IsPolicyCreated(clusterID)
+	if err != nil {
+		return ClusterSpec{}, maskAny(err)
+	}
+	if policyCreated {
+		live, err := s.TokenService.GetPolicy(clusterID)
+		if err != nil {
+			return ClusterSpec{}, maskAny(err)
+		}
+		generated, err := s.TokenService.PolicyRules(clusterID)
+		if err != nil {
+			return ClusterSpec{}, maskAny(err)
+		}
+		if strings.TrimSpace(live) != strings.TrimSpace(generated) {
+			c.PolicyRules = live
+		}
+	}
+
+	return c, nil
+}
+
+// first returns the first of the given values, e.g. of a subject component of
+// a certificate, or an empty string.
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (s *service) DiffRole(c ClusterSpec) ([]Change, error) {
+	role, err := s.PKIService.GetRole(c.ID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	changes, err := roleChanges(role, c)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return changes, nil
+}
+
+// formatHours formats the given duration in hours in case it is a multiple of
+// an hour, like durations are usually written in specs, e.g. 86400h.
+func formatHours(d time.Duration) string {
+	if d != 0 && d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+
+	return d.String()
+}
+
+type actions []Action
+
+func (p Plan) forCluster(clusterID string) actions {
+	var list actions
+	for _, a := range p.Actions {
+		if a.ClusterID == clusterID {
+			list = append(list, a)
+		}
+	}
+
+	return list
+}
+
+func (a actions) has(resource Resource, actionType ActionType) bool {
+	for _, action := range a {
+		if action.Resource == resource && action.Type == actionType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pkiCreateConfig translates the given cluster spec into the configuration used
+// to set up its PKI backend.
+func pkiCreateConfig(c ClusterSpec) pki.CreateConfig {
+	extraRoleParams := map[string]interface{}{}
+	for k, v := range c.Role.Params {
+		extraRoleParams[k] = v
+	}
+
+	createConfig := pki.CreateConfig{
+		AllowedDomains:   strings.Join(c.Role.AllowedDomains, ","),
+		ClusterID:        c.ID,
+		CommonName:       c.CommonName,
+		TTL:              c.CATTL,
+		AllowBareDomains: c.Role.AllowBareDomains,
+		ExtraRoleParams:  extraRoleParams,
+	}
+	if c.Subject != nil {
+		createConfig.Subject = pki.Subject{
+			Country:            c.Subject.Country,
+			Locality:           c.Subject.Locality,
+			Organization:       c.Subject.Organization,
+			OrganizationalUnit: c.Subject.OrganizationalUnit,
+			Province:           c.Subject.Province,
+		}
+	}
+	for _, r := range c.NamedRoles {
+		roleConfig := pki.RoleConfig{
+			Name:             r.Name,
+			AllowedDomains:   strings.Join(r.AllowedDomains, ","),
+			AllowBareDomains: r.AllowBareDomains,
+			TTL:              r.TTL,
+		}
+		if len(r.KeyUsage) > 0 {
+			roleConfig.KeyUsage = r.KeyUsage
+		}
+		createConfig.Roles = append(createConfig.Roles, roleConfig)
+	}
+	return createConfig
+}
+
+// mountTuning returns the lease TTLs the PKI backend of the given cluster spec
+// is tuned with. Empty TTLs are zero, i.e. left as they are.
+func mountTuning(c ClusterSpec) (pki.MountTuning, error) {
+	var tuning pki.MountTuning
+	if c.Mount == nil {
+		return tuning, nil
+	}
+
+	var err error
+	if c.Mount.DefaultLeaseTTL != "" {
+		tuning.DefaultLeaseTTL, err = time.ParseDuration(c.Mount.DefaultLeaseTTL)
+		if err != nil {
+			return pki.MountTuning{}, maskAnyf(invalidConfigError, "cluster '%s': mount.default_lease_ttl: %s", c.ID, err.Error())
+		}
+	}
+	if c.Mount.MaxLeaseTTL != "" {
+		tuning.MaxLeaseTTL, err = time.ParseDuration(c.Mount.MaxLeaseTTL)
+		if err != nil {
+			return pki.MountTuning{}, maskAnyf(invalidConfigError, "cluster '%s': mount.max_lease_ttl: %s", c.ID, err.Error())
+		}
+	}
+
+	return tuning, nil
+}
+
+// mountChanges compares the live tuning of the PKI backend with the tuning
+// described by the given cluster spec.
+func mountChanges(live pki.MountTuning, c ClusterSpec) ([]Change, error) {
+	var changes []Change
+
+	desired, err := mountTuning(c)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if desired.DefaultLeaseTTL != 0 && desired.DefaultLeaseTTL != live.DefaultLeaseTTL {
+		changes = append(changes, Change{Field: "default_lease_ttl", Before: live.DefaultLeaseTTL.String(), After: desired.DefaultLeaseTTL.String()})
+	}
+	if desired.MaxLeaseTTL != 0 && desired.MaxLeaseTTL != live.MaxLeaseTTL {
+		changes = append(changes, Change{Field: "max_lease_ttl", Before: live.MaxLeaseTTL.String(), After: desired.MaxLeaseTTL.String()})
+	}
+
+	return changes, nil
+}
+
+// roleChanges compares the live role with the role described by the given
+// cluster spec.
+func roleChanges(role pki.Role, c ClusterSpec) ([]Change, error) {
+	var changes []Change
+
+	before, after := strings.Join(role.AllowedDomains, ","), strings.Join(c.Role.AllowedDomains, ",")
+	if before != after {
+		changes = append(changes, Change{Field: "allowed_domains", Before: before, After: after})
+	}
+	if role.AllowBareDomains != c.Role.AllowBareDomains {
+		changes = append(changes, Change{Field: "allow_bare_domains", Before: strconv.FormatBool(role.AllowBareDomains), After: strconv.FormatBool(c.Role.AllowBareDomains)})
+	}
+	ttl, err := time.ParseDuration(c.CATTL)
+	if err != nil {
+		return nil, maskAnyf(invalidConfigError, "cluster '%s': ca_ttl: %s", c.ID, err.Error())
+	}
+	if role.TTL != ttl {
+		changes = append(changes, Change{Field: "ttl", Before: role.TTL.String(), After: ttl.String()})
+	}
+	for k, v := range c.Role.Params {
+		live := formatValue(role.Data[k])
+		if !sameValue(live, v) {
+			changes = append(changes, Change{Field: k, Before: live, After: v})
+		}
+	}
+
+	return changes, nil
+}
+
+// namedRoleChanges compares the live named role with the given named role of
+// the given cluster spec. Everything besides the domains, TTL and key usage is
+// taken from the cluster's role.
+func namedRoleChanges(role pki.Role, c ClusterSpec, r NamedRoleSpec) ([]Change, error) {
+	desired := c
+	desired.Role.AllowedDomains = r.AllowedDomains
+	desired.Role.AllowBareDomains = r.AllowBareDomains
+	if r.TTL != "" {
+		if _, err := time.ParseDuration(r.TTL); err != nil {
+			return nil, maskAnyf(invalidConfigError, "cluster '%s': named_role '%s': ttl: %s", c.ID, r.Name, err.Error())
+		}
+		desired.CATTL = r.TTL
+	}
+
+	changes, err := roleChanges(role, desired)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if len(r.KeyUsage) > 0 {
+		before, after := formatValue(role.Data["key_usage"]), strings.Join(r.KeyUsage, ",")
+		if before != after {
+			changes = append(changes, Change{Field: "key_usage", Before: before, After: after})
+		}
+	}
+
+	return changes, nil
+}
+
+// formatValue formats a role value returned by Vault the way it is written in
+// a spec. Lists are comma separated.
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		var list []string
+		for _, i := range t {
+			list = append(list, fmt.Sprintf("%v", i))
+		}
+		return strings.Join(list, ",")
+	case json.Number:
+		return t.String()
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// sameValue compares a formatted live value with a desired value. Durations
+// are returned by Vault in seconds and are compared as durations.
+func sameValue(live, desired string) bool {
+	if live == desired {
+		return true
+	}
+	if d, err := time.ParseDuration(desired); err == nil {
+		if seconds, err := strconv.ParseInt(live, 10, 64); err == nil {
+			return time.Duration(seconds)*time.Second == d
+		}
+	}
+	if b, err := strconv.ParseBool(desired); err == nil {
+		if l, err := strconv.ParseBool(live); err == nil {
+			return b == l
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,263 @@
+package state
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+func (s *service) PlanSetup(config SetupConfig) (Plan, error) {
+	c := config.Create
+	var actions []Action
+
+	newAction := func(resource Resource, actionType ActionType, path string, changes []Change) {
+		actions = append(actions, Action{
+			ClusterID: c.ClusterID,
+			Resource:  resource,
+			Type:      actionType,
+			Path:      path,
+			Changes:   changes,
+		})
+	}
+
+	// Create uses the time remaining until --not-after as TTL, so the plan
+	// does the same.
+	if c.NotAfter != "" {
+		ttl, err := pki.NotAfterTTL(c.NotAfter, time.Now())
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		c.TTL = ttl.String()
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return Plan{}, maskAnyf(invalidConfigError, "cluster '%s': TTL '%s' is malformed", c.ClusterID, c.TTL)
+	}
+
+	mounted, err := s.PKIService.IsMounted(c.ClusterID)
+	if err != nil {
+		return Plan{}, maskAny(err)
+	}
+	if !mounted && c.UseExistingCA {
+		return Plan{}, maskAnyf(invalidConfigError, "cluster '%s': PKI backend not mounted, so there is no existing root CA", c.ClusterID)
+	}
+	if !mounted {
+		newAction(ResourceMount, ActionCreate, s.PKIService.MountPKIPath(c.ClusterID), nil)
+	} else if c.AutoTuneMount {
+		current, err := s.PKIService.MaxLeaseTTL(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		if current < ttl {
+			changes := []Change{{Field: "max_lease_ttl", Before: formatHours(current), After: formatHours(ttl)}}
+			newAction(ResourceMount, ActionUpdate, s.PKIService.MountPKIPath(c.ClusterID), changes)
+		}
+	}
+
+	caGenerated := false
+	if mounted {
+		caGenerated, err = s.PKIService.IsCAGenerated(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+	}
+	switch {
+	case c.KeyRef != "":
+		// A root CA issuer using the key is only generated in case no issuer
+		// uses it yet.
+		used := false
+		if mounted {
+			key, err := s.PKIService.GetKey(c.ClusterID, c.KeyRef)
+			if err != nil {
+				return Plan{}, maskAny(err)
+			}
+			used = key.Used()
+		}
+		if !used {
+			newAction(ResourceCA, ActionCreate, s.PKIService.GenerateIssuerPath(c.ClusterID), nil)
+		}
+	case !caGenerated && c.UseExistingCA:
+		return Plan{}, maskAnyf(invalidConfigError, "cluster '%s': PKI backend has no root CA to use", c.ClusterID)
+	case !caGenerated && c.CABundle != "":
+		newAction(ResourceCA, ActionCreate, s.PKIService.ImportCAPath(c.ClusterID), nil)
+	case !caGenerated:
+		newAction(ResourceCA, ActionCreate, s.PKIService.WriteCAPath(c.ClusterID), nil)
+	case c.RegenerateCAWithin > 0:
+		ca, err := s.PKIService.GetCA(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		now := time.Now()
+		if ca.NotAfter.Sub(now) < c.RegenerateCAWithin {
+			changes := []Change{{Field: "expiration", Before: ca.NotAfter.UTC().Format(time.RFC3339), After: now.Add(ttl).UTC().Format(time.RFC3339)}}
+			newAction(ResourceCA, ActionUpdate, s.PKIService.GenerateRootIssuerPath(c.ClusterID), changes)
+		}
+	}
+
+	roleCreated := false
+	if mounted {
+		roleCreated, err = s.PKIService.IsRoleCreated(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+	}
+	if !roleCreated {
+		newAction(ResourceRole, ActionCreate, s.PKIService.WriteRolePath(c.ClusterID), nil)
+	} else if config.Reconcile {
+		role, err := s.PKIService.GetRole(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		if changes := dataChanges(role.Data, pki.RoleData(c)); len(changes) > 0 {
+			newAction(ResourceRole, ActionUpdate, s.PKIService.WriteRolePath(c.ClusterID), changes)
+		}
+	}
+
+	for _, r := range c.Roles {
+		path := s.PKIService.NamedRolePath(c.ClusterID, r.Name)
+		created := false
+		if mounted {
+			created, err = s.PKIService.IsNamedRoleCreated(c.ClusterID, r.Name)
+			if err != nil {
+				return Plan{}, maskAny(err)
+			}
+		}
+		if !created {
+			newAction(ResourceRole, ActionCreate, path, nil)
+			continue
+		}
+		if !config.Reconcile {
+			continue
+		}
+		role, err := s.PKIService.GetNamedRole(c.ClusterID, r.Name)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		if changes := dataChanges(role.Data, pki.NamedRoleData(c, r)); len(changes) > 0 {
+			newAction(ResourceRole, ActionUpdate, path, changes)
+		}
+	}
+
+	if !config.SkipPolicy {
+		policyCreated, err := s.TokenService.IsPolicyCreated(c.ClusterID)
+		if err != nil {
+			return Plan{}, maskAny(err)
+		}
+		if !policyCreated {
+			newAction(ResourcePolicy, ActionCreate, s.TokenService.PolicyName(c.ClusterID), nil)
+		} else if config.Reconcile {
+			live, err := s.TokenService.GetPolicy(c.ClusterID)
+			if err != nil {
+				return Plan{}, maskAny(err)
+			}
+			desired, err := s.TokenService.PolicyRules(c.ClusterID)
+			if err != nil {
+				return Plan{}, maskAny(err)
+			}
+			if before, after := formatRules(live), formatRules(desired); before != after {
+				changes := []Change{{Field: "rules", Before: before, After: after}}
+				newAction(ResourcePolicy, ActionUpdate, s.TokenService.PolicyName(c.ClusterID), changes)
+			}
+		}
+	}
+
+	// Reconciling only generates tokens for clusters not set up yet, the same
+	// way as Plan, so running setup twice changes nothing the second time.
+	if config.NumTokens > 0 && (!config.Reconcile || !mounted) {
+		changes := []Change{{Field: "num", Before: "0", After: strconv.Itoa(config.NumTokens)}}
+		newAction(ResourceTokens, ActionCreate, "auth/token/create", changes)
+	}
+
+	return Plan{Actions: actions}, nil
+}
+
+func (s *service) ApplySetup(config SetupConfig, plan Plan) error {
+	c := config.Create
+
+	for _, a := range plan.Actions {
+		if a.Type != ActionUpdate {
+			continue
+		}
+
+		switch {
+		case a.Resource == ResourceRole && a.Path == s.PKIService.WriteRolePath(c.ClusterID):
+			err := s.PKIService.UpdateRole(c)
+			if err != nil {
+				return maskAny(err)
+			}
+		case a.Resource == ResourceRole:
+			for _, r := range c.Roles {
+				if a.Path != s.PKIService.NamedRolePath(c.ClusterID, r.Name) {
+					continue
+				}
+				err := s.PKIService.UpdateNamedRole(c, r.Name)
+				if err != nil {
+					return maskAny(err)
+				}
+			}
+		case a.Resource == ResourcePolicy:
+			err := s.TokenService.CreatePolicy(c.ClusterID)
+			if err != nil {
+				return maskAny(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dataChanges compares the live data of a role with the data it would be
+// written with, field by field in alphabetical order. Fields Vault returns but
+// certctl does not write are not compared.
+func dataChanges(live, desired map[string]interface{}) []Change {
+	var keys []string
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changes []Change
+	for _, k := range keys {
+		after := formatDesired(desired[k])
+		before := formatValue(live[k])
+		if sameValue(before, after) {
+			continue
+		}
+		// Vault returns durations in seconds, which are shown the way they are
+		// written instead.
+		if _, err := time.ParseDuration(after); err == nil {
+			if seconds, err := strconv.ParseInt(before, 10, 64); err == nil {
+				before = formatHours(time.Duration(seconds) * time.Second)
+			}
+		}
+		changes = append(changes, Change{Field: k, Before: before, After: after})
+	}
+
+	return changes
+}
+
+// formatDesired formats a value of the data a role is written with the same
+// way formatValue formats the values returned by Vault.
+func formatDesired(v interface{}) string {
+	if list, ok := v.([]string); ok {
+		return strings.Join(list, ",")
+	}
+
+	return formatValue(v)
+}
+
+// formatRules formats the given policy rules on a single line, so rules only
+// differing in indentation or empty lines are considered equal.
+func formatRules(rules string) string {
+	var lines []string
+	for _, l := range strings.Split(rules, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return strings.Join(lines, " ")
+}
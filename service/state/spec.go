@@ -0,0 +1,264 @@
+package state
+
+import (
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+// Spec describes the desired state of the PKI setup of one or more clusters.
+// It is read from HCL or JSON files like the following.
+//
+//	cluster "foo" {
+//	  common_name = "foo.example.com"
+//	  ca_ttl      = "86400h"
+//
+//	  role {
+//	    allowed_domains    = ["foo.example.com"]
+//	    allow_bare_domains = false
+//	  }
+//
+//	  tokens {
+//	    num = 2
+//	    ttl = "720h"
+//	  }
+//	}
+type Spec struct {
+	// Clusters are the clusters being reconciled.
+	Clusters []ClusterSpec `hcl:"cluster" json:"cluster"`
+}
+
+// ClusterSpec describes the desired state of the PKI backend of a cluster.
+type ClusterSpec struct {
+	// ID is the cluster ID. It is given as label of the cluster block.
+	ID string `hcl:",key" json:"-"`
+
+	// CommonName is the common name of the cluster's root CA.
+	CommonName string `hcl:"common_name" json:"common_name"`
+
+	// CATTL is the time to live of the cluster's root CA. Defaults to 86400h.
+	CATTL string `hcl:"ca_ttl" json:"ca_ttl"`
+
+	// Subject describes additional components of the subject of the cluster's
+	// root CA. Like the common name, it is only used to generate the root CA.
+	Subject *SubjectSpec `hcl:"subject" json:"subject,omitempty"`
+
+	// Mount describes the tuning of the cluster's PKI backend. Nil leaves the
+	// tuning as it is.
+	Mount *MountSpec `hcl:"mount" json:"mount,omitempty"`
+
+	// Role describes the PKI role of the cluster.
+	Role RoleSpec `hcl:"role" json:"role"`
+
+	// NamedRoles describe PKI roles created in addition to the cluster's role,
+	// e.g. separate server and client roles having different domain policies.
+	NamedRoles []NamedRoleSpec `hcl:"named_role" json:"named_role,omitempty"`
+
+	// PolicyRules are the rules of the PKI issue policy of the cluster. Empty
+	// means the rules certctl generates for the cluster.
+	PolicyRules string `hcl:"policy_rules" json:"policy_rules,omitempty"`
+
+	// Tokens describes the tokens generated for the cluster.
+	Tokens TokensSpec `hcl:"tokens" json:"tokens"`
+}
+
+// SubjectSpec describes subject components of a root CA besides its common
+// name. Empty components are left out.
+type SubjectSpec struct {
+	Country            string `hcl:"country" json:"country,omitempty"`
+	Locality           string `hcl:"locality" json:"locality,omitempty"`
+	Organization       string `hcl:"organization" json:"organization,omitempty"`
+	OrganizationalUnit string `hcl:"ou" json:"ou,omitempty"`
+	Province           string `hcl:"province" json:"province,omitempty"`
+}
+
+// MountSpec describes the lease TTLs the PKI backend of a cluster is tuned
+// with. Empty TTLs are left as they are.
+type MountSpec struct {
+	DefaultLeaseTTL string `hcl:"default_lease_ttl" json:"default_lease_ttl,omitempty"`
+	MaxLeaseTTL     string `hcl:"max_lease_ttl" json:"max_lease_ttl,omitempty"`
+}
+
+// RoleSpec describes the desired state of the PKI role of a cluster.
+type RoleSpec struct {
+	// AllowedDomains are the domains the role allows to issue certificates for.
+	AllowedDomains []string `hcl:"allowed_domains" json:"allowed_domains"`
+
+	// AllowBareDomains is the allow_bare_domains option of the role.
+	AllowBareDomains bool `hcl:"allow_bare_domains" json:"allow_bare_domains"`
+
+	// Params are additional role parameters, see CreateConfig.ExtraRoleParams in
+	// the pki package.
+	Params map[string]string `hcl:"params" json:"params,omitempty"`
+}
+
+// NamedRoleSpec describes the desired state of a named PKI role of a cluster.
+// Its params are taken from the cluster's role.
+type NamedRoleSpec struct {
+	// Name is the name of the role. It is given as label of the named_role
+	// block.
+	Name string `hcl:",key" json:"-"`
+
+	// AllowedDomains are the domains the role allows to issue certificates for.
+	AllowedDomains []string `hcl:"allowed_domains" json:"allowed_domains"`
+
+	// AllowBareDomains is the allow_bare_domains option of the role.
+	AllowBareDomains bool `hcl:"allow_bare_domains" json:"allow_bare_domains"`
+
+	// TTL is the time to live of certificates issued using the role. Defaults
+	// to the ca_ttl of the cluster, like the cluster's role.
+	TTL string `hcl:"ttl" json:"ttl,omitempty"`
+
+	// KeyUsage are the key usages of certificates issued using the role.
+	// Empty means Vault's default.
+	KeyUsage []string `hcl:"key_usage" json:"key_usage,omitempty"`
+}
+
+// TokensSpec describes the tokens generated for a cluster. Tokens are secret
+// and cannot be read back from Vault. They are only generated together with
+// the creation of the cluster's PKI backend.
+type TokensSpec struct {
+	// Num is the number of tokens generated. Defaults to 0.
+	Num int `hcl:"num" json:"num"`
+
+	// TTL is the time to live of the generated tokens. Defaults to 720h.
+	TTL string `hcl:"ttl" json:"ttl"`
+
+	// Policies are the policies attached to the tokens. Defaults to the PKI
+	// issue policy of the cluster.
+	Policies []string `hcl:"policies" json:"policies,omitempty"`
+}
+
+// ActionType describes what is done with a resource.
+type ActionType string
+
+const (
+	// ActionCreate creates a missing resource.
+	ActionCreate ActionType = "create"
+	// ActionUpdate updates a resource not matching the spec.
+	ActionUpdate ActionType = "update"
+)
+
+// Resource names a kind of resource managed for a cluster.
+type Resource string
+
+const (
+	ResourceMount  Resource = "mount"
+	ResourceCA     Resource = "ca"
+	ResourceRole   Resource = "role"
+	ResourcePolicy Resource = "policy"
+	ResourceTokens Resource = "tokens"
+)
+
+// Change describes the difference of a single field of a resource.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Action describes a single change applied to Vault.
+type Action struct {
+	ClusterID string     `json:"cluster_id"`
+	Resource  Resource   `json:"resource"`
+	Type      ActionType `json:"action"`
+	Path      string     `json:"path"`
+	Changes   []Change   `json:"changes,omitempty"`
+}
+
+// Plan is the list of actions necessary to reconcile Vault with a spec.
+type Plan struct {
+	Actions []Action `json:"actions"`
+
+	// Warnings describe PKI roles of the spec whose domain options contradict
+	// each other. See pki.Role.DomainWarnings. They do not prevent applying
+	// the plan.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ApplyConfig is used to configure applying a plan using Service.Apply.
+type ApplyConfig struct {
+	// Spec is the spec the plan was computed for.
+	Spec Spec
+
+	// Plan is the plan being applied.
+	Plan Plan
+
+	// ContinueOnError configures clusters failing to be reconciled to be
+	// recorded as failures of the result, so the remaining clusters are still
+	// reconciled. Otherwise applying stops at the first failing cluster.
+	ContinueOnError bool
+}
+
+// SetupConfig describes a run of setup, whose changes are planned using
+// Service.PlanSetup.
+type SetupConfig struct {
+	// Create is the configuration setup creates the PKI backend with.
+	Create pki.CreateConfig
+
+	// NumTokens is the number of tokens setup generates.
+	NumTokens int
+
+	// SkipPolicy configures the PKI issue policy to be left alone, because the
+	// policies of the tokens are managed by the operator.
+	SkipPolicy bool
+
+	// Reconcile configures existing roles and the PKI issue policy to be
+	// updated to match the configuration, and tokens to only be generated for
+	// clusters not set up yet. Otherwise existing resources are left as they
+	// are and tokens are generated on every run.
+	Reconcile bool
+}
+
+// Result is the outcome of applying a plan.
+type Result struct {
+	// Plan is the plan that has been applied. Actions of failed clusters are
+	// not part of it.
+	Plan Plan `json:"plan"`
+
+	// Tokens maps cluster IDs to the tokens generated for them, including the
+	// ones generated for a failed cluster before it failed.
+	Tokens map[string][]string `json:"tokens,omitempty"`
+
+	// Failures are the clusters which failed to be reconciled when using
+	// ApplyConfig.ContinueOnError, in the order of the spec. Their actions may
+	// have been applied partially.
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// Failure describes a cluster failing to be reconciled.
+type Failure struct {
+	ClusterID string `json:"cluster_id"`
+	Err       error  `json:"-"`
+}
+
+// Service reconciles the PKI setup in Vault with a declarative spec.
+type Service interface {
+	// Plan computes the actions necessary to reconcile Vault with the given
+	// spec without changing anything.
+	Plan(spec Spec) (Plan, error)
+
+	// Apply executes the plan of the given configuration computed for its
+	// spec, cluster by cluster. In case it fails, the returned result holds
+	// what has been applied before, including the tokens generated.
+	Apply(config ApplyConfig) (Result, error)
+
+	// Export reads the PKI setup of the given cluster ID from Vault and
+	// describes it as cluster spec, so it can be applied elsewhere. Secrets,
+	// like the private key of the root CA and tokens, are not exported.
+	Export(clusterID string) (ClusterSpec, error)
+
+	// DiffRole compares the live PKI role of the given cluster spec's ID with
+	// the role described by the spec field by field. Changes having an empty
+	// before value are additions, changes having an empty after value are
+	// removals. No changes means the role did not drift.
+	DiffRole(c ClusterSpec) ([]Change, error)
+
+	// PlanSetup computes the actions setup executes for the given
+	// configuration against the current state of the cluster, without
+	// changing anything. Role updates list the changes field by field.
+	PlanSetup(config SetupConfig) (Plan, error)
+
+	// ApplySetup executes the update actions of the given plan computed by
+	// PlanSetup, i.e. updates existing roles and the PKI issue policy. Missing
+	// resources are created by setup itself.
+	ApplySetup(config SetupConfig, plan Plan) error
+}
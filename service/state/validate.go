@@ -0,0 +1,350 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+
+	"github.com/giantswarm/certctl/service/pki"
+)
+
+// keySchema describes the keys known within a block of a spec file.
+type keySchema struct {
+	// Fields are the keys known within the block. Attributes have no fields.
+	Fields map[string]keySchema
+
+	// Labeled tells whether blocks of the key carry a label, e.g. the cluster
+	// ID of cluster blocks.
+	Labeled bool
+
+	// Open tells whether any key is allowed within the block, e.g. role
+	// params.
+	Open bool
+}
+
+// specSchema describes the keys of the spec file decoded into Spec.
+var specSchema = keySchema{
+	Fields: map[string]keySchema{
+		"cluster": {
+			Labeled: true,
+			Fields: map[string]keySchema{
+				"common_name": {},
+				"ca_ttl":      {},
+				"subject": {
+					Fields: map[string]keySchema{
+						"country":      {},
+						"locality":     {},
+						"organization": {},
+						"ou":           {},
+						"province":     {},
+					},
+				},
+				"mount": {
+					Fields: map[string]keySchema{
+						"default_lease_ttl": {},
+						"max_lease_ttl":     {},
+					},
+				},
+				"policy_rules": {},
+				"role": {
+					Fields: map[string]keySchema{
+						"allowed_domains":    {},
+						"allow_bare_domains": {},
+						"params":             {Open: true},
+					},
+				},
+				"named_role": {
+					Labeled: true,
+					Fields: map[string]keySchema{
+						"allowed_domains":    {},
+						"allow_bare_domains": {},
+						"ttl":                {},
+						"key_usage":          {},
+					},
+				},
+				"tokens": {
+					Fields: map[string]keySchema{
+						"num":      {},
+						"ttl":      {},
+						"policies": {},
+					},
+				},
+			},
+		},
+	},
+}
+
+// ValidateFile checks the spec file at the given path without contacting
+// Vault. In addition to Validate, keys not known by the spec are reported, as
+// they are ignored otherwise, e.g. when misspelled. All problems found are
+// returned.
+func ValidateFile(path string) []error {
+	b, err := readFile(path)
+	if err != nil {
+		return []error{maskAny(err)}
+	}
+
+	file, err := hcl.ParseBytes(b)
+	if err != nil {
+		return []error{maskAnyf(invalidConfigError, "%s", err.Error())}
+	}
+	var errs []error
+	if list, ok := file.Node.(*ast.ObjectList); ok {
+		errs = append(errs, unknownKeys(list, keyContext{Schema: specSchema})...)
+	}
+
+	spec, err := Parse(b)
+	if err != nil {
+		return append(errs, maskAny(err))
+	}
+
+	return append(errs, Validate(spec)...)
+}
+
+// Validate checks the given spec without contacting Vault. It reports all
+// problems found, e.g. missing fields, malformed durations and domains,
+// duplicate cluster IDs and role params conflicting with typed fields.
+func Validate(spec Spec) []error {
+	var errs []error
+
+	seen := map[string]bool{}
+	for i, c := range spec.Clusters {
+		if c.ID == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster %d: cluster ID must not be empty", i+1))
+			continue
+		}
+		if seen[c.ID] {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': cluster ID must be unique", c.ID))
+		}
+		seen[c.ID] = true
+
+		errs = append(errs, validateCluster(c)...)
+	}
+
+	return errs
+}
+
+func validateCluster(c ClusterSpec) []error {
+	var errs []error
+
+	// The cluster ID is part of the path of the PKI backend, pki-<cluster-id>.
+	if strings.ContainsAny(c.ID, " \t/") {
+		errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': cluster ID must not contain whitespace or slashes", c.ID))
+	}
+	if c.CommonName == "" {
+		errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': common_name must not be empty", c.ID))
+	}
+	if err := validateDuration(c.ID, "ca_ttl", c.CATTL); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Mount != nil && c.Mount.DefaultLeaseTTL != "" {
+		if err := validateDuration(c.ID, "mount.default_lease_ttl", c.Mount.DefaultLeaseTTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Mount != nil && c.Mount.MaxLeaseTTL != "" {
+		if err := validateDuration(c.ID, "mount.max_lease_ttl", c.Mount.MaxLeaseTTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.Role.AllowedDomains) == 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': allowed_domains must not be empty", c.ID))
+	}
+	for _, d := range c.Role.AllowedDomains {
+		if strings.TrimSpace(d) == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': allowed_domains must not contain empty domains", c.ID))
+		} else if strings.ContainsAny(d, " \t/:,") {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': allowed_domains contains invalid domain '%s'", c.ID, d))
+		}
+	}
+	for _, k := range pki.OverriddenRoleParams(pkiCreateConfig(c)) {
+		errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': params.%s conflicts with the role field managing it", c.ID, k))
+	}
+	if v, ok := c.Role.Params["require_cn"]; ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': params.require_cn must be a boolean", c.ID))
+		}
+	}
+
+	errs = append(errs, validateNamedRoles(c)...)
+
+	if c.Tokens.Num < 0 {
+		errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': tokens.num must not be negative", c.ID))
+	}
+	if err := validateDuration(c.ID, "tokens.ttl", c.Tokens.TTL); err != nil {
+		errs = append(errs, err)
+	}
+	for _, p := range c.Tokens.Policies {
+		if strings.TrimSpace(p) == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': tokens.policies must not contain empty policy names", c.ID))
+		}
+	}
+
+	return errs
+}
+
+// validateNamedRoles checks every named role of the given cluster on its own,
+// so problems are reported per role.
+func validateNamedRoles(c ClusterSpec) []error {
+	var errs []error
+
+	seen := map[string]bool{}
+	for i, r := range c.NamedRoles {
+		if r.Name == "" {
+			errs = append(errs, maskAnyf(invalidConfigError, "cluster '%s': named_role %d: name must not be empty", c.ID, i+1))
+			continue
+		}
+		prefix := fmt.Sprintf("cluster '%s': named_role '%s'", c.ID, r.Name)
+		if seen[r.Name] {
+			errs = append(errs, maskAnyf(invalidConfigError, "%s: name must be unique", prefix))
+		}
+		seen[r.Name] = true
+		if strings.ContainsAny(r.Name, " \t/") {
+			errs = append(errs, maskAnyf(invalidConfigError, "%s: name must not contain whitespace or slashes", prefix))
+		}
+		// The cluster's role is registered as role-<cluster-id>.
+		if r.Name == "role-"+c.ID {
+			errs = append(errs, maskAnyf(invalidConfigError, "%s: name is used by the cluster's role", prefix))
+		}
+
+		if len(r.AllowedDomains) == 0 {
+			errs = append(errs, maskAnyf(invalidConfigError, "%s: allowed_domains must not be empty", prefix))
+		}
+		for _, d := range r.AllowedDomains {
+			if strings.TrimSpace(d) == "" {
+				errs = append(errs, maskAnyf(invalidConfigError, "%s: allowed_domains must not contain empty domains", prefix))
+			} else if strings.ContainsAny(d, " \t/:,") {
+				errs = append(errs, maskAnyf(invalidConfigError, "%s: allowed_domains contains invalid domain '%s'", prefix, d))
+			}
+		}
+		if r.TTL != "" {
+			if err := validateDuration(c.ID, fmt.Sprintf("named_role '%s' ttl", r.Name), r.TTL); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, u := range r.KeyUsage {
+			if strings.TrimSpace(u) == "" {
+				errs = append(errs, maskAnyf(invalidConfigError, "%s: key_usage must not contain empty key usages", prefix))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateDuration checks that the given field of the given cluster holds a
+// positive golang time string having a unit.
+func validateDuration(clusterID, field, value string) error {
+	if _, err := strconv.Atoi(value); err == nil {
+		return maskAnyf(invalidConfigError, "cluster '%s': %s must include a unit like %sh", clusterID, field, value)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "cluster '%s': %s must be a duration like 720h", clusterID, field)
+	}
+	if d <= 0 {
+		return maskAnyf(invalidConfigError, "cluster '%s': %s must be positive", clusterID, field)
+	}
+
+	return nil
+}
+
+// keyContext is the position within a spec file while looking for unknown
+// keys.
+type keyContext struct {
+	Schema    keySchema
+	ClusterID string
+	Path      []string
+
+	// NeedLabel tells whether the next key is the label of a labeled block.
+	NeedLabel bool
+}
+
+// unknownKeys returns an error for every key of the given list not known by
+// the schema of the given context. HCL blocks carry their labels and nested
+// keys as multiple keys of one item, while JSON documents nest them as objects,
+// so both are resolved key by key.
+func unknownKeys(list *ast.ObjectList, ctx keyContext) []error {
+	var errs []error
+
+	for _, item := range list.Items {
+		c := ctx
+		known := true
+		for _, k := range item.Keys {
+			name := keyName(k)
+			if c.NeedLabel {
+				// Labels of blocks within cluster blocks, e.g. named roles,
+				// are part of the path of their keys.
+				if c.ClusterID == "" {
+					c.ClusterID = name
+				} else {
+					c.Path = append(append([]string{}, c.Path...), name)
+				}
+				c.NeedLabel = false
+				continue
+			}
+			if c.Schema.Open {
+				break
+			}
+			f, ok := c.Schema.Fields[name]
+			if !ok {
+				errs = append(errs, unknownKeyError(c, name))
+				known = false
+				break
+			}
+			c.Schema = f
+			c.Path = append(append([]string{}, c.Path...), name)
+			c.NeedLabel = f.Labeled
+		}
+		if known {
+			errs = append(errs, unknownValueKeys(item.Val, c)...)
+		}
+	}
+
+	return errs
+}
+
+// unknownValueKeys returns an error for every unknown key of the objects
+// within the given value.
+func unknownValueKeys(n ast.Node, ctx keyContext) []error {
+	switch t := n.(type) {
+	case *ast.ObjectType:
+		if ctx.Schema.Open || (ctx.Schema.Fields == nil && !ctx.NeedLabel) {
+			return nil
+		}
+		return unknownKeys(t.List, ctx)
+	case *ast.ListType:
+		var errs []error
+		for _, e := range t.List {
+			errs = append(errs, unknownValueKeys(e, ctx)...)
+		}
+		return errs
+	}
+
+	return nil
+}
+
+func unknownKeyError(ctx keyContext, name string) error {
+	key := strings.Join(append(append([]string{}, ctx.Path...), name), ".")
+	if ctx.ClusterID != "" {
+		// The path of keys within a cluster block starts below it.
+		key = strings.TrimPrefix(key, "cluster.")
+		return maskAnyf(invalidConfigError, "cluster '%s': unknown key '%s'", ctx.ClusterID, key)
+	}
+
+	return maskAnyf(invalidConfigError, "unknown key '%s'", key)
+}
+
+// keyName returns the unquoted name of the given key.
+func keyName(k *ast.ObjectKey) string {
+	if s, ok := k.Token.Value().(string); ok {
+		return s
+	}
+
+	return fmt.Sprintf("%v", k.Token.Value())
+}
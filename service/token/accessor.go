@@ -0,0 +1,196 @@
+package token
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func (s *service) ListAccessors(clusterID string) ([]string, error) {
+	tokens, err := s.clusterTokens(clusterID)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var accessors []string
+	for a := range tokens {
+		accessors = append(accessors, a)
+	}
+	sort.Strings(accessors)
+
+	return accessors, nil
+}
+
+// MaxConventionLookups is the maximum number of tokens ReadConvention looks up
+// to find the existing tokens of a cluster.
+const MaxConventionLookups = 100
+
+func (s *service) ReadConvention(clusterID string) (_ Convention, _ bool, err error) {
+	span := s.Tracer.StartOperation("token read convention", map[string]string{"certctl.cluster_id": clusterID})
+	defer func() { span.End(err) }()
+
+	var warnings []string
+
+	accessors, err := s.listAccessors()
+	if IsPermissionDenied(err) {
+		warnings = append(warnings, "token may not list token accessors, which requires sudo, so existing tokens are not read")
+		accessors = nil
+	} else if err != nil {
+		return Convention{}, false, maskAny(err)
+	}
+	if len(accessors) > MaxConventionLookups {
+		warnings = append(warnings, fmt.Sprintf("Vault holds %d tokens, more than the at most %d tokens looked up, so existing tokens are not read", len(accessors), MaxConventionLookups))
+		accessors = nil
+	}
+
+	tokens, err := s.lookupClusterTokens(clusterID, accessors)
+	if err != nil {
+		return Convention{}, false, maskAny(err)
+	}
+	if len(tokens) > 0 {
+		convention := Convention{
+			Source:   fmt.Sprintf("%d existing token(s)", len(tokens)),
+			Warnings: warnings,
+		}
+		// Jittered TTLs only ever shorten tokens, so the longest TTL is the one
+		// the tokens were requested with. Policies and max TTLs are taken from
+		// the most recently created token.
+		var newest time.Time
+		for _, data := range tokens {
+			if ttl := toDuration(data["creation_ttl"]); ttl > convention.TTL {
+				convention.TTL = ttl
+			}
+			created := toUnixTime(data["creation_time"])
+			if newest.IsZero() || created.After(newest) {
+				newest = created
+				convention.MaxTTL = toDuration(data["explicit_max_ttl"])
+				convention.Policies = withoutDefaultPolicy(toStringList(data["policies"]))
+			}
+		}
+		return convention, true, nil
+	}
+
+	// Create a client for the logical backend to read the token role.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.RolePath(clusterID))
+	if IsPermissionDenied(err) {
+		warnings = append(warnings, fmt.Sprintf("token may not read token role '%s', so the defaults are used", s.RoleName(clusterID)))
+		return Convention{Warnings: warnings}, false, nil
+	} else if err != nil {
+		return Convention{}, false, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return Convention{Warnings: warnings}, false, nil
+	}
+	convention := Convention{
+		Source:   fmt.Sprintf("token role '%s'", s.RoleName(clusterID)),
+		Warnings: warnings,
+		TTL:      toDuration(secret.Data["token_ttl"]),
+		MaxTTL:   toDuration(secret.Data["explicit_max_ttl"]),
+		Policies: toStringList(secret.Data["allowed_policies"]),
+	}
+	if convention.MaxTTL == 0 {
+		convention.MaxTTL = toDuration(secret.Data["token_explicit_max_ttl"])
+	}
+
+	return convention, true, nil
+}
+
+func (s *service) RevokeAccessors(accessors []string) (err error) {
+	span := s.Tracer.StartOperation("token revoke accessors", map[string]string{"certctl.accessors": strconv.Itoa(len(accessors))})
+	defer func() { span.End(err) }()
+
+	// Get the token auth backend to revoke tokens.
+	tokenAuth := s.VaultClient.Auth().Token()
+
+	for _, a := range accessors {
+		err := tokenAuth.RevokeAccessor(a)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// clusterTokens looks up all tokens of the given cluster ID, which are
+// identified by their cluster-id metadata. It returns the lookup data of the
+// tokens by accessor.
+func (s *service) clusterTokens(clusterID string) (map[string]map[string]interface{}, error) {
+	accessors, err := s.listAccessors()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	tokens, err := s.lookupClusterTokens(clusterID, accessors)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	return tokens, nil
+}
+
+// listAccessors lists the accessors of all tokens held by Vault.
+func (s *service) listAccessors() ([]string, error) {
+	// Create a client for the logical backend to list token accessors.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.List("auth/token/accessors")
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	keys, _ := secret.Data["keys"].([]interface{})
+
+	var accessors []string
+	for _, k := range keys {
+		if accessor, ok := k.(string); ok {
+			accessors = append(accessors, accessor)
+		}
+	}
+
+	return accessors, nil
+}
+
+// lookupClusterTokens looks up the tokens of the given accessors and returns
+// the lookup data of the ones belonging to the given cluster ID by accessor.
+func (s *service) lookupClusterTokens(clusterID string, accessors []string) (map[string]map[string]interface{}, error) {
+	// Get the token auth backend to look up the tokens of the accessors.
+	tokenAuth := s.VaultClient.Auth().Token()
+
+	tokens := map[string]map[string]interface{}{}
+	for _, accessor := range accessors {
+		secret, err := tokenAuth.LookupAccessor(accessor)
+		if IsInvalidAccessor(err) {
+			// The token expired or was revoked after listing the accessors.
+			continue
+		} else if err != nil {
+			return nil, maskAny(err)
+		}
+		if secret == nil || secret.Data == nil {
+			continue
+		}
+		meta, _ := secret.Data["meta"].(map[string]interface{})
+		if id, _ := meta["cluster-id"].(string); id == clusterID {
+			tokens[accessor] = secret.Data
+		}
+	}
+
+	return tokens, nil
+}
+
+// withoutDefaultPolicy returns the given policies without the default policy,
+// which Vault attaches to tokens on its own.
+func withoutDefaultPolicy(policies []string) []string {
+	var result []string
+	for _, p := range policies {
+		if p != "default" {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,59 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toDuration normalizes durations returned by the Vault API. They are decoded
+// JSON numbers of seconds, but depending on the Vault version may also be
+// encoded as strings.
+func toDuration(v interface{}) time.Duration {
+	switch t := v.(type) {
+	case json.Number:
+		i, _ := t.Int64()
+		return time.Duration(i) * time.Second
+	case float64:
+		return time.Duration(t) * time.Second
+	case int:
+		return time.Duration(t) * time.Second
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return time.Duration(i) * time.Second
+		}
+		d, _ := time.ParseDuration(t)
+		return d
+	}
+
+	return 0
+}
+
+// toUnixTime normalizes timestamps returned by the Vault API as seconds since
+// the Unix epoch, e.g. the creation time of tokens.
+func toUnixTime(v interface{}) time.Time {
+	return time.Unix(int64(toDuration(v)/time.Second), 0)
+}
+
+func toStringList(v interface{}) []string {
+	var list []string
+
+	switch t := v.(type) {
+	case []interface{}:
+		for _, i := range t {
+			list = append(list, fmt.Sprintf("%v", i))
+		}
+	case []string:
+		list = append(list, t...)
+	case string:
+		for _, i := range strings.Split(t, ",") {
+			if i = strings.TrimSpace(i); i != "" {
+				list = append(list, i)
+			}
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,119 @@
+package token
+
+import (
+	"fmt"
+)
+
+func (s *service) CreateEntity(clusterID string) (string, error) {
+	// Create a client for the logical backend to manage identities.
+	logicalBackend := s.VaultClient.Logical()
+
+	// Writing the entity by name creates it or updates it in case it exists,
+	// which only returns the entity on creation.
+	_, err := logicalBackend.Write(s.EntityPath(clusterID), map[string]interface{}{
+		"metadata": map[string]string{
+			"cluster-id": clusterID,
+		},
+	})
+	if err != nil {
+		return "", maskAny(err)
+	}
+	secret, err := logicalBackend.Read(s.EntityPath(clusterID))
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if secret == nil {
+		return "", maskAnyf(entityNotFoundError, "entity '%s'", s.EntityName(clusterID))
+	}
+	entityID, _ := secret.Data["id"].(string)
+	if entityID == "" {
+		return "", maskAnyf(entityNotFoundError, "entity '%s' has no ID", s.EntityName(clusterID))
+	}
+
+	// Aliases belong to the token auth backend, so tokens created with the
+	// alias name are associated with the entity.
+	accessor, err := s.tokenAuthAccessor()
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	// The combination of alias name and mount can only be used once, so the
+	// alias is only created in case no entity has it yet.
+	secret, err = logicalBackend.Write("identity/lookup/entity", map[string]interface{}{
+		"alias_name":           s.EntityName(clusterID),
+		"alias_mount_accessor": accessor,
+	})
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if secret != nil {
+		if id, _ := secret.Data["id"].(string); id != entityID {
+			return "", maskAnyf(invalidConfigError, "entity alias '%s' belongs to another entity '%s'", s.EntityName(clusterID), id)
+		}
+		return entityID, nil
+	}
+
+	_, err = logicalBackend.Write("identity/entity-alias", map[string]interface{}{
+		"name":           s.EntityName(clusterID),
+		"canonical_id":   entityID,
+		"mount_accessor": accessor,
+	})
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return entityID, nil
+}
+
+func (s *service) DeleteEntity(clusterID string) error {
+	// Create a client for the logical backend to manage identities.
+	logicalBackend := s.VaultClient.Logical()
+
+	// Deleting the entity deletes its aliases as well.
+	_, err := logicalBackend.Delete(s.EntityPath(clusterID))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) IsEntityCreated(clusterID string) (bool, error) {
+	// Create a client for the logical backend to manage identities.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.EntityPath(clusterID))
+	if err != nil {
+		return false, maskAny(err)
+	}
+
+	return secret != nil, nil
+}
+
+// tokenAuthAccessor returns the accessor of the token auth backend.
+func (s *service) tokenAuthAccessor() (string, error) {
+	// Create a client for the logical backend to read the auth backends.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read("sys/auth")
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if secret != nil {
+		if mount, ok := secret.Data["token/"].(map[string]interface{}); ok {
+			if accessor, _ := mount["accessor"].(string); accessor != "" {
+				return accessor, nil
+			}
+		}
+	}
+
+	return "", maskAnyf(entityNotFoundError, "accessor of the token auth backend not found")
+}
+
+func (s *service) EntityName(clusterID string) string {
+	return fmt.Sprintf("certctl-%s", clusterID)
+}
+
+func (s *service) EntityPath(clusterID string) string {
+	return fmt.Sprintf("identity/entity/name/%s", s.EntityName(clusterID))
+}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/juju/errgo"
 )
@@ -35,3 +36,41 @@ var policyAlreadyExistsError = errgo.New("policy already exists")
 func IsPolicyAlreadyExists(err error) bool {
 	return errgo.Cause(err) == policyAlreadyExistsError
 }
+
+var roleNotFoundError = errgo.New("role not found")
+
+// IsRoleNotFound asserts roleNotFoundError.
+func IsRoleNotFound(err error) bool {
+	return errgo.Cause(err) == roleNotFoundError
+}
+
+var entityNotFoundError = errgo.New("entity not found")
+
+// IsEntityNotFound asserts entityNotFoundError.
+func IsEntityNotFound(err error) bool {
+	return errgo.Cause(err) == entityNotFoundError
+}
+
+// IsInvalidAccessor checks whether the given error is Vault rejecting a token
+// accessor, e.g. because its token expired or was revoked.
+func IsInvalidAccessor(err error) bool {
+	cause := errgo.Cause(err)
+
+	if cause != nil && strings.Contains(cause.Error(), "invalid accessor") {
+		return true
+	}
+
+	return false
+}
+
+// IsPermissionDenied checks whether the given error is Vault denying a request
+// due to missing permissions, e.g. listing token accessors without sudo.
+func IsPermissionDenied(err error) bool {
+	cause := errgo.Cause(err)
+
+	if cause != nil && strings.Contains(cause.Error(), "Code: 403") {
+		return true
+	}
+
+	return false
+}
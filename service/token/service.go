@@ -1,17 +1,30 @@
 package token
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"time"
 
 	"github.com/giantswarm/go-uuid/uuid"
 	vaultclient "github.com/hashicorp/vault/api"
+
+	"github.com/giantswarm/certctl/service/tracing"
 )
 
 // ServiceConfig represents the configuration used to create a new service.
 type ServiceConfig struct {
 	// Dependencies.
+	Tracer      *tracing.Tracer
 	VaultClient *vaultclient.Client
+
+	// Settings.
+
+	// SharedMount is the path of a PKI backend shared by all clusters, each
+	// having a PKI role of its own. Empty means every cluster has a PKI
+	// backend of its own mounted at pki-<clusterID>.
+	SharedMount string
 }
 
 // DefaultServiceConfig provides a default configuration to create a service.
@@ -26,7 +39,11 @@ func DefaultServiceConfig() ServiceConfig {
 
 	newConfig := ServiceConfig{
 		// Dependencies.
+		Tracer:      nil,
 		VaultClient: newVaultClient,
+
+		// Settings.
+		SharedMount: "",
 	}
 
 	return newConfig
@@ -50,59 +67,228 @@ type service struct {
 	ServiceConfig
 }
 
-func (s *service) Create(config CreateConfig) ([]string, error) {
-	// In case there does no policy exist that allows to issue certificates on a
-	// PKI backend, create one.
-	created, err := s.IsPolicyCreated(config.ClusterID)
+func (s *service) Create(config CreateConfig) (CreateResult, error) {
+	span := s.Tracer.StartOperation("token create", map[string]string{"certctl.cluster_id": config.ClusterID})
+	result, err := s.create(config, "")
+	span.End(err)
 	if err != nil {
-		return nil, maskAny(err)
+		return result, maskAny(err)
+	}
+
+	return result, nil
+}
+
+func (s *service) CreateFromRole(roleName string, config CreateConfig) (CreateResult, error) {
+	if roleName == "" {
+		return CreateResult{}, maskAnyf(invalidConfigError, "token role must not be empty")
+	}
+
+	span := s.Tracer.StartOperation("token create", map[string]string{"certctl.cluster_id": config.ClusterID, "vault.token_role": roleName})
+	result, err := s.create(config, roleName)
+	span.End(err)
+	if err != nil {
+		return result, maskAny(err)
+	}
+
+	return result, nil
+}
+
+// create generates new Vault tokens with respect to the given configuration.
+// In case the given token role name is not empty, tokens are created against
+// this token role. In case creating a token fails, the result holds the tokens
+// created before.
+func (s *service) create(config CreateConfig, roleName string) (CreateResult, error) {
+	if config.MaxTTL != "" {
+		ttl, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return CreateResult{}, maskAnyf(invalidConfigError, "TTL must be a duration: %s", err.Error())
+		}
+		maxTTL, err := time.ParseDuration(config.MaxTTL)
+		if err != nil {
+			return CreateResult{}, maskAnyf(invalidConfigError, "max TTL must be a duration: %s", err.Error())
+		}
+		if maxTTL < ttl {
+			return CreateResult{}, maskAnyf(invalidConfigError, "max TTL must not be shorter than TTL")
+		}
 	}
-	if !created {
-		err := s.CreatePolicy(config.ClusterID)
+	var ttl time.Duration
+	if config.TTLJitter != 0 {
+		var err error
+		ttl, err = time.ParseDuration(config.TTL)
 		if err != nil {
-			return nil, maskAny(err)
+			return CreateResult{}, maskAnyf(invalidConfigError, "TTL must be a duration: %s", err.Error())
 		}
+		if config.TTLJitter < 0 || config.TTLJitter >= ttl {
+			return CreateResult{}, maskAnyf(invalidConfigError, "TTL jitter must not be negative and must be shorter than TTL")
+		}
+	}
+	if config.EntityAlias != "" && roleName == "" {
+		return CreateResult{}, maskAnyf(invalidConfigError, "entity alias requires a token role")
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// In case there does no policy exist that allows to issue certificates on a
+	// PKI backend, create one. The policy is not touched in case its creation
+	// is skipped and the policies are managed by the operator.
+	var result CreateResult
+	policies := config.Policies
+	if config.SkipPolicy {
+		if len(policies) == 0 {
+			return CreateResult{}, maskAnyf(invalidConfigError, "policies must not be empty when skipping policy creation")
+		}
+	} else {
+		created, err := s.IsPolicyCreated(config.ClusterID)
+		if err != nil {
+			return CreateResult{}, maskAny(err)
+		}
+		if !created {
+			err := s.CreatePolicy(config.ClusterID)
+			if err != nil {
+				return CreateResult{}, maskAny(err)
+			}
+		}
+		if len(policies) == 0 {
+			policies = []string{s.PolicyName(config.ClusterID)}
+		}
+		result.PolicyName = s.PolicyName(config.ClusterID)
 	}
 
 	// Get the token auth backend to create new tokens.
 	tokenAuth := s.VaultClient.Auth().Token()
 
 	// Create the requested amount of tokens.
-	var tokens []string
 	for i := 0; i < config.Num; i++ {
 		tokenID := uuid.New()
-		tokens = append(tokens, tokenID)
 		newCreateRequest := &vaultclient.TokenCreateRequest{
 			ID: tokenID,
 			Metadata: map[string]string{
 				"cluster-id": config.ClusterID,
 			},
-			NoParent: true,
-			Policies: []string{s.PolicyName(config.ClusterID)},
-			TTL:      config.TTL,
+			NoParent:       true,
+			Policies:       policies,
+			TTL:            config.TTL,
+			ExplicitMaxTTL: config.MaxTTL,
+		}
+		if config.TTLJitter != 0 {
+			// The TTL is only ever shortened, so jittered tokens stay within
+			// capped and explicit max TTLs.
+			offset := time.Duration(random.Int63n(int64(config.TTLJitter) + 1))
+			newCreateRequest.TTL = (ttl - offset).Truncate(time.Second).String()
+		}
+		var secret *vaultclient.Secret
+		var err error
+		if roleName == "" {
+			secret, err = tokenAuth.Create(newCreateRequest)
+		} else if config.EntityAlias != "" {
+			// The Vault client does not support entity aliases, so the request
+			// is written to the token role directly.
+			newCreateRequest.NoParent = false
+			secret, err = s.createWithEntityAlias(newCreateRequest, roleName, config.EntityAlias)
+		} else {
+			// Whether tokens are orphans is configured by the token role.
+			newCreateRequest.NoParent = false
+			secret, err = tokenAuth.CreateWithRole(newCreateRequest, roleName)
 		}
-		_, err := tokenAuth.Create(newCreateRequest)
 		if err != nil {
-			return nil, maskAny(err)
+			// The tokens created so far exist in Vault, so they are returned
+			// to be used or revoked by the caller.
+			return result, maskAny(err)
 		}
+		createdToken := CreatedToken{
+			Token: tokenID,
+		}
+		if secret != nil && secret.Auth != nil {
+			createdToken.Accessor = secret.Auth.Accessor
+			createdToken.TTL = secret.Auth.LeaseDuration
+		}
+		if secret != nil {
+			result.Warnings = appendNew(result.Warnings, secret.Warnings...)
+		}
+		result.Tokens = append(result.Tokens, createdToken)
+		if config.Progress != nil {
+			config.Progress(i+1, config.Num)
+		}
+	}
+
+	return result, nil
+}
+
+// createWithEntityAlias creates the given token against the given token role,
+// associating it with the entity of the given alias name.
+func (s *service) createWithEntityAlias(req *vaultclient.TokenCreateRequest, roleName, entityAlias string) (*vaultclient.Secret, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	data["entity_alias"] = entityAlias
+
+	secret, err := s.VaultClient.Logical().Write(fmt.Sprintf("auth/token/create/%s", roleName), data)
+	if err != nil {
+		return nil, maskAny(err)
 	}
 
-	return tokens, nil
+	return secret, nil
 }
 
 func (s *service) CreatePolicy(clusterID string) error {
+	// Create HCL policy rules.
+	rules, err := s.PolicyRules(clusterID)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	err = s.WritePolicy(clusterID, rules)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) WritePolicy(clusterID, rules string) error {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
 
-	// Create policy name and HCL policy rules.
-	policyName := s.PolicyName(clusterID)
-	rules, err := execTemplate(pkiIssuePolicyTemplate, pkiIssuePolicyContext{ClusterID: clusterID})
+	// Actually create the policy within Vault.
+	err := sysBackend.PutPolicy(s.PolicyName(clusterID), rules)
 	if err != nil {
 		return maskAny(err)
 	}
 
-	// Actually create the policy within Vault.
-	err = sysBackend.PutPolicy(policyName, rules)
+	return nil
+}
+
+func (s *service) CreateRole(clusterID, maxTTL string) error {
+	// Create a client for the logical backend to manage token roles.
+	logicalBackend := s.VaultClient.Logical()
+
+	data := map[string]interface{}{
+		"allowed_policies":       s.PolicyName(clusterID),
+		"allowed_entity_aliases": s.EntityName(clusterID),
+		"orphan":                 true,
+		"renewable":              true,
+	}
+	if maxTTL != "" {
+		data["explicit_max_ttl"] = maxTTL
+	}
+	_, err := logicalBackend.Write(s.RolePath(clusterID), data)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+func (s *service) DeleteRole(clusterID string) error {
+	// Create a client for the logical backend to manage token roles.
+	logicalBackend := s.VaultClient.Logical()
+
+	_, err := logicalBackend.Delete(s.RolePath(clusterID))
 	if err != nil {
 		return maskAny(err)
 	}
@@ -129,6 +315,18 @@ func (s *service) DeletePolicy(clusterID string) error {
 	return nil
 }
 
+func (s *service) GetPolicy(clusterID string) (string, error) {
+	// Get the system backend for policy operations.
+	sysBackend := s.VaultClient.Sys()
+
+	rules, err := sysBackend.GetPolicy(s.PolicyName(clusterID))
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return rules, nil
+}
+
 func (s *service) IsPolicyCreated(clusterID string) (bool, error) {
 	// Get the system backend for policy operations.
 	sysBackend := s.VaultClient.Sys()
@@ -147,6 +345,107 @@ func (s *service) IsPolicyCreated(clusterID string) (bool, error) {
 	return false, nil
 }
 
+func (s *service) IsRoleCreated(clusterID string) (bool, error) {
+	// Create a client for the logical backend to manage token roles.
+	logicalBackend := s.VaultClient.Logical()
+
+	secret, err := logicalBackend.Read(s.RolePath(clusterID))
+	if err != nil {
+		return false, maskAny(err)
+	}
+
+	return secret != nil, nil
+}
+
+func (s *service) MaxTTL(roleName string) (time.Duration, error) {
+	// Create a client for the logical backend to read the tuning of the token
+	// auth backend and the token role.
+	logicalBackend := s.VaultClient.Logical()
+
+	var maxTTL time.Duration
+	lower := func(d time.Duration) {
+		if d > 0 && (maxTTL == 0 || d < maxTTL) {
+			maxTTL = d
+		}
+	}
+
+	secret, err := logicalBackend.Read("sys/auth/token/tune")
+	if err != nil {
+		return 0, maskAny(err)
+	}
+	if secret != nil {
+		lower(toDuration(secret.Data["max_lease_ttl"]))
+	}
+
+	if roleName != "" {
+		secret, err := logicalBackend.Read(fmt.Sprintf("auth/token/roles/%s", roleName))
+		if err != nil {
+			return 0, maskAny(err)
+		}
+		if secret == nil {
+			return 0, maskAnyf(roleNotFoundError, "token role '%s'", roleName)
+		}
+		lower(toDuration(secret.Data["explicit_max_ttl"]))
+		lower(toDuration(secret.Data["max_ttl"]))
+	}
+
+	return maxTTL, nil
+}
+
+func (s *service) PolicyRules(clusterID string) (string, error) {
+	mountPath := fmt.Sprintf("pki-%s", clusterID)
+	if s.SharedMount != "" {
+		mountPath = s.SharedMount
+	}
+	rules, err := execTemplate(pkiIssuePolicyTemplate, pkiIssuePolicyContext{ClusterID: clusterID, MountPath: mountPath})
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	return rules, nil
+}
+
+func (s *service) Revoke(tokens []string) error {
+	// Get the token auth backend to revoke tokens.
+	tokenAuth := s.VaultClient.Auth().Token()
+
+	for _, t := range tokens {
+		err := tokenAuth.RevokeTree(t)
+		if err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
 func (s *service) PolicyName(clusterID string) string {
 	return fmt.Sprintf("pki-issue-policy-%s", clusterID)
 }
+
+func (s *service) RoleName(clusterID string) string {
+	return fmt.Sprintf("token-role-%s", clusterID)
+}
+
+func (s *service) RolePath(clusterID string) string {
+	return fmt.Sprintf("auth/token/roles/%s", s.RoleName(clusterID))
+}
+
+// appendNew appends the given values to the given list unless they are already
+// part of it.
+func appendNew(list []string, values ...string) []string {
+	for _, v := range values {
+		var found bool
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
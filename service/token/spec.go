@@ -1,5 +1,9 @@
 package token
 
+import (
+	"time"
+)
+
 // CreateConfig is a data structure used to configure the token creation process
 // implemented by Service.Create.
 type CreateConfig struct {
@@ -12,17 +16,122 @@ type CreateConfig struct {
 	// Num represents the number of tokens the generator should create.
 	Num int `json:"num"`
 
+	// Progress is called after each created token with the number of tokens
+	// created so far and the total number of tokens requested. It is optional.
+	Progress func(done, total int) `json:"-"`
+
+	// Policies represents the names of the policies attached to the created
+	// tokens. Defaults to the PKI issue policy of the cluster, in case it is
+	// empty.
+	Policies []string `json:"policies"`
+
+	// SkipPolicy disables the creation of the PKI issue policy of the cluster.
+	// This is useful in case policies are managed outside of certctl. Policies
+	// must then be provided explicitly.
+	SkipPolicy bool `json:"skip_policy"`
+
 	// TTL configures the time to live for the requested token. This is a golang
 	// time string with the allowed units s, m and h.
 	TTL string `json:"ttl"`
+
+	// MaxTTL configures the explicit maximum time to live for the requested
+	// token. The token can be renewed up to this TTL. It must not be shorter
+	// than TTL. This is a golang time string with the allowed units s, m and h.
+	// Empty means the maximum TTL configured in Vault applies.
+	MaxTTL string `json:"max_ttl"`
+
+	// TTLJitter is the window each token's TTL is randomly shortened within,
+	// so the expiries of large token pools spread out instead of causing
+	// renewals of all tokens at once. Tokens never outlive TTL. It must be
+	// shorter than TTL. Zero means all tokens are created with TTL.
+	TTLJitter time.Duration `json:"ttl_jitter"`
+
+	// EntityAlias is the name of the identity entity alias the tokens are
+	// associated with, so all of them roll up to the alias' entity for
+	// policies and auditing. It requires creating the tokens against a token
+	// role allowing the alias, e.g. the token role of the cluster. Empty means
+	// tokens are not associated with an entity.
+	EntityAlias string `json:"entity_alias"`
+}
+
+// CreateResult is the outcome of creating Vault tokens using Service.Create
+// or Service.CreateFromRole.
+type CreateResult struct {
+	// PolicyName is the name of the PKI issue policy of the cluster. It is
+	// empty in case the policy creation is skipped.
+	PolicyName string `json:"policy_name,omitempty"`
+
+	// Tokens are the created tokens in order of creation.
+	Tokens []CreatedToken `json:"tokens"`
+
+	// Warnings are the distinct warnings Vault returned while creating the
+	// tokens, e.g. about TTLs being capped.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// IDs returns the IDs of the created tokens.
+func (r CreateResult) IDs() []string {
+	var ids []string
+	for _, t := range r.Tokens {
+		ids = append(ids, t.Token)
+	}
+
+	return ids
+}
+
+// Convention describes how the existing tokens of a cluster are created. It
+// is returned by Service.ReadConvention.
+type Convention struct {
+	// Source names what the convention is read from, e.g. the existing tokens
+	// or the token role of the cluster.
+	Source string `json:"source"`
+
+	// TTL is the time to live tokens are created with. Zero means it is
+	// unknown.
+	TTL time.Duration `json:"ttl"`
+
+	// MaxTTL is the explicit maximum time to live tokens are created with.
+	// Zero means no explicit maximum TTL applies or it is unknown.
+	MaxTTL time.Duration `json:"max_ttl"`
+
+	// Policies are the policies attached to the tokens, not including Vault's
+	// default policy.
+	Policies []string `json:"policies"`
+
+	// Warnings describe why the existing tokens were not read, e.g. because
+	// the token may not list token accessors. They are set regardless of
+	// whether a convention is discoverable.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CreatedToken represents a single token created by Service.Create or
+// Service.CreateFromRole.
+type CreatedToken struct {
+	// Token is the ID of the token used to authenticate against Vault.
+	Token string `json:"token"`
+
+	// Accessor is the accessor of the token. It can be used to look up or
+	// revoke the token without knowing its ID, e.g. for auditing.
+	Accessor string `json:"accessor"`
+
+	// TTL is the time to live of the token in seconds as reported by Vault.
+	TTL int `json:"ttl"`
 }
 
 // Service creates new Vault policies to restrict access capabilities
 // of e.g. Vault tokens.
 type Service interface {
 	// Create generates new Vault tokens allowed to be used to issue signed
-	// certificates with respect to the given configuration.
-	Create(config CreateConfig) ([]string, error)
+	// certificates with respect to the given configuration. In case creating a
+	// token fails, the returned result holds the tokens created before the
+	// failure alongside the error, so they can be used or revoked.
+	Create(config CreateConfig) (CreateResult, error)
+
+	// CreateFromRole generates new Vault tokens against the given token role
+	// with respect to the given configuration. The token role constrains the
+	// created tokens, e.g. their allowed policies and maximum TTL. Partial
+	// failures are returned the same way Create returns them.
+	CreateFromRole(roleName string, config CreateConfig) (CreateResult, error)
 
 	// CreatePolicy creates a new policy to restrict access to only being able to
 	// issue signed certificates on the Vault PKI backend specific to the given
@@ -32,13 +141,106 @@ type Service interface {
 	// to some Vault token.
 	CreatePolicy(clusterID string) error
 
+	// WritePolicy writes the given rules as the PKI issue policy of the given
+	// cluster ID, e.g. rules customized beyond the ones CreatePolicy writes.
+	WritePolicy(clusterID, rules string) error
+
+	// CreateRole creates or updates the token role of the given cluster ID. The
+	// token role only allows the PKI issue policy of the cluster and the
+	// cluster's entity alias, and creates renewable orphan tokens. In case the
+	// given max TTL is not empty, it is configured as the explicit max TTL of
+	// the created tokens.
+	CreateRole(clusterID, maxTTL string) error
+
+	// CreateEntity creates or updates the identity entity of the given cluster
+	// ID and creates its alias on the token auth backend, unless it exists
+	// already. Tokens created with the alias name as CreateConfig.EntityAlias
+	// are associated with the entity. It returns the ID of the entity.
+	CreateEntity(clusterID string) (string, error)
+
+	// DeleteEntity removes the identity entity of the given cluster ID
+	// including its aliases.
+	DeleteEntity(clusterID string) error
+
+	// DeleteRole removes the token role of the given cluster ID.
+	DeleteRole(clusterID string) error
+
 	// DeletePolicy removes a policy from Vault using its name.
 	DeletePolicy(clusterID string) error
 
+	// GetPolicy returns the rules of the PKI issue policy of the given cluster
+	// ID as stored in Vault. The rules are empty in case the policy does not
+	// exist.
+	GetPolicy(clusterID string) (string, error)
+
 	// IsPolicyCreated checks whether the PKI issue policy already exists.
 	IsPolicyCreated(clusterID string) (bool, error)
 
+	// IsEntityCreated checks whether the identity entity of the given cluster
+	// ID already exists.
+	IsEntityCreated(clusterID string) (bool, error)
+
+	// IsRoleCreated checks whether the token role of the given cluster ID
+	// already exists.
+	IsRoleCreated(clusterID string) (bool, error)
+
+	// MaxTTL returns the effective maximum TTL of tokens created by the token
+	// auth backend. In case the given token role name is not empty, the limits
+	// of the token role are taken into account. Zero means Vault does not
+	// report any limit.
+	MaxTTL(roleName string) (time.Duration, error)
+
+	// PolicyRules returns the rules the PKI issue policy of the given cluster ID
+	// is created with.
+	PolicyRules(clusterID string) (string, error)
+
+	// ListAccessors returns the sorted accessors of all tokens created for the
+	// given cluster ID, which are identified by their cluster-id metadata.
+	// Every token is looked up, so listing is costly in case Vault holds many
+	// tokens.
+	ListAccessors(clusterID string) ([]string, error)
+
+	// ReadConvention reads how the existing tokens of the given cluster ID are
+	// created, so further tokens can be created consistently. The convention is
+	// read from the existing tokens of the cluster in the first place, and from
+	// the token role of the cluster otherwise. Listing token accessors requires
+	// sudo, and every token is looked up, so the token role is used with a
+	// warning in case the accessors may not be listed or Vault holds more than
+	// MaxConventionLookups tokens. The returned bool is false in case no
+	// convention is discoverable, including the token role not being readable.
+	ReadConvention(clusterID string) (Convention, bool, error)
+
+	// Revoke revokes the given Vault tokens.
+	Revoke(tokens []string) error
+
+	// RevokeAccessors revokes the Vault tokens of the given accessors.
+	RevokeAccessors(accessors []string) error
+
 	// PolicyName returns the name of a policy used to restrict access to Vault
 	// for PKI issue requests. This policy is scoped to the given cluster ID.
 	PolicyName(clusterID string) string
+
+	// EntityName returns the name of the identity entity scoped to the given
+	// cluster ID. Its alias on the token auth backend has the same name.
+	EntityName(clusterID string) string
+
+	// EntityPath returns the path under which the identity entity of the given
+	// cluster ID is managed by name. This is very specific to Vault. The path
+	// structure is the following.
+	//
+	//     identity/entity/name/certctl-<clusterID>
+	//
+	EntityPath(clusterID string) string
+
+	// RoleName returns the name of the token role scoped to the given cluster
+	// ID.
+	RoleName(clusterID string) string
+
+	// RolePath returns the path under which the token role of the given cluster
+	// ID is registered. This is very specific to Vault. The path structure is
+	// the following.
+	//
+	//     auth/token/roles/token-role-<clusterID>
+	//
+	RolePath(clusterID string) string
 }
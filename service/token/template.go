@@ -9,15 +9,21 @@ import (
 // the pkiIssuePolicyTemplate.
 type pkiIssuePolicyContext struct {
 	ClusterID string
+	MountPath string
 }
 
 // pkiIssuePolicyTemplate provides a template of Vault policies used to
 // restrict access to only being able to issue signed certificates specific to
-// a Vault PKI backend of a cluster ID.
+// a Vault PKI backend of a cluster ID. Reading the PKI role allows checking
+// requests against it before issuing.
 var pkiIssuePolicyTemplate = `
-	path "pki-{{.ClusterID}}/issue/role-{{.ClusterID}}" {
+	path "{{.MountPath}}/issue/role-{{.ClusterID}}" {
 		policy = "write"
 	}
+
+	path "{{.MountPath}}/roles/role-{{.ClusterID}}" {
+		policy = "read"
+	}
 `
 
 func execTemplate(t string, v interface{}) (string, error) {
@@ -0,0 +1,447 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// exportTimeout is the timeout of a single export request to the
+	// collector.
+	exportTimeout = 5 * time.Second
+
+	// maxPendingSpans is the number of ended spans being buffered before they
+	// are exported, so long running commands export their spans continuously.
+	maxPendingSpans = 64
+)
+
+// Span kinds as defined by OTLP.
+const (
+	kindInternal = 1
+	kindClient   = 3
+)
+
+// Config represents the configuration used to create a new tracer.
+type Config struct {
+	// Dependencies.
+	HTTPClient *http.Client
+	Logger     *log.Logger
+
+	// Settings.
+
+	// Endpoint is the OTLP/HTTP endpoint spans are exported to as JSON, e.g.
+	// http://127.0.0.1:4318/v1/traces. Empty disables tracing, so that all
+	// operations of the tracer are no-ops.
+	Endpoint string
+
+	// Headers are sent with every export request, e.g. to authenticate
+	// against the collector.
+	Headers map[string]string
+
+	// ServiceName is the service.name resource attribute of all spans.
+	ServiceName string
+}
+
+// DefaultConfig provides a default configuration to create a tracer.
+func DefaultConfig() Config {
+	newConfig := Config{
+		// Dependencies.
+		HTTPClient: http.DefaultClient,
+		Logger:     log.New(ioutil.Discard, "", 0),
+
+		// Settings.
+		Endpoint:    "",
+		Headers:     nil,
+		ServiceName: "certctl",
+	}
+
+	return newConfig
+}
+
+// New creates a new configured tracer. A nil tracer is valid and behaves like
+// a tracer having tracing disabled.
+func New(config Config) (*Tracer, error) {
+	newTracer := &Tracer{
+		Config: config,
+	}
+
+	// Dependencies.
+	if newTracer.HTTPClient == nil {
+		return nil, maskAnyf(invalidConfigError, "HTTP client must not be empty")
+	}
+	if newTracer.Logger == nil {
+		return nil, maskAnyf(invalidConfigError, "logger must not be empty")
+	}
+	// Settings.
+	if newTracer.Endpoint != "" {
+		u, err := url.Parse(newTracer.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, maskAnyf(invalidConfigError, "endpoint '%s' must be a http or https URL", newTracer.Endpoint)
+		}
+	}
+	if newTracer.ServiceName == "" {
+		return nil, maskAnyf(invalidConfigError, "service name must not be empty")
+	}
+
+	return newTracer, nil
+}
+
+// Tracer records spans and exports them to an OTLP/HTTP collector. Spans are
+// buffered and exported in batches, at the latest when Flush is called.
+type Tracer struct {
+	Config
+
+	mutex   sync.Mutex
+	active  *Span
+	pending []*Span
+}
+
+// Enabled tells whether spans are recorded.
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.Endpoint != ""
+}
+
+// Start starts a span and makes it the active span, i.e. the parent of spans
+// started afterwards, until it ends. The span is a child of the active span. In
+// case no span is active, a new trace is started.
+func (t *Tracer) Start(name string, attributes map[string]string) *Span {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s := t.newSpan(name, kindInternal, attributes)
+	t.active = s
+
+	return s
+}
+
+// StartChild starts a client span as child of the active span, e.g. for a
+// request sent to Vault. The active span is not changed.
+func (t *Tracer) StartChild(name string, attributes map[string]string) *Span {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.newSpan(name, kindClient, attributes)
+}
+
+// StartOperation starts an internal span as child of the active span, e.g. for
+// an operation of a service creating a PKI backend. The active span is not
+// changed, so operations running concurrently, e.g. certificates issued in
+// parallel, do not become parents of each other.
+func (t *Tracer) StartOperation(name string, attributes map[string]string) *Span {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.newSpan(name, kindInternal, attributes)
+}
+
+// newSpan returns a started span being a child of the active span. The
+// caller must hold the mutex.
+func (t *Tracer) newSpan(name string, kind int, attributes map[string]string) *Span {
+	s := &Span{
+		tracer:     t,
+		parent:     t.active,
+		traceID:    randomHex(16),
+		spanID:     randomHex(8),
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: copyAttributes(attributes),
+	}
+	if s.parent != nil {
+		s.traceID = s.parent.traceID
+		s.parentID = s.parent.spanID
+	}
+
+	return s
+}
+
+// Flush exports all ended spans not exported yet.
+func (t *Tracer) Flush() error {
+	if !t.Enabled() {
+		return nil
+	}
+
+	t.mutex.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mutex.Unlock()
+
+	err := t.export(spans)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// end records the given ended span for export. Spans are exported once
+// enough of them are pending.
+func (t *Tracer) end(s *Span) {
+	t.mutex.Lock()
+	if t.active == s {
+		t.active = s.parent
+	}
+	t.pending = append(t.pending, s)
+	full := len(t.pending) >= maxPendingSpans
+	t.mutex.Unlock()
+
+	if full {
+		err := t.Flush()
+		if err != nil {
+			t.Logger.Printf("Exporting spans failed: %s", err.Error())
+		}
+	}
+}
+
+// export sends the given spans to the configured endpoint using the JSON
+// encoding of OTLP/HTTP.
+func (t *Tracer) export(spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var otlpSpans []otlpSpan
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.otlp())
+	}
+	request := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: otlpAttributes(map[string]string{"service.name": t.ServiceName}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "github.com/giantswarm/certctl"},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(request)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	req, err := http.NewRequest("POST", t.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return maskAny(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := *t.HTTPClient
+	client.Timeout = exportTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return maskAnyf(exportFailedError, "%s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return maskAnyf(exportFailedError, "collector '%s' responded with status %d", t.Endpoint, resp.StatusCode)
+	}
+	t.Logger.Printf("Exported %d span(s) to '%s'", len(spans), t.Endpoint)
+
+	return nil
+}
+
+// Span is a single timed operation within a trace. A nil span is valid and
+// ignores all operations, so callers do not need to check whether tracing is
+// enabled.
+type Span struct {
+	tracer *Tracer
+	parent *Span
+
+	traceID  string
+	spanID   string
+	parentID string
+
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        string
+
+	mutex sync.Mutex
+}
+
+// SetAttribute sets the attribute of the given key. Attributes must never hold
+// secrets, e.g. tokens or request bodies.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attributes[key] = value
+}
+
+// End ends the span. In case the given error is not nil, the span is marked as
+// failed, carrying the error message.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mutex.Unlock()
+
+	s.tracer.end(s)
+}
+
+// TraceParent returns the W3C trace context of the span, used as traceparent
+// header to propagate the trace to other services. It is empty for nil spans.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+	}
+	if s.err != "" {
+		span.Status = &otlpStatus{Code: 2, Message: s.err}
+	}
+
+	return span
+}
+
+// The following types are the subset of the OTLP/HTTP JSON encoding of an
+// ExportTraceServiceRequest used by the tracer.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpAttributes returns the given attributes sorted by key.
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	var list []otlpAttribute
+	for k, v := range attributes {
+		list = append(list, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+
+	return list
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+	c := map[string]string{}
+	for k, v := range attributes {
+		c[k] = v
+	}
+
+	return c
+}
+
+// randomHex returns n random bytes hex encoded, as used for trace and span
+// IDs.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// TracesEndpoint returns the URL spans are exported to for the given OTLP/HTTP
+// base endpoint, e.g. http://127.0.0.1:4318. The path /v1/traces is appended
+// unless the endpoint already ends with it, the same way OTel SDKs treat
+// OTEL_EXPORTER_OTLP_ENDPOINT.
+func TracesEndpoint(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" || strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
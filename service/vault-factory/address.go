@@ -0,0 +1,77 @@
+package vaultfactory
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeAddress validates the given Vault address and returns it in the
+// form used by the Vault client. Addresses must have the scheme http or https,
+// point to a unix domain socket, or name a DNS SRV record Vault is discovered
+// by, e.g. srv+_vault._tcp.example.com. In case inferScheme is true addresses
+// without scheme get one, which is http for loopback hosts and https
+// otherwise. The returned bool tells whether a scheme was inferred.
+func NormalizeAddress(address string, inferScheme bool) (string, bool, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", false, maskAnyf(invalidConfigError, "Vault address must not be empty")
+	}
+	if _, ok := unixSocketPath(address); ok {
+		return address, false, nil
+	}
+	if _, _, ok := srvName(address); ok {
+		err := validateSRVAddress(address)
+		if err != nil {
+			return "", false, maskAny(err)
+		}
+		return address, false, nil
+	}
+
+	// Addresses like 127.0.0.1:8200 cannot be parsed as URL, and localhost:8200
+	// is parsed having the scheme localhost, so the scheme separator is looked
+	// up instead.
+	var inferred bool
+	if !strings.Contains(address, "://") {
+		if !inferScheme {
+			return "", false, maskAnyf(invalidConfigError, "Vault address '%s' must have a scheme, e.g. https://%s", address, address)
+		}
+		scheme := "https"
+		if isLoopbackHost(strings.SplitN(address, "/", 2)[0]) {
+			scheme = "http"
+		}
+		address = scheme + "://" + address
+		inferred = true
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", false, maskAnyf(invalidConfigError, "Vault address '%s' is malformed", address)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false, maskAnyf(invalidConfigError, "Vault address '%s' must have the scheme http or https", address)
+	}
+	if u.Hostname() == "" {
+		return "", false, maskAnyf(invalidConfigError, "Vault address '%s' must have a host", address)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", false, maskAnyf(invalidConfigError, "Vault address '%s' must not have credentials, a query or a fragment", address)
+	}
+
+	return address, inferred, nil
+}
+
+// isLoopbackHost checks whether the given host, optionally having a port,
+// refers to the local machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
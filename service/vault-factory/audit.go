@@ -0,0 +1,187 @@
+package vaultfactory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditRecord is a single line of the audit log, describing one request
+// mutating Vault. Request bodies are never recorded, because they likely hold
+// secrets. Their hash allows correlating a record with the change made.
+type auditRecord struct {
+	Time          string `json:"time"`
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Namespace     string `json:"namespace,omitempty"`
+	RequestSHA256 string `json:"request_sha256"`
+	Status        int    `json:"status,omitempty"`
+	RequestID     string `json:"request_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// auditTransport is a http.RoundTripper appending a JSON line to the
+// configured audit log for every request mutating Vault, i.e. every request
+// other than GET, HEAD and LIST. Requests only reading from Vault are not
+// recorded.
+type auditTransport struct {
+	Path      string
+	Transport http.RoundTripper
+
+	mutex sync.Mutex
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case "GET", "HEAD", "LIST":
+		return t.transport().RoundTrip(req)
+	}
+
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	sum := sha256.Sum256(body)
+
+	record := auditRecord{
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Method:        req.Method,
+		Path:          strings.TrimPrefix(req.URL.Path, "/v1/"),
+		Namespace:     req.Header.Get("X-Vault-Namespace"),
+		RequestSHA256: hex.EncodeToString(sum[:]),
+	}
+
+	resp, err := t.transport().RoundTrip(req)
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Status = resp.StatusCode
+		record.RequestID, err = responseRequestID(resp)
+		if err != nil {
+			resp.Body.Close()
+			return nil, maskAny(err)
+		}
+	}
+
+	auditErr := t.write(record)
+	if auditErr != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, maskAny(auditErr)
+	}
+
+	return resp, err
+}
+
+// write appends the given record to the audit log. The file is opened for
+// every record, so multiple processes can share the log.
+func (t *auditTransport) write(record auditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	f, err := os.OpenFile(t.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "audit log: %s", err.Error())
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return maskAnyf(invalidConfigError, "audit log: %s", err.Error())
+	}
+	err = f.Close()
+	if err != nil {
+		return maskAnyf(invalidConfigError, "audit log: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (t *auditTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
+
+// checkAuditLog makes sure the audit log at the given path can be written,
+// so failures show up before anything is changed in Vault.
+func checkAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "audit log: %s", err.Error())
+	}
+	err = f.Close()
+	if err != nil {
+		return maskAnyf(invalidConfigError, "audit log: %s", err.Error())
+	}
+
+	return nil
+}
+
+// requestBody returns the body of the given request without consuming it.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		defer r.Close()
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+
+		return b, nil
+	}
+
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	return b, nil
+}
+
+// responseRequestID returns the request ID Vault assigned to the request of
+// the given response, if any. The body is restored afterwards.
+func responseRequestID(resp *http.Response) (string, error) {
+	if resp.Body == nil {
+		return "", nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	var body struct {
+		RequestID string `json:"request_id"`
+	}
+	// Not every response carries a JSON body, e.g. 204 No Content.
+	json.Unmarshal(b, &body)
+
+	return body.RequestID, nil
+}
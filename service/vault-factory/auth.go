@@ -0,0 +1,30 @@
+package vaultfactory
+
+import (
+	"net/http"
+)
+
+// authRejectedTransport is a http.RoundTripper calling the configured function
+// whenever Vault rejects the authentication of a request, i.e. responds with
+// status 401 or 403, e.g. because the token expired or was revoked.
+type authRejectedTransport struct {
+	Rejected  func()
+	Transport http.RoundTripper
+}
+
+func (t *authRejectedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport().RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		t.Rejected()
+	}
+
+	return resp, err
+}
+
+func (t *authRejectedTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
@@ -0,0 +1,132 @@
+package vaultfactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces the values of secret fields in dumped request bodies.
+const redacted = "<redacted>"
+
+// dumpTransport is a http.RoundTripper writing the method, path and body of
+// every request sent to Vault, followed by the status of its response, to the
+// configured writer. Headers are never written, since they hold the Vault
+// token. Values of request body fields likely holding secrets, e.g. tokens,
+// private keys and PEM bundles, are redacted. Response bodies are never
+// written, since they hold issued certificates' private keys and tokens.
+type dumpTransport struct {
+	Writer    io.Writer
+	Transport http.RoundTripper
+
+	mutex sync.Mutex
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	line := fmt.Sprintf("--> %s %s", req.Method, req.URL.RequestURI())
+	if ns := req.Header.Get("X-Vault-Namespace"); ns != "" {
+		line += fmt.Sprintf(" (namespace %s)", ns)
+	}
+	if len(body) > 0 {
+		line += " " + redactBody(body)
+	}
+	t.write(line)
+
+	start := time.Now()
+	resp, err := t.transport().RoundTrip(req)
+	took := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.write(fmt.Sprintf("<-- %s %s failed after %s: %s", req.Method, req.URL.Path, took, err.Error()))
+	} else {
+		t.write(fmt.Sprintf("<-- %s %s %s in %s", req.Method, req.URL.Path, resp.Status, took))
+	}
+
+	return resp, err
+}
+
+// write writes the given line, so lines of concurrent requests do not
+// interleave.
+func (t *dumpTransport) write(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	fmt.Fprintln(t.Writer, line)
+}
+
+func (t *dumpTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
+
+// redactBody returns the given JSON request body having the values of secret
+// fields redacted. Bodies not being JSON objects are only described by their
+// size, because they can not be redacted.
+func redactBody(body []byte) string {
+	var data map[string]interface{}
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes not being a JSON object>", len(body))
+	}
+
+	b, err := json.Marshal(redactValue(data))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	return string(b)
+}
+
+// redactValue redacts the values of secret fields of the given decoded JSON
+// value, including nested objects.
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			if isSecretField(k) {
+				m[k] = redacted
+			} else {
+				m[k] = redactValue(v)
+			}
+		}
+		return m
+	case []interface{}:
+		var l []interface{}
+		for _, v := range t {
+			l = append(l, redactValue(v))
+		}
+		return l
+	}
+
+	return v
+}
+
+// isSecretField tells whether a request body field of the given name likely
+// holds a secret. The field id sets the ID of tokens created using
+// auth/token/create, which is the token itself.
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "id", "pem_bundle", "password":
+		return true
+	}
+	for _, suffix := range []string{"token", "private_key", "secret", "secret_id"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
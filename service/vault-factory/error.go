@@ -28,3 +28,12 @@ var invalidConfigError = errgo.New("invalid config")
 func IsInvalidConfig(err error) bool {
 	return errgo.Cause(err) == invalidConfigError
 }
+
+var requestFailedError = errgo.New("request failed")
+
+var noReachableAddressError = errgo.New("no reachable address")
+
+// IsNoReachableAddress asserts noReachableAddressError.
+func IsNoReachableAddress(err error) bool {
+	return errgo.Cause(err) == noReachableAddressError
+}
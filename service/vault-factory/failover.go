@@ -0,0 +1,120 @@
+package vaultfactory
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// failoverTransport is a http.RoundTripper sending requests to another of the
+// configured Vault addresses in case the current one cannot be connected to,
+// e.g. because its Vault node went away mid-run. Only requests failing to
+// connect are sent again, so Vault never received them. Later requests are
+// sent to the address which could be connected to last.
+type failoverTransport struct {
+	// Address is the address the Vault client is created with, which the URLs
+	// of its requests start with.
+	Address string
+	// Addresses are all configured addresses, tried in order after the
+	// current one.
+	Addresses []string
+	Logger    *log.Logger
+	Transport http.RoundTripper
+
+	mutex   sync.Mutex
+	current string
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests not built from the client's address, e.g. following a redirect
+	// to the active node, are sent as they are.
+	base := strings.TrimSuffix(t.Address, "/")
+	rawURL := req.URL.String()
+	if !strings.HasPrefix(rawURL, base+"/") {
+		return t.transport().RoundTrip(req)
+	}
+	rest := strings.TrimPrefix(rawURL, base)
+
+	t.mutex.Lock()
+	if t.current == "" {
+		t.current = t.Address
+	}
+	current := t.current
+	t.mutex.Unlock()
+
+	candidates := []string{current}
+	for _, a := range t.Addresses {
+		if a != current {
+			candidates = append(candidates, a)
+		}
+	}
+
+	var lastErr error
+	for i, a := range candidates {
+		newReq, err := t.request(req, strings.TrimSuffix(a, "/")+rest, i > 0)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+
+		resp, err := t.transport().RoundTrip(newReq)
+		if !isDialError(err) {
+			if a != current {
+				t.Logger.Printf("Vault address '%s' not reachable, failed over to '%s'", current, a)
+				t.mutex.Lock()
+				t.current = a
+				t.mutex.Unlock()
+			}
+			return resp, err
+		}
+		lastErr = err
+
+		// Requests having a body can only be sent again in case the body can be
+		// obtained again.
+		if req.Body != nil && req.GetBody == nil {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// request returns a copy of the given request sent to the given URL. In case
+// resend is set, the body is obtained again.
+func (t *failoverTransport) request(req *http.Request, rawURL string, resend bool) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	newReq := req.Clone(req.Context())
+	newReq.URL = u
+	newReq.Host = u.Host
+	if resend && req.Body != nil {
+		newReq.Body, err = req.GetBody()
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	return newReq, nil
+}
+
+func (t *failoverTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
+
+// isDialError checks whether the given error is caused by failing to connect,
+// in which case the request was never sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,140 @@
+package vaultfactory
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRetries is the number of times a request rejected by Vault with 429
+	// Too Many Requests is retried.
+	maxRetries = 5
+
+	// maxRetryDelay caps the delay between retries of rejected requests.
+	maxRetryDelay = 30 * time.Second
+)
+
+// rateLimitTransport is a http.RoundTripper spacing requests to not exceed the
+// configured rate. Requests rejected by Vault due to its rate limit quotas are
+// retried respecting the Retry-After header. Waiting stops as soon as the
+// context of the request is done, e.g. due to the request timeout.
+type rateLimitTransport struct {
+	// Interval is the minimum time between two requests. Zero disables client
+	// side rate limiting.
+	Interval  time.Duration
+	Logger    *log.Logger
+	Transport http.RoundTripper
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	newReq := req
+	for attempt := 0; ; attempt++ {
+		err := t.wait(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.transport().RoundTrip(newReq)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRetries {
+			return resp, err
+		}
+		// Requests having a body can only be retried in case the body can be
+		// obtained again.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		delay := retryDelay(resp, attempt)
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		t.Logger.Printf("Vault rate limit exceeded for %s %s, retrying in %s", req.Method, req.URL.Path, delay)
+		err = sleep(req.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+
+		newReq = req.Clone(req.Context())
+		if req.Body != nil {
+			newReq.Body, err = req.GetBody()
+			if err != nil {
+				return nil, maskAny(err)
+			}
+		}
+	}
+}
+
+// wait blocks until the next request is allowed to be sent, or until the given
+// context is done.
+func (t *rateLimitTransport) wait(ctx context.Context) error {
+	if t.Interval == 0 {
+		return nil
+	}
+
+	t.mutex.Lock()
+	now := time.Now()
+	var delay time.Duration
+	if t.next.After(now) {
+		delay = t.next.Sub(now)
+		t.next = t.next.Add(t.Interval)
+	} else {
+		t.next = now.Add(t.Interval)
+	}
+	t.mutex.Unlock()
+
+	return sleep(ctx, delay)
+}
+
+// sleep blocks for the given duration. It returns the error of the given
+// context in case it is done before.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *rateLimitTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
+
+// retryDelay returns the time to wait before retrying the request of the given
+// rejected response. The Retry-After header is respected, given in seconds or
+// as HTTP date. Otherwise the delay grows exponentially with the attempt.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	delay := time.Second << uint(attempt)
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(v); err == nil {
+			delay = time.Until(date)
+		}
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,84 @@
+package vaultfactory
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// srvScheme is the prefix of Vault addresses discovered using DNS SRV records,
+// e.g. srv+_vault._tcp.example.com. The scheme of the discovered addresses may
+// be given as well, e.g. srv+http://_vault._tcp.example.com. It defaults to
+// https.
+const srvScheme = "srv+"
+
+// lookupSRV resolves SRV records. The returned records are sorted by priority
+// and randomized by weight within each priority, as described by RFC 2782.
+var lookupSRV = func(name string) ([]*net.SRV, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	return records, err
+}
+
+// srvName returns the scheme and the SRV record name of the given address and
+// whether the address is discovered using DNS SRV records at all.
+func srvName(address string) (string, string, bool) {
+	if !strings.HasPrefix(address, srvScheme) {
+		return "", "", false
+	}
+	name := strings.TrimPrefix(address, srvScheme)
+
+	scheme := "https"
+	if i := strings.Index(name, "://"); i >= 0 {
+		scheme = name[:i]
+		name = name[i+len("://"):]
+	}
+
+	return scheme, name, true
+}
+
+// validateSRVAddress checks that the given SRV address names a TCP service,
+// i.e. is of the form srv+[<scheme>://]_<service>._tcp.<domain>.
+func validateSRVAddress(address string) error {
+	scheme, name, _ := srvName(address)
+	if scheme != "http" && scheme != "https" {
+		return maskAnyf(invalidConfigError, "Vault address '%s' must have the scheme http or https", address)
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) < 3 || len(labels[0]) < 2 || labels[0][0] != '_' || labels[1] != "_tcp" {
+		return maskAnyf(invalidConfigError, "Vault address '%s' must name a SRV record of the form _<service>._tcp.<domain>, e.g. srv+_vault._tcp.example.com", address)
+	}
+	for _, l := range labels[2:] {
+		if l == "" || strings.ContainsAny(l, " \t/:_@?#") {
+			return maskAnyf(invalidConfigError, "Vault address '%s' has an invalid domain", address)
+		}
+	}
+
+	return nil
+}
+
+// resolveSRVAddress returns the Vault addresses the given SRV address resolves
+// to, in the order they should be tried.
+func resolveSRVAddress(address string) ([]string, error) {
+	scheme, name, _ := srvName(address)
+	records, err := lookupSRV(name)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var addresses []string
+	for _, r := range records {
+		// A target of . means the service is decidedly not available.
+		target := strings.TrimSuffix(r.Target, ".")
+		if target == "" {
+			continue
+		}
+		addresses = append(addresses, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(target, strconv.Itoa(int(r.Port)))))
+	}
+	if len(addresses) == 0 {
+		return nil, maskAnyf(noReachableAddressError, "SRV record '%s' names no Vault address", name)
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,85 @@
+package vaultfactory
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenSink reads the Vault token from the sink file a Vault Agent writes in
+// its auto-auth mode. The file is read again whenever its modification time
+// changes, so tokens rotated by the agent are picked up by long-running
+// commands.
+type tokenSink struct {
+	Logger *log.Logger
+	Path   string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+// Token returns the current token of the sink file.
+func (s *tokenSink) Token() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "Vault Agent token sink: %s", err.Error())
+	}
+	if s.token != "" && fi.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	b, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return "", maskAnyf(invalidConfigError, "Vault Agent token sink: %s", err.Error())
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", maskAnyf(invalidConfigError, "Vault Agent token sink '%s' must not be empty", s.Path)
+	}
+
+	if s.token != "" && s.token != token {
+		s.Logger.Printf("Vault Agent rotated the token in sink '%s'", s.Path)
+	}
+	s.modTime = fi.ModTime()
+	s.token = token
+
+	return s.token, nil
+}
+
+// tokenSinkTransport is a http.RoundTripper setting the current token of the
+// Vault Agent token sink on every request before passing it to the wrapped
+// transport.
+type tokenSinkTransport struct {
+	Sink      *tokenSink
+	Transport http.RoundTripper
+}
+
+func (t *tokenSinkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Sink.Token()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	// Requests must not be modified by a RoundTripper, so the token is set on a
+	// copy.
+	newReq := req.Clone(req.Context())
+	newReq.Header.Set("X-Vault-Token", token)
+
+	return t.transport().RoundTrip(newReq)
+}
+
+func (t *tokenSinkTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
@@ -0,0 +1,55 @@
+package vaultfactory
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/certctl/service/tracing"
+)
+
+// tracingTransport is a http.RoundTripper recording a span for every request
+// sent to Vault as child of the tracer's active span. Spans only carry the
+// method, path, namespace and status of requests. Headers and bodies are never
+// recorded, because they hold tokens and other secrets.
+type tracingTransport struct {
+	Tracer    *tracing.Tracer
+	Transport http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	attributes := map[string]string{
+		"http.method": req.Method,
+		"vault.path":  path,
+	}
+	if ns := req.Header.Get("X-Vault-Namespace"); ns != "" {
+		attributes["vault.namespace"] = ns
+	}
+	span := t.Tracer.StartChild("vault "+req.Method+" "+path, attributes)
+
+	// Propagate the trace, so proxies in front of Vault can join it. The
+	// request is cloned, since RoundTrippers must not modify requests.
+	newReq := req.Clone(req.Context())
+	newReq.Header.Set("traceparent", span.TraceParent())
+
+	resp, err := t.transport().RoundTrip(newReq)
+	if err == nil {
+		span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.End(maskAnyf(requestFailedError, "status %d", resp.StatusCode))
+			return resp, nil
+		}
+	}
+	span.End(err)
+
+	return resp, err
+}
+
+func (t *tracingTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
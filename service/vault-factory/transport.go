@@ -0,0 +1,31 @@
+package vaultfactory
+
+import (
+	"net/http"
+)
+
+// headerTransport is a http.RoundTripper setting the configured headers on
+// every request before passing it to the wrapped transport.
+type headerTransport struct {
+	Headers   http.Header
+	Transport http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests must not be modified by a RoundTripper, so the headers are set on
+	// a copy.
+	newReq := req.Clone(req.Context())
+	for k, v := range t.Headers {
+		newReq.Header[k] = v
+	}
+
+	return t.transport().RoundTrip(newReq)
+}
+
+func (t *headerTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return t.Transport
+}
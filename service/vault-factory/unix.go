@@ -0,0 +1,62 @@
+package vaultfactory
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// unixScheme is the prefix of Vault addresses pointing to a unix domain socket,
+// e.g. the listener of a local Vault Agent.
+const unixScheme = "unix://"
+
+// unixAddress is the address used by the Vault client in case Vault is reached
+// via a unix domain socket. Its host is only used for the Host header, because
+// the transport dials the socket regardless of the requested address.
+const unixAddress = "http://localhost"
+
+// unixSocketPath returns the socket path of the given address and whether the
+// address points to a unix domain socket at all.
+func unixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, unixScheme) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(address, unixScheme), true
+}
+
+// checkUnixSocket ensures the given path is a unix domain socket accepting
+// connections.
+func checkUnixSocket(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return maskAnyf(invalidConfigError, "Vault socket: %s", err.Error())
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return maskAnyf(invalidConfigError, "Vault socket '%s' is not a unix domain socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, probeTimeout)
+	if err != nil {
+		return maskAnyf(noReachableAddressError, "Vault socket '%s': %s", path, err.Error())
+	}
+	conn.Close()
+
+	return nil
+}
+
+// dialUnixSocket configures the given transport to dial the given unix domain
+// socket for every connection.
+func dialUnixSocket(transport *http.Transport, path string) {
+	dialer := &net.Dialer{
+		Timeout: probeTimeout,
+	}
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	// Proxies configured via the environment must not be used, because the
+	// requests never leave the host.
+	transport.Proxy = nil
+}
@@ -1,21 +1,109 @@
 package vaultfactory
 
 import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-rootcerts"
 	vaultclient "github.com/hashicorp/vault/api"
 
 	"github.com/giantswarm/certctl/service/spec"
+	"github.com/giantswarm/certctl/service/tracing"
 )
 
+// probeTimeout is the timeout of the health check done to find a reachable
+// Vault address.
+const probeTimeout = 5 * time.Second
+
 // Config represents the configuration used to create a new Vault factory.
 type Config struct {
 	// Dependencies.
 	HTTPClient *http.Client
+	Logger     *log.Logger
+	Tracer     *tracing.Tracer
 
 	// Settings.
+
+	// Address is the address of Vault. It may be a comma separated list of
+	// addresses, e.g. the nodes of a HA Vault deployment. In this case the first
+	// reachable address is used, and requests failing to connect to it later on
+	// are sent to the other addresses in order. An address of the form unix:///path/to/socket
+	// connects to Vault via a unix domain socket, e.g. of a local Vault Agent.
+	// It must be the only configured address. An address of the form
+	// srv+_vault._tcp.example.com is resolved using DNS SRV records, whose
+	// targets are tried in priority and weight order.
 	Address    string
 	AdminToken string
+
+	// InferScheme configures addresses without scheme to get one, which is
+	// http for loopback hosts and https otherwise. By default addresses
+	// without scheme are rejected.
+	InferScheme bool
+
+	// CACert is the path to a PEM encoded CA cert file used to verify the Vault
+	// server's TLS certificate.
+	CACert string
+
+	// ClientCert is the path to a PEM encoded client certificate used for TLS
+	// authentication against Vault. It must be provided together with
+	// ClientKey.
+	ClientCert string
+
+	// ClientKey is the path to the PEM encoded private key of ClientCert.
+	ClientKey string
+
+	// SkipVerify disables the verification of the Vault server's TLS
+	// certificate.
+	SkipVerify bool
+
+	// Namespace is the Vault Enterprise namespace all requests are sent to. It is
+	// sent as X-Vault-Namespace header.
+	Namespace string
+
+	// Headers are sent with every request, e.g. to authenticate against a proxy
+	// in front of Vault. Header values are never logged, because they are
+	// likely sensitive.
+	Headers map[string]string
+
+	// TokenSink is the path of the token sink file of a Vault Agent running in
+	// auto-auth mode. In case the file exists the token is read from it instead
+	// of using AdminToken, and read again whenever the agent rotates it. In case
+	// the file does not exist AdminToken is used.
+	TokenSink string
+
+	// RateLimit is the maximum number of requests per second sent to Vault.
+	// Zero means unlimited. Regardless of RateLimit, requests rejected by Vault
+	// due to its rate limit quotas are retried.
+	RateLimit float64
+
+	// AuditLog is the path of a file every request mutating Vault is recorded
+	// in, one JSON line per request. Request bodies are only recorded as hash.
+	// Empty disables the audit log.
+	AuditLog string
+
+	// RequestTimeout limits the time of every single HTTP request sent to
+	// Vault, including waiting for rate limits and retries of rate limited
+	// requests. Zero means requests never time out.
+	RequestTimeout time.Duration
+
+	// RequestDump is the writer the method, path and redacted body of every
+	// request sent to Vault, and the status of its response, are written to
+	// for debugging. Headers and response bodies are never written. Nil
+	// disables dumping requests.
+	RequestDump io.Writer
+
+	// AuthRejected is called whenever Vault rejects the authentication of a
+	// request sent by created clients, i.e. responds with status 401 or 403.
+	// It must not block. Nil disables the notification.
+	AuthRejected func()
 }
 
 // DefaultConfig provides a default configuration to create a Vault factory.
@@ -23,10 +111,26 @@ func DefaultConfig() Config {
 	newConfig := Config{
 		// Dependencies.
 		HTTPClient: http.DefaultClient,
+		Logger:     log.New(ioutil.Discard, "", 0),
+		Tracer:     nil,
 
 		// Settings.
-		Address:    "http://127.0.0.1:8200",
-		AdminToken: "admin-token",
+		Address:     "http://127.0.0.1:8200",
+		AdminToken:  "admin-token",
+		InferScheme: false,
+		CACert:      "",
+		ClientCert:  "",
+		ClientKey:   "",
+		SkipVerify:  false,
+		Namespace:   "",
+		Headers:     nil,
+		TokenSink:   "",
+		RateLimit:   0,
+		AuditLog:    "",
+
+		RequestTimeout: 0,
+		RequestDump:    nil,
+		AuthRejected:   nil,
 	}
 
 	return newConfig
@@ -42,12 +146,52 @@ func New(config Config) (spec.VaultFactory, error) {
 	if newVaultFactory.Address == "" {
 		return nil, maskAnyf(invalidConfigError, "Vault address must not be empty")
 	}
-	// Settings.
 	if newVaultFactory.HTTPClient == nil {
 		return nil, maskAnyf(invalidConfigError, "HTTP client must not be empty")
 	}
-	if newVaultFactory.AdminToken == "" {
-		return nil, maskAnyf(invalidConfigError, "Vault admin token must not be empty")
+	if newVaultFactory.Logger == nil {
+		return nil, maskAnyf(invalidConfigError, "logger must not be empty")
+	}
+	// Settings.
+	addresses := strings.Split(newVaultFactory.Address, ",")
+	for i, a := range addresses {
+		a, inferred, err := NormalizeAddress(a, newVaultFactory.InferScheme)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		if inferred {
+			newVaultFactory.Logger.Printf("Vault address '%s' has no scheme, using '%s'", strings.TrimSpace(addresses[i]), a)
+		}
+		addresses[i] = a
+		if path, ok := unixSocketPath(a); ok {
+			if path == "" {
+				return nil, maskAnyf(invalidConfigError, "Vault socket path must not be empty")
+			}
+			if len(addresses) > 1 {
+				return nil, maskAnyf(invalidConfigError, "Vault socket address must not be combined with other addresses")
+			}
+			if newVaultFactory.CACert != "" || newVaultFactory.ClientCert != "" || newVaultFactory.SkipVerify {
+				return nil, maskAnyf(invalidConfigError, "TLS settings must not be used with a Vault socket address")
+			}
+		}
+	}
+	newVaultFactory.Address = strings.Join(addresses, ",")
+	if newVaultFactory.AdminToken == "" && newVaultFactory.TokenSink == "" {
+		return nil, maskAnyf(invalidConfigError, "Vault admin token or token sink must not be empty")
+	}
+	if (newVaultFactory.ClientCert == "") != (newVaultFactory.ClientKey == "") {
+		return nil, maskAnyf(invalidConfigError, "Vault client cert and client key must be provided together")
+	}
+	if newVaultFactory.RateLimit < 0 {
+		return nil, maskAnyf(invalidConfigError, "rate limit must not be negative")
+	}
+	if newVaultFactory.RequestTimeout < 0 {
+		return nil, maskAnyf(invalidConfigError, "request timeout must not be negative")
+	}
+	for k := range newVaultFactory.Headers {
+		if k == "" {
+			return nil, maskAnyf(invalidConfigError, "header names must not be empty")
+		}
 	}
 
 	return newVaultFactory, nil
@@ -58,14 +202,294 @@ type vaultFactory struct {
 }
 
 func (vf *vaultFactory) NewClient() (*vaultclient.Client, error) {
+	if vf.AuditLog != "" {
+		err := checkAuditLog(vf.AuditLog)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+	}
+
+	sink, err := vf.newTokenSink()
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	httpClient, err := vf.newHTTPClient(sink)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+
+	var address string
+	if path, ok := unixSocketPath(strings.TrimSpace(vf.Address)); ok {
+		err := checkUnixSocket(path)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		vf.Logger.Printf("Connecting to Vault via unix domain socket '%s'", path)
+
+		address = unixAddress
+	} else {
+		var addresses []string
+		address, addresses, err = vf.selectAddress(httpClient)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		// Vault nodes going away after the address was selected are failed
+		// over from as well.
+		if len(addresses) > 1 {
+			httpClient.Transport = &failoverTransport{
+				Address:   address,
+				Addresses: addresses,
+				Logger:    vf.Logger,
+				Transport: httpClient.Transport,
+			}
+		}
+	}
+
 	newClientConfig := vaultclient.DefaultConfig()
-	newClientConfig.Address = vf.Address
-	newClientConfig.HttpClient = vf.HTTPClient
+	newClientConfig.Address = address
+	newClientConfig.HttpClient = httpClient
 	newVaultClient, err := vaultclient.NewClient(newClientConfig)
 	if err != nil {
 		return nil, maskAny(err)
 	}
-	newVaultClient.SetToken(vf.AdminToken)
+	if sink != nil {
+		token, err := sink.Token()
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		newVaultClient.SetToken(token)
+	} else {
+		newVaultClient.SetToken(vf.AdminToken)
+	}
 
 	return newVaultClient, nil
 }
+
+// newTokenSink returns the Vault Agent token sink used to authenticate against
+// Vault. It returns nil in case no token sink is configured or the configured
+// one does not exist, so that the admin token is used instead.
+func (vf *vaultFactory) newTokenSink() (*tokenSink, error) {
+	if vf.TokenSink == "" {
+		return nil, nil
+	}
+
+	_, err := os.Stat(vf.TokenSink)
+	if os.IsNotExist(err) {
+		if vf.AdminToken == "" {
+			return nil, maskAnyf(invalidConfigError, "Vault Agent token sink '%s' does not exist and no Vault admin token is given", vf.TokenSink)
+		}
+		vf.Logger.Printf("Vault Agent token sink '%s' does not exist, using the admin token", vf.TokenSink)
+
+		return nil, nil
+	} else if err != nil {
+		return nil, maskAnyf(invalidConfigError, "Vault Agent token sink: %s", err.Error())
+	}
+	vf.Logger.Printf("Reading the Vault token from Vault Agent token sink '%s'", vf.TokenSink)
+
+	newTokenSink := &tokenSink{
+		Logger: vf.Logger,
+		Path:   vf.TokenSink,
+	}
+
+	return newTokenSink, nil
+}
+
+// selectAddress returns the Vault address used by the client together with all
+// addresses it may fail over to. In case a single address is configured it is
+// used as it is. Otherwise the addresses are tried in order and the first one
+// responding to a health check is used. Standby nodes are fine, because Vault
+// redirects requests to the active node. SRV addresses are replaced by the
+// addresses they resolve to. In case resolving fails, the remaining addresses
+// are tried.
+func (vf *vaultFactory) selectAddress(httpClient *http.Client) (string, []string, error) {
+	var addresses []string
+	for _, a := range strings.Split(vf.Address, ",") {
+		a = strings.TrimSpace(a)
+		if _, name, ok := srvName(a); ok {
+			resolved, err := resolveSRVAddress(a)
+			if err != nil {
+				vf.Logger.Printf("Vault SRV record '%s' not resolvable: %s", name, err.Error())
+				continue
+			}
+			vf.Logger.Printf("Vault SRV record '%s' resolved to '%s'", name, strings.Join(resolved, ","))
+			addresses = append(addresses, resolved...)
+			continue
+		}
+		addresses = append(addresses, a)
+	}
+	if len(addresses) == 0 {
+		return "", nil, maskAnyf(noReachableAddressError, "no Vault address found using %s", vf.Address)
+	}
+	if len(addresses) == 1 {
+		return addresses[0], addresses, nil
+	}
+
+	probeClient := *httpClient
+	probeClient.Timeout = probeTimeout
+
+	for _, a := range addresses {
+		resp, err := probeClient.Get(strings.TrimSuffix(a, "/") + "/v1/sys/health?standbyok=true")
+		if err != nil {
+			vf.Logger.Printf("Vault address '%s' not reachable: %s", a, err.Error())
+			continue
+		}
+		resp.Body.Close()
+
+		vf.Logger.Printf("Vault address '%s' reachable with status %d, using it", a, resp.StatusCode)
+		return a, addresses, nil
+	}
+
+	return "", nil, maskAnyf(noReachableAddressError, "tried %s", strings.Join(addresses, ","))
+}
+
+// newHTTPClient returns a copy of the configured HTTP client having its
+// transport set up according to the socket, TLS, header, token sink, rate
+// limit, audit log, tracing and rejected authentication settings, and its
+// timeout set to the request timeout. The configured HTTP client is copied so
+// it can be shared, e.g. when using http.DefaultClient.
+func (vf *vaultFactory) newHTTPClient(sink *tokenSink) (*http.Client, error) {
+	httpClient := *vf.HTTPClient
+	if vf.RequestTimeout > 0 {
+		httpClient.Timeout = vf.RequestTimeout
+	}
+
+	if path, ok := unixSocketPath(strings.TrimSpace(vf.Address)); ok {
+		transport, err := cloneTransport(httpClient.Transport)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		dialUnixSocket(transport, path)
+
+		httpClient.Transport = transport
+	}
+
+	if vf.CACert != "" || vf.ClientCert != "" || vf.SkipVerify {
+		transport, err := cloneTransport(httpClient.Transport)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+
+		tlsConfig, err := vf.newTLSConfig(transport.TLSClientConfig)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		transport.TLSClientConfig = tlsConfig
+
+		httpClient.Transport = transport
+	}
+
+	if vf.Namespace != "" || len(vf.Headers) > 0 {
+		headers := http.Header{}
+		var names []string
+		for k, v := range vf.Headers {
+			headers.Set(k, v)
+			names = append(names, http.CanonicalHeaderKey(k))
+		}
+		if vf.Namespace != "" {
+			headers.Set("X-Vault-Namespace", vf.Namespace)
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			vf.Logger.Printf("Sending custom headers %s with every request", strings.Join(names, ", "))
+		}
+
+		httpClient.Transport = &headerTransport{
+			Headers:   headers,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	if sink != nil {
+		httpClient.Transport = &tokenSinkTransport{
+			Sink:      sink,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	if vf.AuthRejected != nil {
+		httpClient.Transport = &authRejectedTransport{
+			Rejected:  vf.AuthRejected,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	// Requests are dumped as they are sent, so every retry of rate limited
+	// requests shows up.
+	if vf.RequestDump != nil {
+		httpClient.Transport = &dumpTransport{
+			Writer:    vf.RequestDump,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	var interval time.Duration
+	if vf.RateLimit > 0 {
+		interval = time.Duration(float64(time.Second) / vf.RateLimit)
+	}
+	httpClient.Transport = &rateLimitTransport{
+		Interval:  interval,
+		Logger:    vf.Logger,
+		Transport: httpClient.Transport,
+	}
+
+	// The audit log records the outcome of requests, so it wraps the retries
+	// of rejected requests.
+	if vf.AuditLog != "" {
+		vf.Logger.Printf("Recording requests mutating Vault in audit log '%s'", vf.AuditLog)
+
+		httpClient.Transport = &auditTransport{
+			Path:      vf.AuditLog,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	// Spans cover the whole request, including rate limiting and retries.
+	if vf.Tracer.Enabled() {
+		httpClient.Transport = &tracingTransport{
+			Tracer:    vf.Tracer,
+			Transport: httpClient.Transport,
+		}
+	}
+
+	return &httpClient, nil
+}
+
+// cloneTransport returns a copy of the given transport, which can be modified
+// without affecting the configured HTTP client.
+func cloneTransport(t http.RoundTripper) (*http.Transport, error) {
+	switch t := t.(type) {
+	case nil:
+		return cleanhttp.DefaultTransport(), nil
+	case *http.Transport:
+		return t.Clone(), nil
+	default:
+		return nil, maskAnyf(invalidConfigError, "HTTP client transport must be a *http.Transport to configure TLS or sockets")
+	}
+}
+
+func (vf *vaultFactory) newTLSConfig(base *tls.Config) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	if base != nil {
+		tlsConfig = base.Clone()
+	} else {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{CAFile: vf.CACert})
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if vf.ClientCert != "" {
+		clientCert, err := tls.LoadX509KeyPair(vf.ClientCert, vf.ClientKey)
+		if err != nil {
+			return nil, maskAny(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	tlsConfig.InsecureSkipVerify = vf.SkipVerify
+
+	return tlsConfig, nil
+}